@@ -31,8 +31,33 @@ type GpuNodeSpec struct {
 	GpuInfos map[string]*jsonstruct.GpuInfo `json:"device_infos,omitempty"`
 	// Models group the gpus by model.
 	Models map[string][]string `json:"device_models,omitempty"`
+	// MigDevices maps the MIG device id to the MIG device, the gpus in MIG mode are not in Models.
+	MigDevices map[string]*jsonstruct.MigDeviceInfo `json:"mig_devices,omitempty"`
+	// MigProfiles group the MIG devices by profile.
+	MigProfiles map[string][]string `json:"mig_profiles,omitempty"`
+	// Topology maps each pair of gpus to their link, such as NV12 or SYS.
+	Topology map[string]map[string]string `json:"device_topology,omitempty"`
+	// DriverVersion is the version of the NVIDIA driver, such as 470.57.02.
+	DriverVersion string `json:"driver_version,omitempty"`
+	// CudaDriverVersion is the CUDA version supported by the driver, such as 11.4.
+	CudaDriverVersion string `json:"cuda_driver_version,omitempty"`
 	// NodeDeviceInUse defines the gpus which are used.
 	NodeDeviceInUse []string `json:"device_busy"`
+	// Allocatable defines the gpus which kubelet considers allocatable.
+	// It is null if kubelet does not serve podresources v1 GetAllocatableResources,
+	// then all the gpus in device_models are considered allocatable.
+	// +optional
+	// +nullable
+	Allocatable []string `json:"device_allocatable"`
+	// UnhealthyDevices maps the device id to the critical error which marks the gpu unhealthy.
+	// The unhealthy gpus are not scheduled.
+	UnhealthyDevices map[string]*jsonstruct.DeviceHealth `json:"device_unhealthy,omitempty"`
+	// DegradedDevices maps the device id to the degradation of the gpu by its memory errors.
+	// The gpus NeedsReset are not scheduled, the ones Degraded are deprioritized or excluded by the scheduler option.
+	DegradedDevices map[string]*jsonstruct.DeviceDegradation `json:"device_degraded,omitempty"`
+	// ForeignOccupied maps the device id to the processes running on the gpu not allocated to them.
+	// The gpus are busy with the scheduler option foreign-process-as-busy.
+	ForeignOccupied map[string]*jsonstruct.DeviceOccupation `json:"device_foreign_occupied,omitempty"`
 	// ReportTime record the time gpuinfo populated by each gpuserver-ds.
 	ReportTime metav1.Time `json:"report_time,omitempty"`
 }
@@ -45,6 +70,13 @@ type GpuNodeStatus struct {
 	Message            string      `json:"message,omitempty"`
 	LastHealthyTime    metav1.Time `json:"last_health_time,omitempty"`
 	LastTransitionTime metav1.Time `json:"last_transition_time,omitempty"`
+	// Telemetry maps the device id to the live state of the gpu, it is published by gpuserver-ds.
+	Telemetry map[string]*jsonstruct.GpuTelemetry `json:"device_telemetry,omitempty"`
+	// Conditions are the typed conditions of the node, each is owned by gpunode-lifecycle-controller or gpuserver-ds.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+genclient
@@ -55,6 +87,12 @@ type GpuNodeStatus struct {
 // +kubebuilder:printcolumn:name="LastHealthyTime",type="string",JSONPath=".status.last_health_time",description="The last healthy time of node."
 // +kubebuilder:printcolumn:name="LastTransitionTime",type="string",JSONPath=".status.last_transition_time",description="The last transition time of node status."
 // +kubebuilder:printcolumn:name="MESSAGE",type="string",JSONPath=".status.message",description="The status message of node."
+// +kubebuilder:printcolumn:name="LEASE",type="string",JSONPath=".status.conditions[?(@.type==\"AgentLeaseFresh\")].status",description="The lease of gpuserver-ds is fresh."
+// +kubebuilder:printcolumn:name="NVML",type="string",JSONPath=".status.conditions[?(@.type==\"NVMLReady\")].status",description="The devices are queried through NVML."
+// +kubebuilder:printcolumn:name="PODRESOURCES",type="string",JSONPath=".status.conditions[?(@.type==\"PodResourcesReady\")].status",description="The podresources of kubelet are listed."
+// +kubebuilder:printcolumn:name="DEVICES",type="string",JSONPath=".status.conditions[?(@.type==\"DevicesHealthy\")].status",description="No gpu is unhealthy."
+// +kubebuilder:printcolumn:name="INVENTORY",type="string",JSONPath=".status.conditions[?(@.type==\"InventoryStable\")].status",description="The devices have not changed recently."
+// +kubebuilder:printcolumn:name="DRAINING",type="string",JSONPath=".status.conditions[?(@.type==\"Draining\")].status",description="gpuserver-ds is shutting down."
 // +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp",description="CreationTimestamp is a timestamp representing the server time when this object was created. Clients may not set this value. It is represented in RFC3339 form and is in UTC."
 
 // GpuNode is the Schema for the gpunodes API
@@ -82,4 +120,31 @@ func init() {
 const (
 	StatusHealth    = "True"
 	StatusNotHealth = "False"
+	// StatusDraining means the lease is not renewed since gpuserver-ds shut down, such as on a rolling upgrade.
+	// It turns StatusNotHealth if gpuserver-ds does not come back in the draining grace period.
+	StatusDraining = "Draining"
 )
+
+// The condition types of GpuNode.
+const (
+	// GpuNodeAgentLeaseFresh means the lease of gpuserver-ds is renewed in the grace period, owned by gpunode-lifecycle-controller.
+	GpuNodeAgentLeaseFresh = "AgentLeaseFresh"
+	// GpuNodeNVMLReady means the devices are queried through NVML, owned by gpuserver-ds.
+	GpuNodeNVMLReady = "NVMLReady"
+	// GpuNodePodResourcesReady means the podresources of kubelet are listed, owned by gpuserver-ds.
+	GpuNodePodResourcesReady = "PodResourcesReady"
+	// GpuNodeDevicesHealthy means no gpu is marked unhealthy, owned by gpuserver-ds.
+	GpuNodeDevicesHealthy = "DevicesHealthy"
+	// GpuNodeInventoryStable means the devices have not changed for a while, owned by gpuserver-ds.
+	GpuNodeInventoryStable = "InventoryStable"
+	// GpuNodeDraining means gpuserver-ds is shutting down and the GpuNode is not updated any more, owned by gpuserver-ds.
+	// The pods are not scheduled to the node until it is False again.
+	GpuNodeDraining = "Draining"
+)
+
+// GpuNodePodResourcesUnavailable is the reason of the condition PodResourcesReady False when kubelet is not serving the podresources,
+// such as kubelet restarting. The lease is not renewed until the podresources are listed again.
+const GpuNodePodResourcesUnavailable = "PodResourcesUnavailable"
+
+// GpuNodeConditionTypes are the condition types of GpuNode which are True on the node fit to schedule.
+var GpuNodeConditionTypes = []string{GpuNodeAgentLeaseFresh, GpuNodeNVMLReady, GpuNodePodResourcesReady, GpuNodeDevicesHealthy, GpuNodeInventoryStable}
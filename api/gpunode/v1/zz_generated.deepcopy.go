@@ -24,6 +24,7 @@ package v1
 
 import (
 	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -100,7 +101,7 @@ func (in *GpuNodeSpec) DeepCopyInto(out *GpuNodeSpec) {
 			} else {
 				in, out := &val, &outVal
 				*out = new(jsonstruct.GpuInfo)
-				**out = **in
+				(*in).DeepCopyInto(*out)
 			}
 			(*out)[key] = outVal
 		}
@@ -120,11 +121,108 @@ func (in *GpuNodeSpec) DeepCopyInto(out *GpuNodeSpec) {
 			(*out)[key] = outVal
 		}
 	}
+	if in.MigDevices != nil {
+		in, out := &in.MigDevices, &out.MigDevices
+		*out = make(map[string]*jsonstruct.MigDeviceInfo, len(*in))
+		for key, val := range *in {
+			var outVal *jsonstruct.MigDeviceInfo
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(jsonstruct.MigDeviceInfo)
+				**out = **in
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.MigProfiles != nil {
+		in, out := &in.MigProfiles, &out.MigProfiles
+		*out = make(map[string][]string, len(*in))
+		for key, val := range *in {
+			var outVal []string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make([]string, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.Topology != nil {
+		in, out := &in.Topology, &out.Topology
+		*out = make(map[string]map[string]string, len(*in))
+		for key, val := range *in {
+			var outVal map[string]string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make(map[string]string, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
 	if in.NodeDeviceInUse != nil {
 		in, out := &in.NodeDeviceInUse, &out.NodeDeviceInUse
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Allocatable != nil {
+		in, out := &in.Allocatable, &out.Allocatable
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnhealthyDevices != nil {
+		in, out := &in.UnhealthyDevices, &out.UnhealthyDevices
+		*out = make(map[string]*jsonstruct.DeviceHealth, len(*in))
+		for key, val := range *in {
+			var outVal *jsonstruct.DeviceHealth
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(jsonstruct.DeviceHealth)
+				(*in).DeepCopyInto(*out)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.DegradedDevices != nil {
+		in, out := &in.DegradedDevices, &out.DegradedDevices
+		*out = make(map[string]*jsonstruct.DeviceDegradation, len(*in))
+		for key, val := range *in {
+			var outVal *jsonstruct.DeviceDegradation
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(jsonstruct.DeviceDegradation)
+				(*in).DeepCopyInto(*out)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.ForeignOccupied != nil {
+		in, out := &in.ForeignOccupied, &out.ForeignOccupied
+		*out = make(map[string]*jsonstruct.DeviceOccupation, len(*in))
+		for key, val := range *in {
+			var outVal *jsonstruct.DeviceOccupation
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(jsonstruct.DeviceOccupation)
+				(*in).DeepCopyInto(*out)
+			}
+			(*out)[key] = outVal
+		}
+	}
 	in.ReportTime.DeepCopyInto(&out.ReportTime)
 }
 
@@ -143,6 +241,28 @@ func (in *GpuNodeStatus) DeepCopyInto(out *GpuNodeStatus) {
 	*out = *in
 	in.LastHealthyTime.DeepCopyInto(&out.LastHealthyTime)
 	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	if in.Telemetry != nil {
+		in, out := &in.Telemetry, &out.Telemetry
+		*out = make(map[string]*jsonstruct.GpuTelemetry, len(*in))
+		for key, val := range *in {
+			var outVal *jsonstruct.GpuTelemetry
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(jsonstruct.GpuTelemetry)
+				(*in).DeepCopyInto(*out)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuNodeStatus.
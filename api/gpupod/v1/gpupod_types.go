@@ -35,11 +35,57 @@ type GpuPodSpec struct {
 type ContainerResourcesDetail struct {
 	Name       string                `json:"container_name,omitempty"`
 	DeviceInfo []*jsonstruct.GpuInfo `json:"device_info,omitempty"`
+	// MigDeviceInfo are the MIG devices allocated by nvidia.com/mig-* resources.
+	MigDeviceInfo []*jsonstruct.MigDeviceInfo `json:"mig_device_info,omitempty"`
 }
 
 // GpuPodStatus defines the observed state of GpuPod
 type GpuPodStatus struct {
 	LastChangedTime string `json:"last_changed_time,omitempty"`
+	// MissingDevices are the gpus allocated to the pod which disappeared from the node, such as fell off the bus.
+	// It is set by gpuserver-ds, and cleared once the gpus are back.
+	MissingDevices []string `json:"missing_devices,omitempty"`
+	// ContainerUtilization is the gpu usage of each container over the last window, set by gpuserver-ds.
+	ContainerUtilization []ContainerUtilization `json:"container_utilization,omitempty"`
+	// Conditions are the typed conditions of the pod, such as AllocationVerified set by gpuserver-ds.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// The condition types of GpuPod.
+const (
+	// GpuPodAllocationVerified means the gpus allocated to the pod are of the model annotated,
+	// and they are the devices visible in its containers, owned by gpuserver-ds.
+	GpuPodAllocationVerified = "AllocationVerified"
+)
+
+// The reasons of the condition AllocationVerified False.
+const (
+	// GpuPodModelMismatch means the gpus allocated are not of the model annotated by the pod.
+	GpuPodModelMismatch = "ModelMismatch"
+	// GpuPodVisibleDevicesMismatch means the devices visible in the containers are not the ones allocated.
+	GpuPodVisibleDevicesMismatch = "VisibleDevicesMismatch"
+)
+
+// ContainerUtilization is the gpu usage of the processes of a container over a rolling window,
+// which are mapped to the container by their cgroup.
+type ContainerUtilization struct {
+	Name string `json:"container_name"`
+	// Devices are the gpus the processes of the container ran on in the window.
+	Devices []string `json:"devices,omitempty"`
+	// Samples is the number of samples in the window.
+	Samples int `json:"samples"`
+	// AvgGpuUtilization and MaxGpuUtilization are the percent of SM utilization by the container,
+	// which is averaged over the gpus it ran on in each sample.
+	AvgGpuUtilization uint32 `json:"avg_gpu_utilization"`
+	MaxGpuUtilization uint32 `json:"max_gpu_utilization"`
+	// PeakMemoryUsed is the max memory used by the container on all the gpus in bytes.
+	PeakMemoryUsed uint64 `json:"peak_memory_used"`
+	// WindowStart and WindowEnd are the time of the first and the last sample in the window.
+	WindowStart metav1.Time `json:"window_start"`
+	WindowEnd   metav1.Time `json:"window_end"`
 }
 
 //+genclient
@@ -49,6 +95,8 @@ type GpuPodStatus struct {
 // +kubebuilder:printcolumn:name="PODNAME",type="string",JSONPath=".spec.pod_name",description="The pod name."
 // +kubebuilder:printcolumn:name="NODE",type="string",JSONPath=".spec.node_name",description="The node name."
 // +kubebuilder:printcolumn:name="UPDATE",type="string",JSONPath=".status.last_changed_time",description="The update time."
+// +kubebuilder:printcolumn:name="MISSING",type="string",JSONPath=".status.missing_devices",description="The gpus allocated which disappeared from the node."
+// +kubebuilder:printcolumn:name="VERIFIED",type="string",JSONPath=".status.conditions[?(@.type==\"AllocationVerified\")].status",description="The gpus allocated are verified."
 
 // GpuPod is the Schema for the gpupods API
 type GpuPod struct {
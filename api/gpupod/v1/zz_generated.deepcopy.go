@@ -24,6 +24,7 @@ package v1
 
 import (
 	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -38,6 +39,17 @@ func (in *ContainerResourcesDetail) DeepCopyInto(out *ContainerResourcesDetail)
 			if (*in)[i] != nil {
 				in, out := &(*in)[i], &(*out)[i]
 				*out = new(jsonstruct.GpuInfo)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.MigDeviceInfo != nil {
+		in, out := &in.MigDeviceInfo, &out.MigDeviceInfo
+		*out = make([]*jsonstruct.MigDeviceInfo, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(jsonstruct.MigDeviceInfo)
 				**out = **in
 			}
 		}
@@ -54,13 +66,35 @@ func (in *ContainerResourcesDetail) DeepCopy() *ContainerResourcesDetail {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerUtilization) DeepCopyInto(out *ContainerUtilization) {
+	*out = *in
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.WindowStart.DeepCopyInto(&out.WindowStart)
+	in.WindowEnd.DeepCopyInto(&out.WindowEnd)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerUtilization.
+func (in *ContainerUtilization) DeepCopy() *ContainerUtilization {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerUtilization)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GpuPod) DeepCopyInto(out *GpuPod) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuPod.
@@ -138,6 +172,25 @@ func (in *GpuPodSpec) DeepCopy() *GpuPodSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GpuPodStatus) DeepCopyInto(out *GpuPodStatus) {
 	*out = *in
+	if in.MissingDevices != nil {
+		in, out := &in.MissingDevices, &out.MissingDevices
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ContainerUtilization != nil {
+		in, out := &in.ContainerUtilization, &out.ContainerUtilization
+		*out = make([]ContainerUtilization, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GpuPodStatus.
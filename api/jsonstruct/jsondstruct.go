@@ -1,9 +1,11 @@
 package jsonstruct
 
 import (
-	"k8s.io/apimachinery/pkg/util/sets"
-	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
 	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
 )
 
 type PodResourceUpdate struct {
@@ -18,11 +20,236 @@ type GpuInfo struct {
 	Model    string `json:"device_model,omitempty"`
 	BusId    string `json:"device_busid,omitempty"`
 	NodeName string `json:"device_node,omitempty"`
+	// NumaNodes are the NUMA nodes the device is attached to, reported by kubelet podresources v1.
+	NumaNodes []int64 `json:"device_numa_nodes,omitempty"`
+	// MigEnabled means the gpu is in MIG mode, it is used by its MIG devices rather than as a whole.
+	MigEnabled bool `json:"device_mig_enabled,omitempty"`
+	// ComputeCapability is the CUDA compute capability, such as 8.0.
+	ComputeCapability string `json:"device_compute_capability,omitempty"`
+	// Architecture is the architecture name, such as Ampere.
+	Architecture string `json:"device_architecture,omitempty"`
+	VbiosVersion string `json:"device_vbios_version,omitempty"`
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *GpuInfo) DeepCopyInto(out *GpuInfo) {
+	*out = *in
+	if in.NumaNodes != nil {
+		in, out := &in.NumaNodes, &out.NumaNodes
+		*out = make([]int64, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy copies the receiver, creating a new GpuInfo.
+func (in *GpuInfo) DeepCopy() *GpuInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(GpuInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// MigDeviceInfo is a MIG device, which is a compute instance of a gpu instance on the gpu in MIG mode.
+type MigDeviceInfo struct {
+	DeviceId string `json:"mig_device_id,omitempty"`
+	// ParentId is the device id of the gpu.
+	ParentId string `json:"mig_parent_id,omitempty"`
+	// Profile is the MIG profile name like the one in the resource name nvidia.com/mig-<profile>, such as 1g.5gb.
+	Profile           string `json:"mig_profile,omitempty"`
+	GpuInstanceId     int    `json:"mig_gpu_instance_id"`
+	ComputeInstanceId int    `json:"mig_compute_instance_id"`
+	MemorySizeMB      uint64 `json:"mig_memory_mb,omitempty"`
+	// Model is the model of the gpu.
+	Model string `json:"mig_model,omitempty"`
+}
+
+// GpuTopology maps the device id to the peer device id to the link between them, like nvidia-smi topo -m.
+// The link is NV<n> with n NVLinks in between, directly or through NVSwitches, otherwise the PCIe path.
+type GpuTopology map[string]map[string]string
+
+const (
+	// TopologyLinkNV is the prefix of the link NV<n>.
+	TopologyLinkNV = "NV"
+	// TopologyLinkPIX is at most a single PCIe bridge.
+	TopologyLinkPIX = "PIX"
+	// TopologyLinkPXB is multiple PCIe bridges without the PCIe host bridge.
+	TopologyLinkPXB = "PXB"
+	// TopologyLinkPHB is a PCIe host bridge.
+	TopologyLinkPHB = "PHB"
+	// TopologyLinkNODE is the interconnect between PCIe host bridges within a NUMA node.
+	TopologyLinkNODE = "NODE"
+	// TopologyLinkSYS is the interconnect between NUMA nodes, such as QPI/UPI.
+	TopologyLinkSYS = "SYS"
+)
+
+// GpuTelemetry is the live state of a gpu sampled by gpuserver-ds.
+type GpuTelemetry struct {
+	// MemoryTotal and MemoryUsed are the frame buffer memory in bytes.
+	MemoryTotal uint64 `json:"memory_total,omitempty"`
+	MemoryUsed  uint64 `json:"memory_used,omitempty"`
+	// GpuUtilization and MemoryUtilization are in percent.
+	GpuUtilization    uint32 `json:"gpu_utilization"`
+	MemoryUtilization uint32 `json:"memory_utilization"`
+	// Temperature is the gpu core temperature in degrees C.
+	Temperature uint32 `json:"temperature,omitempty"`
+	// PowerUsage is in milliwatts.
+	PowerUsage uint32 `json:"power_usage,omitempty"`
+	// GraphicsClock, SMClock and MemoryClock are in MHz.
+	GraphicsClock uint32 `json:"graphics_clock,omitempty"`
+	SMClock       uint32 `json:"sm_clock,omitempty"`
+	MemoryClock   uint32 `json:"memory_clock,omitempty"`
+	// ThrottleReasons are the reasons why the clocks are throttled, such as SwPowerCap.
+	ThrottleReasons []string    `json:"throttle_reasons,omitempty"`
+	SampleTime      metav1.Time `json:"sample_time,omitempty"`
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *GpuTelemetry) DeepCopyInto(out *GpuTelemetry) {
+	*out = *in
+	if in.ThrottleReasons != nil {
+		in, out := &in.ThrottleReasons, &out.ThrottleReasons
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.SampleTime.DeepCopyInto(&out.SampleTime)
+}
+
+// DeepCopy copies the receiver, creating a new GpuTelemetry.
+func (in *GpuTelemetry) DeepCopy() *GpuTelemetry {
+	if in == nil {
+		return nil
+	}
+	out := new(GpuTelemetry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeviceHealth records the critical error which marks a gpu unhealthy.
+type DeviceHealth struct {
+	// EventType is the nvml event type name, such as XidCriticalError or DoubleBitEccError.
+	EventType string `json:"event_type,omitempty"`
+	// Xid is set for XidCriticalError.
+	Xid     uint64      `json:"xid,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Time    metav1.Time `json:"time,omitempty"`
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *DeviceHealth) DeepCopyInto(out *DeviceHealth) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy copies the receiver, creating a new DeviceHealth.
+func (in *DeviceHealth) DeepCopy() *DeviceHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// The states of DeviceDegradation.
+const (
+	// DeviceDegraded means the gpu is still usable but wearing out, it is deprioritized or excluded by the scheduler.
+	DeviceDegraded = "Degraded"
+	// DeviceNeedsReset means the gpu has memory pages retired or rows remapped pending until it is reset, it is not scheduled.
+	DeviceNeedsReset = "NeedsReset"
+)
+
+// The reasons of DeviceDegradation.
+const (
+	DegradationReasonCorrectableEcc      = "CorrectableEccErrors"
+	DegradationReasonUncorrectableEcc    = "UncorrectableEccErrors"
+	DegradationReasonRetiredPages        = "RetiredPages"
+	DegradationReasonRetiredPagesPending = "RetiredPagesPending"
+	DegradationReasonRemappedRows        = "RemappedRows"
+	DegradationReasonRowRemapPending     = "RowRemapPending"
+	DegradationReasonRowRemapFailure     = "RowRemapFailure"
+)
+
+// DeviceDegradation records why a gpu is degraded by the memory errors before it fails, such as retired pages.
+type DeviceDegradation struct {
+	// State is Degraded or NeedsReset.
+	State string `json:"state,omitempty"`
+	// Reasons are the counters over the thresholds of the policy, such as RetiredPages.
+	Reasons []string `json:"reasons,omitempty"`
+	// Since is the time the gpu entered the state.
+	Since metav1.Time `json:"since,omitempty"`
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *DeviceDegradation) DeepCopyInto(out *DeviceDegradation) {
+	*out = *in
+	if in.Reasons != nil {
+		in, out := &in.Reasons, &out.Reasons
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy copies the receiver, creating a new DeviceDegradation.
+func (in *DeviceDegradation) DeepCopy() *DeviceDegradation {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceDegradation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// ForeignProcessMessage is the message of DeviceOccupation.
+const ForeignProcessMessage = "device occupied by foreign process"
+
+// GpuProcess is a process running on the gpu, the pod is empty if it is not in a pod.
+type GpuProcess struct {
+	Pid          uint32 `json:"pid"`
+	Type         string `json:"type,omitempty"`
+	PodNamespace string `json:"pod_namespace,omitempty"`
+	PodName      string `json:"pod_name,omitempty"`
+	ContainerId  string `json:"container_id,omitempty"`
+}
+
+// DeviceOccupation records the processes running on a gpu not allocated to them,
+// such as the processes on the host or in the pods which do not request the gpu.
+type DeviceOccupation struct {
+	Message   string        `json:"message,omitempty"`
+	Processes []*GpuProcess `json:"processes,omitempty"`
+}
+
+// DeepCopyInto copies the receiver, writing into out. in must be non-nil.
+func (in *DeviceOccupation) DeepCopyInto(out *DeviceOccupation) {
+	*out = *in
+	if in.Processes != nil {
+		out.Processes = make([]*GpuProcess, len(in.Processes))
+		for i, p := range in.Processes {
+			if p != nil {
+				pc := *p
+				out.Processes[i] = &pc
+			}
+		}
+	}
+}
+
+// DeepCopy copies the receiver, creating a new DeviceOccupation.
+func (in *DeviceOccupation) DeepCopy() *DeviceOccupation {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceOccupation)
+	in.DeepCopyInto(out)
+	return out
 }
 
 type ContainerResourcesDetail struct {
 	Name       string     `json:"container_name,omitempty"`
 	DeviceInfo []*GpuInfo `json:"device_info,omitempty"`
+	// MigDeviceInfo are the MIG devices allocated by nvidia.com/mig-* resources.
+	MigDeviceInfo []*MigDeviceInfo `json:"mig_device_info,omitempty"`
 }
 
 type PodResourcesDetail struct {
@@ -34,6 +261,16 @@ type NodeGpuInfo struct {
 	NodeName string                 `json:"device_node,omitempty"`
 	GpuInfos map[string]*GpuInfo    `json:"device_infos,omitempty"`
 	Models   map[string]sets.String `json:"device_models,omitempty"`
+	// MigDevices maps the MIG device id to the MIG device.
+	MigDevices map[string]*MigDeviceInfo `json:"mig_devices,omitempty"`
+	// MigProfiles group the MIG devices by profile.
+	MigProfiles map[string]sets.String `json:"mig_profiles,omitempty"`
+	// Topology maps each pair of gpus to their link, see GpuTopology.
+	Topology GpuTopology `json:"device_topology,omitempty"`
+	// DriverVersion is the version of the NVIDIA driver, such as 470.57.02.
+	DriverVersion string `json:"driver_version,omitempty"`
+	// CudaDriverVersion is the CUDA version supported by the driver, such as 11.4.
+	CudaDriverVersion string `json:"cuda_driver_version,omitempty"`
 	// Used in gpuserver to record the time message received by the gpuserver
 	ReportTime time.Time `json:"report_time,omitempty"`
 }
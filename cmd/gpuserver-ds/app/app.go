@@ -23,6 +23,11 @@ import (
 	"os"
 
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/controller"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/cri"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/devicecheckpoint"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/procfs"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/nameflag"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -109,6 +114,37 @@ func setServerFlags(nfs *nameflag.NameFlagSet) error {
 	serverPFlags.StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.metrics-podresource.yaml)")
 	serverPFlags.String("write-config-to", "", "If set, write the configuration values to this file and exit.")
 	serverPFlags.String("localPodResourcesEndpoint", options.DefaultPodResourcesEndpoint, "localPodResourcesEndpoint is the path to the local kubelet endpoint serving the podresources GRPC service.")
+	serverPFlags.String("allocation-source", controller.AllocationSourceAuto, "allocation-source is the source of the devices allocated to the pods, one of podresources, checkpoint, cri or auto. auto uses the podresources if its socket exists, or else the device-checkpoint-file if it exists.")
+	serverPFlags.String("device-checkpoint-file", devicecheckpoint.DefaultCheckpointFile, "device-checkpoint-file is the checkpoint of the kubelet device manager, read by the checkpoint allocation-source for the kubelet with the podresources disabled.")
+	serverPFlags.String("cri-endpoint", cri.DefaultEndpoint, "cri-endpoint is the CRI socket of the container runtime, read by the cri allocation-source for the devices injected into the containers by NVIDIA_VISIBLE_DEVICES or the device nodes.")
+	serverPFlags.Duration("verify-allocation-interval", options.DefaultVerifyAllocationInterval, "verify-allocation-interval is the interval to verify the gpus allocated to the pods against their gpu model annotation and the devices visible in the containers listed from cri-endpoint, 0 disables the verification. The result is the condition AllocationVerified of GpuPod.")
+	serverPFlags.Bool("verify-allocation-evict", false, "verify-allocation-evict evicts the pod with the gpus allocated mismatched, so it is rescheduled.")
+	serverPFlags.Duration("relist-interval", 0, "relist-interval lists the devices allocated to the pods periodically besides on the gpu pod events, 0 disables it. It is 10s for the cri allocation-source if not set.")
+	serverPFlags.StringSlice("gpu-resource-names", []string{options.NVIDIAGPUResourceName}, "gpu-resource-names are the extended resource names of whole gpus tracked, such as nvidia.com/gpu,nvidia.com/gpu.shared.")
+	serverPFlags.String("device-provider", device.ProviderNVML, "device-provider is the way to discover gpu devices, one of nvml or fake.")
+	serverPFlags.String("fake-device-inventory", "", "fake-device-inventory is the yaml or json file of devices used by the fake device-provider, it is read again on each check.")
+	serverPFlags.String("device-health-recovery", options.DeviceHealthRecoveryNever, "device-health-recovery is the policy to clear the unhealthy mark of a gpu after critical error, one of never or timeout.")
+	serverPFlags.Duration("device-health-recovery-timeout", options.DefaultDeviceHealthRecoveryTimeout, "device-health-recovery-timeout is the time since the last critical error to clear the unhealthy mark, used by the timeout device-health-recovery.")
+	serverPFlags.Duration("degradation-check-interval", options.DefaultDegradationCheckInterval, "degradation-check-interval is the interval to check the ECC errors, retired pages and remapped rows of gpus for the degradation, 0 disables the check.")
+	serverPFlags.Uint64("degradation-correctable-ecc-threshold", 0, "degradation-correctable-ecc-threshold degrades the gpu with as many aggregate correctable ECC errors, 0 disables it.")
+	serverPFlags.Uint64("degradation-uncorrectable-ecc-threshold", 0, "degradation-uncorrectable-ecc-threshold degrades the gpu with as many aggregate uncorrectable ECC errors, 0 disables it.")
+	serverPFlags.Int("degradation-retired-pages-threshold", options.DefaultDegradationRetiredPagesThreshold, "degradation-retired-pages-threshold degrades the gpu with as many pages retired, 0 disables it.")
+	serverPFlags.Int("degradation-remapped-rows-threshold", 0, "degradation-remapped-rows-threshold degrades the gpu with as many rows remapped for uncorrectable errors, 0 disables it. The gpu failed to remap rows is always degraded, and the one pending retirement or remapping needs reset.")
+	serverPFlags.Duration("telemetry-sample-interval", options.DefaultTelemetrySampleInterval, "telemetry-sample-interval is the interval to sample the live state of gpus, 0 disables the telemetry.")
+	serverPFlags.Duration("telemetry-publish-interval", options.DefaultTelemetryPublishInterval, "telemetry-publish-interval is the minimum interval to publish the telemetry into GpuNode status.")
+	serverPFlags.Duration("process-check-interval", options.DefaultProcessCheckInterval, "process-check-interval is the interval to check the processes on gpus for the devices occupied by foreign process, 0 disables the check.")
+	serverPFlags.String("proc-root", procfs.DefaultProcRoot, "proc-root is the proc filesystem to map the processes on gpus to pods, gpuserver-ds needs the host pid namespace.")
+	serverPFlags.Duration("utilization-sample-interval", options.DefaultUtilizationSampleInterval, "utilization-sample-interval is the interval to sample the utilization of the processes on gpus for their containers, 0 disables the utilization in GpuPod status.")
+	serverPFlags.Duration("utilization-window", options.DefaultUtilizationWindow, "utilization-window is the rolling window of the samples aggregated into the utilization of containers.")
+	serverPFlags.Duration("utilization-publish-interval", options.DefaultUtilizationPublishInterval, "utilization-publish-interval is the interval to publish the utilization of containers into GpuPod status.")
+	serverPFlags.String("metrics-bind-address", options.DefaultMetricsBindAddress, "metrics-bind-address is the address to serve the gpu metrics in prometheus text format on /metrics, empty disables it.")
+	serverPFlags.String("metrics-textfile", "", "metrics-textfile is the file to write the gpu metrics for the textfile collector of node-exporter, such as /var/lib/node_exporter/textfile/gpuserver.prom, empty disables it.")
+	serverPFlags.Duration("metrics-textfile-interval", options.DefaultMetricsTextfileInterval, "metrics-textfile-interval is the interval to write the metrics-textfile.")
+	serverPFlags.String("checkpoint-file", options.DefaultCheckpointFile, "checkpoint-file is the file on the host to keep the state last published, so a restart publishes only the changes since then, empty disables it.")
+	serverPFlags.String("node-label-prefix", options.DefaultNodeLabelPrefix, "node-label-prefix is the prefix of the labels on the Node derived from the gpus, all the labels with it are owned by gpuserver-ds.")
+	serverPFlags.StringSlice("node-labels", controller.NodeLabelGroups, "node-labels are the groups of labels on the Node, some of count,model,architecture,driver,mig, empty disables the labels.")
+	serverPFlags.Bool("model-resources", false, "model-resources advertises the gpus of each model as the extended resource <model-resource-prefix>/<model> of the Node, such as nvidia-gpu-scheduler/tesla-t4.")
+	serverPFlags.String("model-resource-prefix", options.DefaultModelResourcePrefix, "model-resource-prefix is the prefix of the extended resources of gpu models, all the extended resources with it are owned by gpuserver-ds.")
 	return nfs.AddFlagSet("server-ds", serverPFlags)
 }
 
@@ -4,19 +4,88 @@ import "time"
 
 const (
 	NVIDIAGPUResourceName = "nvidia.com/gpu"
+	// NVIDIAMIGResourcePrefix is the prefix of the MIG resource name nvidia.com/mig-<profile> with the mixed MIG strategy.
+	NVIDIAMIGResourcePrefix = "nvidia.com/mig-"
 
 	// DefaultPodResourcesEndpoint is the path to the local endpoint serving the podresources GRPC service.
 	DefaultPodResourcesEndpoint       = "unix:///var/lib/kubelet/pod-resources/kubelet.sock"
 	DefaultPodResourcesTimeoutConnect = 10 * time.Second
 	DefaultPodResourcesMaxSize        = 1024 * 1024 * 16 // 16 Mb
 	DefaultPodResourcesTimeoutList    = 5 * time.Second
-	PRODUCE_MAX_ERRORCOUNT            = 4
+	// the list is retried with the backoff while kubelet is unavailable, such as restarting.
+	PodResources_RetryBaseDelay = time.Second
+	PodResources_RetryMaxDelay  = 30 * time.Second
+	// DefaultCRIRelistInterval is the relist-interval of the cri allocation-source if it is not set.
+	DefaultCRIRelistInterval = 10 * time.Second
 
-	PodWatcher_WATCH_RECONNECT_INTERVAL = time.Second
+	ServerDSController_Workers        = 2
+	ServerDSController_RetryBaseDelay = 100 * time.Millisecond
+	ServerDSController_RetryMaxDelay  = 2 * time.Minute
+	// ServerDSController_ResyncPeriod checks the GpuNode and GpuPods applied, the ones deleted or changed by others are applied again.
+	ServerDSController_ResyncPeriod = 5 * time.Minute
+
+	PodWatcher_ResyncPeriod    = 5 * time.Minute
+	PodWatcher_EventBufferSize = 100
 
 	HostGpuInfoChecker_CheckInterval = 2 * time.Second
+	// InventoryStablePeriod is the time the devices are not changed for the condition InventoryStable.
+	InventoryStablePeriod = time.Minute
+
+	NodeConditionController_RetryInterval = 5 * time.Second
+	NodeConditionController_DrainTimeout  = 5 * time.Second
+
+	DefaultNodeLabelPrefix            = "nvidia-gpu-scheduler"
+	NodeLabelController_RetryInterval = 5 * time.Second
+	NodeLabelController_ResyncPeriod  = 5 * time.Minute
+
+	DeviceInventoryReconciler_RetryInterval = 5 * time.Second
+
+	DefaultVerifyAllocationInterval = time.Minute
+
+	DefaultModelResourcePrefix           = "nvidia-gpu-scheduler"
+	NodeResourceController_RetryInterval = 5 * time.Second
+	NodeResourceController_ResyncPeriod  = 5 * time.Minute
+
+	DeviceHealthRecoveryNever   = "never"
+	DeviceHealthRecoveryTimeout = "timeout"
+
+	DefaultDeviceHealthRecoveryTimeout = 10 * time.Minute
+	DeviceHealthMonitor_WaitTimeout    = 5 * time.Second
+	DeviceHealthMonitor_RetryInterval  = 5 * time.Second
+
+	DefaultDegradationCheckInterval = time.Minute
+	// DefaultDegradationRetiredPagesThreshold follows the NVIDIA guidance to replace the gpu with 60 pages retired.
+	DefaultDegradationRetiredPagesThreshold = 60
+
+	DefaultTelemetrySampleInterval  = 10 * time.Second
+	DefaultProcessCheckInterval     = 10 * time.Second
+	DefaultTelemetryPublishInterval = 30 * time.Second
+
+	DefaultUtilizationSampleInterval  = 10 * time.Second
+	DefaultUtilizationWindow          = 5 * time.Minute
+	DefaultUtilizationPublishInterval = time.Minute
+
+	DefaultMetricsBindAddress      = ":9445"
+	DefaultMetricsTextfileInterval = 15 * time.Second
+
+	DefaultCheckpointFile    = "/var/lib/nvidia-gpu-scheduler/gpuserver-ds-checkpoint"
+	Checkpoint_WriteInterval = time.Second
 
 	CaFromSecret_CheckInterval = time.Second
 
 	GPUPOD_ANNOTATION_TAG_Node = "nvidia-gpu-scheduler.node"
+
+	// FieldManager is the field manager of the server-side apply by gpuserver-ds.
+	FieldManager = "gpuserver-ds"
+	// ConditionFieldManager is the field manager of the GpuNode conditions owned by gpuserver-ds.
+	// It is not FieldManager, or the apply of the telemetry would remove the conditions.
+	ConditionFieldManager = "gpuserver-ds-conditions"
+	// NodeStatusFieldManager is the field manager of the GpuNode status of the node name.
+	NodeStatusFieldManager = "gpuserver-ds-node"
+	// InventoryFieldManager is the field manager of the GpuPod status of the gpus missing.
+	InventoryFieldManager = "gpuserver-ds-inventory"
+	// UtilizationFieldManager is the field manager of the GpuPod status of the container utilization.
+	UtilizationFieldManager = "gpuserver-ds-utilization"
+	// VerifierFieldManager is the field manager of the GpuPod status of the condition AllocationVerified.
+	VerifierFieldManager = "gpuserver-ds-verifier"
 )
@@ -1,6 +1,43 @@
 package options
 
+import "time"
+
 type MetricsPodResourceDSFlags struct {
-	WriteConfigTo             string `mapstructure:"write-config-to" yaml:"-"`
-	LocalPodResourcesEndpoint string `mapstructure:"localPodResourcesEndpoint" yaml:"localPodResourcesEndpoint,omitempty"`
+	WriteConfigTo               string        `mapstructure:"write-config-to" yaml:"-"`
+	LocalPodResourcesEndpoint   string        `mapstructure:"localPodResourcesEndpoint" yaml:"localPodResourcesEndpoint,omitempty"`
+	GpuResourceNames            []string      `mapstructure:"gpu-resource-names" yaml:"gpu-resource-names"`
+	DeviceProvider              string        `mapstructure:"device-provider" yaml:"device-provider,omitempty"`
+	FakeDeviceInventory         string        `mapstructure:"fake-device-inventory" yaml:"fake-device-inventory,omitempty"`
+	DeviceHealthRecovery        string        `mapstructure:"device-health-recovery" yaml:"device-health-recovery"`
+	DeviceHealthRecoveryTimeout time.Duration `mapstructure:"device-health-recovery-timeout" yaml:"device-health-recovery-timeout"`
+	TelemetrySampleInterval     time.Duration `mapstructure:"telemetry-sample-interval" yaml:"telemetry-sample-interval"`
+	TelemetryPublishInterval    time.Duration `mapstructure:"telemetry-publish-interval" yaml:"telemetry-publish-interval"`
+	ProcessCheckInterval        time.Duration `mapstructure:"process-check-interval" yaml:"process-check-interval"`
+	ProcRoot                    string        `mapstructure:"proc-root" yaml:"proc-root,omitempty"`
+	UtilizationSampleInterval   time.Duration `mapstructure:"utilization-sample-interval" yaml:"utilization-sample-interval"`
+	UtilizationWindow           time.Duration `mapstructure:"utilization-window" yaml:"utilization-window"`
+	UtilizationPublishInterval  time.Duration `mapstructure:"utilization-publish-interval" yaml:"utilization-publish-interval"`
+	MetricsBindAddress          string        `mapstructure:"metrics-bind-address" yaml:"metrics-bind-address"`
+	MetricsTextfile             string        `mapstructure:"metrics-textfile" yaml:"metrics-textfile,omitempty"`
+	MetricsTextfileInterval     time.Duration `mapstructure:"metrics-textfile-interval" yaml:"metrics-textfile-interval"`
+	CheckpointFile              string        `mapstructure:"checkpoint-file" yaml:"checkpoint-file,omitempty"`
+	NodeLabelPrefix             string        `mapstructure:"node-label-prefix" yaml:"node-label-prefix"`
+	NodeLabels                  []string      `mapstructure:"node-labels" yaml:"node-labels"`
+	ModelResources              bool          `mapstructure:"model-resources" yaml:"model-resources"`
+	ModelResourcePrefix         string        `mapstructure:"model-resource-prefix" yaml:"model-resource-prefix"`
+	AllocationSource            string        `mapstructure:"allocation-source" yaml:"allocation-source"`
+	DeviceCheckpointFile        string        `mapstructure:"device-checkpoint-file" yaml:"device-checkpoint-file,omitempty"`
+	CRIEndpoint                 string        `mapstructure:"cri-endpoint" yaml:"cri-endpoint,omitempty"`
+	RelistInterval              time.Duration `mapstructure:"relist-interval" yaml:"relist-interval"`
+
+	// DegradationCheckInterval and the thresholds of the degradation policy, 0 disables the threshold.
+	DegradationCheckInterval             time.Duration `mapstructure:"degradation-check-interval" yaml:"degradation-check-interval"`
+	DegradationCorrectableEccThreshold   uint64        `mapstructure:"degradation-correctable-ecc-threshold" yaml:"degradation-correctable-ecc-threshold"`
+	DegradationUncorrectableEccThreshold uint64        `mapstructure:"degradation-uncorrectable-ecc-threshold" yaml:"degradation-uncorrectable-ecc-threshold"`
+	DegradationRetiredPagesThreshold     int           `mapstructure:"degradation-retired-pages-threshold" yaml:"degradation-retired-pages-threshold"`
+	DegradationRemappedRowsThreshold     int           `mapstructure:"degradation-remapped-rows-threshold" yaml:"degradation-remapped-rows-threshold"`
+
+	// VerifyAllocationInterval is the interval to verify the gpus allocated to the pods, 0 disables it.
+	VerifyAllocationInterval time.Duration `mapstructure:"verify-allocation-interval" yaml:"verify-allocation-interval"`
+	VerifyAllocationEvict    bool          `mapstructure:"verify-allocation-evict" yaml:"verify-allocation-evict"`
 }
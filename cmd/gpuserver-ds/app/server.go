@@ -1,10 +1,19 @@
 package app
 
 import (
+	"os"
+
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/checkpoint"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/controller"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/metrics"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/signal"
+	"k8s.io/klog"
 )
 
 func runserverds(sflags *options.MetricsPodResourceDSFlags) (err error) {
@@ -12,11 +21,14 @@ func runserverds(sflags *options.MetricsPodResourceDSFlags) (err error) {
 		return serverutil.LogOrWriteConfig(sflags.WriteConfigTo, sflags)
 	}
 	serverutil.DumpConfig(sflags)
+	if err := util.SetGpuResourceNames(sflags.GpuResourceNames); err != nil {
+		return err
+	}
 	stopCtx, cancelFunc := signal.SetupSignalHandler()
 	defer cancelFunc()
 	stop := stopCtx.Done()
 
-	gic, err := controller.NewHostGpuInfoChecker(options.HostGpuInfoChecker_CheckInterval, stop)
+	provider, err := device.NewProvider(sflags.DeviceProvider, sflags.FakeDeviceInventory)
 	if err != nil {
 		return err
 	}
@@ -26,6 +38,33 @@ func runserverds(sflags *options.MetricsPodResourceDSFlags) (err error) {
 		return err
 	}
 
+	ncc, err := controller.NewNodeConditionController(gpuClient, stop)
+	if err != nil {
+		return err
+	}
+
+	//start NodeConditionController controller
+	err = ncc.Start()
+	if err != nil {
+		return err
+	}
+	// mark the GpuNode draining before exit, so it is not taken as unhealthy on the rolling upgrade.
+	signal.AddCleanFuncs(func() {
+		if err := ncc.Drain("AgentShutdown", "gpuserver-ds is shutting down"); err != nil {
+			klog.Errorf("drain GpuNode err: %v", err)
+		}
+	})
+
+	gic, err := controller.NewHostGpuInfoChecker(provider, options.HostGpuInfoChecker_CheckInterval, ncc, stop)
+	if err != nil {
+		return err
+	}
+
+	dhm, err := controller.NewDeviceHealthMonitor(provider, sflags.DeviceHealthRecovery, sflags.DeviceHealthRecoveryTimeout, stop)
+	if err != nil {
+		return err
+	}
+
 	pw, err := controller.NewPodWatcher(kubeClient, stop)
 	if err != nil {
 		return err
@@ -37,7 +76,7 @@ func runserverds(sflags *options.MetricsPodResourceDSFlags) (err error) {
 		return err
 	}
 
-	controller.StartLeaseControllerErrExit(stopCtx, kubeClient, gpuClient)
+	controller.StartLeaseControllerErrExit(stopCtx, kubeClient, gpuClient, ncc)
 
 	//start HostGpuInfoChecker controller
 	err = gic.Start()
@@ -45,8 +84,110 @@ func runserverds(sflags *options.MetricsPodResourceDSFlags) (err error) {
 		return err
 	}
 
-	dsc, err := controller.NewServerDSController(stop, pw.GetSyncChan(), pw.GetRemoveChan(),
-		gic.GetGpuInfoChan(), sflags.LocalPodResourcesEndpoint, gpuClient, gpuPodClient)
+	//start DeviceHealthMonitor controller
+	err = dhm.Start()
+	if err != nil {
+		return err
+	}
+
+	ddm := controller.NewDeviceDegradationMonitor(provider, controller.DegradationPolicy{
+		CorrectableEccThreshold:   sflags.DegradationCorrectableEccThreshold,
+		UncorrectableEccThreshold: sflags.DegradationUncorrectableEccThreshold,
+		RetiredPagesThreshold:     sflags.DegradationRetiredPagesThreshold,
+		RemappedRowsThreshold:     sflags.DegradationRemappedRowsThreshold,
+	}, sflags.DegradationCheckInterval, stop)
+
+	//start DeviceDegradationMonitor controller
+	if err = ddm.Start(); err != nil {
+		return err
+	}
+
+	pc := controller.NewProcessChecker(provider, sflags.ProcRoot, pw.GetPodByUID, sflags.ProcessCheckInterval, stop)
+
+	//start ProcessChecker controller
+	err = pc.Start()
+	if err != nil {
+		return err
+	}
+
+	uc, err := controller.NewUtilizationController(provider, gpuPodClient, sflags.ProcRoot, pw.GetPodByUID,
+		sflags.UtilizationSampleInterval, sflags.UtilizationWindow, sflags.UtilizationPublishInterval, stop)
+	if err != nil {
+		return err
+	}
+
+	//start UtilizationController controller
+	if err = uc.Start(); err != nil {
+		return err
+	}
+
+	var nlc *controller.NodeLabelController
+	if len(sflags.NodeLabels) != 0 {
+		if nlc, err = controller.NewNodeLabelController(kubeClient, sflags.NodeLabelPrefix, sflags.NodeLabels, stop); err != nil {
+			return err
+		}
+
+		//start NodeLabelController controller
+		if err = nlc.Start(); err != nil {
+			return err
+		}
+	}
+
+	var nrc *controller.NodeResourceController
+	if sflags.ModelResources {
+		if nrc, err = controller.NewNodeResourceController(kubeClient, sflags.ModelResourcePrefix, stop); err != nil {
+			return err
+		}
+
+		//start NodeResourceController controller
+		if err = nrc.Start(); err != nil {
+			return err
+		}
+	}
+
+	// the Events of pods are recorded by one broadcaster.
+	recorder := serverdsutil.NewEventRecorder(kubeClient, options.FieldManager)
+	dir, err := controller.NewDeviceInventoryReconciler(gpuPodClient, recorder, stop)
+	if err != nil {
+		return err
+	}
+
+	//start DeviceInventoryReconciler controller
+	if err = dir.Start(); err != nil {
+		return err
+	}
+
+	prclient, err := controller.NewAllocationClient(sflags.AllocationSource, sflags.LocalPodResourcesEndpoint, sflags.DeviceCheckpointFile, sflags.CRIEndpoint,
+		pw.GetPodByUID, gic.GetDeviceRefs)
+	if err != nil {
+		return err
+	}
+
+	// the pods with the devices injected by the container runtime are not seen by the pod events.
+	relistInterval := sflags.RelistInterval
+	if sflags.AllocationSource == controller.AllocationSourceCRI && relistInterval == 0 {
+		relistInterval = options.DefaultCRIRelistInterval
+	}
+
+	var visible podresources.Client
+	if sflags.VerifyAllocationInterval > 0 {
+		if visible, err = controller.NewVisibleDevicesClient(sflags.AllocationSource, sflags.CRIEndpoint, gic.GetDeviceRefs); err != nil {
+			return err
+		}
+	}
+	av, err := controller.NewAllocationVerifier(kubeClient, gpuPodClient, recorder, pw.Lister(),
+		visible, sflags.VerifyAllocationInterval, sflags.VerifyAllocationEvict, stop)
+	if err != nil {
+		return err
+	}
+
+	//start AllocationVerifier controller
+	if err = av.Start(); err != nil {
+		return err
+	}
+
+	cm := checkpoint.NewManager(sflags.CheckpointFile, os.Getenv("NODENAME"))
+	dsc, err := controller.NewServerDSController(stop, pw.GetEventChan(), gic.GetGpuInfoChan(), dhm.GetHealthChan(), ddm.GetDegradationChan(), pc.GetProcessChan(), provider, prclient, relistInterval, gpuClient, gpuPodClient, cm, ncc, nlc, nrc, dir, av)
 	if err != nil {
 		return err
 	}
@@ -57,6 +198,31 @@ func runserverds(sflags *options.MetricsPodResourceDSFlags) (err error) {
 		return err
 	}
 
+	//start checkpoint writing
+	cm.Start(options.Checkpoint_WriteInterval, stop)
+
+	tc, err := controller.NewTelemetryController(provider, gpuClient, sflags.TelemetrySampleInterval, sflags.TelemetryPublishInterval, stop)
+	if err != nil {
+		return err
+	}
+
+	//start TelemetryController controller
+	err = tc.Start()
+	if err != nil {
+		return err
+	}
+
+	exporter, err := metrics.NewExporter(metrics.DefaultStore, sflags.MetricsBindAddress, sflags.MetricsTextfile, sflags.MetricsTextfileInterval, stop)
+	if err != nil {
+		return err
+	}
+
+	//start Exporter
+	err = exporter.Start()
+	if err != nil {
+		return err
+	}
+
 	<-stop
 	return nil
 }
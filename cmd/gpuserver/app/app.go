@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 
+	dsoptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/nameflag"
 	"github.com/spf13/cobra"
@@ -121,7 +122,13 @@ func setServerFlags(nfs *nameflag.NameFlagSet) error {
 	serverPFlags.String("tls-config.tls-cert-file", "", " SSL certification file used to secure server communication.")
 	serverPFlags.String("tls-config.tls-private-key-file", "", "SSL key file used to secure server communication.")
 	serverPFlags.Bool("enable-scheduler", true, " Enable the http scheduler extender for gpus in kubernetes")
+	serverPFlags.StringSlice("gpu-resource-names", []string{dsoptions.NVIDIAGPUResourceName}, " The extended resource names of whole gpus requested by pods, such as nvidia.com/gpu,nvidia.com/gpu.shared.")
 	serverPFlags.Int("scheduler.parallelism", 10, "Parallelism defines the amount of parallelism in algorithms for scheduling a Pods. Must be greater than 0")
+	serverPFlags.Bool("scheduler.foreign-process-as-busy", false, "Treat the gpus occupied by foreign process, which runs on the gpu not allocated to it, as busy.")
+	serverPFlags.Bool("scheduler.exclude-degraded-devices", false, "Treat the gpus degraded by memory errors as busy, otherwise the nodes with more gpus not degraded are preferred. The gpus needing reset are never scheduled.")
+	serverPFlags.StringSlice("scheduler.required-conditions", nil, "The condition types of GpuNode which must be True to schedule to the node, such as NVMLReady,DevicesHealthy.")
+	serverPFlags.Bool("model-resource.webhook", false, "Enable the mutating webhook which requests the extended resource <model-resource.prefix>/<model> of the gpu model annotated by the pod, gpuserver-ds must advertise them by --model-resources.")
+	serverPFlags.String("model-resource.prefix", dsoptions.DefaultModelResourcePrefix, "The prefix of the extended resources of gpu models, the same as --model-resource-prefix of gpuserver-ds.")
 
 	return nfs.AddFlagSet("server", serverPFlags)
 }
@@ -13,16 +13,25 @@ const (
 	RESOURCE_GPUPOD  = `gpupod`
 	KIND_GPUPOD      = `GpuPod`
 
-	SCHEDULE                            = `schedule`
-	SCHEDULE_FILTER                     = `filter`
-	SCHEDULE_PREEMPT                    = `preempt`
-	SCHEDULE_PRIORITIZE                 = `prioritize`
-	SCHEDULE_ANNOTATION                 = `nvidia-gpu-scheduler/gpu.model`
-	RESOURCES_GPUNODE                   = `gpunodes`
-	RESOURCE_GPUNODE                    = `gpunode`
-	KIND_GPUNODE                        = `GpuNode`
-	SchedulerRouter_Parallelism_Default = 10
+	SCHEDULE                                   = `schedule`
+	SCHEDULE_FILTER                            = `filter`
+	SCHEDULE_PREEMPT                           = `preempt`
+	SCHEDULE_PRIORITIZE                        = `prioritize`
+	SCHEDULE_ANNOTATION                        = `nvidia-gpu-scheduler/gpu.model`
+	SCHEDULE_ANNOTATION_MIG_PROFILE            = `nvidia-gpu-scheduler/gpu.mig-profile`
+	SCHEDULE_ANNOTATION_MIN_DRIVER_VERSION     = `nvidia-gpu-scheduler/gpu.min-driver-version`
+	SCHEDULE_ANNOTATION_MIN_CUDA_VERSION       = `nvidia-gpu-scheduler/gpu.min-cuda-version`
+	SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY = `nvidia-gpu-scheduler/gpu.min-compute-capability`
+	RESOURCES_GPUNODE                          = `gpunodes`
+	RESOURCE_GPUNODE                           = `gpunode`
+	KIND_GPUNODE                               = `GpuNode`
+	SchedulerRouter_Parallelism_Default        = 10
 
 	//v0.2.0
 	NamespaceNodeLease = "nvidia-gpu-scheduler-node-lease"
+
+	MUTATE      = `mutate`
+	MUTATE_PODS = `pods`
+	// MutatingWebhookName is the webhook of the MutatingWebhookConfiguration to request the extended resources of gpu models.
+	MutatingWebhookName = `model-resource.nvidia-gpu-scheduler.caden2016.github.io`
 )
@@ -1,13 +1,15 @@
 package options
 
 type MetricsPodResourceFlags struct {
-	BindAddress     string          `mapstructure:"bind-address" yaml:"bind-address,omitempty"`
-	BindPort        int             `mapstructure:"secure-port" yaml:"secure-port,omitempty"`
-	TLSAuto         bool            `mapstructure:"tls-auto" yaml:"tls-autos"`
-	TLSConfig       TLSCONFIG       `mapstructure:"tls-config" yaml:"tls-config,omitempty"`
-	WriteConfigTo   string          `mapstructure:"write-config-to" yaml:"-"`
-	EnableScheduler bool            `mapstructure:"enable-scheduler" yaml:"enable-scheduler"`
-	Scheduler       SchedulerConfig `mapstructure:"scheduler" yaml:"scheduler"`
+	BindAddress      string              `mapstructure:"bind-address" yaml:"bind-address,omitempty"`
+	BindPort         int                 `mapstructure:"secure-port" yaml:"secure-port,omitempty"`
+	TLSAuto          bool                `mapstructure:"tls-auto" yaml:"tls-autos"`
+	TLSConfig        TLSCONFIG           `mapstructure:"tls-config" yaml:"tls-config,omitempty"`
+	WriteConfigTo    string              `mapstructure:"write-config-to" yaml:"-"`
+	EnableScheduler  bool                `mapstructure:"enable-scheduler" yaml:"enable-scheduler"`
+	GpuResourceNames []string            `mapstructure:"gpu-resource-names" yaml:"gpu-resource-names"`
+	Scheduler        SchedulerConfig     `mapstructure:"scheduler" yaml:"scheduler"`
+	ModelResource    ModelResourceConfig `mapstructure:"model-resource" yaml:"model-resource"`
 }
 
 type TLSCONFIG struct {
@@ -16,6 +18,19 @@ type TLSCONFIG struct {
 	Key    string `mapstructure:"tls-private-key-file" yaml:"tls-private-key-file,omitempty"`
 }
 
+type ModelResourceConfig struct {
+	// Webhook enables the mutating webhook which requests the extended resource of the gpu model annotated by the pod.
+	Webhook bool `mapstructure:"webhook" yaml:"webhook"`
+	// Prefix is the prefix of the extended resources of gpu models advertised by gpuserver-ds.
+	Prefix string `mapstructure:"prefix" yaml:"prefix"`
+}
+
 type SchedulerConfig struct {
 	Parallelism int `mapstructure:"parallelism" yaml:"parallelism"`
+	// ForeignProcessAsBusy makes the gpus occupied by foreign process busy.
+	ForeignProcessAsBusy bool `mapstructure:"foreign-process-as-busy" yaml:"foreign-process-as-busy"`
+	// ExcludeDegradedDevices makes the degraded gpus busy, otherwise they are deprioritized.
+	ExcludeDegradedDevices bool `mapstructure:"exclude-degraded-devices" yaml:"exclude-degraded-devices"`
+	// RequiredConditions are the condition types of GpuNode which must be True to schedule to the node.
+	RequiredConditions []string `mapstructure:"required-conditions" yaml:"required-conditions,omitempty"`
 }
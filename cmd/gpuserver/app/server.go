@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/signal"
@@ -13,13 +14,18 @@ import (
 
 	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
 
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
 	certsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/certs/util"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/controller"
 	routerinit "github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/router/init"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
 	"github.com/gorilla/mux"
 	"github.com/openkruise/kruise/pkg/webhook/util/generator"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 	"k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
@@ -30,6 +36,12 @@ func runserver(sflags *options.MetricsPodResourceFlags) (err error) {
 		return serverutil.LogOrWriteConfig(sflags.WriteConfigTo, sflags)
 	}
 	serverutil.DumpConfig(sflags)
+	if err = util.SetGpuResourceNames(sflags.GpuResourceNames); err != nil {
+		return err
+	}
+	if unknown := sets.NewString(sflags.Scheduler.RequiredConditions...).Difference(sets.NewString(gpunodev1.GpuNodeConditionTypes...)); unknown.Len() != 0 {
+		return fmt.Errorf("unknown required conditions: %v", unknown.List())
+	}
 	stopCtx, cancelFunc := signal.SetupSignalHandler()
 	defer cancelFunc()
 	stop := stopCtx.Done()
@@ -62,6 +74,17 @@ func runserver(sflags *options.MetricsPodResourceFlags) (err error) {
 	if err != nil {
 		return err
 	}
+	if sflags.ModelResource.Webhook {
+		if errs := validation.IsDNS1123Subdomain(sflags.ModelResource.Prefix); len(errs) != 0 {
+			return fmt.Errorf("invalid model-resource.prefix %q: %s", sflags.ModelResource.Prefix, strings.Join(errs, ","))
+		}
+		if kubeClient == nil {
+			return fmt.Errorf("model-resource.webhook needs tls-auto to set the caBundle of the webhook")
+		}
+		if err = serverutil.EnsureMutatingWebhookConfiguration(kubeClient, certs.CACert); err != nil {
+			return err
+		}
+	}
 
 	//get tls.Config from certs
 	tlscfg, err := serverutil.GetTlsConfig(certs)
@@ -83,13 +106,15 @@ func runserver(sflags *options.MetricsPodResourceFlags) (err error) {
 	gpuMgrClient := controller.StartGpuManagerAndLifecycleControllerErrExit(stopCtx, kubeconf, kubeClient, gpuClient)
 
 	// create and start Main channel controller.
-	serverController, err := controller.NewServerController(stop, sflags.Scheduler.Parallelism, gpuMgrClient)
+	pluginArgs := &framework.PluginArgs{ForeignProcessAsBusy: sflags.Scheduler.ForeignProcessAsBusy, ExcludeDegradedDevices: sflags.Scheduler.ExcludeDegradedDevices,
+		RequiredConditions: sflags.Scheduler.RequiredConditions}
+	serverController, err := controller.NewServerController(stop, sflags.Scheduler.Parallelism, pluginArgs, gpuMgrClient)
 	if err != nil {
 		return err
 	}
 
 	// register all routes supports by the server
-	routerinit.RegisterRoutes(servermux, serverController, sflags.EnableScheduler)
+	routerinit.RegisterRoutes(servermux, serverController, sflags.EnableScheduler, &sflags.ModelResource)
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
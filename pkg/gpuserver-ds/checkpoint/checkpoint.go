@@ -0,0 +1,221 @@
+// Package checkpoint persists the state last published by gpuserver-ds on the host,
+// so that gpuserver-ds restarts by diffing against it rather than publishing everything again.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// Version is the version of the checkpoint format, the checkpoint of another version is ignored.
+const Version = 1
+
+var (
+	// ErrCorrupt means the checksum of the checkpoint does not match its data.
+	ErrCorrupt = errors.New("checkpoint is corrupt")
+	// ErrVersionMismatch means the checkpoint is written by another version of gpuserver-ds.
+	ErrVersionMismatch = errors.New("checkpoint version mismatch")
+)
+
+// GpuNode is the GpuNode last applied.
+type GpuNode struct {
+	// NodeGpuInfo is the device inventory applied.
+	NodeGpuInfo *NodeGpuInfo `json:"node_gpu_info,omitempty"`
+	// Patch is the apply patch without the report time.
+	Patch json.RawMessage `json:"patch"`
+	// UID and Generation identify the spec applied, the status written by other field managers does not change them.
+	UID        types.UID `json:"uid,omitempty"`
+	Generation int64     `json:"generation,omitempty"`
+}
+
+// GpuPod is the GpuPod last applied.
+type GpuPod struct {
+	// PodResources are the devices of the pod applied.
+	PodResources *podresourcesapi.PodResources `json:"pod_resources"`
+	Patch        json.RawMessage               `json:"patch"`
+	UID          types.UID                     `json:"uid,omitempty"`
+	Generation   int64                         `json:"generation,omitempty"`
+}
+
+// Data is the state last published by gpuserver-ds.
+type Data struct {
+	NodeName string   `json:"node_name"`
+	GpuNode  *GpuNode `json:"gpu_node,omitempty"`
+	// GpuPods maps the GpuPod name to the GpuPod applied.
+	GpuPods map[string]*GpuPod `json:"gpu_pods,omitempty"`
+}
+
+// checkpoint is the content of the checkpoint file, Checksum is the crc32 of Data.
+type checkpoint struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func NewManager(path, nodeName string) *Manager {
+	return &Manager{
+		path: path,
+		data: &Data{NodeName: nodeName, GpuPods: make(map[string]*GpuPod)},
+	}
+}
+
+// Manager keeps the state last published and writes it to the checkpoint file once it is changed.
+// It does nothing with an empty path.
+type Manager struct {
+	path  string
+	lock  sync.Mutex
+	data  *Data
+	dirty bool
+}
+
+// Load reads the checkpoint file, nil is returned if it does not exist.
+// The checkpoint which is corrupt, of another version or of another node is ignored with error.
+func (m *Manager) Load() (*Data, error) {
+	if m.path == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{}
+	if err := json.Unmarshal(content, cp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if cp.Version != Version {
+		return nil, fmt.Errorf("%w: version %d, want %d", ErrVersionMismatch, cp.Version, Version)
+	}
+	if crc32.ChecksumIEEE(cp.Data) != cp.Checksum {
+		return nil, ErrCorrupt
+	}
+	data := &Data{}
+	if err := json.Unmarshal(cp.Data, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if data.NodeName != m.data.NodeName {
+		return nil, fmt.Errorf("checkpoint of node %s, want %s", data.NodeName, m.data.NodeName)
+	}
+	if data.GpuPods == nil {
+		data.GpuPods = make(map[string]*GpuPod)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data = data
+	return data, nil
+}
+
+// SetGpuNode records the GpuNode applied.
+func (m *Manager) SetGpuNode(gpuNode *GpuNode) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data.GpuNode = gpuNode
+	m.dirty = true
+}
+
+// SetGpuPod records the GpuPod applied, nil means it is deleted.
+func (m *Manager) SetGpuPod(name string, gpuPod *GpuPod) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if gpuPod == nil {
+		delete(m.data.GpuPods, name)
+	} else {
+		m.data.GpuPods[name] = gpuPod
+	}
+	m.dirty = true
+}
+
+// Start writes the checkpoint each interval if it is changed, and once more when stopped.
+func (m *Manager) Start(interval time.Duration, stop <-chan struct{}) {
+	if m.path == "" {
+		klog.Infof("Checkpoint disabled")
+		return
+	}
+	go func() {
+		klog.Infof("Checkpoint writing to %s", m.path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Flush(); err != nil {
+					klog.Errorf("Checkpoint write %s err: %v", m.path, err)
+				}
+			case <-stop:
+				break LOOP
+			}
+		}
+		if err := m.Flush(); err != nil {
+			klog.Errorf("Checkpoint write %s err: %v", m.path, err)
+		}
+	}()
+}
+
+// Flush writes the checkpoint if it is changed.
+func (m *Manager) Flush() error {
+	m.lock.Lock()
+	if !m.dirty || m.path == "" {
+		m.lock.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(m.data)
+	m.dirty = false
+	m.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(&checkpoint{Version: Version, Checksum: crc32.ChecksumIEEE(data), Data: data})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.path, content); err != nil {
+		m.lock.Lock()
+		m.dirty = true
+		m.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic writes a temporary file in the same directory and renames it to path,
+// so the checkpoint is either the old or the new one if gpuserver-ds or the host crashes.
+func writeFileAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
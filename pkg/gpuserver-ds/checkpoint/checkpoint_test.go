@@ -0,0 +1,96 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+func TestManagerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "checkpoint")
+	m := NewManager(path, "node1")
+	if data, err := m.Load(); err != nil || data != nil {
+		t.Fatalf("Load() without file = %v, %v, want nil", data, err)
+	}
+
+	m.SetGpuNode(&GpuNode{NodeGpuInfo: &NodeGpuInfo{NodeName: "node1"}, Patch: json.RawMessage(`{"spec":{}}`), UID: "uid-node", Generation: 10})
+	m.SetGpuPod("default-pod1", &GpuPod{PodResources: &podresourcesapi.PodResources{Namespace: "default", Name: "pod1"}, Patch: json.RawMessage(`{}`), UID: "uid-pod", Generation: 11})
+	m.SetGpuPod("default-pod2", &GpuPod{PodResources: &podresourcesapi.PodResources{Namespace: "default", Name: "pod2"}, Patch: json.RawMessage(`{}`)})
+	m.SetGpuPod("default-pod2", nil)
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := NewManager(path, "node1").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.GpuNode == nil || data.GpuNode.Generation != 10 || data.GpuNode.NodeGpuInfo.NodeName != "node1" {
+		t.Errorf("GpuNode = %#v", data.GpuNode)
+	}
+	if len(data.GpuPods) != 1 || data.GpuPods["default-pod1"].Generation != 11 || data.GpuPods["default-pod1"].PodResources.Name != "pod1" {
+		t.Errorf("GpuPods = %#v", data.GpuPods)
+	}
+}
+
+func TestManagerLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid")
+	m := NewManager(valid, "node1")
+	m.SetGpuPod("default-pod1", &GpuPod{Patch: json.RawMessage(`{}`)})
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := &checkpoint{}
+	if err := json.Unmarshal(content, cp); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name string, cp *checkpoint) string {
+		content, err := json.Marshal(cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	truncated := filepath.Join(dir, "truncated")
+	if err := ioutil.WriteFile(truncated, content[:len(content)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		nodeName string
+		wantErr  error
+	}{
+		{name: "truncated", path: truncated, nodeName: "node1", wantErr: ErrCorrupt},
+		{name: "checksum mismatch", path: write("checksum", &checkpoint{Version: Version, Checksum: cp.Checksum + 1, Data: cp.Data}), nodeName: "node1", wantErr: ErrCorrupt},
+		{name: "version mismatch", path: write("version", &checkpoint{Version: Version + 1, Checksum: cp.Checksum, Data: cp.Data}), nodeName: "node1", wantErr: ErrVersionMismatch},
+		{name: "another node", path: valid, nodeName: "node2"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := NewManager(tc.path, tc.nodeName).Load()
+			if err == nil || data != nil {
+				t.Fatalf("Load() = %v, %v, want error", data, err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("Load() err = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/cri"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/devicecheckpoint"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+)
+
+const (
+	// AllocationSourceAuto uses the podresources if the socket exists, or else the device checkpoint if it exists.
+	AllocationSourceAuto = "auto"
+	// AllocationSourcePodResources lists the devices allocated to the pods from the kubelet podresources api.
+	AllocationSourcePodResources = "podresources"
+	// AllocationSourceCheckpoint reads the devices allocated to the pods from the kubelet device manager checkpoint.
+	AllocationSourceCheckpoint = "checkpoint"
+	// AllocationSourceCRI lists the devices of the containers from the container runtime, it is never detected by auto.
+	AllocationSourceCRI = "cri"
+)
+
+// NewAllocationClient returns the client of the source of the devices allocated to the pods.
+// The auto source falls back to the device checkpoint on the kubelet with the podresources socket disabled or missing,
+// it is the podresources if neither exists, which is dialed again until kubelet is serving.
+// The devices in the containers of the cri source are resolved by deviceRefs, see HostGpuInfoChecker.GetDeviceRefs.
+func NewAllocationClient(source, podresourcesep, checkpointFile, criEndpoint string, getPod func(uid types.UID) (*corev1.Pod, error), deviceRefs func() map[string]string) (podresources.Client, error) {
+	if source == AllocationSourceAuto {
+		source = detectAllocationSource(podresourcesep, checkpointFile)
+		klog.Infof("allocation source detected: %s", source)
+	}
+
+	switch source {
+	case AllocationSourcePodResources:
+		return podresources.NewReconnectingClient(podresourcesep, options.DefaultPodResourcesTimeoutConnect, options.DefaultPodResourcesMaxSize), nil
+	case AllocationSourceCheckpoint:
+		return devicecheckpoint.NewClient(checkpointFile, getPod), nil
+	case AllocationSourceCRI:
+		return cri.NewClient(criEndpoint, options.DefaultPodResourcesTimeoutConnect, options.DefaultPodResourcesMaxSize, deviceRefs)
+	default:
+		return nil, fmt.Errorf("unknown allocation source: %s", source)
+	}
+}
+
+// NewVisibleDevicesClient returns the client of the devices visible in the containers for AllocationVerifier,
+// which lists them from the container runtime. It is nil if they are the devices allocated already by the cri source,
+// or the socket of the runtime is not mounted, so only the models are verified.
+func NewVisibleDevicesClient(source, criEndpoint string, deviceRefs func() map[string]string) (podresources.Client, error) {
+	if source == AllocationSourceCRI {
+		return nil, nil
+	}
+	socket, _, err := util.GetAddressAndDialer(criEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(socket); err != nil {
+		klog.Warningf("the CRI socket %s is not found, the devices visible in the containers are not verified: %v", socket, err)
+		return nil, nil
+	}
+	return cri.NewClient(criEndpoint, options.DefaultPodResourcesTimeoutConnect, options.DefaultPodResourcesMaxSize, deviceRefs)
+}
+
+func detectAllocationSource(podresourcesep, checkpointFile string) string {
+	if socket, _, err := util.GetAddressAndDialer(podresourcesep); err == nil {
+		if _, err := os.Stat(socket); err == nil {
+			return AllocationSourcePodResources
+		}
+	}
+	if _, err := os.Stat(checkpointFile); err == nil {
+		return AllocationSourceCheckpoint
+	}
+	return AllocationSourcePodResources
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/cri"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/devicecheckpoint"
+)
+
+func TestNewAllocationClient(t *testing.T) {
+	var tests = []struct {
+		name        string
+		source      string
+		socket      bool
+		checkpoint  bool
+		wantVersion string
+		wantError   bool
+	}{
+		{name: "auto with socket", source: AllocationSourceAuto, socket: true, checkpoint: true, wantVersion: ""},
+		{name: "auto without socket", source: AllocationSourceAuto, checkpoint: true, wantVersion: devicecheckpoint.Version},
+		{name: "auto without both", source: AllocationSourceAuto, wantVersion: ""},
+		{name: "checkpoint", source: AllocationSourceCheckpoint, socket: true, wantVersion: devicecheckpoint.Version},
+		{name: "podresources", source: AllocationSourcePodResources, checkpoint: true, wantVersion: ""},
+		{name: "cri", source: AllocationSourceCRI, socket: true, checkpoint: true, wantVersion: cri.Version},
+		{name: "unknown", source: "docker", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			socket := filepath.Join(dir, "kubelet.sock")
+			checkpointFile := filepath.Join(dir, "kubelet_internal_checkpoint")
+			touch := func(path string) {
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.socket {
+				touch(socket)
+			}
+			if tt.checkpoint {
+				touch(checkpointFile)
+			}
+
+			c, err := NewAllocationClient(tt.source, "unix://"+socket, checkpointFile, "unix://"+filepath.Join(dir, "containerd.sock"), nil, nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("NewAllocationClient() err = %v, wantError %v", err, tt.wantError)
+			}
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			// the podresources client is not connected yet, the version is negotiated on the first call.
+			if c.Version() != tt.wantVersion {
+				t.Errorf("Version() = %q, want %q", c.Version(), tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestNewVisibleDevicesClient(t *testing.T) {
+	var tests = []struct {
+		name    string
+		source  string
+		socket  bool
+		wantNil bool
+	}{
+		{name: "runtime socket", source: AllocationSourcePodResources, socket: true},
+		{name: "runtime socket missing", source: AllocationSourceAuto, wantNil: true},
+		{name: "cri allocation source", source: AllocationSourceCRI, socket: true, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			socket := filepath.Join(t.TempDir(), "containerd.sock")
+			if tt.socket {
+				if err := os.WriteFile(socket, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := NewVisibleDevicesClient(tt.source, "unix://"+socket, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (c == nil) != tt.wantNil {
+				t.Fatalf("NewVisibleDevicesClient() = %v, wantNil %v", c, tt.wantNil)
+			}
+			if c != nil {
+				c.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpuserveroptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	gpupodcleintset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpupod/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/utils/pointer"
+)
+
+// The reasons of the Events recorded by AllocationVerifier.
+const (
+	EventAllocationMismatch = "AllocationMismatch"
+	EventAllocationEvicted  = "AllocationMismatchEvicted"
+)
+
+func NewAllocationVerifier(kubeClient kubernetes.Interface, gpuPodClient gpupodcleintset.Interface, recorder record.EventRecorder, pods corelisters.PodLister,
+	visible podresources.Client, interval time.Duration, evict bool, stop <-chan struct{}) (*AllocationVerifier, error) {
+	nodeName := os.Getenv("NODENAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("unable get env NODENAME")
+	}
+
+	return &AllocationVerifier{
+		kubeClient:   kubeClient,
+		gpuPodClient: gpuPodClient,
+		recorder:     recorder,
+		pods:         pods,
+		visible:      visible,
+		nodeName:     nodeName,
+		interval:     interval,
+		evict:        evict,
+		stop:         stop,
+		syncChan:     make(chan struct{}, 1),
+		verified:     make(map[string]metav1.Condition),
+		evicted:      make(map[string]bool),
+	}, nil
+}
+
+// AllocationVerifier verifies the gpus allocated to each pod after the allocation, against the model annotated by the pod
+// and the devices visible in its containers listed from the container runtime, if visible is set.
+// The result is the condition AllocationVerified of the GpuPod, the pod mismatched gets an Event,
+// and is evicted to be rescheduled if evict is set.
+type AllocationVerifier struct {
+	kubeClient   kubernetes.Interface
+	gpuPodClient gpupodcleintset.Interface
+	recorder     record.EventRecorder
+	pods         corelisters.PodLister
+	// visible lists the devices visible in the containers, nil disables the check of them.
+	visible  podresources.Client
+	nodeName string
+	interval time.Duration
+	evict    bool
+	stop     <-chan struct{}
+	lock     sync.Mutex
+	// ngi and prm are the last devices and pod resources set, prm is nil until the pod resources are listed.
+	ngi      *NodeGpuInfo
+	prm      map[string]*podresourcesapi.PodResources
+	syncChan chan struct{}
+
+	// the fields below are only accessed by the loop.
+	// verified maps the GpuPod name to the condition AllocationVerified applied into its status,
+	// it is seeded from the GpuPods on the node first, so a restart neither applies nor reports them again.
+	seeded   bool
+	verified map[string]metav1.Condition
+	// evicted are the GpuPods with their pods evicted.
+	evicted map[string]bool
+}
+
+// SetState sets the devices and the pod resources to verify, prm is not changed after set.
+func (av *AllocationVerifier) SetState(ngi *NodeGpuInfo, prm map[string]*podresourcesapi.PodResources) {
+	if av == nil || ngi == nil {
+		return
+	}
+	av.lock.Lock()
+	av.ngi = ngi
+	av.prm = prm
+	av.lock.Unlock()
+
+	select {
+	case av.syncChan <- struct{}{}:
+	default:
+		// a sync is pending already
+	}
+}
+
+func (av *AllocationVerifier) Start() error {
+	if av.interval <= 0 {
+		klog.Infof("AllocationVerifier disabled")
+		return nil
+	}
+
+	go func() {
+		klog.Infof("AllocationVerifier started with interval:%v evict:%v visible devices:%v", av.interval, av.evict, av.visible != nil)
+		ticker := time.NewTicker(av.interval)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-av.stop:
+				break LOOP
+			case <-av.syncChan:
+			case <-ticker.C:
+			}
+			if err := av.verify(); err != nil {
+				klog.Errorf("verify allocation of node %s err: %v", av.nodeName, err)
+			}
+		}
+		if av.visible != nil {
+			if err := av.visible.Close(); err != nil {
+				klog.Errorf("close the client of the devices visible err: %v", err)
+			}
+		}
+		klog.Infof("AllocationVerifier stopped")
+	}()
+	return nil
+}
+
+// verify verifies the pods with gpus allocated, the GpuPods not found are verified again on the next interval.
+// The pod mismatched is evicted after the condition is applied, so the reason is left on the GpuPod.
+func (av *AllocationVerifier) verify() error {
+	av.lock.Lock()
+	ngi, prm := av.ngi, av.prm
+	av.lock.Unlock()
+	if ngi == nil || prm == nil {
+		return nil
+	}
+	if !av.seeded {
+		if err := av.seed(); err != nil {
+			return fmt.Errorf("seed the conditions of GpuPods: %v", err)
+		}
+		av.seeded = true
+	}
+	visible := av.listVisibleDevices()
+
+	var errs []error
+	current := make(map[string]bool, len(prm))
+	for _, pr := range prm {
+		if len(allocatedDevices(pr, ngi.MigDevices)) == 0 {
+			continue
+		}
+		name := util.MetadataToName(pr.Namespace, pr.Name)
+		pod, err := av.pods.Pods(pr.Namespace).Get(pr.Name)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		current[name] = true
+
+		var containers map[string][]string
+		if visible != nil {
+			containers = visible[name]
+		}
+		reason, message := verifyAllocation(pr, pod.Annotations[gpuserveroptions.SCHEDULE_ANNOTATION], ngi, containers)
+		if reason == "" {
+			message = verifiedMessage(visible != nil)
+		}
+		if err := av.setCondition(name, pr, reason, message); apierrors.IsNotFound(err) {
+			// the GpuPod is not created yet
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("apply status of GpuPod %s: %v", name, err))
+			continue
+		}
+		if reason == "" || !av.evict || av.evicted[name] || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if err := av.evictPod(pod); err != nil {
+			errs = append(errs, fmt.Errorf("evict pod %s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		av.evicted[name] = true
+		av.recorder.Eventf(pod, corev1.EventTypeWarning, EventAllocationEvicted,
+			"Pod evicted from node %s to be rescheduled, the gpus allocated are mismatched: %s", av.nodeName, message)
+	}
+	for name := range av.verified {
+		if !current[name] {
+			delete(av.verified, name)
+		}
+	}
+	for name := range av.evicted {
+		if !current[name] {
+			delete(av.evicted, name)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// seed seeds verified from the condition AllocationVerified of the GpuPods on the node.
+func (av *AllocationVerifier) seed() error {
+	lsOpt := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", options.GPUPOD_ANNOTATION_TAG_Node, av.nodeName), ResourceVersion: "0"}
+	gpList, err := av.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).List(context.TODO(), lsOpt)
+	if err != nil {
+		return err
+	}
+	for _, gp := range gpList.Items {
+		if cond := meta.FindStatusCondition(gp.Status.Conditions, gpupodv1.GpuPodAllocationVerified); cond != nil {
+			av.verified[gp.Name] = *cond
+		}
+	}
+	klog.Infof("node:%s seeded %d GpuPods verified", av.nodeName, len(av.verified))
+	return nil
+}
+
+// listVisibleDevices maps the GpuPod name to the devices visible in each container, nil if they are not listed.
+func (av *AllocationVerifier) listVisibleDevices() map[string]map[string][]string {
+	if av.visible == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), options.DefaultPodResourcesTimeoutList)
+	defer cancel()
+	prlist, err := av.visible.List(ctx)
+	if err != nil {
+		klog.Warningf("node:%s list the devices visible in the containers err:%v, only the models are verified", av.nodeName, err)
+		return nil
+	}
+
+	visible := make(map[string]map[string][]string, len(prlist))
+	for _, pr := range prlist {
+		containers := make(map[string][]string, len(pr.Containers))
+		for _, c := range pr.Containers {
+			for _, d := range c.Devices {
+				containers[c.Name] = append(containers[c.Name], d.DeviceIds...)
+			}
+		}
+		visible[util.MetadataToName(pr.Namespace, pr.Name)] = containers
+	}
+	return visible
+}
+
+// verifiedMessage is the message of the condition AllocationVerified True,
+// which tells whether the devices visible in the containers are verified besides the model.
+func verifiedMessage(visibleChecked bool) string {
+	if visibleChecked {
+		return "The gpus allocated are of the model requested and visible in the containers."
+	}
+	return "The gpus allocated are of the model requested, the devices visible in the containers are not verified."
+}
+
+// setCondition applies the condition AllocationVerified of the GpuPod if it is changed, the empty reason means verified.
+// The Event is recorded on the pod once it is mismatched.
+func (av *AllocationVerifier) setCondition(name string, pr *podresourcesapi.PodResources, reason, message string) error {
+	cond := metav1.Condition{Type: gpupodv1.GpuPodAllocationVerified, Status: metav1.ConditionTrue, Reason: "Verified", Message: message}
+	if reason != "" {
+		cond.Status, cond.Reason = metav1.ConditionFalse, reason
+	}
+	last, exist := av.verified[name]
+	if exist && last.Status == cond.Status && last.Reason == cond.Reason && last.Message == cond.Message {
+		return nil
+	}
+	if exist && last.Status == cond.Status {
+		cond.LastTransitionTime = last.LastTransitionTime
+	} else {
+		cond.LastTransitionTime = metav1.Now()
+	}
+
+	patch, err := serverdsutil.GpuPodStatusApplyPatch(name, metadata.MetadataNamespace(), &gpupodv1.GpuPodStatus{Conditions: []metav1.Condition{cond}})
+	if err != nil {
+		return err
+	}
+	_, err = av.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Patch(context.TODO(), name, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: options.VerifierFieldManager, Force: pointer.Bool(true)}, "status")
+	if err != nil {
+		return err
+	}
+	av.verified[name] = cond
+	if reason != "" {
+		klog.Warningf("node:%s pod %s/%s allocation mismatched: %s", av.nodeName, pr.Namespace, pr.Name, message)
+		av.recorder.Eventf(podReference(pr), corev1.EventTypeWarning, EventAllocationMismatch, "Gpus allocated on node %s are mismatched: %s", av.nodeName, message)
+	}
+	return nil
+}
+
+func (av *AllocationVerifier) evictPod(pod *corev1.Pod) error {
+	err := av.kubeClient.CoreV1().Pods(pod.Namespace).EvictV1(context.TODO(), &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// verifyAllocation verifies the gpus allocated to the pod against the model requested and the devices visible in each container,
+// the reason and the message of the mismatch are returned, or empty if verified. The model empty is not verified, nor the containers
+// nil, and the gpus not on the node are left to DeviceInventoryReconciler.
+// A MIG device allocated is of the model of its gpu, and the gpu may be visible in the container too by its device node.
+func verifyAllocation(pr *podresourcesapi.PodResources, model string, ngi *NodeGpuInfo, containers map[string][]string) (reason, message string) {
+	allocated := allocatedDevices(pr, ngi.MigDevices)
+	var mismatches []string
+
+	if model = util.NormalizeModelName(model); model != "" {
+		wrong := sets.NewString()
+		for _, dids := range allocated {
+			for _, did := range dids.List() {
+				gid := did
+				if mig, exist := ngi.MigDevices[did]; exist {
+					gid = mig.ParentId
+				}
+				if gi, exist := ngi.GpuInfos[gid]; exist && util.NormalizeModelName(gi.Model) != model {
+					wrong.Insert(fmt.Sprintf("%s(%s)", did, gi.Model))
+				}
+			}
+		}
+		if wrong.Len() != 0 {
+			reason = gpupodv1.GpuPodModelMismatch
+			mismatches = append(mismatches, fmt.Sprintf("model %s requested, got %s", model, strings.Join(wrong.List(), ",")))
+		}
+	}
+
+	if containers != nil {
+		names := sets.StringKeySet(allocated).Union(sets.StringKeySet(containers)).List()
+		for _, name := range names {
+			dids := allocated[name]
+			if dids == nil {
+				dids = sets.NewString()
+			}
+			parents := sets.NewString()
+			for _, did := range dids.UnsortedList() {
+				if mig, exist := ngi.MigDevices[did]; exist {
+					parents.Insert(mig.ParentId)
+				}
+			}
+			visible := sets.NewString(containers[name]...)
+			if visible.Len() == 0 {
+				// the container is not running, or sees all or none of the gpus.
+				continue
+			}
+			if !dids.IsSuperset(visible.Difference(parents)) || !visible.IsSuperset(dids) {
+				if reason == "" {
+					reason = gpupodv1.GpuPodVisibleDevicesMismatch
+				}
+				mismatches = append(mismatches, fmt.Sprintf("container %s allocated [%s], visible [%s]", name, strings.Join(dids.List(), ","), strings.Join(visible.List(), ",")))
+			}
+		}
+	}
+	return reason, strings.Join(mismatches, "; ")
+}
+
+// allocatedDevices maps the container name to the gpus and MIG devices allocated, the MIG devices known are by their uuid.
+func allocatedDevices(pr *podresourcesapi.PodResources, migDevices map[string]*MigDeviceInfo) map[string]sets.String {
+	allocated := make(map[string]sets.String)
+	for _, c := range pr.Containers {
+		for _, d := range c.Devices {
+			if !util.IsGpuResourceName(d.ResourceName) && !serverdsutil.IsMigResourceName(d.ResourceName) {
+				continue
+			}
+			for _, did := range d.DeviceIds {
+				if mig := serverdsutil.FindMigDevice(migDevices, did); mig != nil {
+					did = mig.DeviceId
+				}
+				if allocated[c.Name] == nil {
+					allocated[c.Name] = sets.NewString()
+				}
+				allocated[c.Name].Insert(did)
+			}
+		}
+	}
+	return allocated
+}
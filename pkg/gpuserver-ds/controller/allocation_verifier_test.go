@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpuserveroptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+func TestVerifyAllocation(t *testing.T) {
+	ngi := &NodeGpuInfo{
+		GpuInfos: map[string]*GpuInfo{
+			"GPU-0": {DeviceId: "GPU-0", Model: "Tesla T4"},
+			"GPU-1": {DeviceId: "GPU-1", Model: "Tesla T4"},
+			"GPU-2": {DeviceId: "GPU-2", Model: "A100-SXM4-40GB", MigEnabled: true},
+		},
+		MigDevices: map[string]*MigDeviceInfo{"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-2", GpuInstanceId: 7}},
+	}
+	pod := func(resourceName string, dids ...string) *podresourcesapi.PodResources {
+		return &podresourcesapi.PodResources{Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: resourceName, DeviceIds: dids}}},
+		}}
+	}
+	var tests = []struct {
+		name        string
+		pr          *podresourcesapi.PodResources
+		model       string
+		containers  map[string][]string
+		wantReason  string
+		wantMessage string
+	}{
+		{name: "verified", pr: pod("nvidia.com/gpu", "GPU-0", "GPU-1"), model: " tesla t4", containers: map[string][]string{"c": {"GPU-1", "GPU-0"}}},
+		{name: "model not requested", pr: pod("nvidia.com/gpu", "GPU-2")},
+		{name: "gpu not on node", pr: pod("nvidia.com/gpu", "GPU-9"), model: "tesla t4"},
+		{
+			name: "model mismatch", pr: pod("nvidia.com/gpu", "GPU-0", "GPU-2"), model: "tesla t4",
+			wantReason: gpupodv1.GpuPodModelMismatch, wantMessage: "model tesla t4 requested, got GPU-2(A100-SXM4-40GB)",
+		},
+		{
+			name: "MIG device of the model", pr: pod("nvidia.com/mig-1g.5gb", "MIG-GPU-2/7/0"), model: "a100-sxm4-40gb",
+			containers: map[string][]string{"c": {"MIG-0", "GPU-2"}},
+		},
+		{
+			name: "visible device not allocated", pr: pod("nvidia.com/gpu", "GPU-0"),
+			containers: map[string][]string{"c": {"GPU-0", "GPU-1"}, "sidecar": {"GPU-2"}},
+			wantReason: gpupodv1.GpuPodVisibleDevicesMismatch, wantMessage: "container c allocated [GPU-0], visible [GPU-0,GPU-1]; container sidecar allocated [], visible [GPU-2]",
+		},
+		{
+			name: "both mismatch", pr: pod("nvidia.com/gpu", "GPU-2"), model: "tesla t4", containers: map[string][]string{"c": {"GPU-0"}},
+			wantReason:  gpupodv1.GpuPodModelMismatch,
+			wantMessage: "model tesla t4 requested, got GPU-2(A100-SXM4-40GB); container c allocated [GPU-2], visible [GPU-0]",
+		},
+		{name: "container not running", pr: pod("nvidia.com/gpu", "GPU-0"), containers: map[string][]string{}},
+		{name: "other resource", pr: pod("example.com/foo", "GPU-2"), model: "tesla t4", containers: map[string][]string{"c": {"GPU-2"}},
+			wantReason: gpupodv1.GpuPodVisibleDevicesMismatch, wantMessage: "container c allocated [], visible [GPU-2]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, message := verifyAllocation(tt.pr, tt.model, ngi, tt.containers)
+			if reason != tt.wantReason || message != tt.wantMessage {
+				t.Errorf("verifyAllocation() = %q, %q, want %q, %q", reason, message, tt.wantReason, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestAllocationVerifier(t *testing.T) {
+	t.Setenv("NODENAME", "node-verifier")
+	_, gpuPodClient := newApplyFakeClients()
+	for _, name := range []string{"default-pod1", "default-pod2"} {
+		_, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Create(context.TODO(), &gpupodv1.GpuPod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metadata.MetadataNamespace(), Labels: map[string]string{options.GPUPOD_ANNOTATION_TAG_Node: "node-verifier"}},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, name := range []string{"pod1", "pod2"} {
+		err := indexer.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name,
+			Annotations: map[string]string{gpuserveroptions.SCHEDULE_ANNOTATION: "Tesla T4"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	kubeClient := fake.NewSimpleClientset()
+	recorder := record.NewFakeRecorder(10)
+	devices := func(dids ...string) []*podresourcesapi.ContainerResources {
+		return []*podresourcesapi.ContainerResources{{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: dids}}}}
+	}
+	visible := &fakePodResourcesClient{prlist: []*podresourcesapi.PodResources{
+		{Namespace: "default", Name: "pod1", Containers: devices("GPU-0")},
+		{Namespace: "default", Name: "pod2", Containers: devices("GPU-0")},
+	}}
+	av, err := NewAllocationVerifier(kubeClient, gpuPodClient, recorder, corelisters.NewPodLister(indexer), visible, time.Minute, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ngi := &NodeGpuInfo{GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0", Model: "Tesla T4"}, "GPU-1": {DeviceId: "GPU-1", Model: "Tesla T4"}}}
+	prm := map[string]*podresourcesapi.PodResources{
+		"default/pod1": {Namespace: "default", Name: "pod1", Containers: devices("GPU-0")},
+		"default/pod2": {Namespace: "default", Name: "pod2", Containers: devices("GPU-1")},
+		// the pod not found is not verified.
+		"default/pod3": {Namespace: "default", Name: "pod3", Containers: devices("GPU-1")},
+	}
+	verify := func() {
+		t.Helper()
+		av.SetState(ngi, prm)
+		if err := av.verify(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantEvents := func(reasons ...string) {
+		t.Helper()
+		var got []string
+		for len(recorder.Events) != 0 {
+			got = append(got, strings.Fields(<-recorder.Events)[1])
+		}
+		if !reflect.DeepEqual(got, reasons) {
+			t.Errorf("events = %v, want %v", got, reasons)
+		}
+	}
+	wantCondition := func(name string, status metav1.ConditionStatus, reason string) *metav1.Condition {
+		t.Helper()
+		gp, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gp.Status.Conditions) != 1 || gp.Status.Conditions[0].Type != gpupodv1.GpuPodAllocationVerified ||
+			gp.Status.Conditions[0].Status != status || gp.Status.Conditions[0].Reason != reason {
+			t.Fatalf("GpuPod %s conditions = %+v, want AllocationVerified %s %s", name, gp.Status.Conditions, status, reason)
+		}
+		return &gp.Status.Conditions[0]
+	}
+	evictions := func() int {
+		n := 0
+		for _, action := range kubeClient.Actions() {
+			if action.GetVerb() == "create" && action.GetSubresource() == "eviction" {
+				n++
+			}
+		}
+		return n
+	}
+
+	verify()
+	if cond := wantCondition("default-pod1", metav1.ConditionTrue, "Verified"); cond.Message != verifiedMessage(true) {
+		t.Errorf("message = %q, want the devices visible verified", cond.Message)
+	}
+	wantCondition("default-pod2", metav1.ConditionFalse, gpupodv1.GpuPodVisibleDevicesMismatch)
+	wantEvents(EventAllocationMismatch, EventAllocationEvicted)
+	if n := evictions(); n != 1 {
+		t.Errorf("%d pods evicted, want 1", n)
+	}
+
+	// the mismatch is neither reported nor evicted again.
+	verify()
+	wantEvents()
+	if n := evictions(); n != 1 {
+		t.Errorf("%d pods evicted, want 1", n)
+	}
+
+	// a restart neither reports nor applies the conditions again, and the pod terminating is not evicted.
+	pod2, err := corelisters.NewPodLister(indexer).Pods("default").Get("pod2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod2 = pod2.DeepCopy()
+	pod2.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	if err := indexer.Update(pod2); err != nil {
+		t.Fatal(err)
+	}
+	transition := wantCondition("default-pod2", metav1.ConditionFalse, gpupodv1.GpuPodVisibleDevicesMismatch).LastTransitionTime
+	gpuPodClient.ClearActions()
+	av, err = NewAllocationVerifier(kubeClient, gpuPodClient, recorder, corelisters.NewPodLister(indexer), visible, time.Minute, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify()
+	wantEvents()
+	if n := evictions(); n != 1 {
+		t.Errorf("%d pods evicted, want 1", n)
+	}
+	for _, action := range gpuPodClient.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("GpuPod %s applied again after restart", action.(k8stesting.PatchAction).GetName())
+		}
+	}
+	if got := wantCondition("default-pod2", metav1.ConditionFalse, gpupodv1.GpuPodVisibleDevicesMismatch).LastTransitionTime; !got.Equal(&transition) {
+		t.Errorf("LastTransitionTime = %v after restart, want %v", got, transition)
+	}
+
+	// the devices visible not listed are told by the message.
+	visible.errs = []error{fmt.Errorf("runtime unavailable")}
+	verify()
+	if cond := wantCondition("default-pod1", metav1.ConditionTrue, "Verified"); cond.Message != verifiedMessage(false) {
+		t.Errorf("message = %q, want the devices visible not verified", cond.Message)
+	}
+
+	// the pod gone is forgotten.
+	delete(prm, "default/pod2")
+	verify()
+	if len(av.verified) != 1 || len(av.evicted) != 0 {
+		t.Errorf("verified:%v evicted:%v, want only default-pod1 verified", av.verified, av.evicted)
+	}
+}
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -12,8 +15,6 @@ import (
 
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 
-	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
-	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -21,163 +22,356 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
 	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
 	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
 	gpupodcleintset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpupod/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/checkpoint"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/metrics"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
 	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
-	"google.golang.org/grpc"
-	"k8s.io/client-go/util/retry"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
-	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/utils/pointer"
 )
 
-var (
-	brand2type = [18]string{"BRAND_UNKNOWN", "BRAND_QUADRO", "BRAND_TESLA", "BRAND_NVS", "BRAND_GRID", "BRAND_GEFORCE",
-		"BRAND_TITAN", "BRAND_NVIDIA_VAPPS", "BRAND_NVIDIA_VPC", "BRAND_NVIDIA_VCS", "BRAND_NVIDIA_VWS", "BRAND_NVIDIA_VGAMING",
-		"BRAND_QUADRO_RTX", "BRAND_NVIDIA_RTX", "BRAND_NVIDIA", "BRAND_GEFORCE_RTX", "BRAND_TITAN_RTX", "BRAND_COUNT"}
-	ttlCacheGpu = serverdsutil.NewTTLCacheGpu(5 * time.Second)
-
-	updateBackoff = wait.Backoff{
-		Steps:    options.PRODUCE_MAX_ERRORCOUNT,
-		Duration: 100 * time.Millisecond,
-		Factor:   2.0,
-		Jitter:   1.0,
-	}
-)
+var ttlCacheGpu = serverdsutil.NewTTLCacheGpu(5 * time.Second)
 
-func NewServerDSController(stop <-chan struct{}, goonChan <-chan struct{}, removeChan <-chan *PodResourceUpdate, gpuinfoChan <-chan *NodeGpuInfo, podresourcesep string, gpuClient gpuclientset.Interface, gpuPodClient gpupodcleintset.Interface) (*ServerDSController, error) {
+func NewServerDSController(stop <-chan struct{}, podEventChan <-chan *PodEvent, gpuinfoChan <-chan *NodeGpuInfo, healthChan <-chan map[string]*DeviceHealth, degradationChan <-chan map[string]*DeviceDegradation, processChan <-chan map[string][]*GpuProcess, provider device.Provider, prclient podresources.Client, relistInterval time.Duration, gpuClient gpuclientset.Interface, gpuPodClient gpupodcleintset.Interface, cm *checkpoint.Manager, conditions *NodeConditionController, labels *NodeLabelController, resources *NodeResourceController, inventory *DeviceInventoryReconciler, verifier *AllocationVerifier) (*ServerDSController, error) {
 	nodeName := os.Getenv("NODENAME")
 	if nodeName == "" {
 		return nil, fmt.Errorf("unable get env NODENAME")
 	}
 
-	client, conn, err := podresources.GetClient(podresourcesep, options.DefaultPodResourcesTimeoutConnect, options.DefaultPodResourcesMaxSize)
-	if err != nil {
-		return nil, fmt.Errorf("error getting grpc client: %v", err)
-	}
-
 	dsc := &ServerDSController{
-		goonChan:     goonChan,
-		removeChan:   removeChan,
-		stop:         stop,
-		gpuinfoChan:  gpuinfoChan,
-		nodeName:     nodeName,
-		prclient:     client,
-		grpconn:      conn,
-		svcName:      metadata.ServiceName(),
-		gpuClient:    gpuClient,
-		gpuPodClient: gpuPodClient,
-		gpuPodLast:   make(map[string]*gpupodv1.GpuPod),
+		podEventChan:    podEventChan,
+		stop:            stop,
+		gpuinfoChan:     gpuinfoChan,
+		healthChan:      healthChan,
+		degradationChan: degradationChan,
+		processChan:     processChan,
+		provider:        provider,
+		nodeName:        nodeName,
+		prclient:        prclient,
+		relistInterval:  relistInterval,
+		prBackoff:       newPodResourcesBackoff(),
+		svcName:         metadata.ServiceName(),
+		gpuClient:       gpuClient,
+		gpuPodClient:    gpuPodClient,
+		gpuPodApplied:   make(map[string]*checkpoint.GpuPod),
+		gpuPodDesired:   make(map[string]*PodResourcesDetail),
+		queue:           newWorkQueue(),
+		checkpoint:      cm,
+		conditions:      conditions,
+		labels:          labels,
+		resources:       resources,
+		inventory:       inventory,
+		verifier:        verifier,
 	}
 
+	data, err := cm.Load()
+	if err != nil {
+		klog.Errorf("ignore checkpoint: %v", err)
+	} else if data != nil {
+		dsc.restore(data)
+	}
 	return dsc, nil
 }
 
+// restore restores the state last published from the checkpoint,
+// then only the changes since then are published after the first list.
+func (dsc *ServerDSController) restore(data *checkpoint.Data) {
+	if data.GpuNode != nil {
+		dsc.gpuNodeApplied = data.GpuNode
+		dsc.lastNodeGpuInfo = data.GpuNode.NodeGpuInfo
+	}
+	dsc.podresourcesLast = make(map[string]*podresourcesapi.PodResources, len(data.GpuPods))
+	for name, gp := range data.GpuPods {
+		if gp == nil || gp.PodResources == nil {
+			// a partial entry, the GpuPod is produced again by the first list.
+			klog.Warningf("node:%s ignore gpupod %s without pod resources in checkpoint", dsc.nodeName, name)
+			continue
+		}
+		dsc.gpuPodApplied[name] = gp
+		dsc.podresourcesLast[strings.Join([]string{gp.PodResources.Namespace, gp.PodResources.Name}, "/")] = gp.PodResources
+	}
+	klog.Infof("node:%s restored %d gpupods from checkpoint", dsc.nodeName, len(dsc.gpuPodApplied))
+}
+
 // ServerDSController is the main controller to signal gpu usage info to the server.
 // Signal pod gpu usage info to the server.
 // Signal node gpu info to the server.
 type ServerDSController struct {
 	stop <-chan struct{}
-	// Signal the server the gpu pod on the node is sync. which means the gpu info changed.
-	goonChan <-chan struct{}
-	// Signal the server the gpu pod on the node is deleted, which means the gpu is freed.
-	removeChan <-chan *PodResourceUpdate
+	// Signal the server the gpu pod on the node is sync or deleted.
+	// Sync of a new pod means the gpu info changed, delete means the gpu is freed.
+	podEventChan <-chan *PodEvent
 	// Signal means the server is not healthy.
 	nohealthChan     <-chan struct{}
 	gpuinfoChan      <-chan *NodeGpuInfo
+	healthChan       <-chan map[string]*DeviceHealth
+	degradationChan  <-chan map[string]*DeviceDegradation
+	processChan      <-chan map[string][]*GpuProcess
+	provider         device.Provider
 	nodeName         string
-	prclient         podresourcesapi.PodResourcesListerClient
-	grpconn          *grpc.ClientConn
+	prclient         podresources.Client
 	podresourcesLast map[string]*podresourcesapi.PodResources
 	lastNodeGpuInfo  *NodeGpuInfo
-	svcName          string
-	gpuClient        gpuclientset.Interface
-	gpuPodClient     gpupodcleintset.Interface
-	gpuNodeLast      *gpunodev1.GpuNode
-	gpuPodLast       map[string]*gpupodv1.GpuPod
-	gpuPodLock       sync.RWMutex //used to protect gpuPodLast.
-	once             sync.Once
+	lastUnhealthy    map[string]*DeviceHealth
+	lastDegraded     map[string]*DeviceDegradation
+	lastProcesses    map[string][]*GpuProcess
+	lastForeign      map[string]*DeviceOccupation
+	// prUnavailable means the last list failed, the list is retried by prBackoff.
+	prUnavailable bool
+	prBackoff     wait.Backoff
+	// relistInterval lists the pod resources periodically besides on the pod events, 0 disables it.
+	relistInterval time.Duration
+	// migChanged means the MIG devices changed since the last list, all the gpupods are produced again.
+	migChanged bool
+	// map the device id kubelet considers allocatable to its NUMA nodes, nil if unknown.
+	allocatableLast map[string][]int64
+	svcName         string
+	gpuClient       gpuclientset.Interface
+	gpuPodClient    gpupodcleintset.Interface
+	// the last objects applied, the write is skipped if the patch is not changed.
+	gpuNodeApplied *checkpoint.GpuNode
+	gpuPodApplied  map[string]*checkpoint.GpuPod
+	gpuPodLock     sync.RWMutex //used to protect gpuPodApplied.
+	// gpuNodeVerified means the GpuNode applied is checked not changed by others, it is reset by the resync.
+	gpuNodeVerified bool
+	// gpuNodeResync is set to 1 by the resync, so the worker of gpuNodeKey checks the GpuNode applied again.
+	gpuNodeResync int32
+	checkpoint    *checkpoint.Manager
+	// the collaborators below may be nil, their methods do nothing on a nil receiver,
+	// so the controller works without any of them, such as in tests.
+	conditions *NodeConditionController
+	labels     *NodeLabelController
+	resources  *NodeResourceController
+	inventory  *DeviceInventoryReconciler
+	verifier   *AllocationVerifier
+	once       sync.Once
+	// queue is keyed by the GpuPod name, and gpuNodeKey for the GpuNode.
+	// Each key is synced by one worker at a time, the key added again before it is synced is coalesced.
+	queue workqueue.RateLimitingInterface
+	// stateLock protects the desired state set by the main loop and synced by the workers.
+	stateLock      sync.Mutex
+	gpuPodDesired  map[string]*PodResourcesDetail
+	gpuNodeDesired *gpuNodeState
+}
+
+// gpuNodeKey is the key of the GpuNode in the queue, it never conflicts with a GpuPod name.
+const gpuNodeKey = "GpuNode/"
+
+// gpuNodeState is the state of the node to produce the GpuNode, it is snapshotted by the main loop.
+type gpuNodeState struct {
+	ngi         *NodeGpuInfo
+	prm         map[string]*podresourcesapi.PodResources
+	unhealthy   map[string]*DeviceHealth
+	degraded    map[string]*DeviceDegradation
+	allocatable map[string][]int64
+	foreign     map[string]*DeviceOccupation
+}
+
+func newWorkQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(options.ServerDSController_RetryBaseDelay, options.ServerDSController_RetryMaxDelay),
+		// overall rate limit of the retries, the ones of all the keys are not sent at once.
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	), "gpuserver-ds")
+}
+
+// newPodResourcesBackoff is the backoff to retry the list while kubelet is unavailable.
+func newPodResourcesBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: options.PodResources_RetryBaseDelay,
+		Factor:   2,
+		Cap:      options.PodResources_RetryMaxDelay,
+		Steps:    math.MaxInt32,
+	}
 }
 
 func (dsc *ServerDSController) Start() error {
 	relistChan := make(chan struct{}, 10)
 	relistChan <- struct{}{}
 
+	for i := 0; i < options.ServerDSController_Workers; i++ {
+		go wait.Until(dsc.runWorker, time.Second, dsc.stop)
+	}
+
 	go func() {
 		klog.Infof("ServerDSController started.")
+		var relistTick <-chan time.Time
+		if dsc.relistInterval > 0 {
+			ticker := time.NewTicker(dsc.relistInterval)
+			defer ticker.Stop()
+			relistTick = ticker.C
+		}
+		resyncTicker := time.NewTicker(options.ServerDSController_ResyncPeriod)
+		defer resyncTicker.Stop()
+		// prRetry is the single retry pending while kubelet is unavailable.
+		var prRetry <-chan time.Time
 	LOOP:
 		for {
 			select {
 			case <-dsc.stop:
 				break LOOP
 
+			case <-relistTick:
+				select {
+				case relistChan <- struct{}{}:
+				default:
+				}
+
+			case <-resyncTicker.C:
+				// the gpupods are not known until the first list, and not fresh while kubelet is unavailable.
+				if dsc.podresourcesLast == nil || dsc.prUnavailable {
+					continue
+				}
+				dsc.resync()
+
 			case ngi := <-dsc.gpuinfoChan:
 				ngi.NodeName = dsc.nodeName
-				dsc.lastNodeGpuInfo = ngi
-				dsc.produceNodeGpuInfoCrd()
-				atomic.SwapInt32(&serverdsutil.NodePushed, 1)
-
-			case prupdate := <-dsc.removeChan:
-				// del podresourcesLast
-				if dsc.podresourcesLast != nil {
-					podidx := strings.Join([]string{prupdate.PodResourcesDEL[0].Namespace, prupdate.PodResourcesDEL[0].Name}, "/")
-					delete(dsc.podresourcesLast, podidx)
+				if dsc.lastNodeGpuInfo != nil && !reflect.DeepEqual(dsc.lastNodeGpuInfo.MigDevices, ngi.MigDevices) {
+					// the MIG devices of the gpupods are resolved again.
+					dsc.migChanged = true
+					select {
+					case relistChan <- struct{}{}:
+					default:
+					}
 				}
-				prupdate.NodeName = dsc.nodeName
-				dsc.cleanPodResourceCrd(util.MetadataToName(prupdate.PodResourcesDEL[0].Namespace, prupdate.PodResourcesDEL[0].Name))
-				dsc.produceNodeGpuInfoCrd()
+				dsc.lastNodeGpuInfo = ngi
+				dsc.enqueueGpuNode()
 
-			case <-dsc.goonChan:
-				relistChan <- struct{}{}
-				continue
+			case unhealthy := <-dsc.healthChan:
+				dsc.lastUnhealthy = unhealthy
+				dsc.enqueueGpuNode()
 
-			case <-relistChan:
-				klog.Infof("go on list")
-				ctx, ctxcancal := context.WithTimeout(context.Background(), options.DefaultPodResourcesTimeoutList)
-				resp, err := dsc.prclient.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
-				if err != nil {
-					ctxcancal()
-					klog.Errorf("ListPodResourcesRequest err: %v", err)
-					break LOOP
+			case degraded := <-dsc.degradationChan:
+				dsc.lastDegraded = degraded
+				dsc.enqueueGpuNode()
+
+			case processes := <-dsc.processChan:
+				dsc.lastProcesses = processes
+				if foreign := dsc.foreignOccupied(); !reflect.DeepEqual(dsc.lastForeign, foreign) {
+					klog.Infof("node:%s devices occupied by foreign process changed: %v", dsc.nodeName, foreign)
+					dsc.enqueueGpuNode()
 				}
-				ctxcancal()
 
-				//report any according to
-				if dsc.podresourcesLast == nil {
-					dsc.podresourcesLast = make(map[string]*podresourcesapi.PodResources)
+			case pe := <-dsc.podEventChan:
+				switch pe.Type {
+				case PodEventDelete:
+					// del podresourcesLast, the devices are freed without list.
+					if dsc.podresourcesLast != nil {
+						delete(dsc.podresourcesLast, pe.Key())
+					}
+					dsc.enqueueGpuPod(util.MetadataToName(pe.Namespace, pe.Name), nil)
+					dsc.enqueueGpuNode()
+
+				case PodEventSync:
+					// the devices allocated to a pod never change, list only for the pod unknown.
+					if _, exist := dsc.podresourcesLast[pe.Key()]; exist {
+						continue
+					}
+					// the list retried lists the pod.
+					if dsc.prUnavailable {
+						continue
+					}
+					klog.Infof("got a gpu pod unknown: %s", pe.Key())
+					select {
+					case relistChan <- struct{}{}:
+					default:
+						// a list is pending already
+					}
 				}
 
-				prmapNew := make(map[string]*podresourcesapi.PodResources)
-				changed := dsc.updatePodResourceFunc(resp.PodResources, dsc.podresourcesLast, prmapNew)
-				dsc.podresourcesLast = prmapNew
-				if changed {
-					// ensure gpuNode.Spec.NodeDeviceInUse fresh.
-					dsc.produceNodeGpuInfoCrd()
+			case <-relistChan:
+				if dsc.prUnavailable {
+					// the list is retried by prRetry only, the relist ticker, the MIG devices changed
+					// and the pod events do not list or step the backoff meanwhile.
+					continue
 				}
+				prRetry = dsc.relist()
 
-				dsc.once.Do(dsc.cleanPodResourceCrdInit)
+			case <-prRetry:
+				prRetry = dsc.relist()
 			}
 		}
+		dsc.queue.ShutDown()
 		klog.Infof("ServerDSController stopped.")
-		if err := dsc.grpconn.Close(); err != nil {
+		if err := dsc.prclient.Close(); err != nil {
 			klog.Errorf("grpc conn close: %v", err)
 		}
 	}()
 	return nil
 }
 
-func (dsc *ServerDSController) updatePodResourceFunc(prlist []*podresourcesapi.PodResources, prmapOld, prmapNew map[string]*podresourcesapi.PodResources) bool {
-	prlistFiltered := fileterPodResource(prlist)
+// relist lists the pod resources and enqueues the gpupods changed,
+// the timer to retry with the backoff is returned if the list failed, nil otherwise.
+func (dsc *ServerDSController) relist() <-chan time.Time {
+	klog.Infof("go on list")
+	ctx, ctxcancal := context.WithTimeout(context.Background(), options.DefaultPodResourcesTimeoutList)
+	prlist, err := dsc.prclient.List(ctx)
+	if err != nil {
+		ctxcancal()
+		// the GpuNode is not published with the data frozen, the lease is not renewed while the condition is False.
+		reason := "ListFailed"
+		if podresources.Unavailable(err) {
+			reason = gpunodev1.GpuNodePodResourcesUnavailable
+		}
+		delay := dsc.prBackoff.Step()
+		klog.Errorf("ListPodResourcesRequest err: %v, retry after %v", err, delay)
+		dsc.conditions.SetCondition(gpunodev1.GpuNodePodResourcesReady, metav1.ConditionFalse, reason, err.Error())
+		dsc.prUnavailable = true
+		return time.After(delay)
+	}
+	ctxcancal()
+	dsc.conditions.SetCondition(gpunodev1.GpuNodePodResourcesReady, metav1.ConditionTrue, "ListSucceeded", "The podresources of kubelet are listed.")
+	// kubelet may restart with the pods changed while unavailable, all the gpupods are produced again.
+	reconnected := dsc.prUnavailable
+	if reconnected {
+		klog.Infof("kubelet podresources available again, resync all the gpupods")
+		dsc.prUnavailable = false
+		dsc.prBackoff = newPodResourcesBackoff()
+	}
+
+	//report any according to
+	if dsc.podresourcesLast == nil {
+		dsc.podresourcesLast = make(map[string]*podresourcesapi.PodResources)
+	}
+
+	prmapNew := make(map[string]*podresourcesapi.PodResources)
+	changed := dsc.updatePodResourceFunc(prlist, dsc.podresourcesLast, prmapNew, dsc.migChanged || reconnected)
+	dsc.podresourcesLast = prmapNew
+	dsc.migChanged = false
+	if dsc.updateAllocatable() {
+		changed = true
+	}
+	if changed {
+		// ensure gpuNode.Spec.NodeDeviceInUse fresh.
+		dsc.enqueueGpuNode()
+	}
+
+	dsc.once.Do(dsc.resync)
+	return nil
+}
+
+// updatePodResourceFunc enqueues the gpupods changed, all the gpupods are enqueued if force.
+func (dsc *ServerDSController) updatePodResourceFunc(prlist []*podresourcesapi.PodResources, prmapOld, prmapNew map[string]*podresourcesapi.PodResources, force bool) bool {
+	prlistFiltered := fileterPodResource(dsc.provider, dsc.migDevices(), prlist)
 
 	changed := false
 	for _, pr := range prlistFiltered {
 		podidx := strings.Join([]string{pr.Namespace, pr.Name}, "/")
 		prmapNew[podidx] = pr.PodResources //add or update
-		if !reflect.DeepEqual(prmapOld[podidx], pr.PodResources) {
-			go dsc.producePodResourceCrd(pr)
+		if force || !reflect.DeepEqual(prmapOld[podidx], pr.PodResources) {
+			dsc.enqueueGpuPod(util.MetadataToName(pr.Namespace, pr.Name), pr)
 			changed = true
 		}
 	}
@@ -186,7 +380,7 @@ func (dsc *ServerDSController) updatePodResourceFunc(prlist []*podresourcesapi.P
 		//exist podresource
 		podidx := strings.Join([]string{pr.Namespace, pr.Name}, "/")
 		if _, exist := prmapNew[podidx]; !exist {
-			go dsc.cleanPodResourceCrd(util.MetadataToName(pr.Namespace, pr.Name))
+			dsc.enqueueGpuPod(util.MetadataToName(pr.Namespace, pr.Name), nil)
 			changed = true
 		}
 	}
@@ -194,8 +388,17 @@ func (dsc *ServerDSController) updatePodResourceFunc(prlist []*podresourcesapi.P
 	return changed
 }
 
-//fileterPodResource filter which we need
-func fileterPodResource(prlist []*podresourcesapi.PodResources) []*PodResourcesDetail {
+func (dsc *ServerDSController) migDevices() map[string]*MigDeviceInfo {
+	if dsc.lastNodeGpuInfo == nil {
+		return nil
+	}
+	return dsc.lastNodeGpuInfo.MigDevices
+}
+
+// fileterPodResource filter which we need
+// The gpus are of the gpu resource names tracked, such as nvidia.com/gpu.
+// The MIG devices of nvidia.com/mig-* are resolved by migDevices, so are the ones of nvidia.com/gpu with the single MIG strategy.
+func fileterPodResource(provider device.Provider, migDevices map[string]*MigDeviceInfo, prlist []*podresourcesapi.PodResources) []*PodResourcesDetail {
 	prlistFiltered := make([]*PodResourcesDetail, 0, len(prlist))
 	for _, pr := range prlist {
 		prdCD := make([]*ContainerResourcesDetail, 0, len(pr.Containers))
@@ -208,16 +411,33 @@ func fileterPodResource(prlist []*podresourcesapi.PodResources) []*PodResourcesD
 				prdCDcrd := &ContainerResourcesDetail{Name: c.Name, DeviceInfo: make([]*GpuInfo, 0, 1)}
 				//get device details
 				for _, d := range c.Devices {
-					if d.ResourceName == options.NVIDIAGPUResourceName {
+					if util.IsGpuResourceName(d.ResourceName) {
 						for _, did := range d.DeviceIds {
+							if mig := serverdsutil.FindMigDevice(migDevices, did); mig != nil {
+								prdCDcrd.MigDeviceInfo = append(prdCDcrd.MigDeviceInfo, mig)
+								continue
+							}
 							//get gpuinfo
-							gpuinfo, err := updateGpuInfo(did)
+							gpuinfo, err := updateGpuInfo(provider, did)
 							if err != nil {
 								klog.Errorf("Error fileterPodResource.updateGpuInfo:%v", err)
 							}
+							if numaNodes := getNumaNodes(d.Topology); numaNodes != nil {
+								// gpuinfo is shared by ttlCacheGpu
+								gpuinfo = gpuinfo.DeepCopy()
+								gpuinfo.NumaNodes = numaNodes
+							}
 							prdCDcrd.DeviceInfo = append(prdCDcrd.DeviceInfo, gpuinfo)
 						}
-						break //only process nvidia.com/gpu
+					} else if serverdsutil.IsMigResourceName(d.ResourceName) {
+						for _, did := range d.DeviceIds {
+							mig := serverdsutil.FindMigDevice(migDevices, did)
+							if mig == nil {
+								klog.Errorf("Error fileterPodResource: MIG device %s of %s not found", did, d.ResourceName)
+								mig = &MigDeviceInfo{DeviceId: did, Profile: strings.TrimPrefix(d.ResourceName, options.NVIDIAMIGResourcePrefix)}
+							}
+							prdCDcrd.MigDeviceInfo = append(prdCDcrd.MigDeviceInfo, mig)
+						}
 					}
 				}
 				prdCD = append(prdCD, prdCDcrd)
@@ -230,193 +450,406 @@ func fileterPodResource(prlist []*podresourcesapi.PodResources) []*PodResourcesD
 	return prlistFiltered
 }
 
-func (dsc *ServerDSController) cleanPodResourceCrdInit() {
-	klog.Infof("Clean gpupods once when start.")
+// updateAllocatable gets the gpus and MIG devices kubelet considers allocatable, returns whether they change.
+func (dsc *ServerDSController) updateAllocatable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), options.DefaultPodResourcesTimeoutList)
+	defer cancel()
+	resp, err := dsc.prclient.GetAllocatableResources(ctx)
+
+	var allocatable map[string][]int64
+	if err == nil {
+		allocatable = make(map[string][]int64)
+		for _, d := range resp.Devices {
+			if !util.IsGpuResourceName(d.ResourceName) && !serverdsutil.IsMigResourceName(d.ResourceName) {
+				continue
+			}
+			for _, did := range d.DeviceIds {
+				if mig := serverdsutil.FindMigDevice(dsc.migDevices(), did); mig != nil {
+					did = mig.DeviceId
+				}
+				allocatable[did] = getNumaNodes(d.Topology)
+			}
+		}
+	} else if err != podresources.ErrAllocatableUnsupported {
+		klog.Errorf("GetAllocatableResources err: %v", err)
+		return false
+	}
+
+	if reflect.DeepEqual(dsc.allocatableLast, allocatable) {
+		return false
+	}
+	klog.Infof("node:%s allocatable devices changed: %v", dsc.nodeName, allocatable)
+	dsc.allocatableLast = allocatable
+	return true
+}
+
+func getNumaNodes(topology *podresourcesapi.TopologyInfo) []int64 {
+	if topology == nil || len(topology.Nodes) == 0 {
+		return nil
+	}
+	numaNodes := make([]int64, 0, len(topology.Nodes))
+	for _, n := range topology.Nodes {
+		numaNodes = append(numaNodes, n.ID)
+	}
+	return numaNodes
+}
+
+// resync cleans the gpupods of the pods gone, and applies again the GpuPods and GpuNode deleted or changed by others.
+// It runs on the first list, so the ones restored from checkpoint are checked, then periodically.
+func (dsc *ServerDSController) resync() {
+	klog.Infof("node:%s resync gpupods", dsc.nodeName)
 	lsOpt := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", options.GPUPOD_ANNOTATION_TAG_Node, dsc.nodeName), ResourceVersion: "0"}
 	gpList, err := dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).List(context.TODO(), lsOpt)
 	if err != nil {
-		klog.Errorf("clean gpupod when start err:%v", err)
+		klog.Errorf("resync gpupods err:%v", err)
 		return
 	}
 
-	for _, gp := range gpList.Items {
+	listed := make(map[string]metav1.Object, len(gpList.Items))
+	for i, gp := range gpList.Items {
 		podidx := strings.Join([]string{gp.Spec.Namespace, gp.Spec.Name}, "/")
 		if _, ok := dsc.podresourcesLast[podidx]; ok {
+			listed[gp.Name] = &gpList.Items[i]
 			continue
 		}
 		klog.Infof("clean gpupod:%s", podidx)
-		dsc.cleanPodResourceCrd(gp.Name)
+		dsc.queue.Add(gp.Name)
 	}
-}
 
-func (dsc *ServerDSController) cleanPodResourceCrd(nameGpuPod string) {
-	err := retry.OnError(updateBackoff,
-		func(err error) bool {
-			if err != nil {
-				return true
-			}
-			return false
-		}, func() error {
-			return dsc.cleanGpuPod(nameGpuPod)
-		})
+	// the gpupods applied are applied again if their spec is changed or they are deleted by others,
+	// the status written by the other field managers does not count.
+	for _, pr := range dsc.podresourcesLast {
+		name := util.MetadataToName(pr.Namespace, pr.Name)
+		dsc.gpuPodLock.Lock()
+		applied := dsc.gpuPodApplied[name]
+		if applied == nil || specUnchanged(listed[name], applied.UID, applied.Generation) {
+			dsc.gpuPodLock.Unlock()
+			continue
+		}
+		delete(dsc.gpuPodApplied, name)
+		dsc.gpuPodLock.Unlock()
+		klog.Infof("gpupod:%s deleted or changed by others", name)
+		for _, prd := range fileterPodResource(dsc.provider, dsc.migDevices(), []*podresourcesapi.PodResources{pr}) {
+			dsc.enqueueGpuPod(name, prd)
+		}
+	}
+	// verify the GpuNode applied even if nothing changed.
+	atomic.StoreInt32(&dsc.gpuNodeResync, 1)
+	dsc.enqueueGpuNode()
+}
 
-	if err == nil {
-		klog.Infof("node:%s cleanPodResourceCrd:%s notice time:%v ", dsc.nodeName, nameGpuPod, time.Now().Format(time.RFC3339))
+// enqueueGpuPod sets the desired state of the GpuPod, nil means it is deleted.
+func (dsc *ServerDSController) enqueueGpuPod(nameGpuPod string, prd *PodResourcesDetail) {
+	dsc.stateLock.Lock()
+	if prd == nil {
+		delete(dsc.gpuPodDesired, nameGpuPod)
 	} else {
-		klog.Errorf("node:%s cleanPodResourceCrd err:%v", dsc.nodeName, err)
+		dsc.gpuPodDesired[nameGpuPod] = prd
 	}
+	dsc.stateLock.Unlock()
+	dsc.queue.Add(nameGpuPod)
 }
 
-func (dsc *ServerDSController) cleanGpuPod(nameGpuPod string) error {
-	dsc.gpuPodLock.Lock()
-	delete(dsc.gpuPodLast, nameGpuPod)
-	dsc.gpuPodLock.Unlock()
-	err := dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Delete(context.TODO(), nameGpuPod, metav1.DeleteOptions{})
-	if err != nil {
-		klog.Errorf("failed to cleanGpuPod:%s/%s err:%v", metadata.MetadataNamespace(), nameGpuPod, err)
+// enqueueGpuNode snapshots the state of the node as the desired state of the GpuNode.
+func (dsc *ServerDSController) enqueueGpuNode() {
+	dsc.lastForeign = dsc.foreignOccupied()
+	dsc.updateDevicesHealthyCondition()
+	dsc.labels.SetNodeGpuInfo(dsc.lastNodeGpuInfo)
+	dsc.resources.SetNodeGpuInfo(dsc.lastNodeGpuInfo)
+	metrics.DefaultStore.SetNodeState(dsc.lastNodeGpuInfo, dsc.lastUnhealthy, dsc.lastForeign, deviceHolders(dsc.podresourcesLast, dsc.migDevices()))
+
+	state := &gpuNodeState{
+		ngi:         dsc.lastNodeGpuInfo,
+		unhealthy:   dsc.lastUnhealthy,
+		degraded:    dsc.lastDegraded,
+		allocatable: dsc.allocatableLast,
+		foreign:     dsc.lastForeign,
 	}
-	return err
+	// podresourcesLast is changed in place by the pod deleted.
+	if dsc.podresourcesLast != nil {
+		state.prm = make(map[string]*podresourcesapi.PodResources, len(dsc.podresourcesLast))
+		for k, v := range dsc.podresourcesLast {
+			state.prm[k] = v
+		}
+	}
+	dsc.inventory.SetState(state.ngi, state.prm)
+	dsc.verifier.SetState(state.ngi, state.prm)
+	dsc.stateLock.Lock()
+	dsc.gpuNodeDesired = state
+	dsc.stateLock.Unlock()
+	dsc.queue.Add(gpuNodeKey)
 }
 
-func (dsc *ServerDSController) producePodResourceCrd(prd *PodResourcesDetail) {
-	err := retry.OnError(updateBackoff,
-		func(err error) bool {
-			if err != nil {
-				return true
-			}
-			return false
-		}, func() error {
-			err := dsc.ensureGpuPod(prd)
-			if err != nil {
-				klog.Errorf("failed to ensureGpuPod:%s/%s err:%v", prd.Namespace, prd.Name, err)
-			}
-			return err
-		})
+// updateDevicesHealthyCondition sets DevicesHealthy false if any gpu is unhealthy.
+func (dsc *ServerDSController) updateDevicesHealthyCondition() {
+	if len(dsc.lastUnhealthy) == 0 {
+		dsc.conditions.SetCondition(gpunodev1.GpuNodeDevicesHealthy, metav1.ConditionTrue, "AllDevicesHealthy", "No gpu is unhealthy.")
+		return
+	}
+	unhealthy := make([]string, 0, len(dsc.lastUnhealthy))
+	for did := range dsc.lastUnhealthy {
+		unhealthy = append(unhealthy, did)
+	}
+	sort.Strings(unhealthy)
+	dsc.conditions.SetCondition(gpunodev1.GpuNodeDevicesHealthy, metav1.ConditionFalse, "DevicesUnhealthy",
+		fmt.Sprintf("The gpus are unhealthy: %s.", strings.Join(unhealthy, ",")))
+}
+
+func (dsc *ServerDSController) runWorker() {
+	for dsc.processNextWorkItem() {
+	}
+}
 
+// processNextWorkItem syncs a key, the key failed is added back with rate limit.
+func (dsc *ServerDSController) processNextWorkItem() bool {
+	key, quit := dsc.queue.Get()
+	if quit {
+		return false
+	}
+	defer dsc.queue.Done(key)
+
+	err := dsc.sync(key.(string))
 	if err == nil {
-		klog.Infof("node:%s producePodResourceCrd:%s/%s notice time:%v ", dsc.nodeName, prd.Namespace, prd.Name, time.Now().Format(time.RFC3339))
-	} else {
-		klog.Errorf("node:%s producePodResourceCrd err:%v", dsc.nodeName, err)
+		dsc.queue.Forget(key)
+		return true
 	}
+	klog.Errorf("node:%s sync %s err:%v, retries:%d", dsc.nodeName, key, err, dsc.queue.NumRequeues(key))
+	dsc.queue.AddRateLimited(key)
+	return true
 }
 
-func (dsc *ServerDSController) ensureGpuPod(prd *PodResourcesDetail) error {
-	var gpuPodLast *gpupodv1.GpuPod
-	gpuPodUuid := util.MetadataToName(prd.Namespace, prd.Name)
-	dsc.gpuPodLock.RLock()
-	gpuPodLast = dsc.gpuPodLast[gpuPodUuid]
-	dsc.gpuPodLock.RUnlock()
+// sync makes the GpuNode or GpuPod of the key the same as the desired state.
+func (dsc *ServerDSController) sync(key string) error {
+	dsc.stateLock.Lock()
+	nodeState := dsc.gpuNodeDesired
+	prd, exist := dsc.gpuPodDesired[key]
+	dsc.stateLock.Unlock()
+
+	if key == gpuNodeKey {
+		if nodeState.ngi == nil || nodeState.prm == nil {
+			// nothing to report until the gpus are checked and the pod resources are listed.
+			return nil
+		}
+		applied, err := dsc.ensureGpuNode(nodeState)
+		if err != nil {
+			return err
+		}
+		atomic.SwapInt32(&serverdsutil.NodePushed, 1)
+		if applied {
+			klog.Infof("node:%s sync GpuNode notice time:%v ", dsc.nodeName, time.Now().Format(time.RFC3339))
+		}
+		return nil
+	}
 
-	if gpuPodLast == nil {
-		return dsc.getAndUpdateGpuPod(gpuPodUuid, prd)
+	if !exist {
+		if err := dsc.cleanGpuPod(key); err != nil {
+			return err
+		}
+		klog.Infof("node:%s clean GpuPod:%s notice time:%v ", dsc.nodeName, key, time.Now().Format(time.RFC3339))
+		return nil
 	}
-	// dsc.gpuPodLast != nil means we can update directly
-	gpuPod := serverdsutil.ToGpuPod(dsc.nodeName, gpuPodLast, prd)
-	gpuPod, err := dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Update(context.TODO(), gpuPod, metav1.UpdateOptions{})
+	applied, err := dsc.ensureGpuPod(key, prd)
 	if err != nil {
-		// resource be deleted or other conflicts
-		klog.Errorf("failed to update GpuPod:%s/%s, error: %v", gpuPod.Spec.Namespace, gpuPod.Spec.Name, err)
-		return dsc.getAndUpdateGpuPod(gpuPodUuid, prd)
+		return err
+	}
+	if applied {
+		klog.Infof("node:%s sync GpuPod:%s notice time:%v ", dsc.nodeName, key, time.Now().Format(time.RFC3339))
 	}
+	return nil
+}
 
+func (dsc *ServerDSController) cleanGpuPod(nameGpuPod string) error {
 	dsc.gpuPodLock.Lock()
-	dsc.gpuPodLast[gpuPodUuid] = gpuPod
+	delete(dsc.gpuPodApplied, nameGpuPod)
 	dsc.gpuPodLock.Unlock()
+	err := dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Delete(context.TODO(), nameGpuPod, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	dsc.checkpoint.SetGpuPod(nameGpuPod, nil)
 	return nil
 }
 
-func (dsc *ServerDSController) getAndUpdateGpuPod(gpuPodUuid string, prd *PodResourcesDetail) error {
-	//get from kube-apiserver cache
-	gpuPod, err := dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), util.MetadataToName(prd.Namespace, prd.Name), metav1.GetOptions{ResourceVersion: "0"})
-	if apierrors.IsNotFound(err) {
-		gpuPod = serverdsutil.ToGpuPod(dsc.nodeName, nil, prd)
-		gpuPod, err = dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Create(context.TODO(), gpuPod, metav1.CreateOptions{})
-		if err != nil {
-			return err
-		}
-		dsc.gpuPodLock.Lock()
-		dsc.gpuPodLast[gpuPodUuid] = gpuPod
-		dsc.gpuPodLock.Unlock()
-		return nil
-	} else if err != nil {
-		return err
+// ensureGpuPod applies the spec of GpuPod owned by gpuserver-ds, it returns false if the spec is not changed.
+func (dsc *ServerDSController) ensureGpuPod(nameGpuPod string, prd *PodResourcesDetail) (bool, error) {
+	patch, err := serverdsutil.GpuPodApplyPatch(metadata.MetadataNamespace(), serverdsutil.ToGpuPodSpec(dsc.nodeName, prd))
+	if err != nil {
+		return false, err
+	}
+	dsc.gpuPodLock.RLock()
+	applied := dsc.gpuPodApplied[nameGpuPod]
+	dsc.gpuPodLock.RUnlock()
+	if applied != nil && bytes.Equal(applied.Patch, patch) {
+		return false, nil
 	}
 
-	gpuPod = serverdsutil.ToGpuPod(dsc.nodeName, gpuPod, prd)
-	gpuPod, err = dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Update(context.TODO(), gpuPod, metav1.UpdateOptions{})
+	gpuPods := dsc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace())
+	apply := func() (*gpupodv1.GpuPod, error) {
+		return gpuPods.Patch(context.TODO(), nameGpuPod, types.ApplyPatchType, patch,
+			metav1.PatchOptions{FieldManager: options.FieldManager, Force: pointer.Bool(true)})
+	}
+	gpuPod, err := apply()
 	if err != nil {
-		return err
+		return false, err
+	}
+	if applied == nil {
+		// the GpuPod written by Update before owns the keys of its spec, they are moved to the apply and applied again.
+		upgrade, err := util.UpgradeManagedFieldsPatch(gpuPod, options.FieldManager)
+		if err != nil {
+			return false, err
+		}
+		if upgrade != nil {
+			klog.Infof("node:%s upgrade the managedFields of GpuPod:%s to server-side apply", dsc.nodeName, nameGpuPod)
+			if _, err := gpuPods.Patch(context.TODO(), nameGpuPod, types.JSONPatchType, upgrade, metav1.PatchOptions{}); err != nil {
+				return false, err
+			}
+			if gpuPod, err = apply(); err != nil {
+				return false, err
+			}
+		}
 	}
+	applied = &checkpoint.GpuPod{PodResources: prd.PodResources, Patch: patch, UID: gpuPod.UID, Generation: gpuPod.Generation}
 	dsc.gpuPodLock.Lock()
-	dsc.gpuPodLast[gpuPodUuid] = gpuPod
+	dsc.gpuPodApplied[nameGpuPod] = applied
 	dsc.gpuPodLock.Unlock()
-	return nil
+	dsc.checkpoint.SetGpuPod(nameGpuPod, applied)
+	return true, nil
+}
+
+// foreignOccupied finds the devices occupied by foreign process with the last processes and pod resources.
+func (dsc *ServerDSController) foreignOccupied() map[string]*DeviceOccupation {
+	return foreignOccupation(dsc.lastProcesses, dsc.podresourcesLast, dsc.migDevices())
 }
 
-func (dsc *ServerDSController) produceNodeGpuInfoCrd() {
-	err := retry.OnError(updateBackoff,
-		func(err error) bool {
-			if err != nil {
-				return true
+// deviceHolders maps the gpu id to the containers the gpu or its MIG devices are allocated to, sorted and without duplicates.
+// A container allocated several MIG devices of a gpu holds the gpu once, or the metrics of the gpu are collected twice with the same labels.
+func deviceHolders(prm map[string]*podresourcesapi.PodResources, migDevices map[string]*MigDeviceInfo) map[string][]metrics.DeviceHolder {
+	seen := make(map[string]map[metrics.DeviceHolder]bool)
+	for _, pr := range prm {
+		for _, c := range pr.Containers {
+			for _, d := range c.Devices {
+				if !util.IsGpuResourceName(d.ResourceName) && !serverdsutil.IsMigResourceName(d.ResourceName) {
+					continue
+				}
+				for _, did := range d.DeviceIds {
+					if mig := serverdsutil.FindMigDevice(migDevices, did); mig != nil {
+						did = mig.ParentId
+					}
+					if seen[did] == nil {
+						seen[did] = make(map[metrics.DeviceHolder]bool)
+					}
+					seen[did][metrics.DeviceHolder{Namespace: pr.Namespace, Pod: pr.Name, Container: c.Name}] = true
+				}
 			}
-			return false
-		}, func() error {
-			err := dsc.ensureGpuNode()
-			if err != nil {
-				klog.Errorf("failed to ensureGpuNode err:%v", err)
+		}
+	}
+
+	holders := make(map[string][]metrics.DeviceHolder, len(seen))
+	for did, hs := range seen {
+		for h := range hs {
+			holders[did] = append(holders[did], h)
+		}
+		sort.Slice(holders[did], func(i, j int) bool {
+			a, b := holders[did][i], holders[did][j]
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
 			}
-			return err
+			if a.Pod != b.Pod {
+				return a.Pod < b.Pod
+			}
+			return a.Container < b.Container
 		})
-
-	if err == nil {
-		klog.Infof("node:%s produceNodeGpuInfoCrd notice time:%v ", dsc.nodeName, time.Now().Format(time.RFC3339))
-	} else {
-		klog.Errorf("node:%s produceNodeGpuInfoCrd err:%v", dsc.nodeName, err)
 	}
+	return holders
 }
 
-func (dsc *ServerDSController) ensureGpuNode() error {
-	if dsc.gpuNodeLast == nil {
-		return dsc.getAndUpdateGpuNode(dsc.lastNodeGpuInfo)
+// ensureGpuNode applies the spec of GpuNode owned by gpuserver-ds, it returns false if the spec is not changed.
+// It is called only by the worker of gpuNodeKey, so gpuNodeApplied is not protected.
+func (dsc *ServerDSController) ensureGpuNode(state *gpuNodeState) (bool, error) {
+	if atomic.SwapInt32(&dsc.gpuNodeResync, 0) == 1 {
+		dsc.gpuNodeVerified = false
+	}
+	if !dsc.gpuNodeVerified && dsc.gpuNodeApplied != nil {
+		gpuNode, err := dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), dsc.nodeName, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		if err != nil || !specUnchanged(gpuNode, dsc.gpuNodeApplied.UID, dsc.gpuNodeApplied.Generation) {
+			klog.Infof("node:%s GpuNode deleted or changed by others", dsc.nodeName)
+			dsc.gpuNodeApplied = nil
+		}
 	}
-	// dsc.gpuNodeLast != nil means we can update directly
-	gpuNode := serverdsutil.ToGpuNode(dsc.nodeName, dsc.gpuNodeLast, dsc.lastNodeGpuInfo, dsc.podresourcesLast)
-	gpuNode, err := dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Update(context.TODO(), gpuNode, metav1.UpdateOptions{})
+	dsc.gpuNodeVerified = true
+
+	spec := serverdsutil.ToGpuNodeSpec(state.ngi, state.prm, state.unhealthy, state.degraded, state.allocatable, state.foreign)
+	// ReportTime is not compared, it changes on each apply.
+	applied, err := serverdsutil.GpuNodeApplyPatch(dsc.nodeName, metadata.MetadataNamespace(), spec)
 	if err != nil {
-		// resource be deleted or other conflicts
-		klog.Errorf("failed to update GpuNode:%s/%s, error: %v", gpuNode.Namespace, gpuNode.Name, err)
-		return dsc.getAndUpdateGpuNode(dsc.lastNodeGpuInfo)
+		return false, err
+	}
+	if dsc.gpuNodeApplied != nil && bytes.Equal(dsc.gpuNodeApplied.Patch, applied) {
+		return false, nil
 	}
-	dsc.gpuNodeLast = gpuNode
-	return nil
-}
 
-func (dsc *ServerDSController) getAndUpdateGpuNode(ngi *NodeGpuInfo) error {
-	//get from kube-apiserver cache
-	gpuNode, err := dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), dsc.nodeName, metav1.GetOptions{ResourceVersion: "0"})
-	if apierrors.IsNotFound(err) {
-		gpuNode = serverdsutil.ToGpuNode(dsc.nodeName, dsc.gpuNodeLast, ngi, dsc.podresourcesLast)
-		gpuNode, err = dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Create(context.TODO(), gpuNode, metav1.CreateOptions{})
+	spec.ReportTime = metav1.Now()
+	patch, err := serverdsutil.GpuNodeApplyPatch(dsc.nodeName, metadata.MetadataNamespace(), spec)
+	if err != nil {
+		return false, err
+	}
+	gpuNodes := dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace())
+	apply := func() (*gpunodev1.GpuNode, error) {
+		return gpuNodes.Patch(context.TODO(), dsc.nodeName, types.ApplyPatchType, patch,
+			metav1.PatchOptions{FieldManager: options.FieldManager, Force: pointer.Bool(true)})
+	}
+	gpuNode, err := apply()
+	if err != nil {
+		return false, err
+	}
+	if dsc.gpuNodeApplied == nil {
+		// the GpuNode written by Update before owns the keys of its maps, such as a gpu gone,
+		// they are moved to the apply and applied again, so the ones not applied are removed.
+		upgrade, err := util.UpgradeManagedFieldsPatch(gpuNode, options.FieldManager)
 		if err != nil {
-			return err
+			return false, err
+		}
+		if upgrade != nil {
+			klog.Infof("node:%s upgrade the managedFields of GpuNode to server-side apply", dsc.nodeName)
+			if _, err := gpuNodes.Patch(context.TODO(), dsc.nodeName, types.JSONPatchType, upgrade, metav1.PatchOptions{}); err != nil {
+				return false, err
+			}
+			if gpuNode, err = apply(); err != nil {
+				return false, err
+			}
+		}
+		// the GpuNode may be created, the node name is written once.
+		if err := dsc.applyGpuNodeName(); err != nil {
+			return false, err
 		}
-		dsc.gpuNodeLast = gpuNode
-		return nil
-	} else if err != nil {
-		return err
 	}
+	dsc.gpuNodeApplied = &checkpoint.GpuNode{NodeGpuInfo: state.ngi, Patch: applied, UID: gpuNode.UID, Generation: gpuNode.Generation}
+	dsc.checkpoint.SetGpuNode(dsc.gpuNodeApplied)
+	return true, nil
+}
 
-	gpuNode = serverdsutil.ToGpuNode(dsc.nodeName, gpuNode, ngi, dsc.podresourcesLast)
-	gpuNode, err = dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Update(context.TODO(), gpuNode, metav1.UpdateOptions{})
+// applyGpuNodeName applies the node name into the status of GpuNode.
+func (dsc *ServerDSController) applyGpuNodeName() error {
+	patch, err := serverdsutil.GpuNodeStatusApplyPatch(dsc.nodeName, metadata.MetadataNamespace(), map[string]interface{}{"node": dsc.nodeName})
 	if err != nil {
 		return err
 	}
-	dsc.gpuNodeLast = gpuNode
-	return nil
+	_, err = dsc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Patch(context.TODO(), dsc.nodeName, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: options.NodeStatusFieldManager, Force: pointer.Bool(true)}, "status")
+	return err
+}
+
+// specUnchanged tells whether the object is the one applied with its spec not changed since then.
+// The generation is bumped only by the spec, as the status is a subresource, so the resourceVersion is not compared.
+func specUnchanged(obj metav1.Object, uid types.UID, generation int64) bool {
+	return obj != nil && obj.GetUID() == uid && obj.GetGeneration() == generation
 }
 
 // update ttlCacheGpu with node gpu info if device id is not exist
-func updateGpuInfo(did string) (*GpuInfo, error) {
+func updateGpuInfo(provider device.Provider, did string) (*GpuInfo, error) {
 	gpuinfo := ttlCacheGpu.GetCacheGpuInfoIgnoreTTL(did)
 	if gpuinfo != nil {
 		return gpuinfo, nil
@@ -424,33 +857,35 @@ func updateGpuInfo(did string) (*GpuInfo, error) {
 
 	gpuinfo = &GpuInfo{DeviceId: did, NodeName: os.Getenv("NODENAME")}
 
-	device, ret := nvml.DeviceGetHandleByUUID(did)
-	if ret != nvml.SUCCESS {
-		return gpuinfo, fmt.Errorf("DevicdId:%s DeviceGetHandleByUUID error: %v", did, nvml.ErrorString(ret))
+	d, err := provider.GetDeviceByUUID(did)
+	if err != nil {
+		return gpuinfo, fmt.Errorf("DevicdId:%s %v", did, err)
 	}
 	//brand
-	brandid, ret := device.GetBrand()
-	if ret != nvml.SUCCESS {
-		return gpuinfo, fmt.Errorf("device.GetBrand error: %v", nvml.ErrorString(ret))
+	if gpuinfo.Brand, err = d.GetBrand(); err != nil {
+		return gpuinfo, err
 	}
-	gpuinfo.Brand = brand2type[brandid]
 	//model
-	gpuinfo.Model, ret = device.GetName()
-	if ret != nvml.SUCCESS {
-		return gpuinfo, fmt.Errorf("device.GetName error: %v", nvml.ErrorString(ret))
+	if gpuinfo.Model, err = d.GetName(); err != nil {
+		return gpuinfo, err
 	}
 	//pci busid
-	pciinfo, ret := device.GetPciInfo()
-	if ret != nvml.SUCCESS {
-		return gpuinfo, fmt.Errorf("DeviceGetHandleByUUID error: %v", nvml.ErrorString(ret))
-	}
-	pciinfoBusid := make([]byte, 0, 32)
-	for _, v := range pciinfo.BusId {
-		if v != 0 {
-			pciinfoBusid = append(pciinfoBusid, byte(v))
-		}
+	if gpuinfo.BusId, err = d.GetPciBusId(); err != nil {
+		return gpuinfo, err
+	}
+	//the ones below are not supported by old drivers or gpus
+	major, minor, err := d.GetCudaComputeCapability()
+	if err != nil && device.ReturnOf(err) != nvml.ERROR_NOT_SUPPORTED {
+		return gpuinfo, err
+	} else if err == nil && major > 0 {
+		gpuinfo.ComputeCapability = fmt.Sprintf("%d.%d", major, minor)
+	}
+	if gpuinfo.Architecture, err = d.GetArchitecture(); err != nil && device.ReturnOf(err) != nvml.ERROR_NOT_SUPPORTED {
+		return gpuinfo, err
+	}
+	if gpuinfo.VbiosVersion, err = d.GetVbiosVersion(); err != nil && device.ReturnOf(err) != nvml.ERROR_NOT_SUPPORTED {
+		return gpuinfo, err
 	}
-	gpuinfo.BusId = string(pciinfoBusid)
 
 	ttlCacheGpu.SetCacheGpuInfo(did, &serverdsutil.CacheGpuInfo{GpuInfo: gpuinfo, LastUpdateTime: time.Now()})
 	klog.V(4).Infof("DevicdId:%s, refresh gpu info from ttlCacheGpu:%#v GpuInfo:%#v", did, ttlCacheGpu, *(gpuinfo))
@@ -0,0 +1,702 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpufake "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned/fake"
+	gpupodfake "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpupod/clientset/versioned/fake"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/checkpoint"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/metrics"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// applyReactor handles the server-side apply of the fake clientset as a merge patch,
+// the object is created if not found unless it is applied to a subresource.
+// The spec not applied is removed as the server does, unless the spec is owned by an Update too.
+func applyReactor(tracker k8stesting.ObjectTracker, newObj func() runtime.Object) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pa, ok := action.(k8stesting.PatchAction)
+		if !ok || pa.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj, err := tracker.Get(pa.GetResource(), pa.GetNamespace(), pa.GetName())
+		if apierrors.IsNotFound(err) {
+			if pa.GetSubresource() != "" {
+				return true, nil, err
+			}
+			obj = newObj()
+			if err := json.Unmarshal(pa.GetPatch(), obj); err != nil {
+				return true, nil, err
+			}
+			return true, obj, tracker.Create(pa.GetResource(), obj, pa.GetNamespace())
+		} else if err != nil {
+			return true, nil, err
+		}
+		current, err := json.Marshal(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		if pa.GetSubresource() == "" && !specOwnedByUpdate(obj) {
+			if current, err = jsonpatch.MergePatch(current, []byte(`{"spec":null}`)); err != nil {
+				return true, nil, err
+			}
+		}
+		merged, err := jsonpatch.MergePatch(current, pa.GetPatch())
+		if err != nil {
+			return true, nil, err
+		}
+		obj = newObj()
+		if err := json.Unmarshal(merged, obj); err != nil {
+			return true, nil, err
+		}
+		return true, obj, tracker.Update(pa.GetResource(), obj, pa.GetNamespace())
+	}
+}
+
+func specOwnedByUpdate(obj runtime.Object) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	for _, entry := range accessor.GetManagedFields() {
+		if entry.Operation == metav1.ManagedFieldsOperationUpdate && entry.Subresource == "" &&
+			entry.FieldsV1 != nil && strings.Contains(string(entry.FieldsV1.Raw), `"f:spec"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func newApplyFakeClients() (*gpufake.Clientset, *gpupodfake.Clientset) {
+	gpuClient := gpufake.NewSimpleClientset()
+	gpuClient.PrependReactor("patch", "gpunodes", applyReactor(gpuClient.Tracker(), func() runtime.Object { return &gpunodev1.GpuNode{} }))
+	gpuPodClient := gpupodfake.NewSimpleClientset()
+	gpuPodClient.PrependReactor("patch", "gpupods", applyReactor(gpuPodClient.Tracker(), func() runtime.Object { return &gpupodv1.GpuPod{} }))
+	// the fake lists by the group of the clientset, which is not the group the types are registered with.
+	gpuPodClient.PrependReactor("list", "gpupods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj, err := gpuPodClient.Tracker().List(action.GetResource(), gpupodv1.GroupVersion.WithKind("GpuPod"), action.GetNamespace())
+		return true, obj, err
+	})
+	return gpuClient, gpuPodClient
+}
+
+func TestFileterPodResourceMig(t *testing.T) {
+	migDevices := map[string]*MigDeviceInfo{
+		"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-0", Profile: "1g.5gb", GpuInstanceId: 7, ComputeInstanceId: 0},
+		"MIG-1": {DeviceId: "MIG-1", ParentId: "GPU-0", Profile: "3g.20gb", GpuInstanceId: 2, ComputeInstanceId: 0},
+	}
+	var tests = []struct {
+		name    string
+		devices []*podresourcesapi.ContainerDevices
+		want    []string
+	}{
+		{
+			name:    "mixed strategy",
+			devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: []string{"MIG-0"}}},
+			want:    []string{"1g.5gb/MIG-0"},
+		},
+		{
+			name:    "mixed strategy with legacy device id",
+			devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-3g.20gb", DeviceIds: []string{"MIG-GPU-0/2/0"}}},
+			want:    []string{"3g.20gb/MIG-1"},
+		},
+		{
+			name:    "single strategy",
+			devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"MIG-GPU-0/7/0", "MIG-1"}}},
+			want:    []string{"1g.5gb/MIG-0", "3g.20gb/MIG-1"},
+		},
+		{
+			name:    "MIG device unknown",
+			devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-2g.10gb", DeviceIds: []string{"MIG-2"}}},
+			want:    []string{"2g.10gb/MIG-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prlist := []*podresourcesapi.PodResources{{Name: "pod", Namespace: "default",
+				Containers: []*podresourcesapi.ContainerResources{{Name: "c", Devices: tt.devices}}}}
+			prds := fileterPodResource(nil, migDevices, prlist)
+			if len(prds) != 1 || len(*prds[0].ContainerDevices) != 1 {
+				t.Fatalf("unexpected pod resources detail: %v", prds)
+			}
+			crd := (*prds[0].ContainerDevices)[0]
+			if len(crd.DeviceInfo) != 0 || len(crd.MigDeviceInfo) != len(tt.want) {
+				t.Fatalf("unexpected container devices: %#v", crd)
+			}
+			for i, mig := range crd.MigDeviceInfo {
+				if got := mig.Profile + "/" + mig.DeviceId; got != tt.want[i] {
+					t.Errorf("MigDeviceInfo[%d] = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceHolders(t *testing.T) {
+	migDevices := map[string]*MigDeviceInfo{
+		"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-1", Profile: "1g.5gb", GpuInstanceId: 7, ComputeInstanceId: 0},
+	}
+	prm := map[string]*podresourcesapi.PodResources{
+		"default/pod1": {Name: "pod1", Namespace: "default", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c1", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"}}}},
+			{Name: "c2", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: []string{"MIG-0"}}}},
+			{Name: "c3", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "example.com/fpga", DeviceIds: []string{"FPGA-0"}}}},
+		}},
+	}
+	holders := deviceHolders(prm, migDevices)
+	if len(holders) != 2 {
+		t.Fatalf("deviceHolders() = %v, want GPU-0 and GPU-1", holders)
+	}
+	if got := holders["GPU-0"]; len(got) != 1 || got[0].Pod != "pod1" || got[0].Container != "c1" {
+		t.Errorf("holders of GPU-0 = %v", got)
+	}
+	if got := holders["GPU-1"]; len(got) != 1 || got[0].Namespace != "default" || got[0].Container != "c2" {
+		t.Errorf("holders of GPU-1 = %v", got)
+	}
+}
+
+func TestDeviceHoldersMigDevicesOfOneGpu(t *testing.T) {
+	migDevices := map[string]*MigDeviceInfo{
+		"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-0", Profile: "1g.5gb", GpuInstanceId: 7, ComputeInstanceId: 0},
+		"MIG-1": {DeviceId: "MIG-1", ParentId: "GPU-0", Profile: "1g.5gb", GpuInstanceId: 8, ComputeInstanceId: 0},
+		"MIG-2": {DeviceId: "MIG-2", ParentId: "GPU-0", Profile: "1g.5gb", GpuInstanceId: 9, ComputeInstanceId: 0},
+	}
+	mig := func(dids ...string) []*podresourcesapi.ContainerDevices {
+		return []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: dids}}
+	}
+	prm := map[string]*podresourcesapi.PodResources{
+		"default/pod1": {Name: "pod1", Namespace: "default", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c", Devices: mig("MIG-0", "MIG-1")},
+		}},
+		"default/pod2": {Name: "pod2", Namespace: "default", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c", Devices: mig("MIG-2")},
+		}},
+	}
+	want := map[string][]metrics.DeviceHolder{"GPU-0": {
+		{Namespace: "default", Pod: "pod1", Container: "c"},
+		{Namespace: "default", Pod: "pod2", Container: "c"},
+	}}
+	holders := deviceHolders(prm, migDevices)
+	if !reflect.DeepEqual(holders, want) {
+		t.Errorf("deviceHolders() = %v, want %v", holders, want)
+	}
+
+	// the metrics of the gpu are gathered once for each holder.
+	store := metrics.NewStore()
+	store.SetNodeState(&NodeGpuInfo{GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}}}, nil, nil, holders)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewCollector(store))
+	if _, err := registry.Gather(); err != nil {
+		t.Errorf("Gather() err = %v", err)
+	}
+}
+
+func TestServerDSControllerQueue(t *testing.T) {
+	gpuClient, gpuPodClient := newApplyFakeClients()
+	dsc := &ServerDSController{
+		nodeName:      "node-queue",
+		gpuClient:     gpuClient,
+		gpuPodClient:  gpuPodClient,
+		gpuPodApplied: make(map[string]*checkpoint.GpuPod),
+		checkpoint:    checkpoint.NewManager("", "node-queue"),
+		gpuPodDesired: make(map[string]*PodResourcesDetail),
+		queue:         newWorkQueue(),
+	}
+	defer dsc.queue.ShutDown()
+
+	// fail the first apply of GpuPod.
+	failed := false
+	gpuPodClient.PrependReactor("patch", "gpupods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failed {
+			return false, nil, nil
+		}
+		failed = true
+		return true, nil, fmt.Errorf("apply failed")
+	})
+
+	prd := func(name string) *PodResourcesDetail {
+		cds := []*ContainerResourcesDetail{{Name: "c", DeviceInfo: []*GpuInfo{{DeviceId: "GPU-0"}}}}
+		return &PodResourcesDetail{PodResources: &podresourcesapi.PodResources{Namespace: "default", Name: name}, ContainerDevices: &cds}
+	}
+	getGpuPod := func(name string) error {
+		_, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		return err
+	}
+
+	// a burst of changes of the same pod is coalesced, the pod deleted at last is not created.
+	dsc.enqueueGpuPod("default-pod1", prd("pod1"))
+	dsc.enqueueGpuPod("default-pod1", nil)
+	dsc.enqueueGpuPod("default-pod2", prd("pod2"))
+	dsc.enqueueGpuPod("default-pod2", prd("pod2"))
+	dsc.lastNodeGpuInfo = &NodeGpuInfo{NodeName: "node-queue", GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}}}
+	dsc.podresourcesLast = map[string]*podresourcesapi.PodResources{}
+	dsc.enqueueGpuNode()
+	if got := dsc.queue.Len(); got != 3 {
+		t.Fatalf("queue.Len() = %d, want 3", got)
+	}
+	for i := 0; i < 3; i++ {
+		dsc.processNextWorkItem()
+	}
+
+	if err := getGpuPod("default-pod1"); !apierrors.IsNotFound(err) {
+		t.Errorf("GpuPod default-pod1 err = %v, want not found", err)
+	}
+	if err := getGpuPod("default-pod2"); !apierrors.IsNotFound(err) {
+		t.Errorf("GpuPod default-pod2 err = %v, want not found before retry", err)
+	}
+	if got := dsc.queue.NumRequeues("default-pod2"); got != 1 {
+		t.Errorf("NumRequeues(default-pod2) = %d, want 1", got)
+	}
+	if _, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-queue", metav1.GetOptions{}); err != nil {
+		t.Errorf("GpuNode err = %v", err)
+	}
+
+	// the rate-limited retry of default-pod2.
+	dsc.processNextWorkItem()
+	if err := getGpuPod("default-pod2"); err != nil {
+		t.Errorf("GpuPod default-pod2 err = %v after retry", err)
+	}
+	if got := dsc.queue.NumRequeues("default-pod2"); got != 0 {
+		t.Errorf("NumRequeues(default-pod2) = %d after retry, want 0", got)
+	}
+
+	dsc.enqueueGpuPod("default-pod2", nil)
+	dsc.processNextWorkItem()
+	if err := getGpuPod("default-pod2"); !apierrors.IsNotFound(err) {
+		t.Errorf("GpuPod default-pod2 err = %v after delete, want not found", err)
+	}
+}
+
+func TestServerDSControllerApply(t *testing.T) {
+	gpuClient, gpuPodClient := newApplyFakeClients()
+	dsc := &ServerDSController{
+		nodeName:      "node-apply",
+		gpuClient:     gpuClient,
+		gpuPodClient:  gpuPodClient,
+		gpuPodApplied: make(map[string]*checkpoint.GpuPod),
+		checkpoint:    checkpoint.NewManager("", "node-apply"),
+	}
+	countPatches := func() (n int) {
+		for _, action := range append(gpuClient.Actions(), gpuPodClient.Actions()...) {
+			if pa, ok := action.(k8stesting.PatchAction); ok {
+				if pa.GetPatchType() != types.ApplyPatchType {
+					t.Errorf("patch type = %s, want apply", pa.GetPatchType())
+				}
+				n++
+			}
+		}
+		return n
+	}
+
+	state := &gpuNodeState{
+		ngi: &NodeGpuInfo{NodeName: "node-apply", GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}, "GPU-1": {DeviceId: "GPU-1"}}},
+		prm: map[string]*podresourcesapi.PodResources{
+			"default/pod1": {Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+				{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-1"}}}}}},
+		},
+	}
+	if applied, err := dsc.ensureGpuNode(state); err != nil || !applied {
+		t.Fatalf("ensureGpuNode() = %v, %v, want applied", applied, err)
+	}
+	// nothing changed but the time.
+	if applied, err := dsc.ensureGpuNode(state); err != nil || applied {
+		t.Fatalf("ensureGpuNode() unchanged = %v, %v, want skipped", applied, err)
+	}
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-apply", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gpuNode.Spec.GpuInfos) != 2 || len(gpuNode.Spec.NodeDeviceInUse) != 1 || gpuNode.Spec.ReportTime.IsZero() {
+		t.Errorf("unexpected GpuNode spec: %#v", gpuNode.Spec)
+	}
+
+	cds := []*ContainerResourcesDetail{{Name: "c", DeviceInfo: []*GpuInfo{{DeviceId: "GPU-1"}}}}
+	prd := &PodResourcesDetail{PodResources: state.prm["default/pod1"], ContainerDevices: &cds}
+	for i := 0; i < 2; i++ {
+		if _, err := dsc.ensureGpuPod("default-pod1", prd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gpuPod, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gpuPod.Labels[options.GPUPOD_ANNOTATION_TAG_Node] != "node-apply" || gpuPod.Spec.Name != "pod1" || len(gpuPod.Spec.ContainerDevices) != 1 {
+		t.Errorf("unexpected GpuPod: %#v", gpuPod)
+	}
+	// the node name is applied into the status of GpuNode created.
+	if n := countPatches(); n != 3 {
+		t.Errorf("got %d applies, want 3 with the unchanged skipped", n)
+	}
+}
+
+func TestServerDSControllerUpgradeManagedFields(t *testing.T) {
+	gpuClient, gpuPodClient := newApplyFakeClients()
+	dsc := &ServerDSController{
+		nodeName:      "node-upgrade",
+		gpuClient:     gpuClient,
+		gpuPodClient:  gpuPodClient,
+		gpuPodApplied: make(map[string]*checkpoint.GpuPod),
+		checkpoint:    checkpoint.NewManager("", "node-upgrade"),
+	}
+	// the objects written by Update before server-side apply, the labels are set by others.
+	managedFields := func(specFields string) []metav1.ManagedFieldsEntry {
+		return []metav1.ManagedFieldsEntry{
+			{Manager: "gpuserver-ds", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: "resources.scheduler.caden2016.github.io/v1",
+				FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{".":{},` + specFields + `}}`)}},
+			{Manager: "kubectl-label", Operation: metav1.ManagedFieldsOperationUpdate, APIVersion: "resources.scheduler.caden2016.github.io/v1",
+				FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{".":{},"f:team":{}}}}`)}},
+		}
+	}
+	wantUpgraded := func(kind string, entries []metav1.ManagedFieldsEntry) {
+		t.Helper()
+		var managers []string
+		for _, entry := range entries {
+			managers = append(managers, entry.Manager+"/"+string(entry.Operation))
+		}
+		if want := []string{"kubectl-label/Update", "gpuserver-ds/Apply"}; !reflect.DeepEqual(managers, want) {
+			t.Errorf("managedFields of %s = %v, want %v", kind, managers, want)
+		}
+	}
+
+	_, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Create(context.TODO(), &gpunodev1.GpuNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-upgrade", Namespace: metadata.MetadataNamespace(), ResourceVersion: "1",
+			Labels: map[string]string{"team": "ml"}, ManagedFields: managedFields(`"f:device_infos":{".":{},"f:GPU-0":{},"f:GPU-1":{}}`)},
+		Spec: gpunodev1.GpuNodeSpec{GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}, "GPU-1": {DeviceId: "GPU-1"}}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// GPU-1 is gone since then.
+	state := &gpuNodeState{
+		ngi: &NodeGpuInfo{NodeName: "node-upgrade", GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}}},
+		prm: map[string]*podresourcesapi.PodResources{},
+	}
+	if _, err := dsc.ensureGpuNode(state); err != nil {
+		t.Fatal(err)
+	}
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-upgrade", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exist := gpuNode.Spec.GpuInfos["GPU-1"]; exist || len(gpuNode.Spec.GpuInfos) != 1 {
+		t.Errorf("GpuNode device_infos = %v, want GPU-1 removed", gpuNode.Spec.GpuInfos)
+	}
+	if gpuNode.Labels["team"] != "ml" {
+		t.Errorf("GpuNode labels = %v, want the label of others kept", gpuNode.Labels)
+	}
+	wantUpgraded("GpuNode", gpuNode.ManagedFields)
+
+	_, err = gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Create(context.TODO(), &gpupodv1.GpuPod{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-pod1", Namespace: metadata.MetadataNamespace(), ResourceVersion: "1",
+			ManagedFields: managedFields(`"f:containers_device":{},"f:pod_name":{},"f:pod_namespace":{}`)},
+		Spec: gpupodv1.GpuPodSpec{Namespace: "default", Name: "pod1"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cds := []*ContainerResourcesDetail{{Name: "c", DeviceInfo: []*GpuInfo{{DeviceId: "GPU-0"}}}}
+	prd := &PodResourcesDetail{PodResources: &podresourcesapi.PodResources{Namespace: "default", Name: "pod1"}, ContainerDevices: &cds}
+	if _, err := dsc.ensureGpuPod("default-pod1", prd); err != nil {
+		t.Fatal(err)
+	}
+	gpuPod, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUpgraded("GpuPod", gpuPod.ManagedFields)
+}
+
+func TestServerDSControllerResync(t *testing.T) {
+	gpuClient, gpuPodClient := newApplyFakeClients()
+	dsc := &ServerDSController{
+		nodeName:      "node-resync",
+		gpuClient:     gpuClient,
+		gpuPodClient:  gpuPodClient,
+		gpuPodApplied: make(map[string]*checkpoint.GpuPod),
+		checkpoint:    checkpoint.NewManager("", "node-resync"),
+		gpuPodDesired: make(map[string]*PodResourcesDetail),
+		queue:         newWorkQueue(),
+	}
+	defer dsc.queue.ShutDown()
+	processAll := func() {
+		t.Helper()
+		for n := dsc.queue.Len(); n > 0; n-- {
+			dsc.processNextWorkItem()
+		}
+	}
+	getGpuNode := func() (*gpunodev1.GpuNode, error) {
+		return gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-resync", metav1.GetOptions{})
+	}
+	getGpuPod := func() error {
+		_, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+		return err
+	}
+
+	dsc.lastNodeGpuInfo = &NodeGpuInfo{NodeName: "node-resync", GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}},
+		MigDevices: map[string]*MigDeviceInfo{"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-0", Profile: "1g.5gb", GpuInstanceId: 7}}}
+	pr := &podresourcesapi.PodResources{Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: []string{"MIG-0"}}}}}}
+	dsc.podresourcesLast = map[string]*podresourcesapi.PodResources{"default/pod1": pr}
+	dsc.enqueueGpuPod("default-pod1", fileterPodResource(nil, dsc.migDevices(), []*podresourcesapi.PodResources{pr})[0])
+	dsc.enqueueGpuNode()
+	processAll()
+	gpuNode, err := getGpuNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gpuNode.Status.NodeName != "node-resync" {
+		t.Errorf("GpuNode status.node = %q, want node-resync", gpuNode.Status.NodeName)
+	}
+	if err := getGpuPod(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ones deleted by others are not applied again without the resync, as nothing changed.
+	if err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Delete(context.TODO(), "node-resync", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Delete(context.TODO(), "default-pod1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dsc.enqueueGpuNode()
+	processAll()
+	if _, err := getGpuNode(); !apierrors.IsNotFound(err) {
+		t.Fatalf("GpuNode err = %v before resync, want not found", err)
+	}
+
+	dsc.resync()
+	processAll()
+	gpuNode, err = getGpuNode()
+	if err != nil {
+		t.Fatalf("GpuNode err = %v after resync", err)
+	}
+	if gpuNode.Status.NodeName != "node-resync" {
+		t.Errorf("GpuNode status.node = %q after resync, want node-resync", gpuNode.Status.NodeName)
+	}
+	if err := getGpuPod(); err != nil {
+		t.Errorf("GpuPod err = %v after resync", err)
+	}
+}
+
+func TestServerDSControllerRestore(t *testing.T) {
+	gpuClient, gpuPodClient := newApplyFakeClients()
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	newController := func() *ServerDSController {
+		cm := checkpoint.NewManager(path, "node-restore")
+		dsc := &ServerDSController{
+			nodeName:      "node-restore",
+			gpuClient:     gpuClient,
+			gpuPodClient:  gpuPodClient,
+			gpuPodApplied: make(map[string]*checkpoint.GpuPod),
+			checkpoint:    cm,
+		}
+		data, err := cm.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != nil {
+			dsc.restore(data)
+		}
+		return dsc
+	}
+
+	pr := &podresourcesapi.PodResources{Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"}}}}}}
+	state := &gpuNodeState{
+		ngi: &NodeGpuInfo{NodeName: "node-restore", GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}}},
+		prm: map[string]*podresourcesapi.PodResources{"default/pod1": pr},
+	}
+	cds := []*ContainerResourcesDetail{{Name: "c", DeviceInfo: []*GpuInfo{{DeviceId: "GPU-0"}}}}
+	prd := &PodResourcesDetail{PodResources: pr, ContainerDevices: &cds}
+
+	dsc := newController()
+	if _, err := dsc.ensureGpuNode(state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dsc.ensureGpuPod("default-pod1", prd); err != nil {
+		t.Fatal(err)
+	}
+	if err := dsc.checkpoint.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the status written by the other field managers changes the resourceVersion only.
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-restore", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpuNode.ResourceVersion = "999"
+	gpuNode.Status.Conditions = []metav1.Condition{{Type: gpunodev1.GpuNodeAgentLeaseFresh, Status: metav1.ConditionTrue}}
+	if _, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).UpdateStatus(context.TODO(), gpuNode, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	gpuPod, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpuPod.ResourceVersion = "1000"
+	gpuPod.Status.MissingDevices = []string{"GPU-0"}
+	if _, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).UpdateStatus(context.TODO(), gpuPod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// a partial entry in the checkpoint is skipped.
+	dsc.checkpoint.SetGpuPod("default-partial", &checkpoint.GpuPod{Patch: json.RawMessage(`{}`)})
+	if err := dsc.checkpoint.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart with nothing changed.
+	dsc = newController()
+	if _, exist := dsc.gpuPodApplied["default-partial"]; exist {
+		t.Errorf("partial GpuPod restored from checkpoint")
+	}
+	if dsc.podresourcesLast["default/pod1"] == nil || dsc.lastNodeGpuInfo == nil {
+		t.Fatalf("state not restored: %v, %v", dsc.podresourcesLast, dsc.lastNodeGpuInfo)
+	}
+	if applied, err := dsc.ensureGpuNode(state); err != nil || applied {
+		t.Errorf("ensureGpuNode() after restart = %v, %v, want skipped", applied, err)
+	}
+	if applied, err := dsc.ensureGpuPod("default-pod1", prd); err != nil || applied {
+		t.Errorf("ensureGpuPod() after restart = %v, %v, want skipped", applied, err)
+	}
+
+	// restart with the GpuNode deleted by others.
+	if err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Delete(context.TODO(), "node-restore", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dsc = newController()
+	if applied, err := dsc.ensureGpuNode(state); err != nil || !applied {
+		t.Errorf("ensureGpuNode() after deleted = %v, %v, want applied", applied, err)
+	}
+}
+
+// fakePodResourcesClient fails the lists with the errors in order, then lists the pod resources.
+// The condition PodResourcesReady seen by each list is recorded.
+type fakePodResourcesClient struct {
+	conditions *NodeConditionController
+	lock       sync.Mutex
+	errs       []error
+	prlist     []*podresourcesapi.PodResources
+	seen       []string
+}
+
+func (c *fakePodResourcesClient) List(context.Context) ([]*podresourcesapi.PodResources, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	seen := "unset"
+	if cond := c.conditions.GetCondition(gpunodev1.GpuNodePodResourcesReady); cond != nil {
+		seen = cond.Reason
+	}
+	c.seen = append(c.seen, seen)
+	if len(c.errs) != 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	return c.prlist, nil
+}
+
+func (c *fakePodResourcesClient) GetAllocatableResources(context.Context) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return nil, podresources.ErrAllocatableUnsupported
+}
+
+func (c *fakePodResourcesClient) Version() string { return podresources.VersionV1 }
+
+func (c *fakePodResourcesClient) Close() error { return nil }
+
+func TestServerDSControllerPodResourcesUnavailable(t *testing.T) {
+	t.Setenv("NODENAME", "node-unavailable")
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	if err := os.WriteFile(inventory, []byte("devices:\n- uuid: GPU-unavailable-0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	gpuClient, gpuPodClient := newApplyFakeClients()
+	ncc, err := NewNodeConditionController(gpuClient, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr := &podresourcesapi.PodResources{Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-unavailable-0"}}}}}}
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	prclient := &fakePodResourcesClient{conditions: ncc, errs: []error{unavailable, unavailable}, prlist: []*podresourcesapi.PodResources{pr}}
+	dsc := &ServerDSController{
+		stop:      stop,
+		provider:  provider,
+		nodeName:  "node-unavailable",
+		prclient:  prclient,
+		prBackoff: wait.Backoff{Duration: 10 * time.Millisecond, Factor: 2, Steps: math.MaxInt32},
+		// the relists triggered while unavailable are ignored.
+		relistInterval: time.Millisecond,
+		gpuClient:      gpuClient,
+		gpuPodClient:   gpuPodClient,
+		gpuPodApplied:  make(map[string]*checkpoint.GpuPod),
+		checkpoint:     checkpoint.NewManager("", "node-unavailable"),
+		gpuPodDesired:  make(map[string]*PodResourcesDetail),
+		queue:          newWorkQueue(),
+		conditions:     ncc,
+		// the pod is known before kubelet restarted, it is produced again after reconnected though not changed.
+		podresourcesLast: map[string]*podresourcesapi.PodResources{"default/pod1": pr},
+	}
+	start := time.Now()
+	if err := dsc.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("GpuPod default-pod1 not produced after reconnected: %v", err)
+	}
+	// only the retries of 10ms and 20ms list before reconnected.
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("reconnected after %v, want the retries after the backoff", elapsed)
+	}
+	prclient.lock.Lock()
+	seen := prclient.seen
+	prclient.lock.Unlock()
+	want := []string{"unset", gpunodev1.GpuNodePodResourcesUnavailable, gpunodev1.GpuNodePodResourcesUnavailable}
+	if len(seen) < len(want) || !reflect.DeepEqual(seen[:len(want)], want) {
+		t.Errorf("conditions seen by the lists = %v, want %v first", seen, want)
+	}
+	if cond := ncc.GetCondition(gpunodev1.GpuNodePodResourcesReady); cond == nil || cond.Status != metav1.ConditionTrue {
+		t.Errorf("condition PodResourcesReady = %v, want True", cond)
+	}
+}
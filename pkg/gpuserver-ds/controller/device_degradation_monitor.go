@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// DegradationPolicy are the thresholds of the memory error counters to degrade a gpu, 0 disables the threshold.
+// The gpu with pages pending retirement or rows pending remapping needs reset regardless of the thresholds,
+// and the one failed to remap rows is degraded.
+type DegradationPolicy struct {
+	// CorrectableEccThreshold and UncorrectableEccThreshold are the aggregate ECC errors over the lifetime of the gpu.
+	CorrectableEccThreshold   uint64
+	UncorrectableEccThreshold uint64
+	// RetiredPagesThreshold is the pages retired of both causes.
+	RetiredPagesThreshold int
+	// RemappedRowsThreshold is the rows remapped for the uncorrectable errors.
+	RemappedRowsThreshold int
+}
+
+// MemoryErrorCounters are the memory error counters of a gpu, the ones not supported are zero.
+type MemoryErrorCounters struct {
+	CorrectableEcc      uint64
+	UncorrectableEcc    uint64
+	RetiredPages        int
+	RetiredPagesPending bool
+	RemappedRows        device.RemappedRows
+}
+
+func NewDeviceDegradationMonitor(provider device.Provider, policy DegradationPolicy, checkInterval time.Duration, stop <-chan struct{}) *DeviceDegradationMonitor {
+	return &DeviceDegradationMonitor{
+		provider:        provider,
+		policy:          policy,
+		checkInterval:   checkInterval,
+		stop:            stop,
+		degradationChan: make(chan map[string]*DeviceDegradation),
+	}
+}
+
+// DeviceDegradationMonitor reads the memory error counters of each gpu each interval, such as the ECC errors,
+// the retired pages and the remapped rows, which rise before the gpu fails with Xid errors.
+// The gpus are evaluated by the policy, and it signals the degraded gpus when they change.
+type DeviceDegradationMonitor struct {
+	provider        device.Provider
+	policy          DegradationPolicy
+	checkInterval   time.Duration
+	stop            <-chan struct{}
+	degradationChan chan map[string]*DeviceDegradation
+	degradedLast    map[string]*DeviceDegradation
+}
+
+func (ddm *DeviceDegradationMonitor) Start() error {
+	if ddm.checkInterval <= 0 {
+		klog.Infof("DeviceDegradationMonitor disabled")
+		return nil
+	}
+
+	go func() {
+		klog.Infof("DeviceDegradationMonitor started with check interval:%v policy:%+v", ddm.checkInterval, ddm.policy)
+		ticker := time.NewTicker(ddm.checkInterval)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-ticker.C:
+				degraded := ddm.checkDevices()
+				if degraded == nil || reflect.DeepEqual(ddm.degradedLast, degraded) {
+					continue
+				}
+				klog.Infof("DeviceDegradationMonitor %d devices degraded", len(degraded))
+				ddm.degradedLast = degraded
+				select {
+				case ddm.degradationChan <- degraded:
+				case <-ddm.stop:
+					break LOOP
+				}
+
+			case <-ddm.stop:
+				break LOOP
+			}
+		}
+		klog.Infof("DeviceDegradationMonitor stopped")
+	}()
+	return nil
+}
+
+// checkDevices evaluates all the devices, nil is returned if the devices can not be counted.
+// The device which can not be got is skipped, the gpu lost is reported by the inventory.
+// A gpu staying in the same state keeps the time it entered the state.
+func (ddm *DeviceDegradationMonitor) checkDevices() map[string]*DeviceDegradation {
+	count, err := ddm.provider.GetDeviceCount()
+	if err != nil {
+		klog.Errorf("checkDevices unable to get device count: %v", err)
+		return nil
+	}
+
+	degraded := make(map[string]*DeviceDegradation)
+	for i := 0; i < count; i++ {
+		d, err := ddm.provider.GetDeviceByIndex(i)
+		if err != nil {
+			klog.Errorf("checkDevices unable to get device at index %d: %v", i, err)
+			continue
+		}
+		did, err := d.GetUUID()
+		if err != nil {
+			klog.Errorf("checkDevices unable to get device uuid at index %d: %v", i, err)
+			continue
+		}
+		counters := readMemoryErrorCounters(did, d)
+		state, reasons := evaluateDegradation(counters, ddm.policy)
+		if state == "" {
+			continue
+		}
+		dd := &DeviceDegradation{State: state, Reasons: reasons, Since: metav1.Now()}
+		last := ddm.degradedLast[did]
+		if last != nil && last.State == state {
+			dd.Since = last.Since
+		}
+		if last == nil || last.State != state || !reflect.DeepEqual(last.Reasons, reasons) {
+			klog.Warningf("DevicdId:%s %s by %v, counters: %+v", did, state, reasons, counters)
+		}
+		degraded[did] = dd
+	}
+	return degraded
+}
+
+// readMemoryErrorCounters reads the counters of the device, the ones not supported or failed are zero.
+// Such as the gpus without ECC enabled, or the page retirement replaced by the row remapping since Ampere.
+func readMemoryErrorCounters(did string, d device.Device) MemoryErrorCounters {
+	var counters MemoryErrorCounters
+	logErr := func(counter string, err error) {
+		if device.ReturnOf(err) != nvml.ERROR_NOT_SUPPORTED {
+			klog.Errorf("DevicdId:%s unable to read %s: %v", did, counter, err)
+		}
+	}
+
+	var err error
+	if counters.CorrectableEcc, err = d.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_CORRECTED); err != nil {
+		logErr("correctable ecc errors", err)
+	}
+	if counters.UncorrectableEcc, err = d.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED); err != nil {
+		logErr("uncorrectable ecc errors", err)
+	}
+	for _, cause := range []nvml.PageRetirementCause{nvml.PAGE_RETIREMENT_CAUSE_MULTIPLE_SINGLE_BIT_ECC_ERRORS, nvml.PAGE_RETIREMENT_CAUSE_DOUBLE_BIT_ECC_ERROR} {
+		pages, err := d.GetRetiredPages(cause)
+		if err != nil {
+			logErr("retired pages", err)
+			break
+		}
+		counters.RetiredPages += len(pages)
+	}
+	if counters.RetiredPagesPending, err = d.GetRetiredPagesPendingStatus(); err != nil {
+		logErr("retired pages pending status", err)
+	}
+	if counters.RemappedRows, err = d.GetRemappedRows(); err != nil {
+		logErr("remapped rows", err)
+	}
+	return counters
+}
+
+// evaluateDegradation gets the state and the reasons of the gpu by the policy, empty state means it is not degraded.
+// NeedsReset takes precedence over Degraded, the reasons of both are returned.
+func evaluateDegradation(counters MemoryErrorCounters, policy DegradationPolicy) (state string, reasons []string) {
+	if counters.RetiredPagesPending {
+		reasons = append(reasons, DegradationReasonRetiredPagesPending)
+	}
+	if counters.RemappedRows.Pending {
+		reasons = append(reasons, DegradationReasonRowRemapPending)
+	}
+	if len(reasons) != 0 {
+		state = DeviceNeedsReset
+	}
+
+	if policy.CorrectableEccThreshold > 0 && counters.CorrectableEcc >= policy.CorrectableEccThreshold {
+		reasons = append(reasons, DegradationReasonCorrectableEcc)
+	}
+	if policy.UncorrectableEccThreshold > 0 && counters.UncorrectableEcc >= policy.UncorrectableEccThreshold {
+		reasons = append(reasons, DegradationReasonUncorrectableEcc)
+	}
+	if policy.RetiredPagesThreshold > 0 && counters.RetiredPages >= policy.RetiredPagesThreshold {
+		reasons = append(reasons, DegradationReasonRetiredPages)
+	}
+	if policy.RemappedRowsThreshold > 0 && counters.RemappedRows.Uncorrectable >= policy.RemappedRowsThreshold {
+		reasons = append(reasons, DegradationReasonRemappedRows)
+	}
+	if counters.RemappedRows.Failure {
+		reasons = append(reasons, DegradationReasonRowRemapFailure)
+	}
+	if state == "" && len(reasons) != 0 {
+		state = DeviceDegraded
+	}
+	return
+}
+
+func (ddm *DeviceDegradationMonitor) GetDegradationChan() <-chan map[string]*DeviceDegradation {
+	return ddm.degradationChan
+}
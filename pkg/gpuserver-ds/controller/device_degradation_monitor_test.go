@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+)
+
+func TestEvaluateDegradation(t *testing.T) {
+	policy := DegradationPolicy{CorrectableEccThreshold: 100, RetiredPagesThreshold: 60}
+	var tests = []struct {
+		name        string
+		counters    MemoryErrorCounters
+		policy      DegradationPolicy
+		wantState   string
+		wantReasons []string
+	}{
+		{
+			name:     "under thresholds",
+			counters: MemoryErrorCounters{CorrectableEcc: 99, UncorrectableEcc: 5, RetiredPages: 59},
+			policy:   policy,
+		},
+		{
+			name:        "over thresholds",
+			counters:    MemoryErrorCounters{CorrectableEcc: 100, RetiredPages: 60},
+			policy:      policy,
+			wantState:   DeviceDegraded,
+			wantReasons: []string{DegradationReasonCorrectableEcc, DegradationReasonRetiredPages},
+		},
+		{
+			name:     "thresholds disabled",
+			counters: MemoryErrorCounters{CorrectableEcc: 1000, RetiredPages: 100},
+		},
+		{
+			name:        "row remap failure",
+			counters:    MemoryErrorCounters{RemappedRows: device.RemappedRows{Uncorrectable: 8, Failure: true}},
+			policy:      DegradationPolicy{RemappedRowsThreshold: 8},
+			wantState:   DeviceDegraded,
+			wantReasons: []string{DegradationReasonRemappedRows, DegradationReasonRowRemapFailure},
+		},
+		{
+			name:        "pending needs reset",
+			counters:    MemoryErrorCounters{RetiredPagesPending: true, RemappedRows: device.RemappedRows{Pending: true}},
+			wantState:   DeviceNeedsReset,
+			wantReasons: []string{DegradationReasonRetiredPagesPending, DegradationReasonRowRemapPending},
+		},
+		{
+			name:        "needs reset over degraded",
+			counters:    MemoryErrorCounters{RetiredPages: 61, RetiredPagesPending: true},
+			policy:      policy,
+			wantState:   DeviceNeedsReset,
+			wantReasons: []string{DegradationReasonRetiredPagesPending, DegradationReasonRetiredPages},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, reasons := evaluateDegradation(tt.counters, tt.policy)
+			if state != tt.wantState || !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("evaluateDegradation() = %q %v, want %q %v", state, reasons, tt.wantState, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestDeviceDegradationMonitorCheckDevices(t *testing.T) {
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "inventory.yaml")
+	writeInventory := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(inventory, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// GPU-1 does not support the page retirement, which is not an error.
+	writeInventory(`
+devices:
+- uuid: GPU-0
+  ecc_errors: {corrected: 10}
+  retired_pages: {multiple_single_bit: [1, 2], double_bit: [3]}
+- uuid: GPU-1
+  remapped_rows: {pending: true}
+  errors:
+    GetRetiredPages: ERROR_NOT_SUPPORTED
+    GetRetiredPagesPendingStatus: ERROR_NOT_SUPPORTED
+`)
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ddm := NewDeviceDegradationMonitor(provider, DegradationPolicy{RetiredPagesThreshold: 3}, 0, nil)
+	degraded := ddm.checkDevices()
+	if len(degraded) != 2 || degraded["GPU-0"].State != DeviceDegraded || degraded["GPU-1"].State != DeviceNeedsReset {
+		t.Fatalf("checkDevices() = %v, want GPU-0 Degraded and GPU-1 NeedsReset", degraded)
+	}
+	if !reflect.DeepEqual(degraded["GPU-0"].Reasons, []string{DegradationReasonRetiredPages}) {
+		t.Errorf("GPU-0 reasons = %v, want [%s]", degraded["GPU-0"].Reasons, DegradationReasonRetiredPages)
+	}
+	ddm.degradedLast = degraded
+
+	// the state kept keeps the time it entered, the gpu reset is not degraded any more.
+	writeInventory(`
+devices:
+- uuid: GPU-0
+  ecc_errors: {corrected: 10}
+  retired_pages: {multiple_single_bit: [1, 2, 4], double_bit: [3]}
+- uuid: GPU-1
+`)
+	next := ddm.checkDevices()
+	if len(next) != 1 || next["GPU-0"] == nil || !next["GPU-0"].Since.Equal(&degraded["GPU-0"].Since) {
+		t.Errorf("checkDevices() = %v, want GPU-0 degraded since %v", next, degraded["GPU-0"].Since)
+	}
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+// healthEventTypes are the events which mark a device unhealthy.
+const healthEventTypes = nvml.EventTypeXidCriticalError | nvml.EventTypeDoubleBitEccError
+
+// applicationXids are caused by the user application rather than the device, they do not mark the device unhealthy.
+// See https://docs.nvidia.com/deploy/xid-errors/index.html
+var applicationXids = sets.NewInt64(
+	13,  // Graphics Engine Exception
+	31,  // GPU memory page fault
+	43,  // GPU stopped processing
+	45,  // Preemptive cleanup, due to previous errors
+	68,  // Video processor exception
+	109, // Context Switch Timeout Error
+)
+
+func NewDeviceHealthMonitor(provider device.Provider, recovery string, recoveryTimeout time.Duration, stop <-chan struct{}) (*DeviceHealthMonitor, error) {
+	switch recovery {
+	case options.DeviceHealthRecoveryNever, options.DeviceHealthRecoveryTimeout:
+	default:
+		return nil, fmt.Errorf("unknown device health recovery policy: %s", recovery)
+	}
+
+	return &DeviceHealthMonitor{
+		provider:        provider,
+		recovery:        recovery,
+		recoveryTimeout: recoveryTimeout,
+		stop:            stop,
+		healthChan:      make(chan map[string]*DeviceHealth),
+		unhealthy:       make(map[string]*DeviceHealth),
+	}, nil
+}
+
+// DeviceHealthMonitor watches the critical errors of devices with nvml events, and marks the device unhealthy.
+// The mark is cleared by the recovery policy, never or after recoveryTimeout since the last error.
+// It populates all the unhealthy devices whenever they change.
+type DeviceHealthMonitor struct {
+	provider        device.Provider
+	recovery        string
+	recoveryTimeout time.Duration
+	stop            <-chan struct{}
+	healthChan      chan map[string]*DeviceHealth
+	// map the device id to the last critical error
+	unhealthy map[string]*DeviceHealth
+}
+
+func (dhm *DeviceHealthMonitor) Start() error {
+	go func() {
+		klog.Infof("DeviceHealthMonitor started with recovery policy:%s", dhm.recovery)
+	LOOP:
+		for {
+			set, registered, count, err := dhm.registerEvents()
+			if err == nil {
+				err = dhm.watchEvents(set, registered, count)
+				if err := set.Free(); err != nil {
+					klog.Errorf("Unable to free event set: %v", err)
+				}
+			}
+			if err != nil {
+				klog.Errorf("DeviceHealthMonitor watch events err: %v", err)
+			}
+
+			select {
+			case <-dhm.stop:
+				break LOOP
+			case <-time.After(options.DeviceHealthMonitor_RetryInterval):
+			}
+		}
+		klog.Infof("DeviceHealthMonitor stopped")
+	}()
+	return nil
+}
+
+// registerEvents registers the health events of all the devices to a new event set,
+// the devices registered and the device count are returned.
+func (dhm *DeviceHealthMonitor) registerEvents() (device.EventSet, sets.String, int, error) {
+	set, err := dhm.provider.NewEventSet()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	count, err := dhm.provider.GetDeviceCount()
+	if err != nil {
+		set.Free()
+		return nil, nil, 0, fmt.Errorf("unable to get device count: %v", err)
+	}
+
+	registered := sets.NewString()
+	for i := 0; i < count; i++ {
+		d, err := dhm.provider.GetDeviceByIndex(i)
+		if err != nil {
+			klog.Errorf("Unable to get device at index %d: %v", i, err)
+			continue
+		}
+		did, err := d.GetUUID()
+		if err != nil {
+			klog.Errorf("Unable to get device uuid at index %d: %v", i, err)
+			continue
+		}
+		supported, err := d.GetSupportedEventTypes()
+		if err != nil {
+			klog.Errorf("DevicdId:%s unable to get supported event types: %v", did, err)
+			continue
+		}
+		if err := d.RegisterEvents(healthEventTypes&supported, set); err != nil {
+			klog.Errorf("DevicdId:%s unable to register events: %v", did, err)
+			continue
+		}
+		registered.Insert(did)
+	}
+	klog.Infof("DeviceHealthMonitor registered health events of devices: %v", registered.List())
+	return set, registered, count, nil
+}
+
+// watchEvents returns when stop, the event set fails or the devices on the node change.
+func (dhm *DeviceHealthMonitor) watchEvents(set device.EventSet, registered sets.String, count int) error {
+	for {
+		select {
+		case <-dhm.stop:
+			return nil
+		default:
+		}
+
+		event, err := set.Wait(options.DeviceHealthMonitor_WaitTimeout)
+		if device.ReturnOf(err) == nvml.ERROR_TIMEOUT {
+			if dhm.recover() && !dhm.populate() {
+				return nil
+			}
+			// register again to watch the device added.
+			if current, err := dhm.provider.GetDeviceCount(); err == nil && current != count {
+				klog.Infof("Device count changed from %d to %d, register events again", count, current)
+				return nil
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if dhm.markUnhealthy(event, registered) && !dhm.populate() {
+			return nil
+		}
+	}
+}
+
+// markUnhealthy marks the device of the event unhealthy, returns whether the unhealthy devices change.
+func (dhm *DeviceHealthMonitor) markUnhealthy(event device.Event, registered sets.String) bool {
+	dh := &DeviceHealth{EventType: device.EventTypeName(event.Type), Time: metav1.Now()}
+	switch event.Type {
+	case nvml.EventTypeXidCriticalError:
+		if applicationXids.Has(int64(event.Data)) {
+			klog.Infof("DevicdId:%s ignore application Xid %d", event.DeviceUUID, event.Data)
+			return false
+		}
+		dh.Xid = event.Data
+		dh.Message = fmt.Sprintf("Xid %d critical error", event.Data)
+	case nvml.EventTypeDoubleBitEccError:
+		dh.Message = "double bit ecc error"
+	default:
+		return false
+	}
+
+	dids := []string{event.DeviceUUID}
+	if event.DeviceUUID == "" {
+		// the error can not be attributed to a device, mark all of them.
+		dids = registered.List()
+	}
+	for _, did := range dids {
+		klog.Warningf("DevicdId:%s mark unhealthy: %s", did, dh.Message)
+		dhm.unhealthy[did] = dh
+	}
+	return len(dids) != 0
+}
+
+// recover clears the unhealthy mark by the recovery policy, returns whether the unhealthy devices change.
+func (dhm *DeviceHealthMonitor) recover() bool {
+	if dhm.recovery != options.DeviceHealthRecoveryTimeout {
+		return false
+	}
+	changed := false
+	for did, dh := range dhm.unhealthy {
+		if time.Since(dh.Time.Time) >= dhm.recoveryTimeout {
+			klog.Infof("DevicdId:%s recover from: %s", did, dh.Message)
+			delete(dhm.unhealthy, did)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// populate sends a copy of the unhealthy devices, false is returned if stopped.
+func (dhm *DeviceHealthMonitor) populate() bool {
+	unhealthy := make(map[string]*DeviceHealth, len(dhm.unhealthy))
+	for did, dh := range dhm.unhealthy {
+		unhealthy[did] = dh.DeepCopy()
+	}
+	select {
+	case dhm.healthChan <- unhealthy:
+		return true
+	case <-dhm.stop:
+		return false
+	}
+}
+
+func (dhm *DeviceHealthMonitor) GetHealthChan() <-chan map[string]*DeviceHealth {
+	return dhm.healthChan
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const healthInventory = `
+devices:
+- uuid: GPU-health-0
+  name: Tesla T4
+- uuid: GPU-health-1
+  name: Tesla T4
+`
+
+func TestDeviceHealthMonitor(t *testing.T) {
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	writeInventory := func(content string) {
+		if err := os.WriteFile(inventory, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeInventory(healthInventory)
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	dhm, err := NewDeviceHealthMonitor(provider, options.DeviceHealthRecoveryNever, 0, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dhm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// wait for the events registered.
+	time.Sleep(200 * time.Millisecond)
+
+	writeInventory(healthInventory + `
+events:
+- uuid: GPU-health-0
+  type: XidCriticalError
+  data: 13
+- uuid: GPU-health-1
+  type: XidCriticalError
+  data: 79
+`)
+	select {
+	case unhealthy := <-dhm.GetHealthChan():
+		if len(unhealthy) != 1 {
+			t.Fatalf("got unhealthy devices %v, want GPU-health-1 only", unhealthy)
+		}
+		if dh := unhealthy["GPU-health-1"]; dh == nil || dh.Xid != 79 || dh.EventType != "XidCriticalError" {
+			t.Fatalf("unexpected health of GPU-health-1: %#v", dh)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for unhealthy devices")
+	}
+}
+
+func TestDeviceHealthMonitorRecover(t *testing.T) {
+	var tests = []struct {
+		name     string
+		recovery string
+		age      time.Duration
+		want     bool
+	}{
+		{
+			name:     "never recover",
+			recovery: options.DeviceHealthRecoveryNever,
+			age:      time.Hour,
+			want:     false,
+		},
+		{
+			name:     "recover after timeout",
+			recovery: options.DeviceHealthRecoveryTimeout,
+			age:      time.Hour,
+			want:     true,
+		},
+		{
+			name:     "not recover before timeout",
+			recovery: options.DeviceHealthRecoveryTimeout,
+			age:      time.Second,
+			want:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dhm, err := NewDeviceHealthMonitor(nil, tt.recovery, time.Minute, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dhm.markUnhealthy(device.Event{DeviceUUID: "GPU-0", Type: nvml.EventTypeDoubleBitEccError}, nil)
+			dhm.unhealthy["GPU-0"].Time = metav1.NewTime(time.Now().Add(-tt.age))
+			if got := dhm.recover(); got != tt.want {
+				t.Errorf("recover() = %v, want %v", got, tt.want)
+			}
+			if _, exist := dhm.unhealthy["GPU-0"]; exist == tt.want {
+				t.Errorf("GPU-0 unhealthy = %v after recover", exist)
+			}
+		})
+	}
+
+	if _, err := NewDeviceHealthMonitor(nil, "always", time.Minute, nil); err == nil {
+		t.Errorf("NewDeviceHealthMonitor() with unknown recovery policy want error")
+	}
+}
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpupodcleintset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpupod/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/utils/pointer"
+)
+
+// The reasons of the Events recorded by DeviceInventoryReconciler.
+const (
+	EventDeviceAdded           = "DeviceAdded"
+	EventDeviceRemoved         = "DeviceRemoved"
+	EventDeviceRestored        = "DeviceRestored"
+	EventAssignedDeviceMissing = "AssignedDeviceMissing"
+	EventAssignedDeviceBack    = "AssignedDeviceRestored"
+)
+
+func NewDeviceInventoryReconciler(gpuPodClient gpupodcleintset.Interface, recorder record.EventRecorder, stop <-chan struct{}) (*DeviceInventoryReconciler, error) {
+	nodeName := os.Getenv("NODENAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("unable get env NODENAME")
+	}
+
+	return &DeviceInventoryReconciler{
+		gpuPodClient: gpuPodClient,
+		recorder:     recorder,
+		nodeName:     nodeName,
+		stop:         stop,
+		syncChan:     make(chan struct{}, 1),
+		migDevices:   make(map[string]*MigDeviceInfo),
+		podMissing:   make(map[string][]string),
+	}, nil
+}
+
+// DeviceInventoryReconciler tracks the gpus expected on the node, which are all the ones seen since gpuserver-ds started.
+// The gpus added, removed and restored are recorded as Events of GpuNode. The pods allocated the gpus missing get Events,
+// and their GpuPods are marked with the gpus missing in status, so the gpus falling off the bus are learned in seconds.
+type DeviceInventoryReconciler struct {
+	gpuPodClient gpupodcleintset.Interface
+	recorder     record.EventRecorder
+	nodeName     string
+	stop         <-chan struct{}
+	lock         sync.Mutex
+	// ngi and prm are the last devices and pod resources set, prm is nil until the pod resources are listed.
+	ngi      *NodeGpuInfo
+	prm      map[string]*podresourcesapi.PodResources
+	syncChan chan struct{}
+
+	// the fields below are only accessed by the loop.
+	// expected are the gpus expected on the node, missing are the ones of them not present.
+	expected sets.String
+	missing  sets.String
+	// migDevices are the MIG devices ever seen, so the MIG devices allocated on the gpus missing are resolved.
+	migDevices map[string]*MigDeviceInfo
+	// podMissing maps the GpuPod name to the gpus missing applied into its status.
+	podMissing map[string][]string
+}
+
+// SetState sets the devices and the pod resources to reconcile, prm is not changed after set.
+func (dir *DeviceInventoryReconciler) SetState(ngi *NodeGpuInfo, prm map[string]*podresourcesapi.PodResources) {
+	if dir == nil || ngi == nil {
+		return
+	}
+	dir.lock.Lock()
+	dir.ngi = ngi
+	dir.prm = prm
+	dir.lock.Unlock()
+
+	select {
+	case dir.syncChan <- struct{}{}:
+	default:
+		// a sync is pending already
+	}
+}
+
+func (dir *DeviceInventoryReconciler) Start() error {
+	go func() {
+		klog.Infof("DeviceInventoryReconciler started.")
+		var retry <-chan time.Time
+	LOOP:
+		for {
+			select {
+			case <-dir.stop:
+				break LOOP
+			case <-dir.syncChan:
+			case <-retry:
+			}
+			retry = nil
+			if err := dir.reconcile(); err != nil {
+				klog.Errorf("reconcile device inventory of node %s err: %v", dir.nodeName, err)
+				retry = time.After(options.DeviceInventoryReconciler_RetryInterval)
+			}
+		}
+		klog.Infof("DeviceInventoryReconciler stopped.")
+	}()
+	return nil
+}
+
+func (dir *DeviceInventoryReconciler) reconcile() error {
+	dir.lock.Lock()
+	ngi, prm := dir.ngi, dir.prm
+	dir.lock.Unlock()
+	if ngi == nil {
+		return nil
+	}
+	dir.reconcileDevices(ngi)
+	if prm == nil {
+		return nil
+	}
+	return dir.reconcilePods(prm)
+}
+
+// reconcileDevices records the gpus changed since the last reconcile as Events of GpuNode.
+// The gpus present on the first reconcile are expected, the ones added later are expected too.
+func (dir *DeviceInventoryReconciler) reconcileDevices(ngi *NodeGpuInfo) {
+	for mid, mig := range ngi.MigDevices {
+		dir.migDevices[mid] = mig
+	}
+	present := sets.StringKeySet(ngi.GpuInfos)
+	if dir.expected == nil {
+		dir.expected = present
+		dir.missing = sets.NewString()
+		klog.Infof("node:%s %d gpus expected: %v", dir.nodeName, dir.expected.Len(), dir.expected.List())
+		return
+	}
+
+	added := present.Difference(dir.expected)
+	restored := dir.missing.Intersection(present)
+	removed := dir.expected.Difference(present).Difference(dir.missing)
+	dir.expected = dir.expected.Union(present)
+	dir.missing = dir.expected.Difference(present)
+
+	ref := &corev1.ObjectReference{APIVersion: gpunodev1.GroupVersion.String(), Kind: "GpuNode", Namespace: metadata.MetadataNamespace(), Name: dir.nodeName}
+	count := fmt.Sprintf("%d of %d gpus expected are present", dir.expected.Len()-dir.missing.Len(), dir.expected.Len())
+	if added.Len() != 0 {
+		dir.recorder.Eventf(ref, corev1.EventTypeNormal, EventDeviceAdded, "Gpus added: %s, %s.", strings.Join(added.List(), ","), count)
+	}
+	if restored.Len() != 0 {
+		dir.recorder.Eventf(ref, corev1.EventTypeNormal, EventDeviceRestored, "Gpus restored: %s, %s.", strings.Join(restored.List(), ","), count)
+	}
+	if removed.Len() != 0 {
+		dir.recorder.Eventf(ref, corev1.EventTypeWarning, EventDeviceRemoved, "Gpus removed: %s, %s.", strings.Join(removed.List(), ","), count)
+	}
+	if added.Len() != 0 || restored.Len() != 0 || removed.Len() != 0 {
+		klog.Infof("node:%s gpus added:%v restored:%v removed:%v, %s", dir.nodeName, added.List(), restored.List(), removed.List(), count)
+	}
+}
+
+// reconcilePods applies the gpus missing into the status of the GpuPods allocated them, and records Events of their pods.
+// The GpuPods of the pods gone are deleted by ServerDSController, they are only forgotten here.
+func (dir *DeviceInventoryReconciler) reconcilePods(prm map[string]*podresourcesapi.PodResources) error {
+	desired := podMissingDevices(prm, dir.missing, dir.migDevices)
+	pods := make(map[string]*podresourcesapi.PodResources, len(prm))
+	for _, pr := range prm {
+		pods[util.MetadataToName(pr.Namespace, pr.Name)] = pr
+	}
+
+	var errs []error
+	for name, dids := range desired {
+		if reflect.DeepEqual(dir.podMissing[name], dids) {
+			continue
+		}
+		if err := dir.applyGpuPodStatus(name, dids); err != nil {
+			errs = append(errs, fmt.Errorf("apply status of GpuPod %s: %v", name, err))
+			continue
+		}
+		dir.podMissing[name] = dids
+		dir.recorder.Eventf(podReference(pods[name]), corev1.EventTypeWarning, EventAssignedDeviceMissing,
+			"Gpus allocated to the pod are missing from node %s: %s.", dir.nodeName, strings.Join(dids, ","))
+	}
+	for name := range dir.podMissing {
+		if _, exist := desired[name]; exist {
+			continue
+		}
+		if pods[name] == nil {
+			delete(dir.podMissing, name)
+			continue
+		}
+		if err := dir.applyGpuPodStatus(name, nil); err != nil {
+			errs = append(errs, fmt.Errorf("apply status of GpuPod %s: %v", name, err))
+			continue
+		}
+		delete(dir.podMissing, name)
+		dir.recorder.Eventf(podReference(pods[name]), corev1.EventTypeNormal, EventAssignedDeviceBack,
+			"Gpus allocated to the pod are back on node %s.", dir.nodeName)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// applyGpuPodStatus applies the gpus missing of the GpuPod, the field is removed if dids is empty.
+func (dir *DeviceInventoryReconciler) applyGpuPodStatus(name string, dids []string) error {
+	patch, err := serverdsutil.GpuPodStatusApplyPatch(name, metadata.MetadataNamespace(), &gpupodv1.GpuPodStatus{MissingDevices: dids})
+	if err != nil {
+		return err
+	}
+	_, err = dir.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Patch(context.TODO(), name, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: options.InventoryFieldManager, Force: pointer.Bool(true)}, "status")
+	return err
+}
+
+func podReference(pr *podresourcesapi.PodResources) *corev1.ObjectReference {
+	return &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: pr.Namespace, Name: pr.Name}
+}
+
+// podMissingDevices maps the GpuPod name to the sorted gpus missing allocated to the pod,
+// the MIG devices allocated are taken as their gpus. The pods without gpus missing are not in it.
+func podMissingDevices(prm map[string]*podresourcesapi.PodResources, missing sets.String, migDevices map[string]*MigDeviceInfo) map[string][]string {
+	podMissing := make(map[string][]string)
+	if missing.Len() == 0 {
+		return podMissing
+	}
+	for _, pr := range prm {
+		dids := sets.NewString()
+		for _, c := range pr.Containers {
+			for _, d := range c.Devices {
+				if !util.IsGpuResourceName(d.ResourceName) && !serverdsutil.IsMigResourceName(d.ResourceName) {
+					continue
+				}
+				for _, did := range d.DeviceIds {
+					if mig := serverdsutil.FindMigDevice(migDevices, did); mig != nil {
+						did = mig.ParentId
+					}
+					if missing.Has(did) {
+						dids.Insert(did)
+					}
+				}
+			}
+		}
+		if dids.Len() != 0 {
+			podMissing[util.MetadataToName(pr.Namespace, pr.Name)] = dids.List()
+		}
+	}
+	return podMissing
+}
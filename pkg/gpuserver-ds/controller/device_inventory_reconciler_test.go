@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+func TestPodMissingDevices(t *testing.T) {
+	migDevices := map[string]*MigDeviceInfo{"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-1", GpuInstanceId: 7}}
+	pod := func(name, resourceName string, dids ...string) *podresourcesapi.PodResources {
+		return &podresourcesapi.PodResources{Namespace: "default", Name: name, Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: resourceName, DeviceIds: dids}}},
+		}}
+	}
+	prm := map[string]*podresourcesapi.PodResources{
+		"default/pod-gpu":    pod("pod-gpu", "nvidia.com/gpu", "GPU-0", "GPU-1"),
+		"default/pod-mig":    pod("pod-mig", "nvidia.com/mig-1g.5gb", "MIG-0"),
+		"default/pod-legacy": pod("pod-legacy", "nvidia.com/gpu", "MIG-GPU-1/7/0"),
+		"default/pod-other":  pod("pod-other", "example.com/foo", "GPU-1"),
+		"default/pod-fine":   pod("pod-fine", "nvidia.com/gpu", "GPU-2"),
+	}
+	var tests = []struct {
+		name    string
+		missing sets.String
+		want    map[string][]string
+	}{
+		{name: "nothing missing", missing: sets.NewString(), want: map[string][]string{}},
+		{
+			name:    "gpu missing",
+			missing: sets.NewString("GPU-0", "GPU-1"),
+			want: map[string][]string{
+				"default-pod-gpu":    {"GPU-0", "GPU-1"},
+				"default-pod-mig":    {"GPU-1"},
+				"default-pod-legacy": {"GPU-1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podMissingDevices(prm, tt.missing, migDevices); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podMissingDevices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceInventoryReconciler(t *testing.T) {
+	t.Setenv("NODENAME", "node-inventory")
+	_, gpuPodClient := newApplyFakeClients()
+	_, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Create(context.TODO(), &gpupodv1.GpuPod{
+		ObjectMeta: metav1.ObjectMeta{Name: "default-pod1", Namespace: metadata.MetadataNamespace()},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	dir, err := NewDeviceInventoryReconciler(gpuPodClient, recorder, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ngi := func(dids ...string) *NodeGpuInfo {
+		gpuInfos := make(map[string]*GpuInfo)
+		for _, did := range dids {
+			gpuInfos[did] = &GpuInfo{DeviceId: did}
+		}
+		return &NodeGpuInfo{GpuInfos: gpuInfos}
+	}
+	prm := map[string]*podresourcesapi.PodResources{"default/pod1": {Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-1"}}}},
+	}}}
+	reconcile := func(ngi *NodeGpuInfo) {
+		t.Helper()
+		dir.SetState(ngi, prm)
+		if err := dir.reconcile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantEvents := func(reasons ...string) {
+		t.Helper()
+		var got []string
+		for len(recorder.Events) != 0 {
+			got = append(got, strings.Fields(<-recorder.Events)[1])
+		}
+		if !reflect.DeepEqual(got, reasons) {
+			t.Errorf("events = %v, want %v", got, reasons)
+		}
+	}
+	missingDevices := func() []string {
+		t.Helper()
+		gp, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gp.Status.MissingDevices
+	}
+
+	// the gpus present first are expected without events.
+	reconcile(ngi("GPU-0", "GPU-1"))
+	wantEvents()
+
+	reconcile(ngi("GPU-0"))
+	wantEvents(EventDeviceRemoved, EventAssignedDeviceMissing)
+	if got := missingDevices(); !reflect.DeepEqual(got, []string{"GPU-1"}) {
+		t.Errorf("MissingDevices = %v, want [GPU-1]", got)
+	}
+
+	// nothing changed is not reported again.
+	reconcile(ngi("GPU-0"))
+	wantEvents()
+
+	reconcile(ngi("GPU-0", "GPU-1", "GPU-2"))
+	wantEvents(EventDeviceAdded, EventDeviceRestored, EventAssignedDeviceBack)
+	if dir.expected.Len() != 3 || dir.missing.Len() != 0 || len(dir.podMissing) != 0 {
+		t.Errorf("expected:%v missing:%v podMissing:%v, want 3 gpus expected and nothing missing", dir.expected.List(), dir.missing.List(), dir.podMissing)
+	}
+}
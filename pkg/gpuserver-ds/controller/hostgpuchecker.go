@@ -3,48 +3,70 @@ package controller
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
 	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
 )
 
-func NewHostGpuInfoChecker(checkInterval time.Duration, stop <-chan struct{}) (*HostGpuInfoChecker, error) {
-	ret := nvml.Init()
-	if ret != nvml.SUCCESS {
-		return nil, fmt.Errorf("unable to initialize NVML: %v", nvml.ErrorString(ret))
+func NewHostGpuInfoChecker(provider device.Provider, checkInterval time.Duration, conditions *NodeConditionController, stop <-chan struct{}) (*HostGpuInfoChecker, error) {
+	if err := provider.Init(); err != nil {
+		return nil, fmt.Errorf("unable to initialize NVML: %v", err)
 	}
 
 	return &HostGpuInfoChecker{
+		provider:      provider,
 		checkInterval: checkInterval,
+		conditions:    conditions,
 		stop:          stop,
 		gpuinfoChan:   make(chan *NodeGpuInfo),
 		modelSetLast:  make(map[string]sets.String),
+		migSetLast:    make(map[string]sets.String),
 	}, nil
 
 }
 
 // HostGpuInfoChecker check node gpu model and populate it.
-// It depends on the package github.com/NVIDIA/go-nvml/pkg/nvml
+// It depends on the device.Provider, which is NVML or the fake provider.
 // It Start to populate gpu model info each interval and never stop until stop chan signal.
 type HostGpuInfoChecker struct {
+	provider      device.Provider
 	checkInterval time.Duration
+	conditions    *NodeConditionController
 	stop          <-chan struct{}
 	gpuinfoChan   chan *NodeGpuInfo
 	// map the device model to the last observed device ids in set
 	modelSetLast map[string]sets.String
+	// map the MIG profile to the last observed MIG device ids in set
+	migSetLast map[string]sets.String
+	// the last observed versions of the driver, the driver may be upgraded without the devices changed
+	driverVersionLast     string
+	cudaDriverVersionLast string
+	// topologyFailed means the last topology is not checked
+	topologyFailed bool
+	// inventoryChecked means the devices are checked once, inventoryChangeTime is the time they changed since.
+	inventoryChecked    bool
+	inventoryChangeTime time.Time
+	// deviceRefs are the references to the devices of the last check, see GetDeviceRefs.
+	deviceRefs     map[string]string
+	deviceRefsLock sync.RWMutex
 }
 
 func (gic *HostGpuInfoChecker) Start() error {
 	go func() {
 		defer func() {
-			ret := nvml.Shutdown()
-			if ret != nvml.SUCCESS {
-				klog.Errorf("Unable to shutdown NVML: %v", nvml.ErrorString(ret))
+			if err := gic.provider.Shutdown(); err != nil {
+				klog.Errorf("Unable to shutdown NVML: %v", err)
 			}
 		}()
 
@@ -54,55 +76,40 @@ func (gic *HostGpuInfoChecker) Start() error {
 		for {
 			select {
 			case <-ct:
-				count, ret := nvml.DeviceGetCount()
-				if ret != nvml.SUCCESS {
-					klog.Errorf("Unable to get device count: %v", nvml.ErrorString(ret))
+				nodegpuinfo, err := gic.checkNodeGpuInfo()
+				if err != nil {
+					klog.Errorf("checkNodeGpuInfo: %v", err)
+					gic.conditions.SetCondition(gpunodev1.GpuNodeNVMLReady, metav1.ConditionFalse, "DeviceQueryFailed", err.Error())
 					continue
 				}
-				needNotify := true
-				nodegpuinfo := &NodeGpuInfo{GpuInfos: make(map[string]*GpuInfo), Models: make(map[string]sets.String)}
-
-				for i := 0; i < count; i++ {
-					device, ret := nvml.DeviceGetHandleByIndex(i)
-					if ret == nvml.SUCCESS {
-						did, ret := device.GetUUID()
-						if ret == nvml.SUCCESS {
-							gpuinfo, err := updateGpuInfo(did)
-							if err != nil {
-								klog.Errorf("updateGpuInfo: %v", err)
-								needNotify = false
-								break
-							}
-							nodegpuinfo.GpuInfos[did] = gpuinfo
-							nmodel := util.NormalizeModelName(gpuinfo.Model)
-							if nodegpuinfo.Models[nmodel] == nil {
-								nodegpuinfo.Models[nmodel] = sets.NewString()
-							}
-							nodegpuinfo.Models[nmodel].Insert(did)
-						} else {
-							klog.Errorf("Unable to get device GetName at index %d: %v", i, nvml.ErrorString(ret))
-							needNotify = false
-							break
-						}
-					} else {
-						klog.Errorf("Unable to get device at index %d: %v", i, nvml.ErrorString(ret))
-						klog.Infof("Try to initiate nvml again")
-						// reinit to restore
-						ret := nvml.Init()
-						if ret != nvml.SUCCESS {
-							klog.Errorf("Unable to initialize NVML: %v", nvml.ErrorString(ret))
+				gic.conditions.SetCondition(gpunodev1.GpuNodeNVMLReady, metav1.ConditionTrue, "DeviceQuerySucceeded", "The devices are queried.")
+
+				changed := !reflect.DeepEqual(gic.modelSetLast, nodegpuinfo.Models) || !reflect.DeepEqual(gic.migSetLast, nodegpuinfo.MigProfiles) ||
+					gic.driverVersionLast != nodegpuinfo.DriverVersion || gic.cudaDriverVersionLast != nodegpuinfo.CudaDriverVersion
+				gic.updateInventoryCondition(changed, nodegpuinfo)
+				if changed || gic.topologyFailed {
+					// the topology changes only with the devices, it is checked again until it succeeds.
+					topology, err := checkTopology(gic.provider, nodegpuinfo.GpuInfos)
+					if err != nil {
+						klog.Errorf("checkTopology: %v", err)
+						if !changed {
+							continue
 						}
-						needNotify = false
-						break
 					}
-				}
+					gic.topologyFailed = err != nil
+					nodegpuinfo.Topology = topology
 
-				if needNotify {
-					if !reflect.DeepEqual(gic.modelSetLast, nodegpuinfo.Models) {
-						klog.Infof("Notify the node devices uuid changed: original:%s current:%s",
-							serverdsutil.DumpModelSetInfo(gic.modelSetLast), serverdsutil.DumpModelSetInfo(nodegpuinfo.Models))
-						gic.modelSetLast = nodegpuinfo.Models
-						gic.gpuinfoChan <- nodegpuinfo
+					klog.Infof("Notify the node devices uuid changed: original:%s%s current:%s%s",
+						serverdsutil.DumpModelSetInfo(gic.modelSetLast), serverdsutil.DumpModelSetInfo(gic.migSetLast),
+						serverdsutil.DumpModelSetInfo(nodegpuinfo.Models), serverdsutil.DumpModelSetInfo(nodegpuinfo.MigProfiles))
+					gic.modelSetLast = nodegpuinfo.Models
+					gic.migSetLast = nodegpuinfo.MigProfiles
+					gic.driverVersionLast = nodegpuinfo.DriverVersion
+					gic.cudaDriverVersionLast = nodegpuinfo.CudaDriverVersion
+					select {
+					case gic.gpuinfoChan <- nodegpuinfo:
+					case <-gic.stop:
+						break CKECKLOOP
 					}
 				}
 
@@ -116,6 +123,160 @@ func (gic *HostGpuInfoChecker) Start() error {
 	return nil
 }
 
+// updateInventoryCondition sets InventoryStable false once the devices change after the first check,
+// and true again if they are not changed in InventoryStablePeriod.
+func (gic *HostGpuInfoChecker) updateInventoryCondition(changed bool, nodegpuinfo *NodeGpuInfo) {
+	switch {
+	case changed && gic.inventoryChecked:
+		gic.inventoryChangeTime = time.Now()
+		gic.conditions.SetCondition(gpunodev1.GpuNodeInventoryStable, metav1.ConditionFalse, "InventoryChanged",
+			fmt.Sprintf("The devices changed to %s%s.", serverdsutil.DumpModelSetInfo(nodegpuinfo.Models), serverdsutil.DumpModelSetInfo(nodegpuinfo.MigProfiles)))
+	case gic.inventoryChangeTime.IsZero() || time.Since(gic.inventoryChangeTime) >= options.InventoryStablePeriod:
+		gic.inventoryChangeTime = time.Time{}
+		gic.conditions.SetCondition(gpunodev1.GpuNodeInventoryStable, metav1.ConditionTrue, "InventoryUnchanged",
+			fmt.Sprintf("The devices are not changed in %s.", options.InventoryStablePeriod))
+	}
+	gic.inventoryChecked = true
+}
+
+// checkNodeGpuInfo gets all the devices of the node, error is returned if any device can not be got.
+// The gpu lost, such as fell off the bus, is skipped and reported missing by DeviceInventoryReconciler.
+// The gpu in MIG mode is not in Models, its MIG devices are grouped by profile instead.
+func (gic *HostGpuInfoChecker) checkNodeGpuInfo() (*NodeGpuInfo, error) {
+	count, err := gic.provider.GetDeviceCount()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get device count: %v", err)
+	}
+
+	nodegpuinfo := &NodeGpuInfo{GpuInfos: make(map[string]*GpuInfo), Models: make(map[string]sets.String),
+		MigDevices: make(map[string]*MigDeviceInfo), MigProfiles: make(map[string]sets.String)}
+	if nodegpuinfo.DriverVersion, err = gic.provider.GetDriverVersion(); err != nil {
+		return nil, fmt.Errorf("unable to get driver version: %v", err)
+	}
+	cudaVersion, err := gic.provider.GetCudaDriverVersion()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cuda driver version: %v", err)
+	}
+	nodegpuinfo.CudaDriverVersion = cudaVersionString(cudaVersion)
+	refs := make(map[string]string)
+	for i := 0; i < count; i++ {
+		d, err := gic.provider.GetDeviceByIndex(i)
+		if device.ReturnOf(err) == nvml.ERROR_GPU_IS_LOST {
+			klog.Errorf("device at index %d is lost: %v", i, err)
+			continue
+		} else if err != nil {
+			klog.Infof("Try to initiate nvml again")
+			// reinit to restore
+			if err := gic.provider.Init(); err != nil {
+				klog.Errorf("Unable to initialize NVML: %v", err)
+			}
+			return nil, fmt.Errorf("unable to get device at index %d: %v", i, err)
+		}
+		did, err := d.GetUUID()
+		if device.ReturnOf(err) == nvml.ERROR_GPU_IS_LOST {
+			klog.Errorf("device at index %d is lost: %v", i, err)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to get device uuid at index %d: %v", i, err)
+		}
+		gpuinfo, err := updateGpuInfo(gic.provider, did)
+		if err != nil {
+			return nil, fmt.Errorf("updateGpuInfo: %v", err)
+		}
+		refs[did] = did
+		refs[strconv.Itoa(i)] = did
+		if minor, err := d.GetMinorNumber(); err != nil {
+			klog.Errorf("DevicdId:%s unable to get minor number: %v", did, err)
+		} else {
+			refs[fmt.Sprintf("/dev/nvidia%d", minor)] = did
+		}
+		migEnabled, err := d.GetMigMode()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get MIG mode of device %s: %v", did, err)
+		}
+		if migEnabled {
+			// gpuinfo is shared by ttlCacheGpu
+			gpuinfo = gpuinfo.DeepCopy()
+			gpuinfo.MigEnabled = true
+			nodegpuinfo.GpuInfos[did] = gpuinfo
+			if err := checkMigDevices(d, i, gpuinfo, nodegpuinfo, refs); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		nodegpuinfo.GpuInfos[did] = gpuinfo
+		nmodel := util.NormalizeModelName(gpuinfo.Model)
+		if nodegpuinfo.Models[nmodel] == nil {
+			nodegpuinfo.Models[nmodel] = sets.NewString()
+		}
+		nodegpuinfo.Models[nmodel].Insert(did)
+	}
+	gic.deviceRefsLock.Lock()
+	gic.deviceRefs = refs
+	gic.deviceRefsLock.Unlock()
+	return nodegpuinfo, nil
+}
+
+// GetDeviceRefs gets the references to the devices in the containers of the last check, nil is returned before the first check.
+// It maps the device id, the host index like NVIDIA_VISIBLE_DEVICES=0 or 0:1 of a MIG device, and the device node /dev/nvidia<minor>
+// to the device id. The indexes are of the host, not the ones of CUDA_VISIBLE_DEVICES relative to the gpus in a container.
+// The map is not changed after returned.
+func (gic *HostGpuInfoChecker) GetDeviceRefs() map[string]string {
+	gic.deviceRefsLock.RLock()
+	defer gic.deviceRefsLock.RUnlock()
+	return gic.deviceRefs
+}
+
+// cudaVersionString formats the CUDA version major*1000+minor*10 like 11.4, empty is returned for 0.
+func cudaVersionString(version int) string {
+	if version <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d", version/1000, version%1000/10)
+}
+
+// checkMigDevices gets the MIG devices of the gpu in MIG mode at index into nodegpuinfo, and their references into refs.
+func checkMigDevices(d device.Device, index int, gpuinfo *GpuInfo, nodegpuinfo *NodeGpuInfo, refs map[string]string) error {
+	count, err := d.GetMaxMigDeviceCount()
+	if err != nil {
+		return fmt.Errorf("unable to get max MIG device count of device %s: %v", gpuinfo.DeviceId, err)
+	}
+	for i := 0; i < count; i++ {
+		mig, err := d.GetMigDeviceByIndex(i)
+		if device.ReturnOf(err) == nvml.ERROR_NOT_FOUND {
+			// the index is not populated
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to get MIG device at index %d of device %s: %v", i, gpuinfo.DeviceId, err)
+		}
+		mid, err := mig.GetUUID()
+		if err != nil {
+			return fmt.Errorf("unable to get MIG device uuid at index %d of device %s: %v", i, gpuinfo.DeviceId, err)
+		}
+		mi, err := mig.GetMigInfo()
+		if err != nil {
+			return fmt.Errorf("unable to get MIG device info of %s: %v", mid, err)
+		}
+		refs[mid] = mid
+		refs[fmt.Sprintf("%d:%d", index, i)] = mid
+		profile := mi.Profile()
+		nodegpuinfo.MigDevices[mid] = &MigDeviceInfo{
+			DeviceId:          mid,
+			ParentId:          gpuinfo.DeviceId,
+			Profile:           profile,
+			GpuInstanceId:     mi.GpuInstanceId,
+			ComputeInstanceId: mi.ComputeInstanceId,
+			MemorySizeMB:      mi.MemorySizeMB,
+			Model:             gpuinfo.Model,
+		}
+		if nodegpuinfo.MigProfiles[profile] == nil {
+			nodegpuinfo.MigProfiles[profile] = sets.NewString()
+		}
+		nodegpuinfo.MigProfiles[profile].Insert(mid)
+	}
+	return nil
+}
+
 func (gic *HostGpuInfoChecker) GetGpuInfoChan() <-chan *NodeGpuInfo {
 	return gic.gpuinfoChan
 }
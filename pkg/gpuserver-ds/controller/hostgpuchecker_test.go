@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestHostGpuInfoCheckerWithFakeProvider(t *testing.T) {
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	writeInventory := func(content string) {
+		if err := os.WriteFile(inventory, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeInventory(`
+devices:
+- uuid: GPU-checker-0
+  name: Tesla T4
+  bus_id: "00000000:00:1E.0"
+- uuid: GPU-checker-1
+  name: Tesla T4
+  bus_id: "00000000:00:1F.0"
+`)
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	gic, err := NewHostGpuInfoChecker(provider, 10*time.Millisecond, nil, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gic.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ngi := <-gic.GetGpuInfoChan():
+		if len(ngi.GpuInfos) != 2 || ngi.Models["tesla t4"].Len() != 2 {
+			t.Fatalf("unexpected node gpu info: %#v", ngi)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for node gpu info")
+	}
+
+	// a lost device is reported with the remaining one.
+	writeInventory(`
+devices:
+- uuid: GPU-checker-0
+  name: Tesla T4
+  bus_id: "00000000:00:1E.0"
+- uuid: GPU-checker-1
+  removed: true
+`)
+	select {
+	case ngi := <-gic.GetGpuInfoChan():
+		if _, exist := ngi.GpuInfos["GPU-checker-0"]; !exist || len(ngi.GpuInfos) != 1 {
+			t.Fatalf("unexpected node gpu info after device removed: %#v", ngi)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for node gpu info after device removed")
+	}
+}
+
+func TestCheckNodeGpuInfoMig(t *testing.T) {
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	err := os.WriteFile(inventory, []byte(`
+devices:
+- uuid: GPU-mig-0
+  name: A100-SXM4-40GB
+  mig_enabled: true
+  mig_devices:
+  - uuid: MIG-mig-0-0
+    mig: {gi: 1, ci: 0, gi_slices: 1, ci_slices: 1, memory_mb: 4864}
+  - uuid: MIG-mig-0-1
+    removed: true
+  - uuid: MIG-mig-0-2
+    mig: {gi: 2, ci: 0, gi_slices: 3, ci_slices: 3, memory_mb: 19968}
+- uuid: GPU-mig-1
+  name: A100-SXM4-40GB
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gic, err := NewHostGpuInfoChecker(provider, time.Second, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ngi, err := gic.checkNodeGpuInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ngi.GpuInfos["GPU-mig-0"].MigEnabled || ngi.GpuInfos["GPU-mig-1"].MigEnabled {
+		t.Errorf("unexpected MIG mode: %#v", ngi.GpuInfos)
+	}
+	if got := ngi.Models["a100-sxm4-40gb"].List(); !reflect.DeepEqual(got, []string{"GPU-mig-1"}) {
+		t.Errorf("Models = %v, want the gpu not in MIG mode only", got)
+	}
+	wantProfiles := map[string]sets.String{"1g.5gb": sets.NewString("MIG-mig-0-0"), "3g.20gb": sets.NewString("MIG-mig-0-2")}
+	if !reflect.DeepEqual(ngi.MigProfiles, wantProfiles) {
+		t.Errorf("MigProfiles = %v, want %v", ngi.MigProfiles, wantProfiles)
+	}
+	if mig := ngi.MigDevices["MIG-mig-0-2"]; mig == nil || mig.ParentId != "GPU-mig-0" || mig.GpuInstanceId != 2 {
+		t.Errorf("unexpected MIG device: %#v", mig)
+	}
+	wantRefs := map[string]string{
+		"GPU-mig-0": "GPU-mig-0", "0": "GPU-mig-0", "/dev/nvidia0": "GPU-mig-0",
+		"GPU-mig-1": "GPU-mig-1", "1": "GPU-mig-1", "/dev/nvidia1": "GPU-mig-1",
+		"MIG-mig-0-0": "MIG-mig-0-0", "0:0": "MIG-mig-0-0",
+		"MIG-mig-0-2": "MIG-mig-0-2", "0:2": "MIG-mig-0-2",
+	}
+	if got := gic.GetDeviceRefs(); !reflect.DeepEqual(got, wantRefs) {
+		t.Errorf("GetDeviceRefs() = %v, want %v", got, wantRefs)
+	}
+}
+
+func TestCheckNodeGpuInfoLost(t *testing.T) {
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	err := os.WriteFile(inventory, []byte(`
+devices:
+- uuid: GPU-lost-0
+  name: Tesla T4
+- uuid: GPU-lost-1
+  name: Tesla T4
+  errors:
+    GetUUID: ERROR_GPU_IS_LOST
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gic, err := NewHostGpuInfoChecker(provider, time.Second, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the gpu still counted but lost is skipped, the others are reported.
+	ngi, err := gic.checkNodeGpuInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sets.StringKeySet(ngi.GpuInfos).List(); !reflect.DeepEqual(got, []string{"GPU-lost-0"}) {
+		t.Errorf("GpuInfos = %v, want the gpu not lost only", got)
+	}
+}
+
+func TestUpdateInventoryCondition(t *testing.T) {
+	gic := &HostGpuInfoChecker{conditions: &NodeConditionController{syncChan: make(chan struct{}, 1)}}
+	ngi := &NodeGpuInfo{Models: map[string]sets.String{"tesla t4": sets.NewString("GPU-0")}}
+	status := func() metav1.ConditionStatus {
+		return gic.conditions.GetCondition(gpunodev1.GpuNodeInventoryStable).Status
+	}
+
+	// the devices discovered first are stable.
+	gic.updateInventoryCondition(true, ngi)
+	if got := status(); got != metav1.ConditionTrue {
+		t.Errorf("InventoryStable after first check = %s, want True", got)
+	}
+	gic.updateInventoryCondition(true, ngi)
+	if got := status(); got != metav1.ConditionFalse {
+		t.Errorf("InventoryStable after changed = %s, want False", got)
+	}
+	gic.updateInventoryCondition(false, ngi)
+	if got := status(); got != metav1.ConditionFalse {
+		t.Errorf("InventoryStable in stable period = %s, want False", got)
+	}
+	gic.inventoryChangeTime = gic.inventoryChangeTime.Add(-options.InventoryStablePeriod)
+	gic.updateInventoryCondition(false, ngi)
+	if got := status(); got != metav1.ConditionTrue {
+		t.Errorf("InventoryStable after stable period = %s, want True", got)
+	}
+}
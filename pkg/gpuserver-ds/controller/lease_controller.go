@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
 	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
@@ -29,14 +30,16 @@ const (
 	exitCode            = 101
 )
 
-func StartLeaseControllerErrExit(ctx context.Context, kubeClient kubernetes.Interface, gpuClient gpuclientset.Interface) {
-	if err := startLeaseController(ctx, kubeClient, gpuClient); err != nil {
+// StartLeaseControllerErrExit starts renewing the lease of the node, it is paused while the podresources of kubelet
+// can not be listed by the conditions, so the node is not taken as healthy with the data frozen.
+func StartLeaseControllerErrExit(ctx context.Context, kubeClient kubernetes.Interface, gpuClient gpuclientset.Interface, conditions *NodeConditionController) {
+	if err := startLeaseController(ctx, kubeClient, gpuClient, conditions); err != nil {
 		klog.Errorf("%s: %v", leaseControllerName, err)
 		os.Exit(exitCode)
 	}
 }
 
-func startLeaseController(ctx context.Context, kubeClient kubernetes.Interface, gpuClient gpuclientset.Interface) error {
+func startLeaseController(ctx context.Context, kubeClient kubernetes.Interface, gpuClient gpuclientset.Interface, conditions *NodeConditionController) error {
 	node := os.Getenv("NODENAME")
 	if node == "" {
 		return fmt.Errorf("unable get env NODENAME")
@@ -62,10 +65,49 @@ func startLeaseController(ctx context.Context, kubeClient kubernetes.Interface,
 		serverdsutil.SetNodeOwnerFunc(gpuClient, metadata.MetadataNamespace(), node))
 
 	klog.Infof("starting %s", leaseControllerName)
-	go nodeLeaseController.Run(ctx.Done())
+	go runWhileReady(ctx.Done(), renewInterval, func() bool { return podResourcesReady(conditions) }, nodeLeaseController.Run)
 	return nil
 }
 
+// podResourcesReady means the podresources are listed, or not listed yet on start.
+func podResourcesReady(conditions *NodeConditionController) bool {
+	cond := conditions.GetCondition(gpunodev1.GpuNodePodResourcesReady)
+	return cond == nil || cond.Status != metav1.ConditionFalse
+}
+
+// runWhileReady runs run while ready is true, it is checked each interval.
+// run is stopped when not ready, and run again when ready again.
+func runWhileReady(stop <-chan struct{}, interval time.Duration, ready func() bool, run func(stop <-chan struct{})) {
+	var runStop chan struct{}
+	check := func() {
+		switch r := ready(); {
+		case r && runStop == nil:
+			klog.Infof("%s: renew the lease", leaseControllerName)
+			runStop = make(chan struct{})
+			go run(runStop)
+		case !r && runStop != nil:
+			klog.Warningf("%s: stop renewing the lease until the podresources are listed", leaseControllerName)
+			close(runStop)
+			runStop = nil
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case <-stop:
+			if runStop != nil {
+				close(runStop)
+			}
+			return
+		}
+	}
+}
+
 func ensureNamespace(ctx context.Context, kubeclient kubernetes.Interface, nsname string) error {
 	nsctx, cancelFun := context.WithTimeout(ctx, time.Second*2)
 	defer cancelFun()
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRunWhileReady(t *testing.T) {
+	t.Setenv("NODENAME", "node-lease")
+	gpuClient, _ := newApplyFakeClients()
+	stop := make(chan struct{})
+	ncc, err := NewNodeConditionController(gpuClient, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var running, runs int32
+	done := make(chan struct{})
+	go func() {
+		runWhileReady(stop, 10*time.Millisecond, func() bool { return podResourcesReady(ncc) }, func(stop <-chan struct{}) {
+			atomic.AddInt32(&runs, 1)
+			atomic.StoreInt32(&running, 1)
+			<-stop
+			atomic.StoreInt32(&running, 0)
+		})
+		close(done)
+	}()
+	waitRunning := func(want int32) {
+		t.Helper()
+		err := wait.PollImmediate(5*time.Millisecond, 5*time.Second, func() (bool, error) {
+			return atomic.LoadInt32(&running) == want, nil
+		})
+		if err != nil {
+			t.Fatalf("running = %d, want %d", atomic.LoadInt32(&running), want)
+		}
+	}
+
+	// the lease is renewed before the first list.
+	waitRunning(1)
+	ncc.SetCondition(gpunodev1.GpuNodePodResourcesReady, metav1.ConditionFalse, gpunodev1.GpuNodePodResourcesUnavailable, "connection refused")
+	waitRunning(0)
+	ncc.SetCondition(gpunodev1.GpuNodePodResourcesReady, metav1.ConditionTrue, "ListSucceeded", "listed")
+	waitRunning(1)
+	if got := atomic.LoadInt32(&runs); got != 2 {
+		t.Errorf("runs = %d, want 2", got)
+	}
+
+	close(stop)
+	<-done
+	waitRunning(0)
+}
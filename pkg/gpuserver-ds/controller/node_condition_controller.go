@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"k8s.io/utils/pointer"
+)
+
+// nodeConditionTypes are the condition types of GpuNode owned by gpuserver-ds.
+var nodeConditionTypes = []string{gpunodev1.GpuNodeNVMLReady, gpunodev1.GpuNodePodResourcesReady, gpunodev1.GpuNodeDevicesHealthy, gpunodev1.GpuNodeInventoryStable,
+	gpunodev1.GpuNodeDraining}
+
+func NewNodeConditionController(gpuClient gpuclientset.Interface, stop <-chan struct{}) (*NodeConditionController, error) {
+	nodeName := os.Getenv("NODENAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("unable get env NODENAME")
+	}
+
+	ncc := &NodeConditionController{
+		gpuClient: gpuClient,
+		nodeName:  nodeName,
+		stop:      stop,
+		syncChan:  make(chan struct{}, 1),
+	}
+	// keep the transition time of the conditions set before restart.
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), nodeName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get GpuNode %s: %v", nodeName, err)
+	} else if err == nil {
+		for _, t := range nodeConditionTypes {
+			if cond := meta.FindStatusCondition(gpuNode.Status.Conditions, t); cond != nil {
+				ncc.conditions = append(ncc.conditions, *cond)
+			}
+		}
+	}
+	// the node drained by the last shutdown is back.
+	ncc.SetCondition(gpunodev1.GpuNodeDraining, metav1.ConditionFalse, "AgentRunning", "gpuserver-ds is running")
+	return ncc, nil
+}
+
+// NodeConditionController keeps the conditions of GpuNode owned by gpuserver-ds,
+// and applies them into GpuNode status once any is changed.
+// The GpuNode is created by ServerDSController, the apply is retried until it exists.
+type NodeConditionController struct {
+	gpuClient gpuclientset.Interface
+	nodeName  string
+	stop      <-chan struct{}
+	lock      sync.Mutex
+	// conditions are ordered by the time first set.
+	conditions []metav1.Condition
+	syncChan   chan struct{}
+	// applyLock serializes the applies, so the one by Drain is not overwritten by an older one.
+	applyLock sync.Mutex
+}
+
+// SetCondition sets the condition, the transition time is kept if the status is not changed.
+func (ncc *NodeConditionController) SetCondition(condType string, status metav1.ConditionStatus, reason, message string) {
+	if ncc == nil {
+		return
+	}
+	ncc.lock.Lock()
+	old := meta.FindStatusCondition(ncc.conditions, condType)
+	if old != nil && old.Status == status && old.Reason == reason && old.Message == message {
+		ncc.lock.Unlock()
+		return
+	}
+	meta.SetStatusCondition(&ncc.conditions, metav1.Condition{Type: condType, Status: status, Reason: reason, Message: message})
+	ncc.lock.Unlock()
+	klog.Infof("node:%s condition %s=%s reason:%s message:%s", ncc.nodeName, condType, status, reason, message)
+
+	select {
+	case ncc.syncChan <- struct{}{}:
+	default:
+		// a sync is pending already
+	}
+}
+
+// GetCondition gets a copy of the condition, nil is returned if it is not set.
+func (ncc *NodeConditionController) GetCondition(condType string) *metav1.Condition {
+	if ncc == nil {
+		return nil
+	}
+	ncc.lock.Lock()
+	defer ncc.lock.Unlock()
+	if cond := meta.FindStatusCondition(ncc.conditions, condType); cond != nil {
+		return cond.DeepCopy()
+	}
+	return nil
+}
+
+// Drain sets the condition Draining True and applies it at once, it is called on shutdown before the stop channel is closed.
+// The lifecycle controller does not take the node as unhealthy for a grace period after the lease expires,
+// so the rolling upgrade of gpuserver-ds does not look like an outage.
+func (ncc *NodeConditionController) Drain(reason, message string) error {
+	if ncc == nil {
+		return nil
+	}
+	ncc.SetCondition(gpunodev1.GpuNodeDraining, metav1.ConditionTrue, reason, message)
+	ctx, cancel := context.WithTimeout(context.Background(), options.NodeConditionController_DrainTimeout)
+	defer cancel()
+	return ncc.applyConditionsWithContext(ctx)
+}
+
+func (ncc *NodeConditionController) Start() error {
+	go func() {
+		klog.Infof("NodeConditionController started.")
+		var retry <-chan time.Time
+	LOOP:
+		for {
+			select {
+			case <-ncc.stop:
+				break LOOP
+			case <-ncc.syncChan:
+			case <-retry:
+			}
+			retry = nil
+			if err := ncc.applyConditions(); err != nil {
+				klog.Errorf("apply conditions of GpuNode %s err: %v", ncc.nodeName, err)
+				retry = time.After(options.NodeConditionController_RetryInterval)
+			}
+		}
+		klog.Infof("NodeConditionController stopped.")
+	}()
+	return nil
+}
+
+// applyConditions applies all the conditions owned into GpuNode status, the ones of others are not touched.
+func (ncc *NodeConditionController) applyConditions() error {
+	return ncc.applyConditionsWithContext(context.TODO())
+}
+
+func (ncc *NodeConditionController) applyConditionsWithContext(ctx context.Context) error {
+	ncc.applyLock.Lock()
+	defer ncc.applyLock.Unlock()
+	ncc.lock.Lock()
+	conditions := make([]metav1.Condition, len(ncc.conditions))
+	for i := range ncc.conditions {
+		ncc.conditions[i].DeepCopyInto(&conditions[i])
+	}
+	ncc.lock.Unlock()
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	patch, err := serverdsutil.GpuNodeStatusApplyPatch(ncc.nodeName, metadata.MetadataNamespace(), map[string]interface{}{"conditions": conditions})
+	if err != nil {
+		return err
+	}
+	_, err = ncc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Patch(ctx, ncc.nodeName, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: options.ConditionFieldManager, Force: pointer.Bool(true)}, "status")
+	return err
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeConditionController(t *testing.T) {
+	t.Setenv("NODENAME", "node-conditions")
+	gpuClient, _ := newApplyFakeClients()
+	lastTransition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	_, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Create(context.TODO(), &gpunodev1.GpuNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-conditions", Namespace: metadata.MetadataNamespace()},
+		Status: gpunodev1.GpuNodeStatus{Conditions: []metav1.Condition{
+			{Type: gpunodev1.GpuNodeNVMLReady, Status: metav1.ConditionTrue, Reason: "DeviceQuerySucceeded", LastTransitionTime: lastTransition},
+			{Type: gpunodev1.GpuNodeAgentLeaseFresh, Status: metav1.ConditionTrue, Reason: "LeaseRenewed", LastTransitionTime: lastTransition},
+		}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ncc, err := NewNodeConditionController(gpuClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := ncc.GetCondition(gpunodev1.GpuNodeAgentLeaseFresh); cond != nil {
+		t.Errorf("condition not owned restored: %v", cond)
+	}
+
+	// the status not changed keeps the transition time before restart.
+	ncc.SetCondition(gpunodev1.GpuNodeNVMLReady, metav1.ConditionTrue, "DeviceQuerySucceeded", "The devices are queried.")
+	ncc.SetCondition(gpunodev1.GpuNodePodResourcesReady, metav1.ConditionFalse, "ListFailed", "connection refused")
+	if len(ncc.syncChan) != 1 {
+		t.Errorf("sync pending = %d, want 1", len(ncc.syncChan))
+	}
+	if err := ncc.applyConditions(); err != nil {
+		t.Fatal(err)
+	}
+
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-conditions", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nvml := meta.FindStatusCondition(gpuNode.Status.Conditions, gpunodev1.GpuNodeNVMLReady)
+	if nvml == nil || nvml.Message != "The devices are queried." || !nvml.LastTransitionTime.Equal(&lastTransition) {
+		t.Errorf("NVMLReady = %v, want transition time %v kept", nvml, lastTransition)
+	}
+	if !meta.IsStatusConditionFalse(gpuNode.Status.Conditions, gpunodev1.GpuNodePodResourcesReady) {
+		t.Errorf("PodResourcesReady not False: %v", gpuNode.Status.Conditions)
+	}
+
+	// the condition transitions.
+	ncc.SetCondition(gpunodev1.GpuNodeNVMLReady, metav1.ConditionFalse, "DeviceQueryFailed", "ERROR_UNKNOWN")
+	if cond := ncc.GetCondition(gpunodev1.GpuNodeNVMLReady); cond.LastTransitionTime.Equal(&lastTransition) {
+		t.Errorf("NVMLReady transition time not changed: %v", cond)
+	}
+}
+
+func TestNodeConditionControllerDrain(t *testing.T) {
+	t.Setenv("NODENAME", "node-drain")
+	gpuClient, _ := newApplyFakeClients()
+	_, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Create(context.TODO(), &gpunodev1.GpuNode{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-drain", Namespace: metadata.MetadataNamespace()},
+		Status: gpunodev1.GpuNodeStatus{Conditions: []metav1.Condition{
+			{Type: gpunodev1.GpuNodeDraining, Status: metav1.ConditionTrue, Reason: "AgentShutdown", LastTransitionTime: metav1.Now()},
+		}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the node drained by the last shutdown is back on restart.
+	ncc, err := NewNodeConditionController(gpuClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := ncc.GetCondition(gpunodev1.GpuNodeDraining); cond == nil || cond.Status != metav1.ConditionFalse {
+		t.Errorf("Draining = %v, want False", cond)
+	}
+
+	// drain applies at once without the controller started.
+	if err := ncc.Drain("AgentShutdown", "gpuserver-ds is shutting down"); err != nil {
+		t.Fatal(err)
+	}
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-drain", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond := meta.FindStatusCondition(gpuNode.Status.Conditions, gpunodev1.GpuNodeDraining); cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != "AgentShutdown" {
+		t.Errorf("Draining = %v, want True by AgentShutdown", cond)
+	}
+}
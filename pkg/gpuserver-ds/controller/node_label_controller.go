@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The groups of the node labels, each is enabled by the flag node-labels.
+const (
+	// NodeLabelCount is <prefix>/gpu.count, the number of gpus.
+	NodeLabelCount = "count"
+	// NodeLabelModel is <prefix>/gpu.model.<model>, the number of gpus of each model.
+	NodeLabelModel = "model"
+	// NodeLabelArchitecture is <prefix>/gpu.architecture.<architecture>, the number of gpus of each architecture.
+	NodeLabelArchitecture = "architecture"
+	// NodeLabelDriver is <prefix>/gpu.driver.major, the major version of the NVIDIA driver.
+	NodeLabelDriver = "driver"
+	// NodeLabelMig is <prefix>/gpu.mig.enabled, the number of gpus in MIG mode,
+	// and <prefix>/gpu.mig.<profile>, the number of MIG devices of each profile.
+	NodeLabelMig = "mig"
+)
+
+// NodeLabelGroups are all the groups of the node labels.
+var NodeLabelGroups = []string{NodeLabelCount, NodeLabelModel, NodeLabelArchitecture, NodeLabelDriver, NodeLabelMig}
+
+func NewNodeLabelController(kubeClient kubernetes.Interface, prefix string, groups []string, stop <-chan struct{}) (*NodeLabelController, error) {
+	if err := validatePrefix("node label", prefix); err != nil {
+		return nil, err
+	}
+	if unknown := sets.NewString(groups...).Difference(sets.NewString(NodeLabelGroups...)); unknown.Len() != 0 {
+		return nil, fmt.Errorf("unknown node labels: %v", unknown.List())
+	}
+	// the labels changed by others are restored on resync.
+	ns, err := newNodeSyncer(kubeClient, "NodeLabelController", options.NodeLabelController_ResyncPeriod, options.NodeLabelController_RetryInterval, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	nlc := &NodeLabelController{
+		nodeSyncer: ns,
+		prefix:     prefix + "/",
+		groups:     sets.NewString(groups...),
+	}
+	ns.patch = nlc.patchLabels
+	return nlc, nil
+}
+
+// NodeLabelController keeps the labels of the Node derived from the gpus on it,
+// so nodeAffinity and nodeSelector work without the scheduler extender.
+// All the labels with the prefix are owned, the ones no longer true are removed.
+type NodeLabelController struct {
+	*nodeSyncer
+	prefix string
+	groups sets.String
+}
+
+// SetNodeGpuInfo sets the gpus on the node to derive the labels from.
+func (nlc *NodeLabelController) SetNodeGpuInfo(ngi *NodeGpuInfo) {
+	if nlc == nil || ngi == nil {
+		return
+	}
+	nlc.setDesired(nodeLabels(ngi, nlc.prefix, nlc.groups))
+}
+
+// patchLabels gets the merge patch of the labels of the Node with the prefix to the desired ones.
+func (nlc *NodeLabelController) patchLabels(node *corev1.Node, desired interface{}) ([]byte, string, error) {
+	patchLabels := diffPrefixed(node.Labels, desired.(map[string]string), nlc.prefix)
+	if len(patchLabels) == 0 {
+		return nil, "", nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": patchLabels}})
+	return patch, "", err
+}
+
+// nodeLabels derives the labels in groups from the gpus, prefix ends with a slash.
+func nodeLabels(ngi *NodeGpuInfo, prefix string, groups sets.String) map[string]string {
+	labels := make(map[string]string)
+	if groups.Has(NodeLabelCount) {
+		labels[prefix+"gpu.count"] = strconv.Itoa(len(ngi.GpuInfos))
+	}
+	if groups.Has(NodeLabelModel) {
+		for model, dids := range ngi.Models {
+			if name := util.ToQualifiedName("gpu.model." + model); name != "" {
+				labels[prefix+name] = strconv.Itoa(dids.Len())
+			}
+		}
+	}
+	if groups.Has(NodeLabelArchitecture) {
+		archCount := make(map[string]int)
+		for _, gi := range ngi.GpuInfos {
+			if gi.Architecture != "" {
+				archCount[gi.Architecture]++
+			}
+		}
+		for arch, count := range archCount {
+			if name := util.ToQualifiedName("gpu.architecture." + arch); name != "" {
+				labels[prefix+name] = strconv.Itoa(count)
+			}
+		}
+	}
+	if groups.Has(NodeLabelDriver) && ngi.DriverVersion != "" {
+		labels[prefix+"gpu.driver.major"] = strings.SplitN(ngi.DriverVersion, ".", 2)[0]
+	}
+	if groups.Has(NodeLabelMig) {
+		var migEnabled int
+		for _, gi := range ngi.GpuInfos {
+			if gi.MigEnabled {
+				migEnabled++
+			}
+		}
+		if migEnabled != 0 {
+			labels[prefix+"gpu.mig.enabled"] = strconv.Itoa(migEnabled)
+		}
+		for profile, mids := range ngi.MigProfiles {
+			if name := util.ToQualifiedName("gpu.mig." + profile); name != "" {
+				labels[prefix+name] = strconv.Itoa(mids.Len())
+			}
+		}
+	}
+	return labels
+}
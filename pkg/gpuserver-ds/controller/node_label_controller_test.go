@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeLabels(t *testing.T) {
+	ngi := &NodeGpuInfo{
+		GpuInfos: map[string]*GpuInfo{
+			"GPU-0": {DeviceId: "GPU-0", Architecture: "Turing"},
+			"GPU-1": {DeviceId: "GPU-1", Architecture: "Ampere", MigEnabled: true},
+			"GPU-2": {DeviceId: "GPU-2", Architecture: "Ampere"},
+		},
+		Models:        map[string]sets.String{"tesla t4": sets.NewString("GPU-0"), "a100-sxm4-40gb": sets.NewString("GPU-1", "GPU-2")},
+		MigProfiles:   map[string]sets.String{"1g.5gb": sets.NewString("MIG-0", "MIG-1")},
+		DriverVersion: "470.57.02",
+	}
+	var tests = []struct {
+		name   string
+		groups []string
+		want   map[string]string
+	}{
+		{
+			name:   "all",
+			groups: NodeLabelGroups,
+			want: map[string]string{
+				"gpu/gpu.count":                "3",
+				"gpu/gpu.model.tesla-t4":       "1",
+				"gpu/gpu.model.a100-sxm4-40gb": "2",
+				"gpu/gpu.architecture.turing":  "1",
+				"gpu/gpu.architecture.ampere":  "2",
+				"gpu/gpu.driver.major":         "470",
+				"gpu/gpu.mig.enabled":          "1",
+				"gpu/gpu.mig.1g.5gb":           "2",
+			},
+		},
+		{
+			name:   "model and driver",
+			groups: []string{NodeLabelModel, NodeLabelDriver},
+			want: map[string]string{
+				"gpu/gpu.model.tesla-t4":       "1",
+				"gpu/gpu.model.a100-sxm4-40gb": "2",
+				"gpu/gpu.driver.major":         "470",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nodeLabels(ngi, "gpu/", sets.NewString(tt.groups...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodeLabels() = %v, want %v", got, tt.want)
+			}
+			for k, v := range got {
+				if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+					t.Errorf("invalid label key %s: %v", k, errs)
+				}
+				if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+					t.Errorf("invalid label value %s: %v", v, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeLabelControllerSync(t *testing.T) {
+	t.Setenv("NODENAME", "node-labels")
+	kubeClient := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-labels", Labels: map[string]string{
+		"kubernetes.io/hostname":     "node-labels",
+		"gpu/gpu.count":              "2",
+		"gpu/gpu.model.tesla-v100":   "2",
+		"gpu/gpu.architecture.volta": "2",
+	}}})
+	if _, err := NewNodeLabelController(kubeClient, "gpu/x", NodeLabelGroups, nil); err == nil {
+		t.Errorf("invalid prefix accepted")
+	}
+	if _, err := NewNodeLabelController(kubeClient, "gpu", []string{"memory"}, nil); err == nil {
+		t.Errorf("unknown label group accepted")
+	}
+	nlc, err := NewNodeLabelController(kubeClient, "gpu", []string{NodeLabelCount, NodeLabelModel}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nlc.SetNodeGpuInfo(&NodeGpuInfo{
+		GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}, "GPU-1": {DeviceId: "GPU-1"}},
+		Models:   map[string]sets.String{"tesla t4": sets.NewString("GPU-0", "GPU-1")},
+	})
+	if len(nlc.syncChan) != 1 {
+		t.Errorf("sync pending = %d, want 1", len(nlc.syncChan))
+	}
+	if err := nlc.sync(); err != nil {
+		t.Fatal(err)
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(context.TODO(), "node-labels", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"kubernetes.io/hostname": "node-labels",
+		"gpu/gpu.count":          "2",
+		"gpu/gpu.model.tesla-t4": "2",
+	}
+	if !reflect.DeepEqual(node.Labels, want) {
+		t.Errorf("labels = %v, want %v", node.Labels, want)
+	}
+
+	// the labels not changed are not patched again.
+	kubeClient.ClearActions()
+	if err := nlc.sync(); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("labels not changed patched")
+		}
+	}
+}
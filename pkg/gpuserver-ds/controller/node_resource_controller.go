@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"encoding/json"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+func NewNodeResourceController(kubeClient kubernetes.Interface, prefix string, stop <-chan struct{}) (*NodeResourceController, error) {
+	if err := validatePrefix("model resource", prefix); err != nil {
+		return nil, err
+	}
+	// the extended resources changed by others are restored on resync.
+	ns, err := newNodeSyncer(kubeClient, "NodeResourceController", options.NodeResourceController_ResyncPeriod, options.NodeResourceController_RetryInterval, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	nrc := &NodeResourceController{
+		nodeSyncer: ns,
+		prefix:     prefix,
+	}
+	ns.patch = nrc.patchResources
+	return nrc, nil
+}
+
+// NodeResourceController advertises the gpus of each model as the extended resource <prefix>/<model> of the Node,
+// so the pods request the model directly without patching kubelet and the device plugin.
+// The extended resources are counted by the scheduler only, kubelet still allocates the gpus by the device plugin.
+// All the extended resources with the prefix are owned, the ones of the models gone are removed.
+type NodeResourceController struct {
+	*nodeSyncer
+	prefix string
+}
+
+// SetNodeGpuInfo sets the gpus on the node to derive the extended resources from.
+func (nrc *NodeResourceController) SetNodeGpuInfo(ngi *NodeGpuInfo) {
+	if nrc == nil || ngi == nil {
+		return
+	}
+	nrc.setDesired(modelResources(ngi, nrc.prefix))
+}
+
+// patchResources gets the merge patch of the capacity and allocatable of the Node with the prefix to the desired ones.
+func (nrc *NodeResourceController) patchResources(node *corev1.Node, desired interface{}) ([]byte, string, error) {
+	resources := resourceStrings(desired.(corev1.ResourceList))
+	patchCapacity := diffPrefixed(resourceStrings(node.Status.Capacity), resources, nrc.prefix+"/")
+	patchAllocatable := diffPrefixed(resourceStrings(node.Status.Allocatable), resources, nrc.prefix+"/")
+	if len(patchCapacity) == 0 && len(patchAllocatable) == 0 {
+		return nil, "", nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{"status": map[string]interface{}{"capacity": patchCapacity, "allocatable": patchAllocatable}})
+	return patch, "status", err
+}
+
+// resourceStrings gets the canonical quantities of the resources, so the equal ones are compared equal.
+func resourceStrings(resources corev1.ResourceList) map[string]string {
+	strs := make(map[string]string, len(resources))
+	for name, q := range resources {
+		strs[string(name)] = q.String()
+	}
+	return strs
+}
+
+// modelResources derives the extended resources from the gpus of each model, the gpus in MIG mode are not counted.
+func modelResources(ngi *NodeGpuInfo, prefix string) corev1.ResourceList {
+	resources := make(corev1.ResourceList)
+	for model, dids := range ngi.Models {
+		if name := util.ModelResourceName(prefix, model); name != "" {
+			resources[corev1.ResourceName(name)] = *resource.NewQuantity(int64(dids.Len()), resource.DecimalSI)
+		}
+	}
+	return resources
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeResourceControllerSync(t *testing.T) {
+	t.Setenv("NODENAME", "node-resources")
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:                resource.MustParse("8"),
+		"nvidia.com/gpu":                  resource.MustParse("4"),
+		"nvidia-gpu-scheduler/tesla-v100": resource.MustParse("2"),
+		"nvidia-gpu-scheduler/tesla-t4":   resource.MustParse("1"),
+	}
+	kubeClient := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-resources"},
+		Status:     corev1.NodeStatus{Capacity: resources.DeepCopy(), Allocatable: resources.DeepCopy()},
+	})
+	if _, err := NewNodeResourceController(kubeClient, "Nvidia GPU", nil); err == nil {
+		t.Errorf("invalid prefix accepted")
+	}
+	nrc, err := NewNodeResourceController(kubeClient, "nvidia-gpu-scheduler", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nrc.SetNodeGpuInfo(&NodeGpuInfo{
+		GpuInfos: map[string]*GpuInfo{"GPU-0": {DeviceId: "GPU-0"}, "GPU-1": {DeviceId: "GPU-1"}, "GPU-2": {DeviceId: "GPU-2", MigEnabled: true}},
+		Models:   map[string]sets.String{"tesla t4": sets.NewString("GPU-0", "GPU-1")},
+	})
+	if len(nrc.syncChan) != 1 {
+		t.Errorf("sync pending = %d, want 1", len(nrc.syncChan))
+	}
+	if err := nrc.sync(); err != nil {
+		t.Fatal(err)
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(context.TODO(), "node-resources", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := corev1.ResourceList{
+		corev1.ResourceCPU:              resource.MustParse("8"),
+		"nvidia.com/gpu":                resource.MustParse("4"),
+		"nvidia-gpu-scheduler/tesla-t4": resource.MustParse("2"),
+	}
+	for _, got := range []corev1.ResourceList{node.Status.Capacity, node.Status.Allocatable} {
+		if len(got) != len(want) {
+			t.Errorf("resources = %v, want %v", got, want)
+		}
+		for name, q := range want {
+			if gq, exist := got[name]; !exist || gq.Cmp(q) != 0 {
+				t.Errorf("resource %s = %v, want %v", name, got[name], q)
+			}
+		}
+	}
+
+	// the resources not changed are not patched again.
+	kubeClient.ClearActions()
+	if err := nrc.sync(); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("resources not changed patched")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+func newNodeSyncer(kubeClient kubernetes.Interface, name string, resyncPeriod, retryInterval time.Duration, stop <-chan struct{}) (*nodeSyncer, error) {
+	nodeName := os.Getenv("NODENAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("unable get env NODENAME")
+	}
+
+	return &nodeSyncer{
+		kubeClient:    kubeClient,
+		nodeName:      nodeName,
+		name:          name,
+		resyncPeriod:  resyncPeriod,
+		retryInterval: retryInterval,
+		stop:          stop,
+		syncChan:      make(chan struct{}, 1),
+	}, nil
+}
+
+// nodeSyncer keeps a part of the Node in the state desired by a controller.
+// The changes of the desired state are coalesced into one sync,
+// the Node is synced again on resync to restore the changes by others, and on retry after an error.
+type nodeSyncer struct {
+	kubeClient    kubernetes.Interface
+	nodeName      string
+	name          string
+	resyncPeriod  time.Duration
+	retryInterval time.Duration
+	stop          <-chan struct{}
+	// patch gets the merge patch of the Node to the desired state and the subresource patched, nil patch means nothing to do.
+	patch func(node *corev1.Node, desired interface{}) ([]byte, string, error)
+	lock  sync.Mutex
+	// desired is the state desired, nil means the gpus are not checked yet.
+	desired  interface{}
+	syncChan chan struct{}
+}
+
+// setDesired sets the state desired, a sync is triggered if it changed.
+func (ns *nodeSyncer) setDesired(desired interface{}) {
+	ns.lock.Lock()
+	if reflect.DeepEqual(ns.desired, desired) {
+		ns.lock.Unlock()
+		return
+	}
+	ns.desired = desired
+	ns.lock.Unlock()
+
+	select {
+	case ns.syncChan <- struct{}{}:
+	default:
+		// a sync is pending already
+	}
+}
+
+func (ns *nodeSyncer) Start() error {
+	go func() {
+		klog.Infof("%s started.", ns.name)
+		var retry <-chan time.Time
+		ticker := time.NewTicker(ns.resyncPeriod)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-ns.stop:
+				break LOOP
+			case <-ns.syncChan:
+			case <-ticker.C:
+			case <-retry:
+			}
+			retry = nil
+			if err := ns.sync(); err != nil {
+				klog.Errorf("%s sync node %s err: %v", ns.name, ns.nodeName, err)
+				retry = time.After(ns.retryInterval)
+			}
+		}
+		klog.Infof("%s stopped.", ns.name)
+	}()
+	return nil
+}
+
+// sync patches the Node to the desired state.
+func (ns *nodeSyncer) sync() error {
+	ns.lock.Lock()
+	desired := ns.desired
+	ns.lock.Unlock()
+	if desired == nil {
+		return nil
+	}
+
+	node, err := ns.kubeClient.CoreV1().Nodes().Get(context.TODO(), ns.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	patch, subresource, err := ns.patch(node, desired)
+	if err != nil || patch == nil {
+		return err
+	}
+	var subresources []string
+	if subresource != "" {
+		subresources = append(subresources, subresource)
+	}
+	if _, err = ns.kubeClient.CoreV1().Nodes().Patch(context.TODO(), ns.nodeName, types.MergePatchType, patch, metav1.PatchOptions{}, subresources...); err != nil {
+		return err
+	}
+	klog.Infof("%s node:%s patched: %s", ns.name, ns.nodeName, patch)
+	return nil
+}
+
+// validatePrefix checks the prefix of the names owned, which is a DNS subdomain.
+func validatePrefix(kind, prefix string) error {
+	if errs := validation.IsDNS1123Subdomain(prefix); len(errs) != 0 {
+		return fmt.Errorf("invalid %s prefix %q: %s", kind, prefix, strings.Join(errs, ","))
+	}
+	return nil
+}
+
+// diffPrefixed gets the merge patch of the map from current to desired, the keys with the prefix not desired are removed by nil.
+func diffPrefixed(current, desired map[string]string, prefix string) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for k, v := range desired {
+		if cv, exist := current[k]; !exist || cv != v {
+			patch[k] = v
+		}
+	}
+	for k := range current {
+		if _, exist := desired[k]; !exist && strings.HasPrefix(k, prefix) {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
@@ -1,120 +1,169 @@
 package controller
 
 import (
-	"context"
 	"fmt"
-	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"os"
+
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
-	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
-	"os"
-	"time"
 )
 
+// PodEventType is the type of PodEvent.
+type PodEventType string
+
+const (
+	// PodEventSync means the gpu pod is running, its devices may be allocated.
+	PodEventSync PodEventType = "Sync"
+	// PodEventDelete means the gpu pod is deleted, its devices are freed.
+	PodEventDelete PodEventType = "Delete"
+)
+
+// PodEvent tells which gpu pod on the node changed.
+type PodEvent struct {
+	Type      PodEventType
+	Namespace string
+	Name      string
+	UID       types.UID
+}
+
+// Key returns the key of the pod like the key of podresourcesLast.
+func (pe *PodEvent) Key() string {
+	return pe.Namespace + "/" + pe.Name
+}
+
+// PodUIDIndex indexes the pods by uid.
+const PodUIDIndex = "uid"
+
 func NewPodWatcher(kubeclient kubernetes.Interface, stop <-chan struct{}) (*PodWatcher, error) {
 	nodeName := os.Getenv("NODENAME")
 	if nodeName == "" {
 		return nil, fmt.Errorf("unable get env NODENAME")
 	}
 
-	return &PodWatcher{
-		nodeName:   nodeName,
-		kubeclient: kubeclient,
-		stop:       stop,
-		goonChan:   make(chan struct{}),
-		removeChan: make(chan *PodResourceUpdate),
-	}, nil
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeclient, options.PodWatcher_ResyncPeriod,
+		informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+			lo.FieldSelector = "spec.nodeName=" + nodeName
+		}))
+	podInformer := factory.Core().V1().Pods()
+	err := podInformer.Informer().AddIndexers(cache.Indexers{PodUIDIndex: func(obj interface{}) ([]string, error) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return nil, nil
+		}
+		return []string{string(pod.UID)}, nil
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("unable add pod uid indexer: %v", err)
+	}
+
+	pw := &PodWatcher{
+		nodeName:  nodeName,
+		factory:   factory,
+		informer:  podInformer.Informer(),
+		lister:    podInformer.Lister(),
+		stop:      stop,
+		eventChan: make(chan *PodEvent, options.PodWatcher_EventBufferSize),
+	}
+	pw.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: pw.onPodUpdate,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			pw.onPodUpdate(newObj)
+		},
+		DeleteFunc: pw.onPodDelete,
+	})
+	return pw, nil
 }
 
-// PodWatcher watch the pod from of each node, filter by gpu and pod condition running.
+// PodWatcher watch the pod from of each node with a node-scoped shared informer, filter by gpu and pod condition running.
+// It emits PodEvent of the gpu pods, each pod is emitted again every resync period.
 type PodWatcher struct {
-	nodeName   string
-	kubeclient kubernetes.Interface
-	stop       <-chan struct{}
-	// Signal the server the gpu pod on the node is sync. which means the gpu info changed.
-	goonChan chan struct{}
-	// Signal the server the gpu pod on the node is deleted, which means the gpu is freed.
-	removeChan chan *PodResourceUpdate
+	nodeName string
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   corelisters.PodLister
+	stop     <-chan struct{}
+	// Signal the server which gpu pod on the node is synced or deleted.
+	eventChan chan *PodEvent
 }
 
+// Start starts the informer and waits for the cache synced, it stops with stop chan.
 func (pw *PodWatcher) Start() error {
-	wthcxt, wthcxtcancel := context.WithCancel(context.TODO())
-	wthopt := metav1.ListOptions{FieldSelector: "spec.nodeName=" + pw.nodeName}
-	podwatch, err := pw.kubeclient.CoreV1().Pods(metav1.NamespaceAll).Watch(wthcxt, wthopt)
-	if err != nil {
-		wthcxtcancel()
-		return fmt.Errorf("unable Watch pods: %v", err)
+	pw.factory.Start(pw.stop)
+	if !cache.WaitForCacheSync(pw.stop, pw.informer.HasSynced) {
+		return fmt.Errorf("unable to sync pod informer of node %s", pw.nodeName)
 	}
+	klog.Infof("PodWatcher started.")
+	return nil
+}
 
-	go func() {
-		defer wthcxtcancel()
-		klog.Infof("PodWatcher started.")
-		for {
-			select {
-			case rc, ok := <-podwatch.ResultChan():
-				if !ok {
-					klog.Errorf("podwatch stoped. sleep %v then reconnect", options.PodWatcher_WATCH_RECONNECT_INTERVAL)
-					podwatch, err = pw.kubeclient.CoreV1().Pods(metav1.NamespaceAll).Watch(wthcxt, wthopt)
-					if err != nil {
-						klog.Errorf("unable Watch pods: %v", err)
-					}
-					time.Sleep(options.PodWatcher_WATCH_RECONNECT_INTERVAL)
-					pw.goonChan <- struct{}{}
-					continue
-				}
-
-				klog.V(1).Infof("[%v] resevent Type:%v,Object:%p", ok, rc.Type, rc.Object)
-				switch rc.Type {
-				case watch.Modified:
-					pod, ispod := rc.Object.(*corev1.Pod)
-					if ispod && isActivePod(pod) && isGpuPod(pod) {
-						klog.Infof("got a new gpu pod running: %s/%s", pod.Namespace, pod.Name)
-						pw.goonChan <- struct{}{}
-						continue
-					}
-					if !ispod {
-						klog.Errorf("not a pod")
-					} else {
-						klog.V(1).Infof("pod %s/%s status:%s", pod.Namespace, pod.Name, pod.Status.Phase)
-					}
-
-				case watch.Deleted:
-					pod, ispod := rc.Object.(*corev1.Pod)
-					if !ispod {
-						klog.Errorf("watch Deleted, not a pod")
-						continue
-					}
-					//care only about gpu pod
-					if !isGpuPod(pod) {
-						continue
-					}
-					klog.Infof("got a new gpu pod deleted: %s/%s", pod.Namespace, pod.Name)
-
-					//notice remove
-					prupdate := &PodResourceUpdate{PodResourcesSYNC: make([]*PodResourcesDetail, 0), PodResourcesDEL: []*podresourcesapi.PodResources{{}}}
-					prupdate.PodResourcesDEL[0].Namespace = pod.Namespace
-					prupdate.PodResourcesDEL[0].Name = pod.Name
-					pw.removeChan <- prupdate
-				}
-			case <-pw.stop:
-				klog.Info("PodWatcher exit with stop siganl")
-			}
+func (pw *PodWatcher) onPodUpdate(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		klog.Errorf("not a pod: %T", obj)
+		return
+	}
+	if !isActivePod(pod) || !isGpuPod(pod) {
+		klog.V(4).Infof("pod %s/%s status:%s", pod.Namespace, pod.Name, pod.Status.Phase)
+		return
+	}
+	klog.V(1).Infof("got a gpu pod running: %s/%s", pod.Namespace, pod.Name)
+	pw.emit(&PodEvent{Type: PodEventSync, Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID})
+}
+
+func (pw *PodWatcher) onPodDelete(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			klog.Errorf("watch Deleted, not a pod: %T", obj)
+			return
 		}
-	}()
+		if pod, ok = tombstone.Obj.(*corev1.Pod); !ok {
+			klog.Errorf("watch Deleted, tombstone not a pod: %T", tombstone.Obj)
+			return
+		}
+	}
+	//care only about gpu pod
+	if !isGpuPod(pod) {
+		return
+	}
+	klog.Infof("got a gpu pod deleted: %s/%s", pod.Namespace, pod.Name)
+	pw.emit(&PodEvent{Type: PodEventDelete, Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID})
+}
 
-	return nil
+// emit sends the event unless stopped, so the informer handler never blocks after stop.
+func (pw *PodWatcher) emit(event *PodEvent) {
+	select {
+	case pw.eventChan <- event:
+	case <-pw.stop:
+	}
 }
 
-func (pw *PodWatcher) GetSyncChan() <-chan struct{} {
-	return pw.goonChan
+func (pw *PodWatcher) GetEventChan() <-chan *PodEvent {
+	return pw.eventChan
+}
+
+// GetPodByUID gets the pod on the node from the informer cache, nil is returned if not found.
+func (pw *PodWatcher) GetPodByUID(uid types.UID) (*corev1.Pod, error) {
+	objs, err := pw.informer.GetIndexer().ByIndex(PodUIDIndex, string(uid))
+	if err != nil || len(objs) == 0 {
+		return nil, err
+	}
+	return objs[0].(*corev1.Pod), nil
 }
 
-func (pw *PodWatcher) GetRemoveChan() <-chan *PodResourceUpdate {
-	return pw.removeChan
+// Lister returns the lister of the pods on the node.
+func (pw *PodWatcher) Lister() corelisters.PodLister {
+	return pw.lister
 }
 
 func isActivePod(pod *corev1.Pod) bool {
@@ -124,26 +173,24 @@ func isActivePod(pod *corev1.Pod) bool {
 	return true
 }
 
+// isGpuPod tells whether any container of the pod, including init containers, requests gpus or MIG devices.
 func isGpuPod(pod *corev1.Pod) bool {
-	isGpuPod := false
-
-	for _, c := range pod.Spec.Containers {
-		if c.Resources.Limits != nil {
-			if gpulimit, exist := c.Resources.Limits[options.NVIDIAGPUResourceName]; exist {
-				if !gpulimit.IsZero() {
-					isGpuPod = true
-					break
-				}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			if hasGpuResource(c.Resources.Limits) || hasGpuResource(c.Resources.Requests) {
+				return true
 			}
 		}
-		if c.Resources.Requests != nil {
-			if gpureq, exist := c.Resources.Requests[options.NVIDIAGPUResourceName]; exist {
-				if !gpureq.IsZero() {
-					isGpuPod = true
-					break
-				}
-			}
+	}
+	return false
+}
+
+// hasGpuResource tells whether any gpu resource name tracked or MIG device is in the resource list.
+func hasGpuResource(rl corev1.ResourceList) bool {
+	for name, quantity := range rl {
+		if (util.IsGpuResourceName(string(name)) || serverdsutil.IsMigResourceName(string(name))) && !quantity.IsZero() {
+			return true
 		}
 	}
-	return isGpuPod
+	return false
 }
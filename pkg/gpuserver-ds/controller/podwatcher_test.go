@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPod(name string, gpu int64, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: k8stypes.UID("uid-" + name)},
+		Spec: corev1.PodSpec{
+			NodeName: "node-watcher",
+			Containers: []corev1.Container{{
+				Name: "c",
+				Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					options.NVIDIAGPUResourceName: *resource.NewQuantity(gpu, resource.DecimalExponent),
+				}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestPodWatcher(t *testing.T) {
+	t.Setenv("NODENAME", "node-watcher")
+	kubeClient := fake.NewSimpleClientset(
+		newTestPod("gpu-running", 1, corev1.PodRunning),
+		newTestPod("gpu-pending", 1, corev1.PodPending),
+		newTestPod("cpu-running", 0, corev1.PodRunning),
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	pw, err := NewPodWatcher(kubeClient, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(want PodEventType, name string) {
+		t.Helper()
+		select {
+		case pe := <-pw.GetEventChan():
+			if pe.Type != want || pe.Name != name || pe.Key() != "default/"+name {
+				t.Fatalf("got event %#v, want %s of %s", pe, want, name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for event %s of %s", want, name)
+		}
+	}
+	expect(PodEventSync, "gpu-running")
+
+	if pod, err := pw.GetPodByUID("uid-gpu-pending"); err != nil || pod == nil || pod.Name != "gpu-pending" {
+		t.Errorf("GetPodByUID() = %v, %v", pod, err)
+	}
+
+	_, err = kubeClient.CoreV1().Pods("default").UpdateStatus(context.TODO(), newTestPod("gpu-pending", 1, corev1.PodRunning), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(PodEventSync, "gpu-pending")
+
+	for _, name := range []string{"cpu-running", "gpu-running"} {
+		if err := kubeClient.CoreV1().Pods("default").Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(PodEventDelete, "gpu-running")
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/procfs"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// PodGetter gets the pod on the node by uid, nil is returned if not found.
+type PodGetter func(uid types.UID) (*corev1.Pod, error)
+
+func NewProcessChecker(provider device.Provider, procRoot string, getPod PodGetter, checkInterval time.Duration, stop <-chan struct{}) *ProcessChecker {
+	return &ProcessChecker{
+		provider:      provider,
+		procRoot:      procRoot,
+		getPod:        getPod,
+		checkInterval: checkInterval,
+		stop:          stop,
+		processChan:   make(chan map[string][]*GpuProcess),
+	}
+}
+
+// ProcessChecker lists the processes running on each gpu each interval, and maps each of them to the pod and container
+// through /proc/<pid>/cgroup, which needs the host pid namespace.
+// It signals the processes of each gpu when they change.
+type ProcessChecker struct {
+	provider      device.Provider
+	procRoot      string
+	getPod        PodGetter
+	checkInterval time.Duration
+	stop          <-chan struct{}
+	processChan   chan map[string][]*GpuProcess
+	processesLast map[string][]*GpuProcess
+}
+
+func (pc *ProcessChecker) Start() error {
+	if pc.checkInterval <= 0 {
+		klog.Infof("ProcessChecker disabled")
+		return nil
+	}
+
+	go func() {
+		klog.Infof("ProcessChecker started with check interval:%v", pc.checkInterval)
+		ticker := time.NewTicker(pc.checkInterval)
+		defer ticker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-ticker.C:
+				processes := pc.checkProcesses()
+				if processes == nil || reflect.DeepEqual(pc.processesLast, processes) {
+					continue
+				}
+				pc.processesLast = processes
+				select {
+				case pc.processChan <- processes:
+				case <-pc.stop:
+					break LOOP
+				}
+
+			case <-pc.stop:
+				break LOOP
+			}
+		}
+		klog.Infof("ProcessChecker stopped")
+	}()
+	return nil
+}
+
+// checkProcesses gets the processes of all the devices sorted by pid, nil is returned if the devices can not be counted.
+// The process whose cgroup can not be read is skipped, it may exit already.
+func (pc *ProcessChecker) checkProcesses() map[string][]*GpuProcess {
+	count, err := pc.provider.GetDeviceCount()
+	if err != nil {
+		klog.Errorf("checkProcesses unable to get device count: %v", err)
+		return nil
+	}
+
+	processes := make(map[string][]*GpuProcess)
+	for i := 0; i < count; i++ {
+		d, err := pc.provider.GetDeviceByIndex(i)
+		if err != nil {
+			klog.Errorf("checkProcesses unable to get device at index %d: %v", i, err)
+			continue
+		}
+		did, err := d.GetUUID()
+		if err != nil {
+			klog.Errorf("checkProcesses unable to get device uuid at index %d: %v", i, err)
+			continue
+		}
+		infos, err := d.GetRunningProcesses()
+		if err != nil {
+			klog.Errorf("checkProcesses unable to get processes of device %s: %v", did, err)
+			continue
+		}
+		for _, info := range infos {
+			p, err := pc.toGpuProcess(info)
+			if err != nil {
+				klog.V(4).Infof("checkProcesses skip process %d of device %s: %v", info.Pid, did, err)
+				continue
+			}
+			processes[did] = append(processes[did], p)
+		}
+		sort.Slice(processes[did], func(i, j int) bool { return processes[did][i].Pid < processes[did][j].Pid })
+	}
+	return processes
+}
+
+func (pc *ProcessChecker) toGpuProcess(info device.ProcessInfo) (*GpuProcess, error) {
+	p := &GpuProcess{Pid: info.Pid, Type: info.Type}
+	podContainer, err := procfs.GetPodContainer(pc.procRoot, info.Pid)
+	if err != nil {
+		return nil, err
+	}
+	if podContainer == nil {
+		return p, nil
+	}
+	p.ContainerId = podContainer.ContainerId
+	pod, err := pc.getPod(podContainer.PodUID)
+	if err != nil {
+		return nil, err
+	}
+	if pod != nil {
+		p.PodNamespace, p.PodName = pod.Namespace, pod.Name
+	}
+	return p, nil
+}
+
+func (pc *ProcessChecker) GetProcessChan() <-chan map[string][]*GpuProcess {
+	return pc.processChan
+}
+
+// foreignOccupation finds the processes running on the gpus not allocated to their pods by kubelet.
+// The gpu in MIG mode is allocated to a pod if any of its MIG devices is.
+func foreignOccupation(processes map[string][]*GpuProcess, prm map[string]*podresourcesapi.PodResources,
+	migDevices map[string]*MigDeviceInfo) map[string]*DeviceOccupation {
+	allocated := make(map[string]map[string]bool, len(prm))
+	for podidx, pr := range prm {
+		allocated[podidx] = make(map[string]bool)
+		for _, cr := range pr.Containers {
+			for _, d := range cr.Devices {
+				for _, did := range d.DeviceIds {
+					allocated[podidx][did] = true
+					if mig := serverdsutil.FindMigDevice(migDevices, did); mig != nil {
+						allocated[podidx][mig.ParentId] = true
+					}
+				}
+			}
+		}
+	}
+
+	occupation := make(map[string]*DeviceOccupation)
+	for did, ps := range processes {
+		for _, p := range ps {
+			if p.PodName != "" && allocated[p.PodNamespace+"/"+p.PodName][did] {
+				continue
+			}
+			if occupation[did] == nil {
+				occupation[did] = &DeviceOccupation{Message: ForeignProcessMessage}
+			}
+			occupation[did].Processes = append(occupation[did].Processes, p)
+		}
+	}
+	return occupation
+}
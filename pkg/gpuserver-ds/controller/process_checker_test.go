@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	processPodUID      = "6b0e4c1a-2f3d-4e5f-8a9b-0c1d2e3f4a5b"
+	processContainerId = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func TestProcessCheckerCheckProcesses(t *testing.T) {
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "inventory.yaml")
+	err := os.WriteFile(inventory, []byte(`
+devices:
+- uuid: GPU-proc-0
+  processes:
+  - {pid: 200, type: graphics}
+  - {pid: 100}
+  - {pid: 300}
+- uuid: GPU-proc-1
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procRoot := filepath.Join(dir, "proc")
+	for pid, cgroup := range map[string]string{
+		"100": "0::/kubepods/pod" + processPodUID + "/" + processContainerId + "\n",
+		"200": "0::/system.slice/Xorg.service\n",
+		// 300 exits
+	} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "cgroup"), []byte(cgroup), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getPod := func(uid types.UID) (*corev1.Pod, error) {
+		if uid != processPodUID {
+			return nil, nil
+		}
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod", UID: uid}}, nil
+	}
+
+	pc := NewProcessChecker(provider, procRoot, getPod, 0, nil)
+	want := map[string][]*GpuProcess{"GPU-proc-0": {
+		{Pid: 100, Type: device.ProcessTypeCompute, PodNamespace: "default", PodName: "pod", ContainerId: processContainerId},
+		{Pid: 200, Type: device.ProcessTypeGraphics},
+	}}
+	if got := pc.checkProcesses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("checkProcesses() = %v, want %v", got, want)
+	}
+}
+
+func TestForeignOccupation(t *testing.T) {
+	prm := map[string]*podresourcesapi.PodResources{
+		"default/pod": {Namespace: "default", Name: "pod", Containers: []*podresourcesapi.ContainerResources{{
+			Name:    "c",
+			Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"}}},
+		}}},
+		"default/mig": {Namespace: "default", Name: "mig", Containers: []*podresourcesapi.ContainerResources{{
+			Name:    "c",
+			Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: []string{"MIG-0"}}},
+		}}},
+	}
+	migDevices := map[string]*MigDeviceInfo{"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-2"}}
+	var tests = []struct {
+		name      string
+		processes map[string][]*GpuProcess
+		want      []string
+	}{
+		{
+			name: "allocated",
+			processes: map[string][]*GpuProcess{
+				"GPU-0": {{Pid: 1, PodNamespace: "default", PodName: "pod"}},
+				"GPU-2": {{Pid: 2, PodNamespace: "default", PodName: "mig"}},
+			},
+			want: []string{},
+		},
+		{
+			name:      "host process",
+			processes: map[string][]*GpuProcess{"GPU-1": {{Pid: 1}}},
+			want:      []string{"GPU-1"},
+		},
+		{
+			name:      "pod without the gpu allocated",
+			processes: map[string][]*GpuProcess{"GPU-1": {{Pid: 1, PodNamespace: "default", PodName: "pod"}}},
+			want:      []string{"GPU-1"},
+		},
+		{
+			name:      "pod not requesting gpu",
+			processes: map[string][]*GpuProcess{"GPU-0": {{Pid: 1, PodNamespace: "default", PodName: "privileged"}}},
+			want:      []string{"GPU-0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := foreignOccupation(tt.processes, prm, migDevices)
+			dids := make([]string, 0, len(got))
+			for did, occupation := range got {
+				if occupation.Message != ForeignProcessMessage {
+					t.Errorf("unexpected message: %s", occupation.Message)
+				}
+				dids = append(dids, did)
+			}
+			if !reflect.DeepEqual(dids, tt.want) {
+				t.Errorf("foreignOccupation() = %v, want %v", dids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/metrics"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"k8s.io/utils/pointer"
+)
+
+func NewTelemetryController(provider device.Provider, gpuClient gpuclientset.Interface, sampleInterval, publishInterval time.Duration, stop <-chan struct{}) (*TelemetryController, error) {
+	nodeName := os.Getenv("NODENAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("unable get env NODENAME")
+	}
+	if publishInterval < sampleInterval {
+		publishInterval = sampleInterval
+	}
+
+	return &TelemetryController{
+		provider:        provider,
+		gpuClient:       gpuClient,
+		nodeName:        nodeName,
+		sampleInterval:  sampleInterval,
+		publishInterval: publishInterval,
+		stop:            stop,
+	}, nil
+}
+
+// TelemetryController samples the live state of each gpu on the node each sampleInterval,
+// and publishes the latest sample into GpuNode status at most once each publishInterval.
+// The GpuNode is created by ServerDSController, publish is skipped until it exists.
+type TelemetryController struct {
+	provider        device.Provider
+	gpuClient       gpuclientset.Interface
+	nodeName        string
+	sampleInterval  time.Duration
+	publishInterval time.Duration
+	stop            <-chan struct{}
+	// the latest telemetry not published yet.
+	pending map[string]*GpuTelemetry
+}
+
+func (tc *TelemetryController) Start() error {
+	if tc.sampleInterval <= 0 {
+		klog.Infof("TelemetryController disabled")
+		return nil
+	}
+
+	go func() {
+		klog.Infof("TelemetryController started with sample interval:%v publish interval:%v", tc.sampleInterval, tc.publishInterval)
+		sampleTicker := time.NewTicker(tc.sampleInterval)
+		defer sampleTicker.Stop()
+		publishTicker := time.NewTicker(tc.publishInterval)
+		defer publishTicker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-sampleTicker.C:
+				tc.pending = tc.sampleTelemetry()
+				metrics.DefaultStore.SetTelemetry(tc.pending)
+
+			case <-publishTicker.C:
+				if tc.pending == nil {
+					continue
+				}
+				if err := tc.publishTelemetry(tc.pending); err != nil {
+					klog.Errorf("node:%s publishTelemetry err:%v", tc.nodeName, err)
+					continue
+				}
+				tc.pending = nil
+
+			case <-tc.stop:
+				break LOOP
+			}
+		}
+		klog.Infof("TelemetryController stopped")
+	}()
+	return nil
+}
+
+// sampleTelemetry samples all the devices, the device which can not be got is skipped.
+func (tc *TelemetryController) sampleTelemetry() map[string]*GpuTelemetry {
+	count, err := tc.provider.GetDeviceCount()
+	if err != nil {
+		klog.Errorf("sampleTelemetry unable to get device count: %v", err)
+		return nil
+	}
+
+	telemetry := make(map[string]*GpuTelemetry, count)
+	for i := 0; i < count; i++ {
+		d, err := tc.provider.GetDeviceByIndex(i)
+		if err != nil {
+			klog.Errorf("sampleTelemetry unable to get device at index %d: %v", i, err)
+			continue
+		}
+		did, err := d.GetUUID()
+		if err != nil {
+			klog.Errorf("sampleTelemetry unable to get device uuid at index %d: %v", i, err)
+			continue
+		}
+		telemetry[did] = sampleDevice(did, d)
+	}
+	return telemetry
+}
+
+// sampleDevice gets each metric of the device, the metric failed is left zero.
+func sampleDevice(did string, d device.Device) *GpuTelemetry {
+	gt := &GpuTelemetry{SampleTime: metav1.Now()}
+	logErr := func(metric string, err error) {
+		// the metric may be not supported by the device, such as power usage of some GeForce
+		klog.V(4).Infof("DevicdId:%s unable to sample %s: %v", did, metric, err)
+	}
+
+	if memory, err := d.GetMemoryInfo(); err != nil {
+		logErr("memory", err)
+	} else {
+		gt.MemoryTotal, gt.MemoryUsed = memory.Total, memory.Used
+	}
+	if utilization, err := d.GetUtilizationRates(); err != nil {
+		logErr("utilization", err)
+	} else {
+		gt.GpuUtilization, gt.MemoryUtilization = utilization.Gpu, utilization.Memory
+	}
+	var err error
+	if gt.Temperature, err = d.GetTemperature(); err != nil {
+		logErr("temperature", err)
+	}
+	if gt.PowerUsage, err = d.GetPowerUsage(); err != nil {
+		logErr("power usage", err)
+	}
+	if gt.GraphicsClock, err = d.GetClockInfo(nvml.CLOCK_GRAPHICS); err != nil {
+		logErr("graphics clock", err)
+	}
+	if gt.SMClock, err = d.GetClockInfo(nvml.CLOCK_SM); err != nil {
+		logErr("sm clock", err)
+	}
+	if gt.MemoryClock, err = d.GetClockInfo(nvml.CLOCK_MEM); err != nil {
+		logErr("memory clock", err)
+	}
+	if reasons, err := d.GetCurrentClocksThrottleReasons(); err != nil {
+		logErr("clocks throttle reasons", err)
+	} else {
+		gt.ThrottleReasons = device.ThrottleReasonNames(reasons)
+	}
+	return gt
+}
+
+// publishTelemetry applies telemetry into the status of GpuNode through the status subresource.
+// Only the telemetry is owned by gpuserver-ds, the health is owned by the gpunode-lifecycle-controller.
+func (tc *TelemetryController) publishTelemetry(telemetry map[string]*GpuTelemetry) error {
+	patch, err := serverdsutil.GpuNodeStatusApplyPatch(tc.nodeName, metadata.MetadataNamespace(), map[string]interface{}{"device_telemetry": telemetry})
+	if err != nil {
+		return err
+	}
+	_, err = tc.gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Patch(context.TODO(), tc.nodeName, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: options.FieldManager, Force: pointer.Bool(true)}, "status")
+	if apierrors.IsNotFound(err) {
+		klog.V(4).Infof("node:%s GpuNode not created yet, skip publishTelemetry", tc.nodeName)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTelemetryControllerPublish(t *testing.T) {
+	t.Setenv("NODENAME", "node-telemetry")
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	err := os.WriteFile(inventory, []byte(`
+devices:
+- uuid: GPU-telemetry-0
+  name: Tesla T4
+  memory: {total: 16106127360, used: 1073741824, free: 15032385536}
+  utilization: {gpu: 35, memory: 10}
+  temperature: 41
+  power_usage: 27000
+  clocks: {graphics: 1590, sm: 1590, mem: 5000}
+  throttle_reasons: 5
+- uuid: GPU-telemetry-1
+  name: Tesla T4
+  errors:
+    GetPowerUsage: ERROR_NOT_SUPPORTED
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpuClient, _ := newApplyFakeClients()
+	tc, err := NewTelemetryController(provider, gpuClient, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GpuNode not created yet.
+	if err := tc.publishTelemetry(tc.sampleTelemetry()); err != nil {
+		t.Fatalf("publishTelemetry() without GpuNode err = %v", err)
+	}
+
+	_, err = gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Create(context.TODO(),
+		&gpunodev1.GpuNode{ObjectMeta: metav1.ObjectMeta{Name: "node-telemetry", Namespace: metadata.MetadataNamespace()}}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.publishTelemetry(tc.sampleTelemetry()); err != nil {
+		t.Fatal(err)
+	}
+
+	gpuNode, err := gpuClient.GpunodeV1().GpuNodes(metadata.MetadataNamespace()).Get(context.TODO(), "node-telemetry", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gpuNode.Status.Telemetry) != 2 {
+		t.Fatalf("got telemetry of %d devices, want 2", len(gpuNode.Status.Telemetry))
+	}
+	gt := gpuNode.Status.Telemetry["GPU-telemetry-0"]
+	if gt.MemoryUsed != 1073741824 || gt.GpuUtilization != 35 || gt.Temperature != 41 || gt.PowerUsage != 27000 ||
+		gt.SMClock != 1590 || gt.MemoryClock != 5000 || gt.SampleTime.IsZero() {
+		t.Errorf("unexpected telemetry: %#v", gt)
+	}
+	if want := []string{"GpuIdle", "SwPowerCap"}; !reflect.DeepEqual(gt.ThrottleReasons, want) {
+		t.Errorf("ThrottleReasons = %v, want %v", gt.ThrottleReasons, want)
+	}
+	if gt := gpuNode.Status.Telemetry["GPU-telemetry-1"]; gt.PowerUsage != 0 {
+		t.Errorf("PowerUsage of not supported = %d, want 0", gt.PowerUsage)
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var topologyLevel2Link = map[nvml.GpuTopologyLevel]string{
+	nvml.TOPOLOGY_INTERNAL:   TopologyLinkPIX,
+	nvml.TOPOLOGY_SINGLE:     TopologyLinkPIX,
+	nvml.TOPOLOGY_MULTIPLE:   TopologyLinkPXB,
+	nvml.TOPOLOGY_HOSTBRIDGE: TopologyLinkPHB,
+	nvml.TOPOLOGY_NODE:       TopologyLinkNODE,
+	nvml.TOPOLOGY_SYSTEM:     TopologyLinkSYS,
+}
+
+// checkTopology builds the topology matrix of the gpus, the link of each pair is set on both devices.
+// Two gpus are linked by NVLink if a link of one ends at the other, or at an NVSwitch the other links to.
+func checkTopology(provider device.Provider, gpuInfos map[string]*GpuInfo) (GpuTopology, error) {
+	dids := make([]string, 0, len(gpuInfos))
+	devices := make(map[string]device.Device, len(gpuInfos))
+	nvlinks := make(map[string][]string, len(gpuInfos))
+	gpuBusIds := sets.NewString()
+	for did, gpuinfo := range gpuInfos {
+		d, err := provider.GetDeviceByUUID(did)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get device %s: %v", did, err)
+		}
+		links, err := d.GetNvLinkRemotePciBusIds()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get NVLinks of device %s: %v", did, err)
+		}
+		for i := range links {
+			links[i] = strings.ToUpper(links[i])
+		}
+		dids = append(dids, did)
+		devices[did] = d
+		nvlinks[did] = links
+		gpuBusIds.Insert(strings.ToUpper(gpuinfo.BusId))
+	}
+
+	topology := make(GpuTopology, len(dids))
+	for _, did := range dids {
+		topology[did] = make(map[string]string, len(dids)-1)
+	}
+	for i, did := range dids {
+		for _, peer := range dids[i+1:] {
+			link := ""
+			if n := countNvLinks(nvlinks[did], nvlinks[peer], strings.ToUpper(gpuInfos[peer].BusId), gpuBusIds); n != 0 {
+				link = fmt.Sprintf("%s%d", TopologyLinkNV, n)
+			} else {
+				level, err := devices[did].GetTopologyCommonAncestor(devices[peer])
+				if err != nil {
+					return nil, fmt.Errorf("unable to get common ancestor of device %s and %s: %v", did, peer, err)
+				}
+				if link = topologyLevel2Link[level]; link == "" {
+					link = TopologyLinkSYS
+				}
+			}
+			topology[did][peer] = link
+			topology[peer][did] = link
+		}
+	}
+	return topology, nil
+}
+
+// countNvLinks counts the NVLinks of the device which end at the peer, or at the NVSwitches the peer links to.
+func countNvLinks(links, peerLinks []string, peerBusId string, gpuBusIds sets.String) int {
+	peerSwitches := sets.NewString()
+	for _, remote := range peerLinks {
+		if !gpuBusIds.Has(remote) {
+			peerSwitches.Insert(remote)
+		}
+	}
+	n := 0
+	for _, remote := range links {
+		if remote == peerBusId || peerSwitches.Has(remote) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+)
+
+// GPU-topo-0 and GPU-topo-1 link to both NVSwitches, GPU-topo-2 links to GPU-topo-3 directly.
+const topologyInventory = `
+devices:
+- uuid: GPU-topo-0
+  bus_id: "00000000:07:00.0"
+  nvlinks: ["00000000:c0:00.0", "00000000:c0:00.0", "00000000:c1:00.0"]
+  topology: {GPU-topo-1: multiple, GPU-topo-2: hostbridge}
+- uuid: GPU-topo-1
+  bus_id: "00000000:0f:00.0"
+  nvlinks: ["00000000:C0:00.0", "00000000:C1:00.0", "00000000:c1:00.0"]
+- uuid: GPU-topo-2
+  bus_id: "00000000:47:00.0"
+  nvlinks: ["00000000:4e:00.0", "00000000:4e:00.0"]
+  topology: {GPU-topo-3: single}
+- uuid: GPU-topo-3
+  bus_id: "00000000:4e:00.0"
+  nvlinks: ["00000000:47:00.0", "00000000:47:00.0"]
+`
+
+func TestCheckTopology(t *testing.T) {
+	inventory := filepath.Join(t.TempDir(), "inventory.yaml")
+	if err := os.WriteFile(inventory, []byte(topologyInventory), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gic, err := NewHostGpuInfoChecker(provider, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ngi, err := gic.checkNodeGpuInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topology, err := checkTopology(provider, ngi.GpuInfos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := GpuTopology{
+		"GPU-topo-0": {"GPU-topo-1": "NV3", "GPU-topo-2": "PHB", "GPU-topo-3": "SYS"},
+		"GPU-topo-1": {"GPU-topo-0": "NV3", "GPU-topo-2": "SYS", "GPU-topo-3": "SYS"},
+		"GPU-topo-2": {"GPU-topo-0": "PHB", "GPU-topo-1": "SYS", "GPU-topo-3": "NV2"},
+		"GPU-topo-3": {"GPU-topo-0": "SYS", "GPU-topo-1": "SYS", "GPU-topo-2": "NV2"},
+	}
+	if !reflect.DeepEqual(topology, want) {
+		t.Errorf("checkTopology() = %v, want %v", topology, want)
+	}
+}
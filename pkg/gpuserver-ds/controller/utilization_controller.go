@@ -0,0 +1,352 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	gpupodcleintset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpupod/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/procfs"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	serverdsutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/serverds"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+	"k8s.io/utils/pointer"
+)
+
+func NewUtilizationController(provider device.Provider, gpuPodClient gpupodcleintset.Interface, procRoot string, getPod PodGetter,
+	sampleInterval, window, publishInterval time.Duration, stop <-chan struct{}) (*UtilizationController, error) {
+	nodeName := os.Getenv("NODENAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("unable get env NODENAME")
+	}
+	if window < sampleInterval {
+		window = sampleInterval
+	}
+	if publishInterval < sampleInterval {
+		publishInterval = sampleInterval
+	}
+
+	return &UtilizationController{
+		provider:        provider,
+		gpuPodClient:    gpuPodClient,
+		procRoot:        procRoot,
+		getPod:          getPod,
+		nodeName:        nodeName,
+		sampleInterval:  sampleInterval,
+		window:          window,
+		publishInterval: publishInterval,
+		stop:            stop,
+		lastSeen:        make(map[string]uint64),
+		samples:         make(map[containerKey][]containerSample),
+		published:       make(map[string]bool),
+	}, nil
+}
+
+// UtilizationController samples the utilization and the memory of the processes on each gpu each sampleInterval,
+// and attributes them to the containers by the cgroup of the processes, which needs the host pid namespace.
+// The utilization of a process is sampled by nvml, or got from the accounting stats if not sampled and the accounting mode is on.
+// The samples of each container in the window are aggregated and published into GpuPod status each publishInterval.
+type UtilizationController struct {
+	provider        device.Provider
+	gpuPodClient    gpupodcleintset.Interface
+	procRoot        string
+	getPod          PodGetter
+	nodeName        string
+	sampleInterval  time.Duration
+	window          time.Duration
+	publishInterval time.Duration
+	stop            <-chan struct{}
+	// lastSeen maps the gpu to the timestamp of the last process utilization sample got.
+	lastSeen map[string]uint64
+	// samples are the samples of each container in the window.
+	samples map[containerKey][]containerSample
+	// published are the GpuPods with the utilization published.
+	published map[string]bool
+}
+
+// containerKey is the GpuPod name and the container name.
+type containerKey struct {
+	gpuPod    string
+	container string
+}
+
+// containerSample is the usage of a container in a sample.
+type containerSample struct {
+	time time.Time
+	// utilization maps the gpu to the SM utilization of the processes of the container on it.
+	utilization map[string]uint32
+	memoryUsed  uint64
+}
+
+func (uc *UtilizationController) Start() error {
+	if uc.sampleInterval <= 0 {
+		klog.Infof("UtilizationController disabled")
+		return nil
+	}
+
+	go func() {
+		klog.Infof("UtilizationController started with sample interval:%v window:%v publish interval:%v", uc.sampleInterval, uc.window, uc.publishInterval)
+		sampleTicker := time.NewTicker(uc.sampleInterval)
+		defer sampleTicker.Stop()
+		publishTicker := time.NewTicker(uc.publishInterval)
+		defer publishTicker.Stop()
+	LOOP:
+		for {
+			select {
+			case <-sampleTicker.C:
+				uc.sample(time.Now())
+
+			case <-publishTicker.C:
+				if err := uc.publish(); err != nil {
+					klog.Errorf("node:%s publish utilization err:%v", uc.nodeName, err)
+				}
+
+			case <-uc.stop:
+				break LOOP
+			}
+		}
+		klog.Infof("UtilizationController stopped")
+	}()
+	return nil
+}
+
+// sample samples the processes on all the devices, and drops the samples out of the window.
+// The device which can not be got is skipped, so is the process not in a pod.
+func (uc *UtilizationController) sample(now time.Time) {
+	count, err := uc.provider.GetDeviceCount()
+	if err != nil {
+		klog.Errorf("sampleUtilization unable to get device count: %v", err)
+		return
+	}
+
+	samples := make(map[containerKey]*containerSample)
+	containers := make(map[uint32]*containerKey)
+	for i := 0; i < count; i++ {
+		d, err := uc.provider.GetDeviceByIndex(i)
+		if err != nil {
+			klog.Errorf("sampleUtilization unable to get device at index %d: %v", i, err)
+			continue
+		}
+		did, err := d.GetUUID()
+		if err != nil {
+			klog.Errorf("sampleUtilization unable to get device uuid at index %d: %v", i, err)
+			continue
+		}
+		processes, err := d.GetRunningProcesses()
+		if err != nil {
+			klog.Errorf("sampleUtilization unable to get processes of device %s: %v", did, err)
+			continue
+		}
+		utilization, memoryUsed := uc.sampleProcesses(did, d, processes)
+		for _, p := range processes {
+			key, exist := containers[p.Pid]
+			if !exist {
+				if key, err = uc.containerOf(p.Pid); err != nil {
+					klog.V(4).Infof("sampleUtilization skip process %d of device %s: %v", p.Pid, did, err)
+				}
+				containers[p.Pid] = key
+			}
+			if key == nil {
+				continue
+			}
+			cs := samples[*key]
+			if cs == nil {
+				cs = &containerSample{time: now, utilization: make(map[string]uint32)}
+				samples[*key] = cs
+			}
+			// the processes of a container on a gpu can not use more than all of it.
+			if cs.utilization[did] += utilization[p.Pid]; cs.utilization[did] > 100 {
+				cs.utilization[did] = 100
+			}
+			cs.memoryUsed += memoryUsed[p.Pid]
+		}
+	}
+
+	for key, cs := range samples {
+		uc.samples[key] = append(uc.samples[key], *cs)
+	}
+	for key, ss := range uc.samples {
+		i := 0
+		for i < len(ss) && ss[i].time.Before(now.Add(-uc.window)) {
+			i++
+		}
+		if i == len(ss) {
+			delete(uc.samples, key)
+		} else {
+			uc.samples[key] = ss[i:]
+		}
+	}
+}
+
+// sampleProcesses gets the SM utilization and the memory used of the processes on the device.
+// The utilization samples of a process since the last ones are averaged,
+// the process not sampled gets the one of the accounting stats if the accounting mode is on.
+func (uc *UtilizationController) sampleProcesses(did string, d device.Device, processes []device.ProcessInfo) (utilization map[uint32]uint32, memoryUsed map[uint32]uint64) {
+	utilization = make(map[uint32]uint32, len(processes))
+	memoryUsed = make(map[uint32]uint64, len(processes))
+	for _, p := range processes {
+		memoryUsed[p.Pid] = p.UsedGpuMemory
+	}
+	if len(processes) == 0 {
+		return
+	}
+
+	samples, err := d.GetProcessUtilization(uc.lastSeen[did])
+	if err != nil && device.ReturnOf(err) != nvml.ERROR_NOT_SUPPORTED {
+		klog.V(4).Infof("DevicdId:%s unable to get process utilization: %v", did, err)
+	}
+	sum := make(map[uint32]uint32)
+	num := make(map[uint32]uint32)
+	for _, s := range samples {
+		sum[s.Pid] += s.SmUtil
+		num[s.Pid]++
+		if s.Timestamp > uc.lastSeen[did] {
+			uc.lastSeen[did] = s.Timestamp
+		}
+	}
+	for pid := range sum {
+		utilization[pid] = sum[pid] / num[pid]
+	}
+
+	if accounting, err := d.GetAccountingMode(); err != nil || !accounting {
+		return
+	}
+	for _, p := range processes {
+		stats, err := d.GetAccountingStats(p.Pid)
+		if err != nil {
+			klog.V(4).Infof("DevicdId:%s unable to get accounting stats of process %d: %v", did, p.Pid, err)
+			continue
+		}
+		if _, sampled := utilization[p.Pid]; !sampled {
+			utilization[p.Pid] = stats.GpuUtilization
+		}
+		if stats.MaxMemoryUsage > memoryUsed[p.Pid] {
+			memoryUsed[p.Pid] = stats.MaxMemoryUsage
+		}
+	}
+	return
+}
+
+// containerOf maps the process to the container by its cgroup, nil is returned if the process is not in a pod.
+func (uc *UtilizationController) containerOf(pid uint32) (*containerKey, error) {
+	podContainer, err := procfs.GetPodContainer(uc.procRoot, pid)
+	if err != nil || podContainer == nil {
+		return nil, err
+	}
+	pod, err := uc.getPod(podContainer.PodUID)
+	if err != nil || pod == nil {
+		return nil, err
+	}
+	name := containerName(pod, podContainer.ContainerId)
+	if name == "" {
+		return nil, fmt.Errorf("container %s not found in pod %s/%s", podContainer.ContainerId, pod.Namespace, pod.Name)
+	}
+	return &containerKey{gpuPod: util.MetadataToName(pod.Namespace, pod.Name), container: name}, nil
+}
+
+// containerName finds the name of the container by the id in the status of the pod, like containerd://<id>.
+func containerName(pod *corev1.Pod, containerId string) string {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, cs := range statuses {
+			if i := strings.Index(cs.ContainerID, "://"); i >= 0 && cs.ContainerID[i+3:] == containerId {
+				return cs.Name
+			}
+		}
+	}
+	return ""
+}
+
+// publish applies the utilization of the containers into the status of their GpuPods,
+// the utilization of the GpuPods without samples in the window is removed.
+// The GpuPod not found is skipped, the process may run in a pod without gpus allocated.
+func (uc *UtilizationController) publish() error {
+	utilization := aggregateUtilization(uc.samples)
+	for name := range uc.published {
+		if _, exist := utilization[name]; !exist {
+			utilization[name] = nil
+		}
+	}
+
+	var failed []string
+	for name, cus := range utilization {
+		patch, err := serverdsutil.GpuPodStatusApplyPatch(name, metadata.MetadataNamespace(), &gpupodv1.GpuPodStatus{ContainerUtilization: cus})
+		if err != nil {
+			return err
+		}
+		_, err = uc.gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Patch(context.TODO(), name, types.ApplyPatchType, patch,
+			metav1.PatchOptions{FieldManager: options.UtilizationFieldManager, Force: pointer.Bool(true)}, "status")
+		if apierrors.IsNotFound(err) {
+			delete(uc.published, name)
+			continue
+		} else if err != nil {
+			klog.Errorf("node:%s apply utilization of GpuPod %s err:%v", uc.nodeName, name, err)
+			failed = append(failed, name)
+			continue
+		}
+		if cus == nil {
+			delete(uc.published, name)
+		} else {
+			uc.published[name] = true
+		}
+	}
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("unable to apply utilization of GpuPods: %s", strings.Join(failed, ","))
+	}
+	return nil
+}
+
+// aggregateUtilization gets the utilization of each container from its samples, grouped by the GpuPod and sorted by the container name.
+func aggregateUtilization(samples map[containerKey][]containerSample) map[string][]gpupodv1.ContainerUtilization {
+	utilization := make(map[string][]gpupodv1.ContainerUtilization)
+	for key, ss := range samples {
+		if len(ss) == 0 {
+			continue
+		}
+		cu := gpupodv1.ContainerUtilization{
+			Name:        key.container,
+			Samples:     len(ss),
+			WindowStart: metav1.NewTime(ss[0].time),
+			WindowEnd:   metav1.NewTime(ss[len(ss)-1].time),
+		}
+		devices := sets.NewString()
+		var sum uint32
+		for _, s := range ss {
+			var util uint32
+			for did, u := range s.utilization {
+				devices.Insert(did)
+				util += u
+			}
+			if len(s.utilization) != 0 {
+				util /= uint32(len(s.utilization))
+			}
+			sum += util
+			if util > cu.MaxGpuUtilization {
+				cu.MaxGpuUtilization = util
+			}
+			if s.memoryUsed > cu.PeakMemoryUsed {
+				cu.PeakMemoryUsed = s.memoryUsed
+			}
+		}
+		cu.AvgGpuUtilization = sum / uint32(len(ss))
+		cu.Devices = devices.List()
+		utilization[key.gpuPod] = append(utilization[key.gpuPod], cu)
+	}
+	for _, cus := range utilization {
+		sort.Slice(cus, func(i, j int) bool { return cus[i].Name < cus[j].Name })
+	}
+	return utilization
+}
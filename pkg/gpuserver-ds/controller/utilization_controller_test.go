@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/device"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAggregateUtilization(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	testCases := []struct {
+		name    string
+		samples map[containerKey][]containerSample
+		want    map[string][]gpupodv1.ContainerUtilization
+	}{
+		{
+			name:    "no samples",
+			samples: map[containerKey][]containerSample{{gpuPod: "default-pod", container: "c"}: nil},
+			want:    map[string][]gpupodv1.ContainerUtilization{},
+		},
+		{
+			name: "utilization averaged over the gpus of the container",
+			samples: map[containerKey][]containerSample{
+				{gpuPod: "default-pod", container: "trainer"}: {
+					{time: at(0), utilization: map[string]uint32{"GPU-0": 100, "GPU-1": 0}, memoryUsed: 100},
+					{time: at(10), utilization: map[string]uint32{"GPU-0": 100, "GPU-1": 100}, memoryUsed: 300},
+					{time: at(20), utilization: map[string]uint32{"GPU-0": 10}, memoryUsed: 200},
+				},
+				{gpuPod: "default-pod", container: "sidecar"}: {
+					{time: at(20), utilization: map[string]uint32{"GPU-2": 0}},
+				},
+				{gpuPod: "default-other", container: "c"}: {
+					{time: at(10), utilization: map[string]uint32{"GPU-3": 40}, memoryUsed: 10},
+				},
+			},
+			want: map[string][]gpupodv1.ContainerUtilization{
+				"default-pod": {
+					{Name: "sidecar", Devices: []string{"GPU-2"}, Samples: 1, WindowStart: metav1.NewTime(at(20)), WindowEnd: metav1.NewTime(at(20))},
+					{Name: "trainer", Devices: []string{"GPU-0", "GPU-1"}, Samples: 3, AvgGpuUtilization: 53, MaxGpuUtilization: 100, PeakMemoryUsed: 300,
+						WindowStart: metav1.NewTime(at(0)), WindowEnd: metav1.NewTime(at(20))},
+				},
+				"default-other": {
+					{Name: "c", Devices: []string{"GPU-3"}, Samples: 1, AvgGpuUtilization: 40, MaxGpuUtilization: 40, PeakMemoryUsed: 10,
+						WindowStart: metav1.NewTime(at(10)), WindowEnd: metav1.NewTime(at(10))},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := aggregateUtilization(tc.samples); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("aggregateUtilization() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUtilizationController(t *testing.T) {
+	t.Setenv("NODENAME", "node-utilization")
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "inventory.yaml")
+	// pid 100 is sampled by nvml, 101 only has the accounting stats, 200 is not in a pod.
+	err := os.WriteFile(inventory, []byte(`
+devices:
+- uuid: GPU-util-0
+  processes:
+  - {pid: 100, used_memory: 1000}
+  - {pid: 101, used_memory: 500}
+  - {pid: 200}
+  process_utilization:
+  - {pid: 100, timestamp: 1, sm_util: 60}
+  - {pid: 100, timestamp: 2, sm_util: 80}
+  - {pid: 200, timestamp: 2, sm_util: 90}
+  accounting_mode: true
+  accounting_stats:
+  - {pid: 101, gpu_utilization: 30, max_memory_usage: 2000}
+- uuid: GPU-util-1
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procRoot := filepath.Join(dir, "proc")
+	for pid, cgroup := range map[string]string{
+		"100": "0::/kubepods/pod" + processPodUID + "/" + processContainerId + "\n",
+		"101": "0::/kubepods/pod" + processPodUID + "/" + processContainerId + "\n",
+		"200": "0::/system.slice/Xorg.service\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(procRoot, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(procRoot, pid, "cgroup"), []byte(cgroup), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider, err := device.NewProvider(device.ProviderFake, inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getPod := func(uid types.UID) (*corev1.Pod, error) {
+		if uid != processPodUID {
+			return nil, nil
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod1", UID: uid},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "sidecar", ContainerID: "containerd://fedcba"},
+				{Name: "trainer", ContainerID: "containerd://" + processContainerId},
+			}},
+		}, nil
+	}
+	_, gpuPodClient := newApplyFakeClients()
+	_, err = gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Create(context.TODO(), &gpupodv1.GpuPod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: metadata.MetadataNamespace(), Name: "default-pod1"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	containerUtilization := func() []gpupodv1.ContainerUtilization {
+		t.Helper()
+		gp, err := gpuPodClient.GpupodV1().GpuPods(metadata.MetadataNamespace()).Get(context.TODO(), "default-pod1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gp.Status.ContainerUtilization
+	}
+
+	uc, err := NewUtilizationController(provider, gpuPodClient, procRoot, getPod, time.Second, time.Minute, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Truncate(time.Second)
+	uc.sample(start)
+	// the samples seen are not sampled again, so only the accounting stats are left.
+	uc.sample(start.Add(time.Second))
+	if err := uc.publish(); err != nil {
+		t.Fatal(err)
+	}
+	want := []gpupodv1.ContainerUtilization{{
+		Name: "trainer", Devices: []string{"GPU-util-0"}, Samples: 2, AvgGpuUtilization: 65, MaxGpuUtilization: 100, PeakMemoryUsed: 3000,
+		WindowStart: metav1.NewTime(start), WindowEnd: metav1.NewTime(start.Add(time.Second)),
+	}}
+	if got := containerUtilization(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ContainerUtilization = %v, want %v", got, want)
+	}
+
+	// the samples out of the window are dropped, and the utilization is removed.
+	uc.sample(start.Add(2 * time.Minute))
+	if len(uc.samples) != 1 {
+		t.Errorf("samples = %v, want only the last sample", uc.samples)
+	}
+	// the fake apply does not remove the fields not applied, so the apply itself is checked.
+	uc.samples = map[containerKey][]containerSample{}
+	gpuPodClient.ClearActions()
+	if err := uc.publish(); err != nil {
+		t.Fatal(err)
+	}
+	actions := gpuPodClient.Actions()
+	if len(actions) != 1 || strings.Contains(string(actions[0].(k8stesting.PatchAction).GetPatch()), "container_utilization") || len(uc.published) != 0 {
+		t.Errorf("actions = %v published = %v, want the utilization removed", actions, uc.published)
+	}
+}
@@ -0,0 +1,244 @@
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources/util"
+	pkgutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	// DefaultEndpoint is the CRI socket of containerd.
+	DefaultEndpoint = "unix:///run/containerd/containerd.sock"
+	// Version is the version of the pod resources listed from the container runtime.
+	Version = "cri"
+
+	// the labels of the containers set by kubelet.
+	podNameLabel       = "io.kubernetes.pod.name"
+	podNamespaceLabel  = "io.kubernetes.pod.namespace"
+	podUIDLabel        = "io.kubernetes.pod.uid"
+	containerNameLabel = "io.kubernetes.container.name"
+
+	envNvidiaVisibleDevices = "NVIDIA_VISIBLE_DEVICES"
+	envCudaVisibleDevices   = "CUDA_VISIBLE_DEVICES"
+)
+
+// ErrDevicesNotChecked is returned by List before the devices are checked, the references in the containers can not be resolved.
+var ErrDevicesNotChecked = errors.New("the devices are not checked yet")
+
+// deviceNodeRegexp matches the device node of a whole gpu, not /dev/nvidiactl or /dev/nvidia-uvm.
+var deviceNodeRegexp = regexp.MustCompile(`^/dev/nvidia[0-9]+$`)
+
+// NewClient returns the podresources.Client listing the devices of the running containers from the container runtime,
+// for the setups with the devices injected by the NVIDIA container toolkit rather than allocated by the device plugin,
+// where kubelet podresources knows nothing about them.
+// The devices are referred by NVIDIA_VISIBLE_DEVICES, or the uuids in CUDA_VISIBLE_DEVICES if it is not set, and the device nodes
+// /dev/nvidia<minor> of the containers. They are resolved by the references of deviceRefs, see HostGpuInfoChecker.GetDeviceRefs.
+// The runtime serves CRI v1alpha2, such as containerd 1.5 or CRI-O.
+func NewClient(endpoint string, connectionTimeout time.Duration, maxMsgSize int, deviceRefs func() map[string]string) (podresources.Client, error) {
+	addr, dialer, err := util.GetAddressAndDialer(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithDialer(dialer), grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize)))
+	if err != nil {
+		return nil, fmt.Errorf("Error dialing socket %s: %v", endpoint, err)
+	}
+	return &client{conn: conn, runtime: criapi.NewRuntimeServiceClient(conn), deviceRefs: deviceRefs}, nil
+}
+
+type client struct {
+	conn       *grpc.ClientConn
+	runtime    criapi.RuntimeServiceClient
+	deviceRefs func() map[string]string
+}
+
+// containerInfo is the verbose info of the container status, the config is by containerd and the runtimeSpec by both containerd and CRI-O.
+type containerInfo struct {
+	Config *struct {
+		Envs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"envs"`
+		Devices []struct {
+			HostPath string `json:"host_path"`
+		} `json:"devices"`
+	} `json:"config"`
+	RuntimeSpec *struct {
+		Process *struct {
+			Env []string `json:"env"`
+		} `json:"process"`
+		Linux *struct {
+			Devices []struct {
+				Path string `json:"path"`
+			} `json:"devices"`
+		} `json:"linux"`
+	} `json:"runtimeSpec"`
+}
+
+// List lists the pods with the containers of devices, the pods and the containers are sorted by name.
+func (c *client) List(ctx context.Context) ([]*podresourcesapi.PodResources, error) {
+	refs := c.deviceRefs()
+	if refs == nil {
+		return nil, ErrDevicesNotChecked
+	}
+	resp, err := c.runtime.ListContainers(ctx, &criapi.ListContainersRequest{
+		Filter: &criapi.ContainerFilter{State: &criapi.ContainerStateValue{State: criapi.ContainerState_CONTAINER_RUNNING}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prs := make(map[string]*podresourcesapi.PodResources)
+	for _, ctr := range resp.Containers {
+		uid, name := ctr.Labels[podUIDLabel], ctr.Labels[containerNameLabel]
+		if uid == "" || name == "" {
+			// not a container of pod
+			continue
+		}
+		st, err := c.runtime.ContainerStatus(ctx, &criapi.ContainerStatusRequest{ContainerId: ctr.Id, Verbose: true})
+		if status.Code(err) == codes.NotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		deviceIds := resolveDeviceRefs(ctr.Id, containerDeviceRefs(st), refs)
+		if len(deviceIds) == 0 {
+			continue
+		}
+
+		pr := prs[uid]
+		if pr == nil {
+			pr = &podresourcesapi.PodResources{Name: ctr.Labels[podNameLabel], Namespace: ctr.Labels[podNamespaceLabel]}
+			prs[uid] = pr
+		}
+		pr.Containers = append(pr.Containers, &podresourcesapi.ContainerResources{Name: name, Devices: []*podresourcesapi.ContainerDevices{
+			{ResourceName: pkgutil.GetGpuResourceNames()[0], DeviceIds: deviceIds},
+		}})
+	}
+
+	prlist := make([]*podresourcesapi.PodResources, 0, len(prs))
+	for _, pr := range prs {
+		sort.Slice(pr.Containers, func(i, j int) bool { return pr.Containers[i].Name < pr.Containers[j].Name })
+		prlist = append(prlist, pr)
+	}
+	sort.Slice(prlist, func(i, j int) bool {
+		if prlist[i].Namespace != prlist[j].Namespace {
+			return prlist[i].Namespace < prlist[j].Namespace
+		}
+		return prlist[i].Name < prlist[j].Name
+	})
+	return prlist, nil
+}
+
+// containerDeviceRefs gets the references to the devices of the container, in the order of the visible devices then the device nodes.
+// The visible devices all, none and void are not the devices allocated, the container sees all or no gpu.
+// The indexes in CUDA_VISIBLE_DEVICES are of the gpus visible in the container rather than the host, only its uuids are taken.
+func containerDeviceRefs(st *criapi.ContainerStatusResponse) []string {
+	var info containerInfo
+	if data, exist := st.Info["info"]; exist {
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			klog.Errorf("container:%s unable to parse the verbose info: %v", st.Status.GetId(), err)
+		}
+	}
+
+	env := make(map[string]string)
+	var deviceNodes []string
+	if info.RuntimeSpec != nil && info.RuntimeSpec.Process != nil {
+		for _, kv := range info.RuntimeSpec.Process.Env {
+			if i := strings.Index(kv, "="); i > 0 {
+				env[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+	if info.RuntimeSpec != nil && info.RuntimeSpec.Linux != nil {
+		for _, d := range info.RuntimeSpec.Linux.Devices {
+			deviceNodes = append(deviceNodes, d.Path)
+		}
+	}
+	if info.Config != nil {
+		for _, kv := range info.Config.Envs {
+			env[kv.Key] = kv.Value
+		}
+		for _, d := range info.Config.Devices {
+			deviceNodes = append(deviceNodes, d.HostPath)
+		}
+	}
+	for _, m := range st.Status.GetMounts() {
+		deviceNodes = append(deviceNodes, m.HostPath)
+	}
+
+	visible, exist := env[envNvidiaVisibleDevices]
+	uuidOnly := false
+	if !exist {
+		visible, uuidOnly = env[envCudaVisibleDevices], true
+	}
+	var refs []string
+	switch visible = strings.TrimSpace(visible); visible {
+	case "", "all", "none", "void":
+	default:
+		for _, ref := range strings.Split(visible, ",") {
+			if ref = strings.TrimSpace(ref); ref == "" {
+				continue
+			}
+			if uuidOnly && !strings.HasPrefix(ref, "GPU-") && !strings.HasPrefix(ref, "MIG-") {
+				continue
+			}
+			refs = append(refs, ref)
+		}
+	}
+	for _, node := range deviceNodes {
+		if deviceNodeRegexp.MatchString(node) {
+			refs = append(refs, node)
+		}
+	}
+	return refs
+}
+
+// resolveDeviceRefs resolves the references to the device ids without duplicates, the ones unknown are skipped.
+func resolveDeviceRefs(containerId string, deviceRefs []string, refs map[string]string) []string {
+	var deviceIds []string
+	seen := make(map[string]bool)
+	for _, ref := range deviceRefs {
+		did, exist := refs[ref]
+		if !exist {
+			klog.V(4).Infof("container:%s device %s unknown", containerId, ref)
+			continue
+		}
+		if !seen[did] {
+			seen[did] = true
+			deviceIds = append(deviceIds, did)
+		}
+	}
+	return deviceIds
+}
+
+// GetAllocatableResources is unsupported, the container runtime does not know the devices.
+func (c *client) GetAllocatableResources(ctx context.Context) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return nil, podresources.ErrAllocatableUnsupported
+}
+
+func (c *client) Version() string {
+	return Version
+}
+
+func (c *client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,135 @@
+package cri
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// fakeRuntimeServer is the container runtime serving the containers and their status.
+type fakeRuntimeServer struct {
+	criapi.UnimplementedRuntimeServiceServer
+	containers []*criapi.Container
+	// statuses are the status of the containers, a container without status is removed after listed.
+	statuses map[string]*criapi.ContainerStatusResponse
+}
+
+func (s *fakeRuntimeServer) ListContainers(ctx context.Context, req *criapi.ListContainersRequest) (*criapi.ListContainersResponse, error) {
+	containers := make([]*criapi.Container, 0, len(s.containers))
+	for _, c := range s.containers {
+		if req.Filter != nil && req.Filter.State != nil && req.Filter.State.State != c.State {
+			continue
+		}
+		containers = append(containers, c)
+	}
+	return &criapi.ListContainersResponse{Containers: containers}, nil
+}
+
+func (s *fakeRuntimeServer) ContainerStatus(ctx context.Context, req *criapi.ContainerStatusRequest) (*criapi.ContainerStatusResponse, error) {
+	st, exist := s.statuses[req.ContainerId]
+	if !exist {
+		return nil, status.Errorf(codes.NotFound, "container %s not found", req.ContainerId)
+	}
+	return st, nil
+}
+
+// startRuntime serves the fake runtime on a unix socket, the endpoint is returned.
+func startRuntime(t *testing.T, s *fakeRuntimeServer) string {
+	t.Helper()
+	endpoint := "unix://" + filepath.Join(t.TempDir(), "containerd.sock")
+	l, err := util.CreateListener(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := grpc.NewServer()
+	criapi.RegisterRuntimeServiceServer(gs, s)
+	go gs.Serve(l)
+	t.Cleanup(gs.Stop)
+	return endpoint
+}
+
+func podContainer(id, namespace, pod, uid, name string, state criapi.ContainerState) *criapi.Container {
+	return &criapi.Container{Id: id, State: state, Labels: map[string]string{
+		podNamespaceLabel: namespace, podNameLabel: pod, podUIDLabel: uid, containerNameLabel: name,
+	}}
+}
+
+func TestClientList(t *testing.T) {
+	s := &fakeRuntimeServer{
+		containers: []*criapi.Container{
+			podContainer("trainer", "default", "pod1", "uid-1", "trainer", criapi.ContainerState_CONTAINER_RUNNING),
+			podContainer("sidecar", "default", "pod1", "uid-1", "sidecar", criapi.ContainerState_CONTAINER_RUNNING),
+			podContainer("all", "default", "pod1", "uid-1", "all", criapi.ContainerState_CONTAINER_RUNNING),
+			podContainer("crio", "team", "pod2", "uid-2", "c", criapi.ContainerState_CONTAINER_RUNNING),
+			podContainer("relative", "team", "pod5", "uid-5", "c", criapi.ContainerState_CONTAINER_RUNNING),
+			podContainer("exited", "team", "pod3", "uid-3", "c", criapi.ContainerState_CONTAINER_EXITED),
+			podContainer("removed", "team", "pod4", "uid-4", "c", criapi.ContainerState_CONTAINER_RUNNING),
+			{Id: "not-pod", State: criapi.ContainerState_CONTAINER_RUNNING},
+		},
+		statuses: map[string]*criapi.ContainerStatusResponse{
+			// containerd with the env and devices in the config, and a MIG device by index.
+			"trainer": {Status: &criapi.ContainerStatus{Id: "trainer"}, Info: map[string]string{"info": `{
+				"config": {"envs": [{"key": "NVIDIA_VISIBLE_DEVICES", "value": "GPU-0, 0:1,GPU-unknown"}],
+				           "devices": [{"container_path": "/dev/nvidia0", "host_path": "/dev/nvidia0"}, {"host_path": "/dev/nvidiactl"}]}}`}},
+			// the device node mounted only, CUDA_VISIBLE_DEVICES is not taken with NVIDIA_VISIBLE_DEVICES set.
+			"sidecar": {Status: &criapi.ContainerStatus{Id: "sidecar", Mounts: []*criapi.Mount{{ContainerPath: "/dev/nvidia1", HostPath: "/dev/nvidia1"}}},
+				Info: map[string]string{"info": `{"config": {"envs": [{"key": "NVIDIA_VISIBLE_DEVICES", "value": "void"}, {"key": "CUDA_VISIBLE_DEVICES", "value": "0"}]}}`}},
+			"all": {Status: &criapi.ContainerStatus{Id: "all"}, Info: map[string]string{"info": `{"config": {"envs": [{"key": "NVIDIA_VISIBLE_DEVICES", "value": "all"}]}}`}},
+			// CRI-O with the runtime spec only.
+			"crio": {Status: &criapi.ContainerStatus{Id: "crio"}, Info: map[string]string{"info": `{
+				"runtimeSpec": {"process": {"env": ["PATH=/bin", "CUDA_VISIBLE_DEVICES=1"]}, "linux": {"devices": [{"path": "/dev/nvidia1"}, {"path": "/dev/nvidia-uvm"}]}}}`}},
+			// the index 0 of CUDA_VISIBLE_DEVICES is the only gpu in the container, the host gpu 1 by the device node.
+			"relative": {Status: &criapi.ContainerStatus{Id: "relative"}, Info: map[string]string{"info": `{
+				"runtimeSpec": {"process": {"env": ["CUDA_VISIBLE_DEVICES=0,MIG-1"]}, "linux": {"devices": [{"path": "/dev/nvidia1"}]}}}`}},
+			"exited":  {Status: &criapi.ContainerStatus{Id: "exited"}},
+			"not-pod": {Status: &criapi.ContainerStatus{Id: "not-pod"}},
+		},
+	}
+	refs := map[string]string{
+		"GPU-0": "GPU-0", "0": "GPU-0", "/dev/nvidia0": "GPU-0",
+		"GPU-1": "GPU-1", "1": "GPU-1", "/dev/nvidia1": "GPU-1",
+		"MIG-1": "MIG-1", "0:1": "MIG-1",
+	}
+	var checked map[string]string
+	c, err := NewClient(startRuntime(t, s), 5*time.Second, 1024*1024, func() map[string]string { return checked })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.List(context.TODO()); err != ErrDevicesNotChecked {
+		t.Fatalf("List() err = %v before the devices checked, want %v", err, ErrDevicesNotChecked)
+	}
+	checked = refs
+	prlist, err := c.List(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := func(ids ...string) []*podresourcesapi.ContainerDevices {
+		return []*podresourcesapi.ContainerDevices{{ResourceName: "nvidia.com/gpu", DeviceIds: ids}}
+	}
+	want := []*podresourcesapi.PodResources{
+		{Namespace: "default", Name: "pod1", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "sidecar", Devices: devices("GPU-1")},
+			{Name: "trainer", Devices: devices("GPU-0", "MIG-1")},
+		}},
+		{Namespace: "team", Name: "pod2", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c", Devices: devices("GPU-1")},
+		}},
+		{Namespace: "team", Name: "pod5", Containers: []*podresourcesapi.ContainerResources{
+			{Name: "c", Devices: devices("MIG-1", "GPU-1")},
+		}},
+	}
+	if !reflect.DeepEqual(prlist, want) {
+		t.Errorf("List() = %v, want %v", prlist, want)
+	}
+}
@@ -0,0 +1,717 @@
+package device
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+)
+
+// FakeInventory is the content of the inventory file read by the fake provider, in yaml or json.
+// The file is read again on each GetDeviceCount, so faults can be injected into a running gpuserver-ds.
+//
+//	delay: 100ms
+//	errors:
+//	  GetDeviceCount: ERROR_UNKNOWN
+//	driver_version: 470.57.02
+//	cuda_driver_version: 11040
+//	devices:
+//	- uuid: GPU-8d6a2c4e-0000-0000-0000-000000000000
+//	  name: Tesla T4
+//	  brand: BRAND_TESLA
+//	  bus_id: "00000000:00:1E.0"
+//	  compute_capability: {major: 7, minor: 5}
+//	  architecture: Turing
+//	  vbios_version: 90.04.96.00.9F
+//	  minor: 0
+//	  memory: {total: 16106127360, used: 1073741824, free: 15032385536}
+//	  utilization: {gpu: 35, memory: 10}
+//	  temperature: 41
+//	  power_usage: 27000
+//	  clocks: {graphics: 1590, sm: 1590, mem: 5000}
+//	  throttle_reasons: 1
+//	  processes:
+//	  - {pid: 1234, used_memory: 1073741824}
+//	  process_utilization:
+//	  - {pid: 1234, timestamp: 1, sm_util: 80, mem_util: 30}
+//	  ecc_errors: {corrected: 12, uncorrected: 0}
+//	  retired_pages: {multiple_single_bit: [4096], double_bit: []}
+//	  retired_pages_pending: false
+//	  remapped_rows: {correctable: 1, uncorrectable: 0, pending: false, failure: false}
+//	  removed: false
+//	  mig_enabled: true
+//	  mig_devices:
+//	  - uuid: MIG-2c9b8e43-0000-0000-0000-000000000000
+//	    mig: {gi: 1, ci: 0, gi_slices: 1, ci_slices: 1, memory_mb: 4864}
+//	  errors:
+//	    GetName: ERROR_GPU_IS_LOST
+//	events:
+//	- uuid: GPU-8d6a2c4e-0000-0000-0000-000000000000
+//	  type: XidCriticalError
+//	  data: 79
+type FakeInventory struct {
+	// Delay slows down each provider call.
+	Delay metav1.Duration `json:"delay,omitempty"`
+	// Errors maps the provider call name, such as Init or GetDeviceCount, to the nvml return name it fails with.
+	Errors map[string]string `json:"errors,omitempty"`
+	// DriverVersion and CudaDriverVersion are the versions of the driver, see Provider.
+	DriverVersion     string        `json:"driver_version,omitempty"`
+	CudaDriverVersion int           `json:"cuda_driver_version,omitempty"`
+	Devices           []*FakeDevice `json:"devices,omitempty"`
+	// Events are delivered in order to the event sets, appending to it raises new events.
+	Events []*FakeEvent `json:"events,omitempty"`
+}
+
+// FakeEvent describes an event raised by the fake provider.
+type FakeEvent struct {
+	UUID string `json:"uuid,omitempty"`
+	// Type is the name of the event type, such as XidCriticalError or DoubleBitEccError.
+	Type string `json:"type"`
+	// Data is the Xid for XidCriticalError.
+	Data uint64 `json:"data,omitempty"`
+}
+
+// FakeDevice describes a device of the fake provider.
+type FakeDevice struct {
+	UUID  string `json:"uuid"`
+	Name  string `json:"name,omitempty"`
+	Brand string `json:"brand,omitempty"`
+	BusId string `json:"bus_id,omitempty"`
+
+	ComputeCapability ComputeCapability `json:"compute_capability,omitempty"`
+	Architecture      string            `json:"architecture,omitempty"`
+	VbiosVersion      string            `json:"vbios_version,omitempty"`
+	// Minor is the minor number of /dev/nvidia<minor>, it is the index in the devices if not set.
+	Minor *int `json:"minor,omitempty"`
+
+	Memory      MemoryInfo  `json:"memory,omitempty"`
+	Utilization Utilization `json:"utilization,omitempty"`
+	Temperature uint32      `json:"temperature,omitempty"`
+	PowerUsage  uint32      `json:"power_usage,omitempty"`
+	// Clocks maps the clock name graphics, sm or mem to the clock speed in MHz.
+	Clocks          map[string]uint32 `json:"clocks,omitempty"`
+	ThrottleReasons uint64            `json:"throttle_reasons,omitempty"`
+	MigEnabled      bool              `json:"mig_enabled,omitempty"`
+	// MigDevices are the MIG devices of the gpu in MIG mode, a removed one leaves its index unpopulated.
+	MigDevices []*FakeDevice `json:"mig_devices,omitempty"`
+	// Mig is set for a MIG device.
+	Mig *MigInfo `json:"mig,omitempty"`
+	// Topology maps the peer uuid to the common ancestor internal, single, multiple, hostbridge, node or system.
+	// It is enough to be set on either device of the pair, system is the default.
+	Topology map[string]string `json:"topology,omitempty"`
+	// NvLinks are the remote pci bus ids of the active NVLinks, which are gpus or NVSwitches.
+	NvLinks []string `json:"nvlinks,omitempty"`
+	// Processes are the processes running on the device.
+	Processes []ProcessInfo `json:"processes,omitempty"`
+	// ProcessUtilization are the utilization samples of the processes, the ones newer than the timestamp asked are returned.
+	ProcessUtilization []ProcessUtilization `json:"process_utilization,omitempty"`
+	// AccountingMode enables the accounting stats of the processes.
+	AccountingMode  bool              `json:"accounting_mode,omitempty"`
+	AccountingStats []AccountingStats `json:"accounting_stats,omitempty"`
+	// EccErrors are the aggregate ECC errors of the device.
+	EccErrors FakeEccErrors `json:"ecc_errors,omitempty"`
+	// RetiredPages maps the cause multiple_single_bit or double_bit to the addresses of the pages retired.
+	RetiredPages        map[string][]uint64 `json:"retired_pages,omitempty"`
+	RetiredPagesPending bool                `json:"retired_pages_pending,omitempty"`
+	RemappedRows        RemappedRows        `json:"remapped_rows,omitempty"`
+	// Removed makes the device disappear from the node, as if it fell off the bus.
+	Removed bool `json:"removed,omitempty"`
+	// Delay slows down each call of the device.
+	Delay metav1.Duration `json:"delay,omitempty"`
+	// Errors maps the device call name, such as GetName or GetDeviceByIndex, to the nvml return name it fails with.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// FakeEccErrors are the aggregate ECC errors of a fake device.
+type FakeEccErrors struct {
+	Corrected   uint64 `json:"corrected"`
+	Uncorrected uint64 `json:"uncorrected"`
+}
+
+// ComputeCapability is the CUDA compute capability of a fake device.
+type ComputeCapability struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+}
+
+var _ Provider = &fakeProvider{}
+
+// NewFakeProvider creates the Provider which reads devices from the inventory file.
+func NewFakeProvider(inventory string) (Provider, error) {
+	if inventory == "" {
+		return nil, fmt.Errorf("fake device provider needs an inventory file")
+	}
+	p := &fakeProvider{inventory: inventory}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type fakeProvider struct {
+	inventory string
+	lock      sync.RWMutex
+	current   *FakeInventory
+}
+
+// reload reads the inventory file, the last inventory is kept if the file is broken.
+func (p *fakeProvider) reload() error {
+	data, err := os.ReadFile(p.inventory)
+	if err != nil {
+		return fmt.Errorf("read fake device inventory %s: %v", p.inventory, err)
+	}
+	inv := &FakeInventory{}
+	if err := yaml.Unmarshal(data, inv); err != nil {
+		return fmt.Errorf("parse fake device inventory %s: %v", p.inventory, err)
+	}
+	p.lock.Lock()
+	p.current = inv
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *fakeProvider) inv() *FakeInventory {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.current
+}
+
+// call simulates the delay and the error injected for the provider call op.
+func (p *fakeProvider) call(op string) error {
+	inv := p.inv()
+	time.Sleep(inv.Delay.Duration)
+	return injectedError(op, inv.Errors)
+}
+
+func injectedError(op string, errs map[string]string) error {
+	name, exist := errs[op]
+	if !exist {
+		return nil
+	}
+	ret, err := parseReturnName(name)
+	if err != nil {
+		klog.Errorf("fake device: %v", err)
+	}
+	if ret == nvml.SUCCESS {
+		return nil
+	}
+	return newError(op, ret, ReturnName(ret))
+}
+
+func (p *fakeProvider) Init() error {
+	if err := p.reload(); err != nil {
+		klog.Errorf("fake device: %v", err)
+	}
+	return p.call("Init")
+}
+
+func (p *fakeProvider) Shutdown() error {
+	return p.call("Shutdown")
+}
+
+func (p *fakeProvider) GetDeviceCount() (int, error) {
+	if err := p.reload(); err != nil {
+		klog.Errorf("fake device: %v", err)
+	}
+	if err := p.call("GetDeviceCount"); err != nil {
+		return 0, err
+	}
+	return len(p.present()), nil
+}
+
+// present returns the devices not removed.
+func (p *fakeProvider) present() []*FakeDevice {
+	inv := p.inv()
+	devices := make([]*FakeDevice, 0, len(inv.Devices))
+	for _, d := range inv.Devices {
+		if !d.Removed {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+func (p *fakeProvider) GetDeviceByIndex(idx int) (Device, error) {
+	if err := p.call("GetDeviceByIndex"); err != nil {
+		return nil, err
+	}
+	devices := p.present()
+	if idx < 0 || idx >= len(devices) {
+		return nil, newError("GetDeviceByIndex", nvml.ERROR_INVALID_ARGUMENT, ReturnName(nvml.ERROR_INVALID_ARGUMENT))
+	}
+	d := &fakeDevice{provider: p, uuid: devices[idx].UUID}
+	if _, err := d.call("GetDeviceByIndex"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (p *fakeProvider) GetDeviceByUUID(uuid string) (Device, error) {
+	if err := p.call("GetDeviceByUUID"); err != nil {
+		return nil, err
+	}
+	if findFakeDevice(p.inv().Devices, uuid) != nil {
+		d := &fakeDevice{provider: p, uuid: uuid}
+		if _, err := d.call("GetDeviceByUUID"); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	return nil, newError("GetDeviceByUUID", nvml.ERROR_NOT_FOUND, ReturnName(nvml.ERROR_NOT_FOUND))
+}
+
+func (p *fakeProvider) GetDriverVersion() (string, error) {
+	if err := p.call("GetDriverVersion"); err != nil {
+		return "", err
+	}
+	return p.inv().DriverVersion, nil
+}
+
+func (p *fakeProvider) GetCudaDriverVersion() (int, error) {
+	if err := p.call("GetCudaDriverVersion"); err != nil {
+		return 0, err
+	}
+	return p.inv().CudaDriverVersion, nil
+}
+
+func (p *fakeProvider) NewEventSet() (EventSet, error) {
+	if err := p.call("NewEventSet"); err != nil {
+		return nil, err
+	}
+	return &fakeEventSet{provider: p, registered: make(map[string]uint64), delivered: len(p.inv().Events)}, nil
+}
+
+// fakeEventSetPollInterval is the interval the fake event set reads the inventory for new events.
+const fakeEventSetPollInterval = 100 * time.Millisecond
+
+// fakeEventSet delivers the events appended to the inventory after it is created.
+type fakeEventSet struct {
+	provider   *fakeProvider
+	lock       sync.Mutex
+	registered map[string]uint64
+	delivered  int
+}
+
+func (s *fakeEventSet) register(uuid string, eventTypes uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.registered[uuid] |= eventTypes
+}
+
+// next returns the next event registered, false is returned if no event.
+func (s *fakeEventSet) next() (Event, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	events := s.provider.inv().Events
+	if len(events) < s.delivered {
+		// the inventory is rewritten with less events
+		s.delivered = len(events)
+	}
+	for s.delivered < len(events) {
+		fe := events[s.delivered]
+		s.delivered++
+		eventType, err := parseEventTypeName(fe.Type)
+		if err != nil {
+			klog.Errorf("fake device: %v", err)
+			continue
+		}
+		if fe.UUID != "" && s.registered[fe.UUID]&eventType == 0 {
+			continue
+		}
+		return Event{DeviceUUID: fe.UUID, Type: eventType, Data: fe.Data}, true
+	}
+	return Event{}, false
+}
+
+func (s *fakeEventSet) Wait(timeout time.Duration) (Event, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := s.provider.reload(); err != nil {
+			klog.Errorf("fake device: %v", err)
+		}
+		if err := s.provider.call("EventSetWait"); err != nil {
+			return Event{}, err
+		}
+		if event, ok := s.next(); ok {
+			return event, nil
+		}
+		remain := time.Until(deadline)
+		if remain <= 0 {
+			return Event{}, newError("EventSetWait", nvml.ERROR_TIMEOUT, ReturnName(nvml.ERROR_TIMEOUT))
+		}
+		if remain > fakeEventSetPollInterval {
+			remain = fakeEventSetPollInterval
+		}
+		time.Sleep(remain)
+	}
+}
+
+func (s *fakeEventSet) Free() error {
+	return s.provider.call("EventSetFree")
+}
+
+// fakeDevice looks up the inventory on each call, so a device removed after it is got becomes lost.
+type fakeDevice struct {
+	provider *fakeProvider
+	uuid     string
+}
+
+func (d *fakeDevice) call(op string) (*FakeDevice, error) {
+	if fd := findFakeDevice(d.provider.inv().Devices, d.uuid); fd != nil {
+		time.Sleep(fd.Delay.Duration)
+		return fd, injectedError(op, fd.Errors)
+	}
+	return nil, newError(op, nvml.ERROR_GPU_IS_LOST, ReturnName(nvml.ERROR_GPU_IS_LOST))
+}
+
+// findFakeDevice finds the device or MIG device not removed by uuid.
+func findFakeDevice(devices []*FakeDevice, uuid string) *FakeDevice {
+	for _, fd := range devices {
+		if fd.Removed {
+			continue
+		}
+		if fd.UUID == uuid {
+			return fd
+		}
+		if mig := findFakeDevice(fd.MigDevices, uuid); mig != nil {
+			return mig
+		}
+	}
+	return nil
+}
+
+func (d *fakeDevice) GetUUID() (string, error) {
+	fd, err := d.call("GetUUID")
+	if err != nil {
+		return "", err
+	}
+	return fd.UUID, nil
+}
+
+func (d *fakeDevice) GetName() (string, error) {
+	fd, err := d.call("GetName")
+	if err != nil {
+		return "", err
+	}
+	return fd.Name, nil
+}
+
+func (d *fakeDevice) GetBrand() (string, error) {
+	fd, err := d.call("GetBrand")
+	if err != nil {
+		return "", err
+	}
+	if fd.Brand == "" {
+		return brand2type[0], nil
+	}
+	return fd.Brand, nil
+}
+
+func (d *fakeDevice) GetPciBusId() (string, error) {
+	fd, err := d.call("GetPciBusId")
+	if err != nil {
+		return "", err
+	}
+	return fd.BusId, nil
+}
+
+func (d *fakeDevice) GetCudaComputeCapability() (int, int, error) {
+	fd, err := d.call("GetCudaComputeCapability")
+	if err != nil {
+		return 0, 0, err
+	}
+	return fd.ComputeCapability.Major, fd.ComputeCapability.Minor, nil
+}
+
+func (d *fakeDevice) GetArchitecture() (string, error) {
+	fd, err := d.call("GetArchitecture")
+	if err != nil {
+		return "", err
+	}
+	return fd.Architecture, nil
+}
+
+func (d *fakeDevice) GetVbiosVersion() (string, error) {
+	fd, err := d.call("GetVbiosVersion")
+	if err != nil {
+		return "", err
+	}
+	return fd.VbiosVersion, nil
+}
+
+func (d *fakeDevice) GetMinorNumber() (int, error) {
+	fd, err := d.call("GetMinorNumber")
+	if err != nil {
+		return 0, err
+	}
+	if fd.Minor != nil {
+		return *fd.Minor, nil
+	}
+	for i, gpu := range d.provider.inv().Devices {
+		if gpu == fd {
+			return i, nil
+		}
+	}
+	return 0, newError("GetMinorNumber", nvml.ERROR_NOT_SUPPORTED, ReturnName(nvml.ERROR_NOT_SUPPORTED))
+}
+
+func (d *fakeDevice) GetMemoryInfo() (MemoryInfo, error) {
+	fd, err := d.call("GetMemoryInfo")
+	if err != nil {
+		return MemoryInfo{}, err
+	}
+	return fd.Memory, nil
+}
+
+func (d *fakeDevice) GetUtilizationRates() (Utilization, error) {
+	fd, err := d.call("GetUtilizationRates")
+	if err != nil {
+		return Utilization{}, err
+	}
+	return fd.Utilization, nil
+}
+
+func (d *fakeDevice) GetTemperature() (uint32, error) {
+	fd, err := d.call("GetTemperature")
+	if err != nil {
+		return 0, err
+	}
+	return fd.Temperature, nil
+}
+
+func (d *fakeDevice) GetPowerUsage() (uint32, error) {
+	fd, err := d.call("GetPowerUsage")
+	if err != nil {
+		return 0, err
+	}
+	return fd.PowerUsage, nil
+}
+
+var fakeClockNames = map[nvml.ClockType]string{
+	nvml.CLOCK_GRAPHICS: "graphics",
+	nvml.CLOCK_SM:       "sm",
+	nvml.CLOCK_MEM:      "mem",
+}
+
+func (d *fakeDevice) GetClockInfo(clock nvml.ClockType) (uint32, error) {
+	fd, err := d.call("GetClockInfo")
+	if err != nil {
+		return 0, err
+	}
+	name, exist := fakeClockNames[clock]
+	if !exist {
+		return 0, newError("GetClockInfo", nvml.ERROR_INVALID_ARGUMENT, ReturnName(nvml.ERROR_INVALID_ARGUMENT))
+	}
+	return fd.Clocks[name], nil
+}
+
+func (d *fakeDevice) GetCurrentClocksThrottleReasons() (uint64, error) {
+	fd, err := d.call("GetCurrentClocksThrottleReasons")
+	if err != nil {
+		return 0, err
+	}
+	return fd.ThrottleReasons, nil
+}
+
+func (d *fakeDevice) GetSupportedEventTypes() (uint64, error) {
+	if _, err := d.call("GetSupportedEventTypes"); err != nil {
+		return 0, err
+	}
+	return nvml.EventTypeAll, nil
+}
+
+func (d *fakeDevice) RegisterEvents(eventTypes uint64, set EventSet) error {
+	if _, err := d.call("RegisterEvents"); err != nil {
+		return err
+	}
+	s, ok := set.(*fakeEventSet)
+	if !ok {
+		return fmt.Errorf("RegisterEvents error: event set %T is not created by fake provider", set)
+	}
+	s.register(d.uuid, eventTypes)
+	return nil
+}
+
+func (d *fakeDevice) GetMigMode() (bool, error) {
+	fd, err := d.call("GetMigMode")
+	if err != nil {
+		return false, err
+	}
+	return fd.MigEnabled, nil
+}
+
+func (d *fakeDevice) GetMaxMigDeviceCount() (int, error) {
+	fd, err := d.call("GetMaxMigDeviceCount")
+	if err != nil {
+		return 0, err
+	}
+	return len(fd.MigDevices), nil
+}
+
+func (d *fakeDevice) GetMigDeviceByIndex(idx int) (Device, error) {
+	fd, err := d.call("GetMigDeviceByIndex")
+	if err != nil {
+		return nil, err
+	}
+	if !fd.MigEnabled || idx < 0 || idx >= len(fd.MigDevices) || fd.MigDevices[idx].Removed {
+		return nil, newError("GetMigDeviceByIndex", nvml.ERROR_NOT_FOUND, ReturnName(nvml.ERROR_NOT_FOUND))
+	}
+	return &fakeDevice{provider: d.provider, uuid: fd.MigDevices[idx].UUID}, nil
+}
+
+func (d *fakeDevice) GetMigInfo() (MigInfo, error) {
+	fd, err := d.call("GetMigInfo")
+	if err != nil {
+		return MigInfo{}, err
+	}
+	if fd.Mig == nil {
+		return MigInfo{}, newError("GetMigInfo", nvml.ERROR_INVALID_ARGUMENT, ReturnName(nvml.ERROR_INVALID_ARGUMENT))
+	}
+	return *fd.Mig, nil
+}
+
+var fakeTopologyLevels = map[string]nvml.GpuTopologyLevel{
+	"internal":   nvml.TOPOLOGY_INTERNAL,
+	"single":     nvml.TOPOLOGY_SINGLE,
+	"multiple":   nvml.TOPOLOGY_MULTIPLE,
+	"hostbridge": nvml.TOPOLOGY_HOSTBRIDGE,
+	"node":       nvml.TOPOLOGY_NODE,
+	"system":     nvml.TOPOLOGY_SYSTEM,
+}
+
+func (d *fakeDevice) GetTopologyCommonAncestor(peer Device) (nvml.GpuTopologyLevel, error) {
+	fd, err := d.call("GetTopologyCommonAncestor")
+	if err != nil {
+		return 0, err
+	}
+	p, ok := peer.(*fakeDevice)
+	if !ok {
+		return 0, fmt.Errorf("GetTopologyCommonAncestor error: peer %T is not got by fake provider", peer)
+	}
+	pfd, err := p.call("GetTopologyCommonAncestor")
+	if err != nil {
+		return 0, err
+	}
+	name, exist := fd.Topology[pfd.UUID]
+	if !exist {
+		name, exist = pfd.Topology[fd.UUID]
+	}
+	if !exist {
+		return nvml.TOPOLOGY_SYSTEM, nil
+	}
+	level, exist := fakeTopologyLevels[name]
+	if !exist {
+		return 0, newError("GetTopologyCommonAncestor", nvml.ERROR_UNKNOWN, ReturnName(nvml.ERROR_UNKNOWN))
+	}
+	return level, nil
+}
+
+func (d *fakeDevice) GetNvLinkRemotePciBusIds() ([]string, error) {
+	fd, err := d.call("GetNvLinkRemotePciBusIds")
+	if err != nil {
+		return nil, err
+	}
+	return fd.NvLinks, nil
+}
+
+func (d *fakeDevice) GetRunningProcesses() ([]ProcessInfo, error) {
+	fd, err := d.call("GetRunningProcesses")
+	if err != nil {
+		return nil, err
+	}
+	processes := make([]ProcessInfo, 0, len(fd.Processes))
+	for _, p := range fd.Processes {
+		if p.Type == "" {
+			p.Type = ProcessTypeCompute
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+func (d *fakeDevice) GetProcessUtilization(lastSeen uint64) ([]ProcessUtilization, error) {
+	fd, err := d.call("GetProcessUtilization")
+	if err != nil {
+		return nil, err
+	}
+	var utilization []ProcessUtilization
+	for _, u := range fd.ProcessUtilization {
+		if u.Timestamp > lastSeen {
+			utilization = append(utilization, u)
+		}
+	}
+	return utilization, nil
+}
+
+func (d *fakeDevice) GetAccountingMode() (bool, error) {
+	fd, err := d.call("GetAccountingMode")
+	if err != nil {
+		return false, err
+	}
+	return fd.AccountingMode, nil
+}
+
+func (d *fakeDevice) GetAccountingStats(pid uint32) (AccountingStats, error) {
+	fd, err := d.call("GetAccountingStats")
+	if err != nil {
+		return AccountingStats{}, err
+	}
+	for _, stats := range fd.AccountingStats {
+		if fd.AccountingMode && stats.Pid == pid {
+			return stats, nil
+		}
+	}
+	return AccountingStats{}, newError("GetAccountingStats", nvml.ERROR_NOT_FOUND, ReturnName(nvml.ERROR_NOT_FOUND))
+}
+
+func (d *fakeDevice) GetTotalEccErrors(errorType nvml.MemoryErrorType) (uint64, error) {
+	fd, err := d.call("GetTotalEccErrors")
+	if err != nil {
+		return 0, err
+	}
+	switch errorType {
+	case nvml.MEMORY_ERROR_TYPE_CORRECTED:
+		return fd.EccErrors.Corrected, nil
+	case nvml.MEMORY_ERROR_TYPE_UNCORRECTED:
+		return fd.EccErrors.Uncorrected, nil
+	}
+	return 0, newError("GetTotalEccErrors", nvml.ERROR_INVALID_ARGUMENT, ReturnName(nvml.ERROR_INVALID_ARGUMENT))
+}
+
+var fakePageRetirementCauseNames = map[nvml.PageRetirementCause]string{
+	nvml.PAGE_RETIREMENT_CAUSE_MULTIPLE_SINGLE_BIT_ECC_ERRORS: "multiple_single_bit",
+	nvml.PAGE_RETIREMENT_CAUSE_DOUBLE_BIT_ECC_ERROR:           "double_bit",
+}
+
+func (d *fakeDevice) GetRetiredPages(cause nvml.PageRetirementCause) ([]uint64, error) {
+	fd, err := d.call("GetRetiredPages")
+	if err != nil {
+		return nil, err
+	}
+	name, exist := fakePageRetirementCauseNames[cause]
+	if !exist {
+		return nil, newError("GetRetiredPages", nvml.ERROR_INVALID_ARGUMENT, ReturnName(nvml.ERROR_INVALID_ARGUMENT))
+	}
+	return fd.RetiredPages[name], nil
+}
+
+func (d *fakeDevice) GetRetiredPagesPendingStatus() (bool, error) {
+	fd, err := d.call("GetRetiredPagesPendingStatus")
+	if err != nil {
+		return false, err
+	}
+	return fd.RetiredPagesPending, nil
+}
+
+func (d *fakeDevice) GetRemappedRows() (RemappedRows, error) {
+	fd, err := d.call("GetRemappedRows")
+	if err != nil {
+		return RemappedRows{}, err
+	}
+	return fd.RemappedRows, nil
+}
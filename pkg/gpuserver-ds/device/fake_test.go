@@ -0,0 +1,160 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+const testInventory = `
+devices:
+- uuid: GPU-0
+  name: Tesla T4
+  brand: BRAND_TESLA
+  bus_id: "00000000:00:1E.0"
+- uuid: GPU-1
+  name: Tesla T4
+  bus_id: "00000000:00:1F.0"
+  errors:
+    GetName: ERROR_UNKNOWN
+- uuid: GPU-2
+  name: Tesla V100
+  removed: true
+`
+
+func writeInventory(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "inventory.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFakeProvider(t *testing.T) {
+	p, err := NewFakeProvider(writeInventory(t, t.TempDir(), testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := p.GetDeviceCount()
+	if err != nil || count != 2 {
+		t.Fatalf("GetDeviceCount() = %d, %v, want 2, nil", count, err)
+	}
+
+	var tests = []struct {
+		name      string
+		uuid      string
+		call      func(d Device) (string, error)
+		want      string
+		wantGetRe nvml.Return
+		wantRe    nvml.Return
+	}{
+		{
+			name: "get name",
+			uuid: "GPU-0",
+			call: Device.GetName,
+			want: "Tesla T4",
+		},
+		{
+			name: "get brand",
+			uuid: "GPU-0",
+			call: Device.GetBrand,
+			want: "BRAND_TESLA",
+		},
+		{
+			name: "get brand unset",
+			uuid: "GPU-1",
+			call: Device.GetBrand,
+			want: "BRAND_UNKNOWN",
+		},
+		{
+			name: "get pci bus id",
+			uuid: "GPU-1",
+			call: Device.GetPciBusId,
+			want: "00000000:00:1F.0",
+		},
+		{
+			name:   "injected error",
+			uuid:   "GPU-1",
+			call:   Device.GetName,
+			wantRe: nvml.ERROR_UNKNOWN,
+		},
+		{
+			name:      "removed device",
+			uuid:      "GPU-2",
+			wantGetRe: nvml.ERROR_NOT_FOUND,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := p.GetDeviceByUUID(tt.uuid)
+			if re := ReturnOf(err); re != tt.wantGetRe {
+				t.Fatalf("GetDeviceByUUID() return = %s, want %s", ReturnName(re), ReturnName(tt.wantGetRe))
+			}
+			if err != nil {
+				return
+			}
+			got, err := tt.call(d)
+			if re := ReturnOf(err); re != tt.wantRe {
+				t.Fatalf("call return = %s, want %s", ReturnName(re), ReturnName(tt.wantRe))
+			}
+			if got != tt.want {
+				t.Errorf("call = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeProviderReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeInventory(t, dir, testInventory)
+	p, err := NewFakeProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := p.GetDeviceByIndex(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the device falls off the bus after it is got.
+	writeInventory(t, dir, `
+delay: 20ms
+devices:
+- uuid: GPU-0
+  removed: true
+- uuid: GPU-1
+`)
+	start := time.Now()
+	count, err := p.GetDeviceCount()
+	if err != nil || count != 1 {
+		t.Fatalf("GetDeviceCount() = %d, %v, want 1, nil", count, err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("GetDeviceCount() is not delayed")
+	}
+	if _, err := d.GetName(); ReturnOf(err) != nvml.ERROR_GPU_IS_LOST {
+		t.Errorf("GetName() of removed device err = %v, want %s", err, ReturnName(nvml.ERROR_GPU_IS_LOST))
+	}
+
+	// a broken inventory keeps the last one.
+	writeInventory(t, dir, `devices: [`)
+	if count, err := p.GetDeviceCount(); err != nil || count != 1 {
+		t.Fatalf("GetDeviceCount() with broken inventory = %d, %v, want 1, nil", count, err)
+	}
+
+	writeInventory(t, dir, `
+errors:
+  GetDeviceCount: ERROR_DRIVER_NOT_LOADED
+`)
+	if _, err := p.GetDeviceCount(); ReturnOf(err) != nvml.ERROR_DRIVER_NOT_LOADED {
+		t.Errorf("GetDeviceCount() err = %v, want %s", err, ReturnName(nvml.ERROR_DRIVER_NOT_LOADED))
+	}
+}
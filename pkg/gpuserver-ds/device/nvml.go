@@ -0,0 +1,457 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+var brand2type = [18]string{"BRAND_UNKNOWN", "BRAND_QUADRO", "BRAND_TESLA", "BRAND_NVS", "BRAND_GRID", "BRAND_GEFORCE",
+	"BRAND_TITAN", "BRAND_NVIDIA_VAPPS", "BRAND_NVIDIA_VPC", "BRAND_NVIDIA_VCS", "BRAND_NVIDIA_VWS", "BRAND_NVIDIA_VGAMING",
+	"BRAND_QUADRO_RTX", "BRAND_NVIDIA_RTX", "BRAND_NVIDIA", "BRAND_GEFORCE_RTX", "BRAND_TITAN_RTX", "BRAND_COUNT"}
+
+var arch2name = map[nvml.DeviceArchitecture]string{
+	nvml.DEVICE_ARCH_KEPLER:  "Kepler",
+	nvml.DEVICE_ARCH_MAXWELL: "Maxwell",
+	nvml.DEVICE_ARCH_PASCAL:  "Pascal",
+	nvml.DEVICE_ARCH_VOLTA:   "Volta",
+	nvml.DEVICE_ARCH_TURING:  "Turing",
+	nvml.DEVICE_ARCH_AMPERE:  "Ampere",
+}
+
+var _ Provider = &nvmlProvider{}
+
+// NewNvmlProvider creates the Provider depends on the package github.com/NVIDIA/go-nvml/pkg/nvml.
+func NewNvmlProvider() Provider {
+	return &nvmlProvider{}
+}
+
+type nvmlProvider struct{}
+
+func nvmlError(op string, ret nvml.Return) error {
+	return newError(op, ret, nvml.ErrorString(ret))
+}
+
+func (p *nvmlProvider) Init() error {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return nvmlError("nvml.Init", ret)
+	}
+	return nil
+}
+
+func (p *nvmlProvider) Shutdown() error {
+	if ret := nvml.Shutdown(); ret != nvml.SUCCESS {
+		return nvmlError("nvml.Shutdown", ret)
+	}
+	return nil
+}
+
+func (p *nvmlProvider) GetDeviceCount() (int, error) {
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("nvml.DeviceGetCount", ret)
+	}
+	return count, nil
+}
+
+func (p *nvmlProvider) GetDeviceByIndex(idx int) (Device, error) {
+	device, ret := nvml.DeviceGetHandleByIndex(idx)
+	if ret != nvml.SUCCESS {
+		return nil, nvmlError("nvml.DeviceGetHandleByIndex", ret)
+	}
+	return &nvmlDevice{device: device}, nil
+}
+
+func (p *nvmlProvider) GetDeviceByUUID(uuid string) (Device, error) {
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return nil, nvmlError("nvml.DeviceGetHandleByUUID", ret)
+	}
+	return &nvmlDevice{device: device}, nil
+}
+
+func (p *nvmlProvider) GetDriverVersion() (string, error) {
+	version, ret := nvml.SystemGetDriverVersion()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("nvml.SystemGetDriverVersion", ret)
+	}
+	return version, nil
+}
+
+func (p *nvmlProvider) GetCudaDriverVersion() (int, error) {
+	version, ret := nvml.SystemGetCudaDriverVersion()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("nvml.SystemGetCudaDriverVersion", ret)
+	}
+	return version, nil
+}
+
+func (p *nvmlProvider) NewEventSet() (EventSet, error) {
+	set, ret := nvml.EventSetCreate()
+	if ret != nvml.SUCCESS {
+		return nil, nvmlError("nvml.EventSetCreate", ret)
+	}
+	return &nvmlEventSet{set: set}, nil
+}
+
+type nvmlEventSet struct {
+	set nvml.EventSet
+}
+
+func (s *nvmlEventSet) Wait(timeout time.Duration) (Event, error) {
+	data, ret := s.set.Wait(uint32(timeout.Milliseconds()))
+	if ret != nvml.SUCCESS {
+		return Event{}, nvmlError("nvml.EventSetWait", ret)
+	}
+	event := Event{Type: data.EventType, Data: data.EventData}
+	// the device handle may be nil, for example some Xids are not attributed to a device.
+	if data.Device.Handle != nil {
+		if uuid, ret := data.Device.GetUUID(); ret == nvml.SUCCESS {
+			event.DeviceUUID = uuid
+		}
+	}
+	return event, nil
+}
+
+func (s *nvmlEventSet) Free() error {
+	if ret := s.set.Free(); ret != nvml.SUCCESS {
+		return nvmlError("nvml.EventSetFree", ret)
+	}
+	return nil
+}
+
+type nvmlDevice struct {
+	device nvml.Device
+}
+
+func (d *nvmlDevice) GetUUID() (string, error) {
+	uuid, ret := d.device.GetUUID()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("device.GetUUID", ret)
+	}
+	return uuid, nil
+}
+
+func (d *nvmlDevice) GetName() (string, error) {
+	name, ret := d.device.GetName()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("device.GetName", ret)
+	}
+	return name, nil
+}
+
+func (d *nvmlDevice) GetBrand() (string, error) {
+	brandid, ret := d.device.GetBrand()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("device.GetBrand", ret)
+	}
+	if int(brandid) < 0 || int(brandid) >= len(brand2type) {
+		return brand2type[0], nil
+	}
+	return brand2type[brandid], nil
+}
+
+func (d *nvmlDevice) GetPciBusId() (string, error) {
+	pciinfo, ret := d.device.GetPciInfo()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("device.GetPciInfo", ret)
+	}
+	return busIdToString(pciinfo.BusId), nil
+}
+
+func (d *nvmlDevice) GetCudaComputeCapability() (int, int, error) {
+	major, minor, ret := d.device.GetCudaComputeCapability()
+	if ret != nvml.SUCCESS {
+		return 0, 0, nvmlError("device.GetCudaComputeCapability", ret)
+	}
+	return major, minor, nil
+}
+
+func (d *nvmlDevice) GetArchitecture() (string, error) {
+	arch, ret := d.device.GetArchitecture()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("device.GetArchitecture", ret)
+	}
+	if name, exist := arch2name[arch]; exist {
+		return name, nil
+	}
+	return "Unknown", nil
+}
+
+func (d *nvmlDevice) GetVbiosVersion() (string, error) {
+	version, ret := d.device.GetVbiosVersion()
+	if ret != nvml.SUCCESS {
+		return "", nvmlError("device.GetVbiosVersion", ret)
+	}
+	return version, nil
+}
+
+func (d *nvmlDevice) GetMinorNumber() (int, error) {
+	minor, ret := d.device.GetMinorNumber()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetMinorNumber", ret)
+	}
+	return minor, nil
+}
+
+func (d *nvmlDevice) GetMemoryInfo() (MemoryInfo, error) {
+	memory, ret := d.device.GetMemoryInfo()
+	if ret != nvml.SUCCESS {
+		return MemoryInfo{}, nvmlError("device.GetMemoryInfo", ret)
+	}
+	return MemoryInfo{Total: memory.Total, Used: memory.Used, Free: memory.Free}, nil
+}
+
+func (d *nvmlDevice) GetUtilizationRates() (Utilization, error) {
+	utilization, ret := d.device.GetUtilizationRates()
+	if ret != nvml.SUCCESS {
+		return Utilization{}, nvmlError("device.GetUtilizationRates", ret)
+	}
+	return Utilization{Gpu: utilization.Gpu, Memory: utilization.Memory}, nil
+}
+
+func (d *nvmlDevice) GetTemperature() (uint32, error) {
+	temperature, ret := d.device.GetTemperature(nvml.TEMPERATURE_GPU)
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetTemperature", ret)
+	}
+	return temperature, nil
+}
+
+func (d *nvmlDevice) GetPowerUsage() (uint32, error) {
+	power, ret := d.device.GetPowerUsage()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetPowerUsage", ret)
+	}
+	return power, nil
+}
+
+func (d *nvmlDevice) GetClockInfo(clock nvml.ClockType) (uint32, error) {
+	mhz, ret := d.device.GetClockInfo(clock)
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetClockInfo", ret)
+	}
+	return mhz, nil
+}
+
+func (d *nvmlDevice) GetCurrentClocksThrottleReasons() (uint64, error) {
+	reasons, ret := d.device.GetCurrentClocksThrottleReasons()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetCurrentClocksThrottleReasons", ret)
+	}
+	return reasons, nil
+}
+
+func (d *nvmlDevice) GetSupportedEventTypes() (uint64, error) {
+	eventTypes, ret := d.device.GetSupportedEventTypes()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetSupportedEventTypes", ret)
+	}
+	return eventTypes, nil
+}
+
+func (d *nvmlDevice) RegisterEvents(eventTypes uint64, set EventSet) error {
+	s, ok := set.(*nvmlEventSet)
+	if !ok {
+		return fmt.Errorf("device.RegisterEvents error: event set %T is not created by nvml provider", set)
+	}
+	if ret := d.device.RegisterEvents(eventTypes, s.set); ret != nvml.SUCCESS {
+		return nvmlError("device.RegisterEvents", ret)
+	}
+	return nil
+}
+
+func (d *nvmlDevice) GetMigMode() (bool, error) {
+	current, _, ret := d.device.GetMigMode()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return false, nil
+	}
+	if ret != nvml.SUCCESS {
+		return false, nvmlError("device.GetMigMode", ret)
+	}
+	return current == nvml.DEVICE_MIG_ENABLE, nil
+}
+
+func (d *nvmlDevice) GetMaxMigDeviceCount() (int, error) {
+	count, ret := d.device.GetMaxMigDeviceCount()
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetMaxMigDeviceCount", ret)
+	}
+	return count, nil
+}
+
+func (d *nvmlDevice) GetMigDeviceByIndex(idx int) (Device, error) {
+	mig, ret := d.device.GetMigDeviceHandleByIndex(idx)
+	if ret != nvml.SUCCESS {
+		return nil, nvmlError("device.GetMigDeviceHandleByIndex", ret)
+	}
+	return &nvmlDevice{device: mig}, nil
+}
+
+func (d *nvmlDevice) GetMigInfo() (MigInfo, error) {
+	gi, ret := d.device.GetGpuInstanceId()
+	if ret != nvml.SUCCESS {
+		return MigInfo{}, nvmlError("device.GetGpuInstanceId", ret)
+	}
+	ci, ret := d.device.GetComputeInstanceId()
+	if ret != nvml.SUCCESS {
+		return MigInfo{}, nvmlError("device.GetComputeInstanceId", ret)
+	}
+	attr, ret := d.device.GetAttributes()
+	if ret != nvml.SUCCESS {
+		return MigInfo{}, nvmlError("device.GetAttributes", ret)
+	}
+	return MigInfo{
+		GpuInstanceId:             gi,
+		ComputeInstanceId:         ci,
+		GpuInstanceSliceCount:     attr.GpuInstanceSliceCount,
+		ComputeInstanceSliceCount: attr.ComputeInstanceSliceCount,
+		MemorySizeMB:              attr.MemorySizeMB,
+	}, nil
+}
+
+func (d *nvmlDevice) GetTopologyCommonAncestor(peer Device) (nvml.GpuTopologyLevel, error) {
+	p, ok := peer.(*nvmlDevice)
+	if !ok {
+		return 0, fmt.Errorf("device.GetTopologyCommonAncestor error: peer %T is not got by nvml provider", peer)
+	}
+	level, ret := d.device.GetTopologyCommonAncestor(p.device)
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetTopologyCommonAncestor", ret)
+	}
+	return level, nil
+}
+
+func (d *nvmlDevice) GetNvLinkRemotePciBusIds() ([]string, error) {
+	var busIds []string
+	for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+		state, ret := d.device.GetNvLinkState(link)
+		if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+			// NVLink is not supported or the link is not present.
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, nvmlError("device.GetNvLinkState", ret)
+		}
+		if state != nvml.FEATURE_ENABLED {
+			continue
+		}
+		pciinfo, ret := d.device.GetNvLinkRemotePciInfo(link)
+		if ret != nvml.SUCCESS {
+			return nil, nvmlError("device.GetNvLinkRemotePciInfo", ret)
+		}
+		busIds = append(busIds, busIdToString(pciinfo.BusId))
+	}
+	return busIds, nil
+}
+
+func (d *nvmlDevice) GetRunningProcesses() ([]ProcessInfo, error) {
+	var processes []ProcessInfo
+	pids := make(map[uint32]bool)
+	for _, get := range []struct {
+		op          string
+		processType string
+		get         func() ([]nvml.ProcessInfo, nvml.Return)
+	}{
+		{"device.GetComputeRunningProcesses", ProcessTypeCompute, d.device.GetComputeRunningProcesses},
+		{"device.GetGraphicsRunningProcesses", ProcessTypeGraphics, d.device.GetGraphicsRunningProcesses},
+	} {
+		infos, ret := get.get()
+		if ret == nvml.ERROR_NOT_SUPPORTED {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, nvmlError(get.op, ret)
+		}
+		for _, info := range infos {
+			if pids[info.Pid] {
+				continue
+			}
+			pids[info.Pid] = true
+			processes = append(processes, ProcessInfo{Pid: info.Pid, UsedGpuMemory: info.UsedGpuMemory, Type: get.processType})
+		}
+	}
+	return processes, nil
+}
+
+func (d *nvmlDevice) GetProcessUtilization(lastSeen uint64) ([]ProcessUtilization, error) {
+	samples, ret := d.device.GetProcessUtilization(lastSeen)
+	if ret == nvml.ERROR_NOT_FOUND {
+		// no sample newer than lastSeen
+		return nil, nil
+	}
+	if ret != nvml.SUCCESS {
+		return nil, nvmlError("device.GetProcessUtilization", ret)
+	}
+	utilization := make([]ProcessUtilization, 0, len(samples))
+	for _, s := range samples {
+		if s.Pid == 0 {
+			// the buffer is not filled
+			continue
+		}
+		utilization = append(utilization, ProcessUtilization{Pid: s.Pid, Timestamp: s.TimeStamp, SmUtil: s.SmUtil, MemUtil: s.MemUtil})
+	}
+	return utilization, nil
+}
+
+func (d *nvmlDevice) GetAccountingMode() (bool, error) {
+	mode, ret := d.device.GetAccountingMode()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return false, nil
+	}
+	if ret != nvml.SUCCESS {
+		return false, nvmlError("device.GetAccountingMode", ret)
+	}
+	return mode == nvml.FEATURE_ENABLED, nil
+}
+
+func (d *nvmlDevice) GetAccountingStats(pid uint32) (AccountingStats, error) {
+	stats, ret := d.device.GetAccountingStats(pid)
+	if ret != nvml.SUCCESS {
+		return AccountingStats{}, nvmlError("device.GetAccountingStats", ret)
+	}
+	return AccountingStats{Pid: pid, GpuUtilization: stats.GpuUtilization, MemoryUtilization: stats.MemoryUtilization, MaxMemoryUsage: stats.MaxMemoryUsage}, nil
+}
+
+func (d *nvmlDevice) GetTotalEccErrors(errorType nvml.MemoryErrorType) (uint64, error) {
+	count, ret := d.device.GetTotalEccErrors(errorType, nvml.AGGREGATE_ECC)
+	if ret != nvml.SUCCESS {
+		return 0, nvmlError("device.GetTotalEccErrors", ret)
+	}
+	return count, nil
+}
+
+func (d *nvmlDevice) GetRetiredPages(cause nvml.PageRetirementCause) ([]uint64, error) {
+	addresses, ret := d.device.GetRetiredPages(cause)
+	if ret != nvml.SUCCESS {
+		return nil, nvmlError("device.GetRetiredPages", ret)
+	}
+	return addresses, nil
+}
+
+func (d *nvmlDevice) GetRetiredPagesPendingStatus() (bool, error) {
+	pending, ret := d.device.GetRetiredPagesPendingStatus()
+	if ret != nvml.SUCCESS {
+		return false, nvmlError("device.GetRetiredPagesPendingStatus", ret)
+	}
+	return pending == nvml.FEATURE_ENABLED, nil
+}
+
+func (d *nvmlDevice) GetRemappedRows() (RemappedRows, error) {
+	correctable, uncorrectable, pending, failure, ret := d.device.GetRemappedRows()
+	if ret != nvml.SUCCESS {
+		return RemappedRows{}, nvmlError("device.GetRemappedRows", ret)
+	}
+	return RemappedRows{Correctable: correctable, Uncorrectable: uncorrectable, Pending: pending, Failure: failure}, nil
+}
+
+func busIdToString(busId [32]int8) string {
+	pciinfoBusid := make([]byte, 0, 32)
+	for _, v := range busId {
+		if v != 0 {
+			pciinfoBusid = append(pciinfoBusid, byte(v))
+		}
+	}
+	return string(pciinfoBusid)
+}
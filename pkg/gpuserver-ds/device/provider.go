@@ -0,0 +1,329 @@
+// Package device abstracts the gpu device discovery used by gpuserver-ds.
+// The nvml provider talks to the NVIDIA driver through NVML, the fake provider
+// reads the devices from an inventory file so gpuserver-ds can run without gpus.
+package device
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+const (
+	// ProviderNVML discovers devices through NVML.
+	ProviderNVML = "nvml"
+	// ProviderFake discovers devices from an inventory file.
+	ProviderFake = "fake"
+)
+
+// Provider is the entrypoint of the device discovery.
+type Provider interface {
+	Init() error
+	Shutdown() error
+	// GetDeviceCount returns the number of devices on the node.
+	GetDeviceCount() (int, error)
+	GetDeviceByIndex(idx int) (Device, error)
+	GetDeviceByUUID(uuid string) (Device, error)
+	// GetDriverVersion returns the version of the NVIDIA driver, such as 470.57.02.
+	GetDriverVersion() (string, error)
+	// GetCudaDriverVersion returns the CUDA version supported by the driver as major*1000+minor*10, such as 11040 for 11.4.
+	GetCudaDriverVersion() (int, error)
+	// NewEventSet creates the EventSet which devices register events to.
+	NewEventSet() (EventSet, error)
+}
+
+// EventSet receives the events registered by devices.
+type EventSet interface {
+	// Wait waits for the next event, the error of nvml.ERROR_TIMEOUT is returned if no event arrives in timeout.
+	Wait(timeout time.Duration) (Event, error)
+	Free() error
+}
+
+// Event is an nvml event of a device.
+type Event struct {
+	// DeviceUUID is empty if the event can not be attributed to a device.
+	DeviceUUID string
+	// Type is one of nvml.EventType*.
+	Type uint64
+	// Data is the Xid for nvml.EventTypeXidCriticalError.
+	Data uint64
+}
+
+// Device is a single gpu device returned by the Provider.
+type Device interface {
+	GetUUID() (string, error)
+	// GetName returns the product name of the device, such as "Tesla T4".
+	GetName() (string, error)
+	// GetBrand returns the brand type name, such as "BRAND_TESLA".
+	GetBrand() (string, error)
+	// GetPciBusId returns the pci bus id of the device.
+	GetPciBusId() (string, error)
+	// GetCudaComputeCapability returns the major and minor CUDA compute capability, such as 8 and 0.
+	GetCudaComputeCapability() (int, int, error)
+	// GetArchitecture returns the architecture name, such as Ampere.
+	GetArchitecture() (string, error)
+	// GetVbiosVersion returns the version of the VBIOS of the device.
+	GetVbiosVersion() (string, error)
+	// GetMinorNumber returns the minor number of the device node /dev/nvidia<minor>, it is not supported by MIG devices.
+	GetMinorNumber() (int, error)
+	GetMemoryInfo() (MemoryInfo, error)
+	GetUtilizationRates() (Utilization, error)
+	// GetTemperature returns the gpu core temperature in degrees C.
+	GetTemperature() (uint32, error)
+	// GetPowerUsage returns the power usage in milliwatts.
+	GetPowerUsage() (uint32, error)
+	// GetClockInfo returns the current clock speed in MHz.
+	GetClockInfo(clock nvml.ClockType) (uint32, error)
+	// GetCurrentClocksThrottleReasons returns the bitmask of nvml.ClocksThrottleReason*.
+	GetCurrentClocksThrottleReasons() (uint64, error)
+	// GetSupportedEventTypes returns the bitmask of nvml.EventType* the device supports.
+	GetSupportedEventTypes() (uint64, error)
+	// RegisterEvents registers the bitmask of nvml.EventType* to the set.
+	RegisterEvents(eventTypes uint64, set EventSet) error
+	// GetMigMode returns whether MIG mode is enabled currently, false is returned if MIG is not supported.
+	GetMigMode() (bool, error)
+	// GetMaxMigDeviceCount returns the max number of MIG devices of the gpu in MIG mode.
+	GetMaxMigDeviceCount() (int, error)
+	// GetMigDeviceByIndex returns the MIG device of the gpu, nvml.ERROR_NOT_FOUND is returned if the index is not populated.
+	GetMigDeviceByIndex(idx int) (Device, error)
+	// GetMigInfo returns the instance ids and attributes of a MIG device.
+	GetMigInfo() (MigInfo, error)
+	// GetTopologyCommonAncestor returns the closest PCIe ancestor the device shares with the peer.
+	GetTopologyCommonAncestor(peer Device) (nvml.GpuTopologyLevel, error)
+	// GetNvLinkRemotePciBusIds returns the remote pci bus id of each active NVLink, which is a gpu or an NVSwitch.
+	// Nothing is returned if NVLink is not supported.
+	GetNvLinkRemotePciBusIds() ([]string, error)
+	// GetRunningProcesses returns the compute and graphics processes running on the device.
+	GetRunningProcesses() ([]ProcessInfo, error)
+	// GetProcessUtilization returns the utilization samples of the processes newer than the CPU timestamp lastSeen in microseconds.
+	// Nothing is returned if there is no sample newer.
+	GetProcessUtilization(lastSeen uint64) ([]ProcessUtilization, error)
+	// GetAccountingMode returns whether the driver keeps the accounting stats of the processes.
+	GetAccountingMode() (bool, error)
+	// GetAccountingStats returns the accounting stats of the process, nvml.ERROR_NOT_FOUND is returned if they are not kept.
+	GetAccountingStats(pid uint32) (AccountingStats, error)
+	// GetTotalEccErrors returns the aggregate count of the ECC errors of the type over the lifetime of the device.
+	GetTotalEccErrors(errorType nvml.MemoryErrorType) (uint64, error)
+	// GetRetiredPages returns the addresses of the memory pages retired for the cause.
+	GetRetiredPages(cause nvml.PageRetirementCause) ([]uint64, error)
+	// GetRetiredPagesPendingStatus returns whether any page is pending retirement until the device is reset.
+	GetRetiredPagesPendingStatus() (bool, error)
+	// GetRemappedRows returns the rows remapped of the device, which replaces the page retirement since Ampere.
+	GetRemappedRows() (RemappedRows, error)
+}
+
+const (
+	ProcessTypeCompute  = "compute"
+	ProcessTypeGraphics = "graphics"
+)
+
+// ProcessInfo is a process running on the device, a process both compute and graphics is of type compute.
+type ProcessInfo struct {
+	Pid uint32 `json:"pid"`
+	// UsedGpuMemory is the memory used by the process in bytes.
+	UsedGpuMemory uint64 `json:"used_memory,omitempty"`
+	Type          string `json:"type,omitempty"`
+}
+
+// ProcessUtilization is a utilization sample of a process on the device.
+type ProcessUtilization struct {
+	Pid uint32 `json:"pid"`
+	// Timestamp is the CPU timestamp of the sample in microseconds.
+	Timestamp uint64 `json:"timestamp"`
+	// SmUtil and MemUtil are the percent of the SM and memory utilization by the process.
+	SmUtil  uint32 `json:"sm_util"`
+	MemUtil uint32 `json:"mem_util"`
+}
+
+// AccountingStats are the stats of a process kept by the driver when the accounting mode is on.
+type AccountingStats struct {
+	Pid uint32 `json:"pid"`
+	// GpuUtilization and MemoryUtilization are the percent averaged over the lifetime of the process.
+	GpuUtilization    uint32 `json:"gpu_utilization"`
+	MemoryUtilization uint32 `json:"memory_utilization"`
+	// MaxMemoryUsage is the max memory used by the process in bytes.
+	MaxMemoryUsage uint64 `json:"max_memory_usage"`
+}
+
+// RemappedRows are the memory rows remapped of the device.
+type RemappedRows struct {
+	// Correctable and Uncorrectable are the rows remapped for the correctable and uncorrectable errors.
+	Correctable   int `json:"correctable"`
+	Uncorrectable int `json:"uncorrectable"`
+	// Pending means a remapping is pending until the device is reset.
+	Pending bool `json:"pending"`
+	// Failure means a remapping failed, the device has no spare rows any more.
+	Failure bool `json:"failure"`
+}
+
+// MigInfo is the gpu instance and compute instance of a MIG device.
+type MigInfo struct {
+	GpuInstanceId             int    `json:"gi"`
+	ComputeInstanceId         int    `json:"ci"`
+	GpuInstanceSliceCount     uint32 `json:"gi_slices"`
+	ComputeInstanceSliceCount uint32 `json:"ci_slices"`
+	MemorySizeMB              uint64 `json:"memory_mb"`
+}
+
+// Profile returns the MIG profile name like the one in the resource name nvidia.com/mig-<profile>,
+// such as 1g.5gb, or 1c.2g.10gb if the compute instance takes part of the gpu instance.
+func (mi MigInfo) Profile() string {
+	gb := (mi.MemorySizeMB + 1024 - 1) / 1024
+	if mi.ComputeInstanceSliceCount == mi.GpuInstanceSliceCount {
+		return fmt.Sprintf("%dg.%dgb", mi.GpuInstanceSliceCount, gb)
+	}
+	return fmt.Sprintf("%dc.%dg.%dgb", mi.ComputeInstanceSliceCount, mi.GpuInstanceSliceCount, gb)
+}
+
+// MemoryInfo is the frame buffer memory of the device in bytes.
+type MemoryInfo struct {
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
+	Free  uint64 `json:"free"`
+}
+
+// Utilization is the percent of time over the past sample period.
+type Utilization struct {
+	Gpu    uint32 `json:"gpu"`
+	Memory uint32 `json:"memory"`
+}
+
+// NewProvider creates the Provider by name, inventory is only used by the fake provider.
+func NewProvider(name, inventory string) (Provider, error) {
+	switch name {
+	case ProviderNVML, "":
+		return NewNvmlProvider(), nil
+	case ProviderFake:
+		return NewFakeProvider(inventory)
+	default:
+		return nil, fmt.Errorf("unknown device provider: %s", name)
+	}
+}
+
+var eventTypeNames = map[uint64]string{
+	nvml.EventTypeSingleBitEccError: "SingleBitEccError",
+	nvml.EventTypeDoubleBitEccError: "DoubleBitEccError",
+	nvml.EventTypePState:            "PState",
+	nvml.EventTypeXidCriticalError:  "XidCriticalError",
+	nvml.EventTypeClock:             "Clock",
+	nvml.EventTypePowerSourceChange: "PowerSourceChange",
+}
+
+// EventTypeName returns the name of the nvml.EventType*, such as XidCriticalError.
+func EventTypeName(eventType uint64) string {
+	if name, ok := eventTypeNames[eventType]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType_%d", eventType)
+}
+
+func parseEventTypeName(name string) (uint64, error) {
+	for t, n := range eventTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown nvml event type name: %s", name)
+}
+
+var throttleReasonNames = []struct {
+	reason uint64
+	name   string
+}{
+	{nvml.ClocksThrottleReasonGpuIdle, "GpuIdle"},
+	{nvml.ClocksThrottleReasonApplicationsClocksSetting, "ApplicationsClocksSetting"},
+	{nvml.ClocksThrottleReasonSwPowerCap, "SwPowerCap"},
+	{nvml.ClocksThrottleReasonHwSlowdown, "HwSlowdown"},
+	{nvml.ClocksThrottleReasonSyncBoost, "SyncBoost"},
+	{nvml.ClocksThrottleReasonSwThermalSlowdown, "SwThermalSlowdown"},
+	{nvml.ClocksThrottleReasonHwThermalSlowdown, "HwThermalSlowdown"},
+	{nvml.ClocksThrottleReasonHwPowerBrakeSlowdown, "HwPowerBrakeSlowdown"},
+	{nvml.ClocksThrottleReasonDisplayClockSetting, "DisplayClockSetting"},
+}
+
+// ThrottleReasonNames returns the names of the reasons set in the bitmask of GetCurrentClocksThrottleReasons.
+func ThrottleReasonNames(reasons uint64) []string {
+	var names []string
+	for _, r := range throttleReasonNames {
+		if reasons&r.reason != 0 {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
+
+// Error is returned when a device call fails, it keeps the nvml return code.
+type Error struct {
+	Op     string
+	Return nvml.Return
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s error: %s", e.Op, e.Msg)
+}
+
+func newError(op string, ret nvml.Return, msg string) error {
+	return &Error{Op: op, Return: ret, Msg: msg}
+}
+
+// ReturnOf gets the nvml return code from err, nvml.SUCCESS is returned if err is nil
+// and nvml.ERROR_UNKNOWN is returned if err is not an *Error.
+func ReturnOf(err error) nvml.Return {
+	if err == nil {
+		return nvml.SUCCESS
+	}
+	var derr *Error
+	if errors.As(err, &derr) {
+		return derr.Return
+	}
+	return nvml.ERROR_UNKNOWN
+}
+
+var returnNames = map[nvml.Return]string{
+	nvml.SUCCESS:                       "SUCCESS",
+	nvml.ERROR_UNINITIALIZED:           "ERROR_UNINITIALIZED",
+	nvml.ERROR_INVALID_ARGUMENT:        "ERROR_INVALID_ARGUMENT",
+	nvml.ERROR_NOT_SUPPORTED:           "ERROR_NOT_SUPPORTED",
+	nvml.ERROR_NO_PERMISSION:           "ERROR_NO_PERMISSION",
+	nvml.ERROR_ALREADY_INITIALIZED:     "ERROR_ALREADY_INITIALIZED",
+	nvml.ERROR_NOT_FOUND:               "ERROR_NOT_FOUND",
+	nvml.ERROR_INSUFFICIENT_SIZE:       "ERROR_INSUFFICIENT_SIZE",
+	nvml.ERROR_INSUFFICIENT_POWER:      "ERROR_INSUFFICIENT_POWER",
+	nvml.ERROR_DRIVER_NOT_LOADED:       "ERROR_DRIVER_NOT_LOADED",
+	nvml.ERROR_TIMEOUT:                 "ERROR_TIMEOUT",
+	nvml.ERROR_IRQ_ISSUE:               "ERROR_IRQ_ISSUE",
+	nvml.ERROR_LIBRARY_NOT_FOUND:       "ERROR_LIBRARY_NOT_FOUND",
+	nvml.ERROR_FUNCTION_NOT_FOUND:      "ERROR_FUNCTION_NOT_FOUND",
+	nvml.ERROR_CORRUPTED_INFOROM:       "ERROR_CORRUPTED_INFOROM",
+	nvml.ERROR_GPU_IS_LOST:             "ERROR_GPU_IS_LOST",
+	nvml.ERROR_RESET_REQUIRED:          "ERROR_RESET_REQUIRED",
+	nvml.ERROR_OPERATING_SYSTEM:        "ERROR_OPERATING_SYSTEM",
+	nvml.ERROR_LIB_RM_VERSION_MISMATCH: "ERROR_LIB_RM_VERSION_MISMATCH",
+	nvml.ERROR_IN_USE:                  "ERROR_IN_USE",
+	nvml.ERROR_MEMORY:                  "ERROR_MEMORY",
+	nvml.ERROR_NO_DATA:                 "ERROR_NO_DATA",
+	nvml.ERROR_VGPU_ECC_NOT_SUPPORTED:  "ERROR_VGPU_ECC_NOT_SUPPORTED",
+	nvml.ERROR_INSUFFICIENT_RESOURCES:  "ERROR_INSUFFICIENT_RESOURCES",
+	nvml.ERROR_UNKNOWN:                 "ERROR_UNKNOWN",
+}
+
+// ReturnName returns the name of the nvml return code without calling into the nvml library.
+func ReturnName(ret nvml.Return) string {
+	if name, ok := returnNames[ret]; ok {
+		return name
+	}
+	return fmt.Sprintf("RETURN_%d", ret)
+}
+
+// parseReturnName is the reverse of ReturnName.
+func parseReturnName(name string) (nvml.Return, error) {
+	for ret, n := range returnNames {
+		if n == name {
+			return ret, nil
+		}
+	}
+	return nvml.ERROR_UNKNOWN, fmt.Errorf("unknown nvml return name: %s", name)
+}
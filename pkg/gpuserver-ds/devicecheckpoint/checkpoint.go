@@ -0,0 +1,79 @@
+package devicecheckpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DefaultCheckpointFile is the checkpoint of the kubelet device manager, kubelet writes it on each allocation.
+const DefaultCheckpointFile = "/var/lib/kubelet/device-plugins/kubelet_internal_checkpoint"
+
+// NoNUMANode is the NUMA node of the devices without topology, and of all the devices in the checkpoint before kubernetes v1.20.
+const NoNUMANode int64 = -1
+
+// Checkpoint is the data of the kubelet device manager checkpoint, the checksum is not verified
+// since it is computed on the go structs of kubelet, which differ between the kubelet versions.
+type Checkpoint struct {
+	PodDeviceEntries []PodDevicesEntry
+	// RegisteredDevices maps the resource name to the device ids registered by the device plugins.
+	RegisteredDevices map[string][]string
+}
+
+// PodDevicesEntry is the devices of a resource allocated to a container.
+type PodDevicesEntry struct {
+	PodUID        string
+	ContainerName string
+	ResourceName  string
+	// DeviceIDs maps the NUMA node to the device ids.
+	DeviceIDs map[int64][]string
+}
+
+// podDevicesEntry is PodDevicesEntry in the checkpoint, DeviceIDs is a list before kubernetes v1.20 or a map by the NUMA nodes since then.
+type podDevicesEntry struct {
+	PodUID        string
+	ContainerName string
+	ResourceName  string
+	DeviceIDs     json.RawMessage
+}
+
+type checkpointData struct {
+	Data struct {
+		PodDeviceEntries  []podDevicesEntry
+		RegisteredDevices map[string][]string
+	}
+}
+
+// Read reads the checkpoint file.
+func Read(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read device checkpoint: %v", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses the checkpoint of the kubelet device manager of any version.
+func Parse(data []byte) (*Checkpoint, error) {
+	var cd checkpointData
+	if err := json.Unmarshal(data, &cd); err != nil {
+		return nil, fmt.Errorf("parse device checkpoint: %v", err)
+	}
+
+	cp := &Checkpoint{
+		PodDeviceEntries:  make([]PodDevicesEntry, 0, len(cd.Data.PodDeviceEntries)),
+		RegisteredDevices: cd.Data.RegisteredDevices,
+	}
+	for _, e := range cd.Data.PodDeviceEntries {
+		entry := PodDevicesEntry{PodUID: e.PodUID, ContainerName: e.ContainerName, ResourceName: e.ResourceName}
+		if err := json.Unmarshal(e.DeviceIDs, &entry.DeviceIDs); err != nil {
+			var deviceIDs []string
+			if err := json.Unmarshal(e.DeviceIDs, &deviceIDs); err != nil {
+				return nil, fmt.Errorf("parse device ids of pod %s container %s: %v", e.PodUID, e.ContainerName, err)
+			}
+			entry.DeviceIDs = map[int64][]string{NoNUMANode: deviceIDs}
+		}
+		cp.PodDeviceEntries = append(cp.PodDeviceEntries, entry)
+	}
+	return cp, nil
+}
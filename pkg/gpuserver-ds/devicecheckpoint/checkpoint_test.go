@@ -0,0 +1,112 @@
+package devicecheckpoint
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	testPodUID     = "6b0e4c1a-2f3d-4e5f-8a9b-0c1d2e3f4a5b"
+	testDonePodUID = "0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b"
+	testGonePodUID = "11111111-2222-3333-4444-555555555555"
+	testCheckpoint = "testdata/checkpoint-v1.20"
+)
+
+func TestRead(t *testing.T) {
+	var tests = []struct {
+		name      string
+		path      string
+		want      []PodDevicesEntry
+		wantError bool
+	}{
+		{
+			name: "devices by NUMA nodes since v1.20",
+			path: testCheckpoint,
+			want: []PodDevicesEntry{
+				{PodUID: testPodUID, ContainerName: "trainer", ResourceName: "nvidia.com/gpu", DeviceIDs: map[int64][]string{0: {"GPU-0"}, 1: {"GPU-2", "GPU-3"}}},
+				{PodUID: testPodUID, ContainerName: "trainer", ResourceName: "example.com/nic", DeviceIDs: map[int64][]string{NoNUMANode: {"nic-0"}}},
+				{PodUID: testPodUID, ContainerName: "sidecar", ResourceName: "nvidia.com/mig-1g.5gb", DeviceIDs: map[int64][]string{NoNUMANode: {"MIG-0"}}},
+				{PodUID: testDonePodUID, ContainerName: "c", ResourceName: "nvidia.com/gpu", DeviceIDs: map[int64][]string{0: {"GPU-1"}}},
+				{PodUID: testGonePodUID, ContainerName: "c", ResourceName: "nvidia.com/gpu", DeviceIDs: map[int64][]string{1: {"GPU-4"}}},
+			},
+		},
+		{
+			name: "devices list before v1.20",
+			path: "testdata/checkpoint-v1.19",
+			want: []PodDevicesEntry{
+				{PodUID: testPodUID, ContainerName: "trainer", ResourceName: "nvidia.com/gpu", DeviceIDs: map[int64][]string{NoNUMANode: {"GPU-0", "GPU-2"}}},
+			},
+		},
+		{
+			name:      "corrupted",
+			path:      "testdata/checkpoint-corrupted",
+			wantError: true,
+		},
+		{
+			name:      "not found",
+			path:      "testdata/checkpoint-not-found",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp, err := Read(tt.path)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("Read() err = %v, wantError %v", err, tt.wantError)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(cp.PodDeviceEntries, tt.want) {
+				t.Errorf("PodDeviceEntries = %+v, want %+v", cp.PodDeviceEntries, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientList(t *testing.T) {
+	pods := map[types.UID]*corev1.Pod{
+		testPodUID: {ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod1", UID: testPodUID},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		testDonePodUID: {ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "done", UID: testDonePodUID},
+			Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+	}
+	getPod := func(uid types.UID) (*corev1.Pod, error) {
+		return pods[uid], nil
+	}
+
+	c := NewClient(testCheckpoint, getPod)
+	prlist, err := c.List(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	numaNode := func(id int64) *podresourcesapi.TopologyInfo {
+		return &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: id}}}
+	}
+	// the pod terminated and the one not found are not listed.
+	want := []*podresourcesapi.PodResources{{
+		Namespace: "default", Name: "pod1",
+		Containers: []*podresourcesapi.ContainerResources{
+			{Name: "trainer", Devices: []*podresourcesapi.ContainerDevices{
+				{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"}, Topology: numaNode(0)},
+				{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-2", "GPU-3"}, Topology: numaNode(1)},
+				{ResourceName: "example.com/nic", DeviceIds: []string{"nic-0"}},
+			}},
+			{Name: "sidecar", Devices: []*podresourcesapi.ContainerDevices{
+				{ResourceName: "nvidia.com/mig-1g.5gb", DeviceIds: []string{"MIG-0"}},
+			}},
+		},
+	}}
+	if !reflect.DeepEqual(prlist, want) {
+		t.Errorf("List() = %v, want %v", prlist, want)
+	}
+	if c.Version() != Version {
+		t.Errorf("Version() = %s, want %s", c.Version(), Version)
+	}
+}
@@ -0,0 +1,97 @@
+package devicecheckpoint
+
+import (
+	"context"
+	"sort"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// Version is the version of the pod resources listed from the checkpoint.
+const Version = "checkpoint"
+
+// NewClient returns the podresources.Client listing the pod resources from the checkpoint file,
+// for the kubelet with the podresources socket disabled or missing. The file is read again on each list.
+// The pod uids are resolved to the pods by getPod, the pods not found or terminated are not listed.
+func NewClient(path string, getPod func(uid types.UID) (*corev1.Pod, error)) podresources.Client {
+	return &client{path: path, getPod: getPod}
+}
+
+type client struct {
+	path   string
+	getPod func(uid types.UID) (*corev1.Pod, error)
+}
+
+func (c *client) List(ctx context.Context) ([]*podresourcesapi.PodResources, error) {
+	cp, err := Read(c.path)
+	if err != nil {
+		return nil, err
+	}
+	return ToPodResources(cp, c.getPod)
+}
+
+// ToPodResources converts the entries of the checkpoint to the pod resources like the ones listed from kubelet,
+// in the order of the entries. The devices of each NUMA node are a ContainerDevices with the topology.
+func ToPodResources(cp *Checkpoint, getPod func(uid types.UID) (*corev1.Pod, error)) ([]*podresourcesapi.PodResources, error) {
+	prlist := make([]*podresourcesapi.PodResources, 0)
+	prs := make(map[string]*podresourcesapi.PodResources)
+	containers := make(map[string]*podresourcesapi.ContainerResources)
+	for _, e := range cp.PodDeviceEntries {
+		pr, seen := prs[e.PodUID]
+		if !seen {
+			pod, err := getPod(types.UID(e.PodUID))
+			if err != nil {
+				return nil, err
+			}
+			// the entries of the pods terminated are kept until kubelet allocates the devices again.
+			if pod == nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				klog.V(4).Infof("device checkpoint: skip pod %s not found or terminated", e.PodUID)
+			} else {
+				pr = &podresourcesapi.PodResources{Name: pod.Name, Namespace: pod.Namespace}
+				prlist = append(prlist, pr)
+			}
+			prs[e.PodUID] = pr
+		}
+		if pr == nil {
+			continue
+		}
+
+		key := e.PodUID + "/" + e.ContainerName
+		cr := containers[key]
+		if cr == nil {
+			cr = &podresourcesapi.ContainerResources{Name: e.ContainerName}
+			containers[key] = cr
+			pr.Containers = append(pr.Containers, cr)
+		}
+		numaNodes := make([]int64, 0, len(e.DeviceIDs))
+		for numaNode := range e.DeviceIDs {
+			numaNodes = append(numaNodes, numaNode)
+		}
+		sort.Slice(numaNodes, func(i, j int) bool { return numaNodes[i] < numaNodes[j] })
+		for _, numaNode := range numaNodes {
+			cd := &podresourcesapi.ContainerDevices{ResourceName: e.ResourceName, DeviceIds: e.DeviceIDs[numaNode]}
+			if numaNode != NoNUMANode {
+				cd.Topology = &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: numaNode}}}
+			}
+			cr.Devices = append(cr.Devices, cd)
+		}
+	}
+	return prlist, nil
+}
+
+// GetAllocatableResources is unsupported, the checkpoint has the devices registered but not their health.
+func (c *client) GetAllocatableResources(ctx context.Context) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	return nil, podresources.ErrAllocatableUnsupported
+}
+
+func (c *client) Version() string {
+	return Version
+}
+
+func (c *client) Close() error {
+	return nil
+}
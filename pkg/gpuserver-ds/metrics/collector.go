@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gpuserver_device"
+
+// deviceLabels are the labels of each device metric, namespace, pod and container are empty if no GpuPod holds the device.
+var deviceLabels = []string{"node", "uuid", "model", "bus_id", "namespace", "pod", "container"}
+
+func newDeviceDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, deviceLabels, nil)
+}
+
+var (
+	infoDesc      = newDeviceDesc("info", "The gpu on the node, always 1.")
+	healthyDesc   = newDeviceDesc("healthy", "Whether the gpu is healthy, 0 after a critical error.")
+	allocatedDesc = newDeviceDesc("allocated", "Whether the gpu or its MIG devices are allocated to a GpuPod.")
+	foreignDesc   = newDeviceDesc("foreign_occupied", "Whether the gpu is occupied by foreign process, which runs on the gpu not allocated to it.")
+
+	gpuUtilizationDesc    = newDeviceDesc("gpu_utilization_percent", "The gpu utilization in percent.")
+	memoryUtilizationDesc = newDeviceDesc("memory_utilization_percent", "The memory utilization in percent.")
+	memoryTotalDesc       = newDeviceDesc("memory_total_bytes", "The total frame buffer memory in bytes.")
+	memoryUsedDesc        = newDeviceDesc("memory_used_bytes", "The used frame buffer memory in bytes.")
+	temperatureDesc       = newDeviceDesc("temperature_celsius", "The gpu core temperature in degrees C.")
+	powerUsageDesc        = newDeviceDesc("power_usage_watts", "The power usage in watts.")
+	graphicsClockDesc     = newDeviceDesc("graphics_clock_mhz", "The graphics clock in MHz.")
+	smClockDesc           = newDeviceDesc("sm_clock_mhz", "The SM clock in MHz.")
+	memoryClockDesc       = newDeviceDesc("memory_clock_mhz", "The memory clock in MHz.")
+)
+
+var _ prometheus.Collector = &Collector{}
+
+func NewCollector(store *Store) *Collector {
+	return &Collector{store: store}
+}
+
+// Collector collects the inventory, health and telemetry of each gpu from Store.
+// The metrics of a gpu are collected once for each container it is allocated to.
+type Collector struct {
+	store *Store
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{infoDesc, healthyDesc, allocatedDesc, foreignDesc,
+		gpuUtilizationDesc, memoryUtilizationDesc, memoryTotalDesc, memoryUsedDesc, temperatureDesc,
+		powerUsageDesc, graphicsClockDesc, smClockDesc, memoryClockDesc} {
+		ch <- desc
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.store.snapshots() {
+		holders := s.holders
+		if len(holders) == 0 {
+			holders = []DeviceHolder{{}}
+		}
+		for _, holder := range holders {
+			labels := []string{s.nodeName, s.gpuInfo.DeviceId, s.gpuInfo.Model, s.gpuInfo.BusId, holder.Namespace, holder.Pod, holder.Container}
+			gauge := func(desc *prometheus.Desc, value float64) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+			}
+			gauge(infoDesc, 1)
+			gauge(healthyDesc, boolToFloat(s.healthy))
+			gauge(allocatedDesc, boolToFloat(len(s.holders) != 0))
+			gauge(foreignDesc, boolToFloat(s.foreign))
+			if s.telemetry != nil {
+				collectTelemetry(s.telemetry, gauge)
+			}
+		}
+	}
+}
+
+func collectTelemetry(t *GpuTelemetry, gauge func(desc *prometheus.Desc, value float64)) {
+	gauge(gpuUtilizationDesc, float64(t.GpuUtilization))
+	gauge(memoryUtilizationDesc, float64(t.MemoryUtilization))
+	gauge(memoryTotalDesc, float64(t.MemoryTotal))
+	gauge(memoryUsedDesc, float64(t.MemoryUsed))
+	gauge(temperatureDesc, float64(t.Temperature))
+	gauge(powerUsageDesc, float64(t.PowerUsage)/1000)
+	gauge(graphicsClockDesc, float64(t.GraphicsClock))
+	gauge(smClockDesc, float64(t.SMClock))
+	gauge(memoryClockDesc, float64(t.MemoryClock))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog"
+)
+
+// MetricsPath is the http path serving the metrics in prometheus text format.
+const MetricsPath = "/metrics"
+
+func NewExporter(store *Store, bindAddress, textfile string, textfileInterval time.Duration, stop <-chan struct{}) (*Exporter, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(NewCollector(store)); err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		registry:         registry,
+		bindAddress:      bindAddress,
+		textfile:         textfile,
+		textfileInterval: textfileInterval,
+		stop:             stop,
+	}, nil
+}
+
+// Exporter serves the metrics of gpus on bindAddress, and writes them to textfile each textfileInterval
+// for the textfile collector of node-exporter. Each of them is disabled if empty.
+type Exporter struct {
+	registry         *prometheus.Registry
+	bindAddress      string
+	textfile         string
+	textfileInterval time.Duration
+	stop             <-chan struct{}
+}
+
+// Start returns the error if bindAddress is not listened, such as in use.
+// The metrics stop being served if the server fails later, the other controllers keep running.
+func (e *Exporter) Start() error {
+	if e.bindAddress != "" {
+		listener, err := net.Listen("tcp", e.bindAddress)
+		if err != nil {
+			return fmt.Errorf("listen metrics on %s: %v", e.bindAddress, err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle(MetricsPath, promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{}))
+		srv := &http.Server{Addr: e.bindAddress, Handler: mux}
+		go func() {
+			klog.Infof("Exporter serving metrics on %s%s", e.bindAddress, MetricsPath)
+			if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+				klog.Errorf("Exporter stopped serving metrics err: %v", err)
+			}
+		}()
+		go func() {
+			<-e.stop
+			if err := srv.Shutdown(context.Background()); err != nil {
+				klog.Errorf("Exporter shutdown err: %v", err)
+			}
+		}()
+	}
+
+	if e.textfile != "" && e.textfileInterval > 0 {
+		go func() {
+			klog.Infof("Exporter writing metrics to %s each %v", e.textfile, e.textfileInterval)
+			ticker := time.NewTicker(e.textfileInterval)
+			defer ticker.Stop()
+		LOOP:
+			for {
+				select {
+				case <-ticker.C:
+					if err := e.WriteTextfile(); err != nil {
+						klog.Errorf("Exporter write textfile %s err: %v", e.textfile, err)
+					}
+				case <-e.stop:
+					break LOOP
+				}
+			}
+			klog.Infof("Exporter textfile writer stopped")
+		}()
+	}
+	return nil
+}
+
+// WriteTextfile writes the metrics to textfile atomically.
+func (e *Exporter) WriteTextfile() error {
+	return prometheus.WriteToTextfile(e.textfile, e.registry)
+}
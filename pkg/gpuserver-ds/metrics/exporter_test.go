@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+)
+
+func TestExporterWriteTextfile(t *testing.T) {
+	store := NewStore()
+	store.SetNodeState(&NodeGpuInfo{
+		NodeName: "node1",
+		GpuInfos: map[string]*GpuInfo{
+			"GPU-0": {DeviceId: "GPU-0", Model: "Tesla T4", BusId: "00000000:3B:00.0"},
+			"GPU-1": {DeviceId: "GPU-1", Model: "Tesla T4", BusId: "00000000:86:00.0"},
+		},
+	}, map[string]*DeviceHealth{"GPU-1": {EventType: "XidCriticalError", Xid: 79}},
+		map[string]*DeviceOccupation{"GPU-1": {Message: ForeignProcessMessage}},
+		map[string][]DeviceHolder{"GPU-0": {{Namespace: "default", Pod: "pod1", Container: "c1"}}})
+	store.SetTelemetry(map[string]*GpuTelemetry{
+		"GPU-0": {GpuUtilization: 80, MemoryTotal: 16 << 30, PowerUsage: 70500},
+	})
+
+	textfile := filepath.Join(t.TempDir(), "gpuserver.prom")
+	e, err := NewExporter(store, "", textfile, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteTextfile(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gpu0 := `{bus_id="00000000:3B:00.0",container="c1",model="Tesla T4",namespace="default",node="node1",pod="pod1",uuid="GPU-0"}`
+	gpu1 := `{bus_id="00000000:86:00.0",container="",model="Tesla T4",namespace="",node="node1",pod="",uuid="GPU-1"}`
+	for _, want := range []string{
+		"gpuserver_device_info" + gpu0 + " 1",
+		"gpuserver_device_healthy" + gpu0 + " 1",
+		"gpuserver_device_allocated" + gpu0 + " 1",
+		"gpuserver_device_foreign_occupied" + gpu0 + " 0",
+		"gpuserver_device_gpu_utilization_percent" + gpu0 + " 80",
+		"gpuserver_device_memory_total_bytes" + gpu0 + " 1.7179869184e+10",
+		"gpuserver_device_power_usage_watts" + gpu0 + " 70.5",
+		"gpuserver_device_info" + gpu1 + " 1",
+		"gpuserver_device_healthy" + gpu1 + " 0",
+		"gpuserver_device_allocated" + gpu1 + " 0",
+		"gpuserver_device_foreign_occupied" + gpu1 + " 1",
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("metric %s not found in:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "gpuserver_device_gpu_utilization_percent"+gpu1) {
+		t.Errorf("telemetry of GPU-1 not sampled should not be exported:\n%s", data)
+	}
+}
+
+func TestExporterStartAddressInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	e, err := NewExporter(NewStore(), l.Addr().String(), "", 0, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Start(); err == nil {
+		t.Errorf("Start() on %s in use = nil, want error", l.Addr())
+	}
+}
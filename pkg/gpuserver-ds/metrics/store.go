@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"sync"
+
+	. "github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+)
+
+// DefaultStore is the state of gpus on the node exported by gpuserver-ds.
+var DefaultStore = NewStore()
+
+// DeviceHolder is the container of the GpuPod which the device is allocated to.
+type DeviceHolder struct {
+	Namespace string
+	Pod       string
+	Container string
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Store keeps the latest state of gpus on the node.
+// It is written by the controllers of gpuserver-ds and read by the Collector.
+type Store struct {
+	lock      sync.RWMutex
+	nodeName  string
+	gpuInfos  map[string]*GpuInfo
+	unhealthy map[string]*DeviceHealth
+	foreign   map[string]*DeviceOccupation
+	// holders maps the gpu id to the containers the gpu or its MIG devices are allocated to.
+	holders   map[string][]DeviceHolder
+	telemetry map[string]*GpuTelemetry
+}
+
+// SetNodeState sets the inventory, health and allocation of gpus on the node.
+func (s *Store) SetNodeState(ngi *NodeGpuInfo, unhealthy map[string]*DeviceHealth, foreign map[string]*DeviceOccupation, holders map[string][]DeviceHolder) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if ngi != nil {
+		s.nodeName = ngi.NodeName
+		s.gpuInfos = ngi.GpuInfos
+	}
+	s.unhealthy = unhealthy
+	s.foreign = foreign
+	s.holders = holders
+}
+
+// SetTelemetry sets the latest telemetry sampled.
+func (s *Store) SetTelemetry(telemetry map[string]*GpuTelemetry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.telemetry = telemetry
+}
+
+// snapshot is the state of a gpu read from Store.
+type snapshot struct {
+	nodeName  string
+	gpuInfo   *GpuInfo
+	healthy   bool
+	foreign   bool
+	holders   []DeviceHolder
+	telemetry *GpuTelemetry
+}
+
+func (s *Store) snapshots() []*snapshot {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	snapshots := make([]*snapshot, 0, len(s.gpuInfos))
+	for did, gpuInfo := range s.gpuInfos {
+		_, unhealthy := s.unhealthy[did]
+		_, foreign := s.foreign[did]
+		snapshots = append(snapshots, &snapshot{
+			nodeName:  s.nodeName,
+			gpuInfo:   gpuInfo,
+			healthy:   !unhealthy,
+			foreign:   foreign,
+			holders:   s.holders[did],
+			telemetry: s.telemetry[did],
+		})
+	}
+	return snapshots
+}
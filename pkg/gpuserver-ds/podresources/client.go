@@ -18,27 +18,138 @@ package podresources
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
 
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources/util"
-	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	podresourcesapiv1alpha1 "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
 )
 
+const (
+	VersionV1       = "v1"
+	VersionV1alpha1 = "v1alpha1"
+)
+
+// ErrAllocatableUnsupported is returned by GetAllocatableResources when kubelet does not serve it,
+// either kubelet only speaks v1alpha1 or the feature gate KubeletPodResourcesGetAllocatable is disabled.
+var ErrAllocatableUnsupported = errors.New("kubelet podresources GetAllocatableResources is unsupported")
+
+// Client is the client of kubelet PodResourcesLister grpc service.
+// It negotiates the api version with kubelet, v1 is preferred and v1alpha1 is the fallback.
+// The pod resources of v1alpha1 are converted to v1.
+type Client interface {
+	List(ctx context.Context) ([]*podresourcesapi.PodResources, error)
+	GetAllocatableResources(ctx context.Context) (*podresourcesapi.AllocatableResourcesResponse, error)
+	// Version returns the api version negotiated, it is empty before the first call.
+	Version() string
+	Close() error
+}
+
 // GetClient returns a client for the PodResourcesLister grpc service
-func GetClient(socket string, connectionTimeout time.Duration, maxMsgSize int) (podresourcesapi.PodResourcesListerClient, *grpc.ClientConn, error) {
+func GetClient(socket string, connectionTimeout time.Duration, maxMsgSize int) (Client, error) {
 	addr, dialer, err := util.GetAddressAndDialer(socket)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
 	defer cancel()
 
 	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithDialer(dialer), grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMsgSize)))
 	if err != nil {
-		return nil, nil, fmt.Errorf("Error dialing socket %s: %v", socket, err)
+		return nil, fmt.Errorf("Error dialing socket %s: %v", socket, err)
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient creates the Client on conn, conn is closed by Client.Close.
+func NewClient(conn *grpc.ClientConn) Client {
+	return &client{
+		conn:     conn,
+		v1:       podresourcesapi.NewPodResourcesListerClient(conn),
+		v1alpha1: podresourcesapiv1alpha1.NewPodResourcesListerClient(conn),
+	}
+}
+
+type client struct {
+	conn     *grpc.ClientConn
+	v1       podresourcesapi.PodResourcesListerClient
+	v1alpha1 podresourcesapiv1alpha1.PodResourcesListerClient
+	lock     sync.RWMutex
+	version  string
+}
+
+func (c *client) Version() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.version
+}
+
+func (c *client) setVersion(version string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.version != version {
+		klog.Infof("kubelet podresources api version negotiated: %s", version)
+	}
+	c.version = version
+}
+
+func (c *client) List(ctx context.Context) ([]*podresourcesapi.PodResources, error) {
+	if c.Version() != VersionV1alpha1 {
+		resp, err := c.v1.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+		if err == nil {
+			c.setVersion(VersionV1)
+			return resp.PodResources, nil
+		}
+		if status.Code(err) != codes.Unimplemented {
+			return nil, err
+		}
+		klog.Infof("kubelet podresources v1 is unimplemented, fall back to v1alpha1")
+	}
+
+	resp, err := c.v1alpha1.List(ctx, &podresourcesapiv1alpha1.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	c.setVersion(VersionV1alpha1)
+	return FromV1alpha1(resp.PodResources), nil
+}
+
+func (c *client) GetAllocatableResources(ctx context.Context) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	if c.Version() == VersionV1alpha1 {
+		return nil, ErrAllocatableUnsupported
+	}
+	resp, err := c.v1.GetAllocatableResources(ctx, &podresourcesapi.AllocatableResourcesRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, ErrAllocatableUnsupported
+	}
+	return resp, err
+}
+
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// FromV1alpha1 converts the pod resources of v1alpha1 to v1.
+func FromV1alpha1(prlist []*podresourcesapiv1alpha1.PodResources) []*podresourcesapi.PodResources {
+	prs := make([]*podresourcesapi.PodResources, 0, len(prlist))
+	for _, pr := range prlist {
+		cs := make([]*podresourcesapi.ContainerResources, 0, len(pr.Containers))
+		for _, c := range pr.Containers {
+			ds := make([]*podresourcesapi.ContainerDevices, 0, len(c.Devices))
+			for _, d := range c.Devices {
+				ds = append(ds, &podresourcesapi.ContainerDevices{ResourceName: d.ResourceName, DeviceIds: d.DeviceIds})
+			}
+			cs = append(cs, &podresourcesapi.ContainerResources{Name: c.Name, Devices: ds})
+		}
+		prs = append(prs, &podresourcesapi.PodResources{Name: pr.Name, Namespace: pr.Namespace, Containers: cs})
 	}
-	return podresourcesapi.NewPodResourcesListerClient(conn), conn, nil
+	return prs
 }
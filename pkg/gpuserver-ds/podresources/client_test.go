@@ -0,0 +1,144 @@
+package podresources
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver-ds/podresources/util"
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	podresourcesapiv1alpha1 "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+)
+
+type fakeV1Server struct {
+	podresourcesapi.UnimplementedPodResourcesListerServer
+	allocatable bool
+}
+
+func (s *fakeV1Server) List(context.Context, *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: []*podresourcesapi.PodResources{{
+		Name: "pod", Namespace: "default",
+		Containers: []*podresourcesapi.ContainerResources{{Name: "c", Devices: []*podresourcesapi.ContainerDevices{{
+			ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"},
+			Topology: &podresourcesapi.TopologyInfo{Nodes: []*podresourcesapi.NUMANode{{ID: 1}}},
+		}}}},
+	}}}, nil
+}
+
+func (s *fakeV1Server) GetAllocatableResources(ctx context.Context, req *podresourcesapi.AllocatableResourcesRequest) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	if !s.allocatable {
+		return s.UnimplementedPodResourcesListerServer.GetAllocatableResources(ctx, req)
+	}
+	return &podresourcesapi.AllocatableResourcesResponse{Devices: []*podresourcesapi.ContainerDevices{{
+		ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0", "GPU-1"},
+	}}}, nil
+}
+
+type fakeV1alpha1Server struct{}
+
+func (s *fakeV1alpha1Server) List(context.Context, *podresourcesapiv1alpha1.ListPodResourcesRequest) (*podresourcesapiv1alpha1.ListPodResourcesResponse, error) {
+	return &podresourcesapiv1alpha1.ListPodResourcesResponse{PodResources: []*podresourcesapiv1alpha1.PodResources{{
+		Name: "pod", Namespace: "default",
+		Containers: []*podresourcesapiv1alpha1.ContainerResources{{Name: "c", Devices: []*podresourcesapiv1alpha1.ContainerDevices{{
+			ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0"},
+		}}}},
+	}}}, nil
+}
+
+// startServer serves the podresources api on a unix socket like kubelet, the endpoint is returned.
+func startServer(t *testing.T, register func(s *grpc.Server)) string {
+	t.Helper()
+	endpoint := "unix://" + filepath.Join(t.TempDir(), "kubelet.sock")
+	serve(t, endpoint, register)
+	return endpoint
+}
+
+// serve serves the podresources api on the endpoint like kubelet, the server is returned to stop it like kubelet restarting.
+func serve(t *testing.T, endpoint string, register func(s *grpc.Server)) *grpc.Server {
+	t.Helper()
+	l, err := util.CreateListener(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	register(s)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func TestClientNegotiate(t *testing.T) {
+	var tests = []struct {
+		name            string
+		register        func(s *grpc.Server)
+		wantVersion     string
+		wantNumaNodes   bool
+		wantAllocatable []string
+	}{
+		{
+			name: "v1 with allocatable",
+			register: func(s *grpc.Server) {
+				podresourcesapi.RegisterPodResourcesListerServer(s, &fakeV1Server{allocatable: true})
+			},
+			wantVersion:     VersionV1,
+			wantNumaNodes:   true,
+			wantAllocatable: []string{"GPU-0", "GPU-1"},
+		},
+		{
+			name: "v1 without allocatable",
+			register: func(s *grpc.Server) {
+				podresourcesapi.RegisterPodResourcesListerServer(s, &fakeV1Server{})
+			},
+			wantVersion:   VersionV1,
+			wantNumaNodes: true,
+		},
+		{
+			name: "fall back to v1alpha1",
+			register: func(s *grpc.Server) {
+				podresourcesapiv1alpha1.RegisterPodResourcesListerServer(s, &fakeV1alpha1Server{})
+			},
+			wantVersion: VersionV1alpha1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := GetClient(startServer(t, tt.register), 5*time.Second, 1024*1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			prlist, err := c.List(context.TODO())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version() != tt.wantVersion {
+				t.Errorf("Version() = %s, want %s", c.Version(), tt.wantVersion)
+			}
+			if len(prlist) != 1 || prlist[0].Name != "pod" || len(prlist[0].Containers) != 1 {
+				t.Fatalf("unexpected pod resources: %v", prlist)
+			}
+			d := prlist[0].Containers[0].Devices[0]
+			if !reflect.DeepEqual(d.DeviceIds, []string{"GPU-0"}) || (d.Topology != nil) != tt.wantNumaNodes {
+				t.Errorf("unexpected container devices: %v", d)
+			}
+
+			resp, err := c.GetAllocatableResources(context.TODO())
+			if tt.wantAllocatable == nil {
+				if err != ErrAllocatableUnsupported {
+					t.Errorf("GetAllocatableResources() err = %v, want %v", err, ErrAllocatableUnsupported)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Devices[0].DeviceIds; !reflect.DeepEqual(got, tt.wantAllocatable) {
+				t.Errorf("GetAllocatableResources() = %v, want %v", got, tt.wantAllocatable)
+			}
+		})
+	}
+}
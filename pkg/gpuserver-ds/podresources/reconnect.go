@@ -0,0 +1,111 @@
+package podresources
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// NewReconnectingClient returns the Client dialing the socket on the first call, and re-dialing it after kubelet is unavailable.
+// Kubelet recreates the socket on restart, the connection is dropped so the next call dials the new socket at once,
+// instead of waiting for the reconnection backoff of grpc. The api version is negotiated again on the new connection.
+func NewReconnectingClient(socket string, connectionTimeout time.Duration, maxMsgSize int) Client {
+	return &reconnectingClient{
+		dial: func() (Client, error) {
+			return GetClient(socket, connectionTimeout, maxMsgSize)
+		},
+	}
+}
+
+type reconnectingClient struct {
+	dial   func() (Client, error)
+	lock   sync.Mutex
+	client Client // nil if not connected
+}
+
+// Unavailable means the error is got for kubelet not serving, such as kubelet restarting.
+func Unavailable(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+func (rc *reconnectingClient) get() (Client, error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.client == nil {
+		client, err := rc.dial()
+		if err != nil {
+			return nil, err
+		}
+		rc.client = client
+	}
+	return rc.client, nil
+}
+
+// drop closes the connection if kubelet is unavailable, the next call dials again.
+func (rc *reconnectingClient) drop(client Client, err error) {
+	if !Unavailable(err) {
+		return
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	// the connection is dropped already by another call.
+	if rc.client != client {
+		return
+	}
+	klog.Infof("kubelet podresources unavailable, reconnect on the next call: %v", err)
+	if err := rc.client.Close(); err != nil {
+		klog.Errorf("grpc conn close: %v", err)
+	}
+	rc.client = nil
+}
+
+func (rc *reconnectingClient) List(ctx context.Context) ([]*podresourcesapi.PodResources, error) {
+	client, err := rc.get()
+	if err != nil {
+		return nil, err
+	}
+	prlist, err := client.List(ctx)
+	if err != nil {
+		rc.drop(client, err)
+	}
+	return prlist, err
+}
+
+func (rc *reconnectingClient) GetAllocatableResources(ctx context.Context) (*podresourcesapi.AllocatableResourcesResponse, error) {
+	client, err := rc.get()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.GetAllocatableResources(ctx)
+	if err != nil {
+		rc.drop(client, err)
+	}
+	return resp, err
+}
+
+func (rc *reconnectingClient) Version() string {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.client == nil {
+		return ""
+	}
+	return rc.client.Version()
+}
+
+func (rc *reconnectingClient) Close() error {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.client == nil {
+		return nil
+	}
+	err := rc.client.Close()
+	rc.client = nil
+	return err
+}
@@ -0,0 +1,57 @@
+package podresources
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	podresourcesapiv1alpha1 "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+)
+
+func TestReconnectingClient(t *testing.T) {
+	endpoint := "unix://" + filepath.Join(t.TempDir(), "kubelet.sock")
+	c := NewReconnectingClient(endpoint, 5*time.Second, 1024*1024)
+	defer c.Close()
+	list := func() error {
+		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+		defer cancel()
+		_, err := c.List(ctx)
+		return err
+	}
+
+	// kubelet is not started yet.
+	if err := list(); !Unavailable(err) {
+		t.Fatalf("List() err = %v, want unavailable", err)
+	}
+
+	s := serve(t, endpoint, func(s *grpc.Server) {
+		podresourcesapi.RegisterPodResourcesListerServer(s, &fakeV1Server{})
+	})
+	if err := list(); err != nil {
+		t.Fatalf("List() err = %v", err)
+	}
+	if c.Version() != VersionV1 {
+		t.Errorf("Version() = %s, want %s", c.Version(), VersionV1)
+	}
+
+	// kubelet restarts, and it is downgraded to serve v1alpha1 only.
+	s.Stop()
+	if err := list(); !Unavailable(err) {
+		t.Fatalf("List() err = %v, want unavailable", err)
+	}
+	if c.Version() != "" {
+		t.Errorf("Version() = %s, want empty after the connection dropped", c.Version())
+	}
+	serve(t, endpoint, func(s *grpc.Server) {
+		podresourcesapiv1alpha1.RegisterPodResourcesListerServer(s, &fakeV1alpha1Server{})
+	})
+	if err := list(); err != nil {
+		t.Fatalf("List() err = %v after kubelet restarted", err)
+	}
+	if c.Version() != VersionV1alpha1 {
+		t.Errorf("Version() = %s, want %s", c.Version(), VersionV1alpha1)
+	}
+}
@@ -0,0 +1,63 @@
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultProcRoot is the proc filesystem of the host, which needs the host pid namespace.
+const DefaultProcRoot = "/proc"
+
+var (
+	// podRegexp matches the pod cgroup of both the cgroupfs and the systemd cgroup driver, such as
+	// /kubepods/burstable/pod<uid> or /kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid with _>.slice.
+	podRegexp = regexp.MustCompile(`pod([0-9a-fA-F]{8}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{4}[-_][0-9a-fA-F]{12})`)
+	// containerRegexp matches the container cgroup, such as /<id>, /docker-<id>.scope or /cri-containerd-<id>.scope.
+	containerRegexp = regexp.MustCompile(`([0-9a-f]{64})(\.scope)?$`)
+)
+
+// PodContainer is the pod and container a process runs in.
+type PodContainer struct {
+	PodUID      types.UID
+	ContainerId string
+}
+
+// GetPodContainer reads /proc/<pid>/cgroup under procRoot, nil is returned if the process is not in a pod.
+func GetPodContainer(procRoot string, pid uint32) (*PodContainer, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.FormatUint(uint64(pid), 10), "cgroup"))
+	if err != nil {
+		return nil, fmt.Errorf("read cgroup of process %d: %v", pid, err)
+	}
+	return ParsePodContainer(data), nil
+}
+
+// ParsePodContainer parses the content of /proc/<pid>/cgroup of cgroup v1 or v2, nil is returned if not in a pod.
+func ParsePodContainer(cgroup []byte) *PodContainer {
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		path := fields[2]
+		m := podRegexp.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		pc := &PodContainer{PodUID: types.UID(strings.ReplaceAll(m[1], "_", "-"))}
+		if m := containerRegexp.FindStringSubmatch(path); m != nil {
+			pc.ContainerId = m[1]
+		}
+		return pc
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testPodUID      = "6b0e4c1a-2f3d-4e5f-8a9b-0c1d2e3f4a5b"
+	testContainerId = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+)
+
+func TestParsePodContainer(t *testing.T) {
+	var tests = []struct {
+		name   string
+		cgroup string
+		want   *PodContainer
+	}{
+		{
+			name: "cgroup v1 cgroupfs",
+			cgroup: "12:memory:/kubepods/burstable/pod" + testPodUID + "/" + testContainerId + "\n" +
+				"11:devices:/kubepods/burstable/pod" + testPodUID + "/" + testContainerId + "\n",
+			want: &PodContainer{PodUID: testPodUID, ContainerId: testContainerId},
+		},
+		{
+			name: "cgroup v1 systemd",
+			cgroup: "11:devices:/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" +
+				"6b0e4c1a_2f3d_4e5f_8a9b_0c1d2e3f4a5b.slice/docker-" + testContainerId + ".scope\n",
+			want: &PodContainer{PodUID: testPodUID, ContainerId: testContainerId},
+		},
+		{
+			name: "cgroup v2 systemd",
+			cgroup: "0::/kubepods.slice/kubepods-pod6b0e4c1a_2f3d_4e5f_8a9b_0c1d2e3f4a5b.slice/cri-containerd-" +
+				testContainerId + ".scope\n",
+			want: &PodContainer{PodUID: testPodUID, ContainerId: testContainerId},
+		},
+		{
+			name:   "pod without container",
+			cgroup: "0::/kubepods/pod" + testPodUID + "\n",
+			want:   &PodContainer{PodUID: testPodUID},
+		},
+		{
+			name:   "host process",
+			cgroup: "0::/system.slice/sshd.service\n",
+			want:   nil,
+		},
+		{
+			name:   "docker container not in pod",
+			cgroup: "11:devices:/docker/" + testContainerId + "\n",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParsePodContainer([]byte(tt.cgroup)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePodContainer() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPodContainer(t *testing.T) {
+	procRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procRoot, "42"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(procRoot, "42", "cgroup"), []byte("0::/kubepods/pod"+testPodUID+"/"+testContainerId+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc, err := GetPodContainer(procRoot, 42); err != nil || pc == nil || pc.PodUID != testPodUID {
+		t.Errorf("GetPodContainer() = %#v, %v", pc, err)
+	}
+	if _, err := GetPodContainer(procRoot, 43); err == nil {
+		t.Errorf("GetPodContainer() of the process exited want error")
+	}
+}
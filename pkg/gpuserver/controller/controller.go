@@ -25,9 +25,9 @@ func (sc *ServerController) GetParallelism() int {
 	return options.SchedulerRouter_Parallelism_Default
 }
 
-func NewServerController(stop <-chan struct{}, parallelism int, gpuMgrClient client.Client) (*ServerController, error) {
+func NewServerController(stop <-chan struct{}, parallelism int, pluginArgs *framework.PluginArgs, gpuMgrClient client.Client) (*ServerController, error) {
 	registryInTree := plugins.NewInTreeRegistry()
-	fw, err := fwruntime.NewFramework(registryInTree)
+	fw, err := fwruntime.NewFramework(registryInTree, pluginArgs)
 	if err != nil {
 		return nil, err
 	}
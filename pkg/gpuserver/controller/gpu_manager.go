@@ -173,6 +173,7 @@ func startNLCC(ctx context.Context, mgr manager.Manager, kubeconfig *rest.Config
 	RenewDeadline := 10 * time.Second
 	RetryPeriod := 2 * time.Second
 	nodeMonitorGracePeriod := 4 * time.Second // 2* renewInterval in start_lease_controller.go
+	drainingGracePeriod := 5 * time.Minute    // the time for gpuserver-ds to come back on the rolling upgrade
 
 	leaseInformer := leaseinformer.NewFilteredLeaseInformer(kubeClient, options.NamespaceNodeLease, ResyncPeriod()(), cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil)
 	go leaseInformer.Run(ctx.Done())
@@ -180,6 +181,7 @@ func startNLCC(ctx context.Context, mgr manager.Manager, kubeconfig *rest.Config
 	nlcc := NewNodeLifecycleController(
 		nodeMonitorPeriod,
 		nodeMonitorGracePeriod,
+		drainingGracePeriod,
 		leaseLister.NewLeaseLister(leaseInformer.GetIndexer()),
 		leaseInformer.HasSynced,
 		gpuClient,
@@ -29,13 +29,17 @@ import (
 	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
 	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 
 	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	coordlisters "k8s.io/client-go/listers/coordination/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -49,6 +53,7 @@ const (
 func NewNodeLifecycleController(
 	nodeMonitorPeriod time.Duration,
 	nodeMonitorGracePeriod time.Duration,
+	drainingGracePeriod time.Duration,
 	leaseLister coordlisters.LeaseLister,
 	leaseInformerSynced cache.InformerSynced,
 	gpuclient gpuclientset.Interface,
@@ -59,6 +64,7 @@ func NewNodeLifecycleController(
 	return &Controller{
 		nodeMonitorPeriod:      nodeMonitorPeriod,
 		nodeMonitorGracePeriod: nodeMonitorGracePeriod,
+		drainingGracePeriod:    drainingGracePeriod,
 		leaseLister:            leaseLister,
 		leaseInformerSynced:    leaseInformerSynced,
 		gpuclient:              gpuclient,
@@ -77,6 +83,7 @@ type nodeHealthData struct {
 type Controller struct {
 	nodeMonitorPeriod      time.Duration
 	nodeMonitorGracePeriod time.Duration
+	drainingGracePeriod    time.Duration
 	leaseLister            coordlisters.LeaseLister
 	leaseInformerSynced    cache.InformerSynced
 	gpuclient              gpuclientset.Interface
@@ -134,21 +141,20 @@ func (nc *Controller) monitorGpuNodeHealth(ctx context.Context) error {
 			nc.savedHealthDataMap[gpunode.Name] = saveNodeHealth
 
 			//klog.Infof("saveNodeHealth.probeTimestamp:%v", saveNodeHealth.probeTimestamp)
-			if nc.now().After(saveNodeHealth.probeTimestamp.Add(nc.nodeMonitorGracePeriod)) {
-				// gpunode Leases not report health for nodeMonitorPeriod, so update gpunode status to false
-				err = nc.updateGpuNodeStatus(ctx, false, &gpunode,
-					fmt.Sprintf("Lease of GpuNode is not refreshed in %s.", nc.nodeMonitorGracePeriod.String()))
-				if err != nil {
-					klog.Errorf("Update GpuNodeStatusFail of '%s',error: %v", gpunode.Name, err)
-					return false, nil
-				}
-			} else {
-				err = nc.updateGpuNodeStatus(ctx, true, &gpunode,
-					fmt.Sprintf("Lease of GpuNode is refreshed in %s.", nc.nodeMonitorGracePeriod.String()))
-				if err != nil {
-					klog.Errorf("Update GpuNodeStatusFail of '%s',error: %v", gpunode.Name, err)
-					return false, nil
-				}
+			// gpunode Leases not report health for nodeMonitorPeriod, so update gpunode status to false or draining
+			leaseFresh := !nc.now().After(saveNodeHealth.probeTimestamp.Add(nc.nodeMonitorGracePeriod))
+			health, reason := gpuNodeHealth(leaseFresh, &gpunode, nc.now().Time, nc.drainingGracePeriod)
+			msg := fmt.Sprintf("Lease of GpuNode is refreshed in %s.", nc.nodeMonitorGracePeriod.String())
+			if !leaseFresh {
+				msg = fmt.Sprintf("Lease of GpuNode is not refreshed in %s.", nc.nodeMonitorGracePeriod.String())
+			}
+			if health == gpunodev1.StatusDraining {
+				msg = fmt.Sprintf("%s gpuserver-ds is draining in %s.", msg, nc.drainingGracePeriod.String())
+			}
+			err = nc.updateGpuNodeStatus(ctx, health, reason, &gpunode, msg)
+			if err != nil {
+				klog.Errorf("Update GpuNodeStatusFail of '%s',error: %v", gpunode.Name, err)
+				return false, nil
 			}
 
 			return true, nil
@@ -161,39 +167,61 @@ func (nc *Controller) monitorGpuNodeHealth(ctx context.Context) error {
 	return nil
 }
 
-func (nc *Controller) updateGpuNodeStatus(ctx context.Context, healthy bool, gpunode *gpunodev1.GpuNode, msg string) error {
+// gpuNodeHealth gets the health of the GpuNode and the reason of the condition AgentLeaseFresh by the freshness of the lease.
+// The GpuNode with the lease expired is StatusDraining rather than StatusNotHealth,
+// if gpuserver-ds marked it draining on shutdown less than drainingGracePeriod ago.
+func gpuNodeHealth(leaseFresh bool, gpunode *gpunodev1.GpuNode, now time.Time, drainingGracePeriod time.Duration) (health, reason string) {
+	if leaseFresh {
+		return gpunodev1.StatusHealth, "LeaseRenewed"
+	}
+	if cond := meta.FindStatusCondition(gpunode.Status.Conditions, gpunodev1.GpuNodeDraining); cond != nil && cond.Status == metav1.ConditionTrue &&
+		now.Before(cond.LastTransitionTime.Add(drainingGracePeriod)) {
+		return gpunodev1.StatusDraining, "AgentDraining"
+	}
+	return gpunodev1.StatusNotHealth, "LeaseExpired"
+}
 
-	if healthy {
-		if gpunode.Status.Health == gpunodev1.StatusHealth {
-			// If already set health, skip set again.
-			return nil
-		}
+// updateGpuNodeStatus sets the health and the condition AgentLeaseFresh of the GpuNode by the lease.
+func (nc *Controller) updateGpuNodeStatus(ctx context.Context, health, reason string, gpunode *gpunodev1.GpuNode, msg string) error {
+	healthy := health == gpunodev1.StatusHealth
+	cond := metav1.Condition{Type: gpunodev1.GpuNodeAgentLeaseFresh, Status: metav1.ConditionTrue, Reason: reason, Message: msg}
+	if !healthy {
+		cond.Status = metav1.ConditionFalse
+	}
+	if gpunode.Status.Health == health && meta.IsStatusConditionPresentAndEqual(gpunode.Status.Conditions, cond.Type, cond.Status) {
+		// If already set, skip set again.
+		return nil
+	}
 
+	if gpunode.Status.Health != health {
 		gpunode.Status.Message = msg
-		gpunode.Status.Health = gpunodev1.StatusHealth
+		gpunode.Status.Health = health
 		gpunode.Status.LastTransitionTime = metav1.Now()
-		gpunode.Status.LastHealthyTime = metav1.Now()
-
-		upctx, cancelFun := context.WithTimeout(ctx, time.Second*2)
-		defer cancelFun()
-		_, err := nc.gpuclient.GpunodeV1().GpuNodes(gpunode.Namespace).UpdateStatus(upctx, gpunode, metav1.UpdateOptions{})
-		return err
-	}
-
-	if gpunode.Status.Health == gpunodev1.StatusNotHealth {
-		// If already set unhealth, skip set again.
-		return nil
+		if healthy || gpunode.Status.LastHealthyTime.IsZero() {
+			gpunode.Status.LastHealthyTime = metav1.Now()
+		}
 	}
+	meta.SetStatusCondition(&gpunode.Status.Conditions, cond)
+	return nc.applyGpuNodeHealth(ctx, gpunode)
+}
 
-	gpunode.Status.Message = msg
-	gpunode.Status.Health = gpunodev1.StatusNotHealth
-	gpunode.Status.LastTransitionTime = metav1.Now()
-	if gpunode.Status.LastHealthyTime.IsZero() {
-		gpunode.Status.LastHealthyTime = metav1.Now()
+// applyGpuNodeHealth applies the health of the GpuNode status, which is owned by gpunode-lifecycle-controller.
+// The other fields of the status, such as the telemetry and the conditions published by gpuserver-ds, are not touched.
+func (nc *Controller) applyGpuNodeHealth(ctx context.Context, gpunode *gpunodev1.GpuNode) error {
+	patch, err := util.ApplyPatch(gpunodev1.GroupVersion.WithKind("GpuNode"), gpunode.Name, gpunode.Namespace, nil, nil, map[string]interface{}{
+		"health":               gpunode.Status.Health,
+		"message":              gpunode.Status.Message,
+		"last_health_time":     gpunode.Status.LastHealthyTime,
+		"last_transition_time": gpunode.Status.LastTransitionTime,
+		"conditions":           []*metav1.Condition{meta.FindStatusCondition(gpunode.Status.Conditions, gpunodev1.GpuNodeAgentLeaseFresh)},
+	})
+	if err != nil {
+		return err
 	}
 
 	upctx, cancelFun := context.WithTimeout(ctx, time.Second*2)
 	defer cancelFun()
-	_, err := nc.gpuclient.GpunodeV1().GpuNodes(gpunode.Namespace).UpdateStatus(upctx, gpunode, metav1.UpdateOptions{})
+	_, err = nc.gpuclient.GpunodeV1().GpuNodes(gpunode.Namespace).Patch(upctx, gpunode.Name, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: lifecycleControllerName, Force: pointer.Bool(true)}, "status")
 	return err
 }
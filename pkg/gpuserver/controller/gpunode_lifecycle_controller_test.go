@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGpuNodeHealth(t *testing.T) {
+	now := time.Now()
+	draining := func(status metav1.ConditionStatus, since time.Duration) *gpunodev1.GpuNode {
+		return &gpunodev1.GpuNode{Status: gpunodev1.GpuNodeStatus{Conditions: []metav1.Condition{
+			{Type: gpunodev1.GpuNodeDraining, Status: status, LastTransitionTime: metav1.NewTime(now.Add(-since))},
+		}}}
+	}
+	var tests = []struct {
+		name       string
+		leaseFresh bool
+		gpunode    *gpunodev1.GpuNode
+		wantHealth string
+		wantReason string
+	}{
+		{name: "lease fresh", leaseFresh: true, gpunode: &gpunodev1.GpuNode{}, wantHealth: gpunodev1.StatusHealth, wantReason: "LeaseRenewed"},
+		{name: "lease fresh while draining", leaseFresh: true, gpunode: draining(metav1.ConditionTrue, time.Second), wantHealth: gpunodev1.StatusHealth, wantReason: "LeaseRenewed"},
+		{name: "lease expired", leaseFresh: false, gpunode: &gpunodev1.GpuNode{}, wantHealth: gpunodev1.StatusNotHealth, wantReason: "LeaseExpired"},
+		{name: "lease expired not draining", leaseFresh: false, gpunode: draining(metav1.ConditionFalse, time.Second), wantHealth: gpunodev1.StatusNotHealth, wantReason: "LeaseExpired"},
+		{name: "lease expired draining", leaseFresh: false, gpunode: draining(metav1.ConditionTrue, time.Minute), wantHealth: gpunodev1.StatusDraining, wantReason: "AgentDraining"},
+		{name: "lease expired draining too long", leaseFresh: false, gpunode: draining(metav1.ConditionTrue, time.Hour), wantHealth: gpunodev1.StatusNotHealth, wantReason: "LeaseExpired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health, reason := gpuNodeHealth(tt.leaseFresh, tt.gpunode, now, 5*time.Minute)
+			if health != tt.wantHealth || reason != tt.wantReason {
+				t.Errorf("gpuNodeHealth() = %s, %s, want %s, %s", health, reason, tt.wantHealth, tt.wantReason)
+			}
+		})
+	}
+}
@@ -4,15 +4,17 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/controller"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/router"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/router/metricserver"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/router/schedulerserver"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/router/webhookserver"
 	"github.com/gorilla/mux"
 	"k8s.io/klog"
 )
 
-func RegisterRoutes(m *mux.Router, sc *controller.ServerController, enableScheduler bool) {
+func RegisterRoutes(m *mux.Router, sc *controller.ServerController, enableScheduler bool, modelResource *options.ModelResourceConfig) {
 	allrouter := []router.Router{
 		metricserver.NewRouter(sc),
 	}
@@ -20,6 +22,10 @@ func RegisterRoutes(m *mux.Router, sc *controller.ServerController, enableSchedu
 		klog.Infof("Flag enable-scheduler is enabled, register routes for scheduler server.")
 		allrouter = append(allrouter, schedulerserver.NewRouter(sc))
 	}
+	if modelResource.Webhook {
+		klog.Infof("Flag model-resource.webhook is enabled, register routes for webhook server.")
+		allrouter = append(allrouter, webhookserver.NewRouter(modelResource.Prefix))
+	}
 
 	for _, routers := range allrouter {
 		for _, r := range routers.Routes() {
@@ -0,0 +1,146 @@
+package webhookserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/router"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+type webhookRouter struct {
+	routes []router.Route
+	// prefix is the prefix of the extended resources of gpu models.
+	prefix string
+}
+
+func NewRouter(prefix string) router.Router {
+	r := &webhookRouter{prefix: prefix}
+	r.initRoutes()
+	return r
+}
+
+// Routes returns the available routes to the webhookRouter.
+func (wr *webhookRouter) Routes() []router.Route {
+	return wr.routes
+}
+
+// initRoutes initializes the routes in webhookRouter.
+func (wr *webhookRouter) initRoutes() {
+	wr.routes = []router.Route{
+		router.NewPostRoute(path.Join([]string{"/apis", options.APIGROUP, options.APIVERSION, options.MUTATE, options.MUTATE_PODS}...), wr.postMutatePodsHandler),
+	}
+}
+
+func (wr *webhookRouter) DumpRoutes() {
+	klog.Infof("Webhook server routes initialized.")
+	for _, r := range wr.routes {
+		fn := runtime.FuncForPC(reflect.ValueOf(r.Handler()).Pointer()).Name()
+		fns := strings.Split(fn, ".")
+		klog.Infof("%-5s%-50s\tfunc %s %s", r.Method(), r.Path(), fns[len(fns)-2], fns[len(fns)-1])
+	}
+}
+
+// postMutatePodsHandler requests the extended resource of the gpu model annotated by the pod.
+// The pod is always allowed, it is not patched if the model or gpus are not requested.
+func (wr *webhookRouter) postMutatePodsHandler(w http.ResponseWriter, r *http.Request) {
+	review := &admissionv1.AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil || review.Request == nil {
+		klog.Errorf("decode AdmissionReview err: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	patch, err := wr.mutatePod(review.Request.Object.Raw)
+	if err != nil {
+		klog.Errorf("mutate pod %s/%s err: %v", review.Request.Namespace, review.Request.Name, err)
+		response.Result = &metav1.Status{Message: err.Error()}
+	} else if len(patch) != 0 {
+		klog.Infof("mutate pod %s/%s patch: %s", review.Request.Namespace, review.Request.Name, patch)
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patch
+		response.PatchType = &patchType
+	}
+	serverutil.WriteJSON(w, http.StatusOK, &admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response})
+}
+
+// mutatePod gets the json patch of the pod, nil is returned if it is not changed.
+func (wr *webhookRouter) mutatePod(raw []byte) ([]byte, error) {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		return nil, err
+	}
+	model, exist := pod.Annotations[options.SCHEDULE_ANNOTATION]
+	if !exist {
+		return nil, nil
+	}
+	resourceName := util.ModelResourceName(wr.prefix, model)
+	if resourceName == "" {
+		return nil, fmt.Errorf("invalid gpu model %q", model)
+	}
+
+	mutated := pod.DeepCopy()
+	changed := false
+	for i := range mutated.Spec.InitContainers {
+		changed = requestModelResource(&mutated.Spec.InitContainers[i], corev1.ResourceName(resourceName)) || changed
+	}
+	for i := range mutated.Spec.Containers {
+		changed = requestModelResource(&mutated.Spec.Containers[i], corev1.ResourceName(resourceName)) || changed
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	// diff the pods both encoded, so the fields defaulted by encoding are not patched.
+	originalRaw, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	mutatedRaw, err := json.Marshal(mutated)
+	if err != nil {
+		return nil, err
+	}
+	operations, err := jsonpatch.CreatePatch(originalRaw, mutatedRaw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(operations)
+}
+
+// requestModelResource requests the extended resource of the gpu model as many as the gpus requested by the container,
+// which is not changed if the gpus are not requested or the extended resource is requested already.
+func requestModelResource(c *corev1.Container, resourceName corev1.ResourceName) bool {
+	num := serverutil.GetContainerRequestGpuNum(c)
+	if num == 0 {
+		return false
+	}
+	if _, exist := c.Resources.Limits[resourceName]; exist {
+		return false
+	}
+	if _, exist := c.Resources.Requests[resourceName]; exist {
+		return false
+	}
+	// the extended resources must be set in limits, and equal in requests if set.
+	if c.Resources.Limits == nil {
+		c.Resources.Limits = make(corev1.ResourceList)
+	}
+	c.Resources.Limits[resourceName] = *resource.NewQuantity(num, resource.DecimalSI)
+	if c.Resources.Requests != nil {
+		c.Resources.Requests[resourceName] = *resource.NewQuantity(num, resource.DecimalSI)
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package webhookserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dsoptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	jsonpatchapply "github.com/evanphx/json-patch"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func gpuContainer(name string, num int64, requests bool) corev1.Container {
+	c := corev1.Container{Name: name, Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+		dsoptions.NVIDIAGPUResourceName: *resource.NewQuantity(num, resource.DecimalSI),
+	}}}
+	if requests {
+		c.Resources.Requests = c.Resources.Limits.DeepCopy()
+	}
+	return c
+}
+
+func TestPostMutatePodsHandler(t *testing.T) {
+	const modelResource = corev1.ResourceName("nvidia-gpu-scheduler/tesla-t4")
+	var tests = []struct {
+		name string
+		pod  *corev1.Pod
+		// want maps the container name to the model resource requested, nil means not patched.
+		want map[string]int64
+	}{
+		{
+			name: "no annotation",
+			pod:  &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{gpuContainer("app", 1, false)}}},
+		},
+		{
+			name: "gpus not requested",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{options.SCHEDULE_ANNOTATION: "Tesla T4"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			},
+		},
+		{
+			name: "requested",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{options.SCHEDULE_ANNOTATION: "Tesla T4"}},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{gpuContainer("init", 1, true)},
+					Containers:     []corev1.Container{gpuContainer("app", 2, false), {Name: "sidecar"}},
+				},
+			},
+			want: map[string]int64{"init": 1, "app": 2},
+		},
+		{
+			name: "requested already",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{options.SCHEDULE_ANNOTATION: "Tesla T4"}},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					dsoptions.NVIDIAGPUResourceName: *resource.NewQuantity(1, resource.DecimalSI),
+					modelResource:                   *resource.NewQuantity(1, resource.DecimalSI),
+				}}}}},
+			},
+		},
+	}
+	wr := NewRouter("nvidia-gpu-scheduler").(*webhookRouter)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, _ := json.Marshal(tt.pod)
+			body, _ := json.Marshal(&admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request:  &admissionv1.AdmissionRequest{UID: types.UID("uid"), Object: runtime.RawExtension{Raw: raw}},
+			})
+			w := httptest.NewRecorder()
+			wr.postMutatePodsHandler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d", w.Code)
+			}
+			review := &admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(w.Body.Bytes(), review); err != nil {
+				t.Fatal(err)
+			}
+			if review.Response == nil || !review.Response.Allowed || review.Response.UID != "uid" {
+				t.Fatalf("response = %+v, want allowed", review.Response)
+			}
+			if tt.want == nil {
+				if len(review.Response.Patch) != 0 {
+					t.Errorf("patched: %s", review.Response.Patch)
+				}
+				return
+			}
+
+			patch, err := jsonpatchapply.DecodePatch(review.Response.Patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patchedRaw, err := patch.Apply(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patched := &corev1.Pod{}
+			if err := json.Unmarshal(patchedRaw, patched); err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range append(patched.Spec.InitContainers, patched.Spec.Containers...) {
+				limit, exist := c.Resources.Limits[modelResource]
+				if want, wantExist := tt.want[c.Name]; exist != wantExist || limit.Value() != want {
+					t.Errorf("container %s limits %s = %v, want %d", c.Name, modelResource, c.Resources.Limits, want)
+				}
+				if request, exist := c.Resources.Requests[modelResource]; c.Resources.Requests != nil && (!exist || request.Cmp(limit) != 0) {
+					t.Errorf("container %s requests %v not equal to limits", c.Name, c.Resources.Requests)
+				}
+			}
+		})
+	}
+}
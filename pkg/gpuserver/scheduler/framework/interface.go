@@ -7,11 +7,25 @@ import (
 	extenderv1 "k8s.io/kube-scheduler/extender/v1"
 )
 
+// MaxNodeScore is the max score of a node by each score plugin after normalized,
+// so the score plugins ranking nodes by different units weigh the same when summed.
+const MaxNodeScore int64 = 100
+
 type Status struct {
 	Accepted bool
 	Err      error
 }
 
+// PluginArgs are the arguments to build the plugins, which are set by the scheduler options.
+type PluginArgs struct {
+	// ForeignProcessAsBusy makes the gpus occupied by foreign process busy.
+	ForeignProcessAsBusy bool
+	// ExcludeDegradedDevices makes the degraded gpus busy, otherwise they are deprioritized.
+	ExcludeDegradedDevices bool
+	// RequiredConditions are the condition types of GpuNode which must be True to schedule to the node.
+	RequiredConditions []string
+}
+
 // PluginToHostPriorityList declares a map from plugin name to its extenderv1.HostPriorityList.
 type PluginToHostPriorityList map[string]extenderv1.HostPriorityList
 
@@ -33,7 +47,7 @@ type FilterPlugin interface {
 type ScorePlugin interface {
 	Plugin
 	// Score is called on each filtered node. It must return success and an integer
-	// indicating the rank of the node.
+	// indicating the rank of the node, which is normalized to [0, MaxNodeScore] among the nodes.
 	Score(ctx context.Context, pod *corev1.Pod, node string) (int64, *Status)
 }
 
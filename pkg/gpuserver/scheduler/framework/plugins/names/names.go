@@ -1,5 +1,8 @@
 package names
 
 const (
-	GpuModelFitName = "GpuModelFit"
+	GpuModelFitName      = "GpuModelFit"
+	GpuMigProfileFitName = "GpuMigProfileFit"
+	GpuTopologyFitName   = "GpuTopologyFit"
+	GpuDriverFitName     = "GpuDriverFit"
 )
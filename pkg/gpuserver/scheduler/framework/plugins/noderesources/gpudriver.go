@@ -0,0 +1,121 @@
+package noderesources
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework/plugins/names"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+)
+
+const GpuDriverFitName = names.GpuDriverFitName
+
+var _ framework.FilterPlugin = &GpuDriverFit{}
+
+func NewGpuDriverFit(args *framework.PluginArgs) (framework.Plugin, error) {
+	return &GpuDriverFit{args: args}, nil
+}
+
+// GpuDriverFit is a plugin that checks if a node meets the minimum driver version, CUDA version
+// and compute capability in the annotations of the pod. The nodes not reporting the versions are rejected.
+// The compute capability is checked on the free gpus, with model requested if the pod annotates it.
+type GpuDriverFit struct {
+	args *framework.PluginArgs
+}
+
+func (f *GpuDriverFit) Name() string {
+	return GpuDriverFitName
+}
+
+func (f *GpuDriverFit) Filter(ctx context.Context, pod *corev1.Pod, node string) (status *framework.Status) {
+	status = &framework.Status{Accepted: true}
+	if len(pod.Annotations) == 0 {
+		return
+	}
+	minDriver, hasDriver := pod.Annotations[options.SCHEDULE_ANNOTATION_MIN_DRIVER_VERSION]
+	minCuda, hasCuda := pod.Annotations[options.SCHEDULE_ANNOTATION_MIN_CUDA_VERSION]
+	minCapability, hasCapability := pod.Annotations[options.SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY]
+	if !hasDriver && !hasCuda && !hasCapability {
+		return
+	}
+	if status = checkNode(node, f.args); !status.Accepted {
+		return
+	}
+
+	driverVersion, cudaVersion := cache.DefaultGpuNodeCache.GetDriverVersion(node)
+	if hasDriver {
+		if err := checkMinVersion("driver version", driverVersion, minDriver); err != nil {
+			return &framework.Status{Err: fmt.Errorf("node:[%s] pod[%s/%s] %v", node, pod.Namespace, pod.Name, err)}
+		}
+	}
+	if hasCuda {
+		if err := checkMinVersion("cuda version", cudaVersion, minCuda); err != nil {
+			return &framework.Status{Err: fmt.Errorf("node:[%s] pod[%s/%s] %v", node, pod.Namespace, pod.Name, err)}
+		}
+	}
+	if hasCapability {
+		capableDevice, err := getCapableDevice(node, minCapability, util.NormalizeModelName(pod.Annotations[options.SCHEDULE_ANNOTATION]), f.args)
+		if err != nil {
+			return &framework.Status{Err: fmt.Errorf("node:[%s] pod[%s/%s] %v", node, pod.Namespace, pod.Name, err)}
+		}
+		reqDeviceNum := serverutil.GetPodRequestGpuNum(pod)
+		if reqDeviceNum == 0 {
+			reqDeviceNum = 1
+		}
+		klog.Infof("node:[%s] pod[%s/%s] reqDeviceNum:%d minComputeCapability:%s ,capableDevice:%v",
+			node, pod.Namespace, pod.Name, reqDeviceNum, minCapability, capableDevice.List())
+		if reqDeviceNum > int64(capableDevice.Len()) {
+			status.Err = fmt.Errorf("node:[%s] pod[%s/%s] reqGpuNum:%d > availNum:%d with compute capability >= %s",
+				node, pod.Namespace, pod.Name, reqDeviceNum, capableDevice.Len(), minCapability)
+			status.Accepted = false
+		}
+	}
+	return
+}
+
+// checkMinVersion checks the version reported is not lower than the minimum, the unknown version is not.
+func checkMinVersion(name, version, minVersion string) error {
+	if version == "" {
+		return fmt.Errorf("%s unknown, want >= %s", name, minVersion)
+	}
+	cmp, err := util.CompareVersion(version, minVersion)
+	if err != nil {
+		return fmt.Errorf("compare %s %s with %s: %v", name, version, minVersion, err)
+	}
+	if cmp < 0 {
+		return fmt.Errorf("%s %s < %s", name, version, minVersion)
+	}
+	return nil
+}
+
+// getCapableDevice gets the free gpus with compute capability not lower than the minimum, of all models if model is empty.
+func getCapableDevice(node, minCapability, model string, args *framework.PluginArgs) (sets.String, error) {
+	var freeDevice sets.String
+	if model != "" {
+		freeDevice = getFreeDeviceByModel(node, model, args)
+	} else {
+		freeDevice = excludeBusyDevice(node, cache.DefaultGpuNodeCache.GetFreeDevice(node), args)
+	}
+	computeCapability := cache.DefaultGpuNodeCache.GetComputeCapability(node)
+	capableDevice := sets.NewString()
+	for _, did := range freeDevice.List() {
+		if computeCapability[did] == "" {
+			continue
+		}
+		cmp, err := util.CompareVersion(computeCapability[did], minCapability)
+		if err != nil {
+			return nil, fmt.Errorf("compare compute capability %s with %s: %v", computeCapability[did], minCapability, err)
+		}
+		if cmp >= 0 {
+			capableDevice.Insert(did)
+		}
+	}
+	return capableDevice, nil
+}
@@ -0,0 +1,80 @@
+package noderesources
+
+import (
+	"context"
+	"testing"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	dsoptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGpuDriverFitFilter(t *testing.T) {
+	cache.DefaultGpuNodeCache.SetGpuNode("node-driver", &gpunodev1.GpuNode{
+		Spec: gpunodev1.GpuNodeSpec{
+			DriverVersion:     "470.57.02",
+			CudaDriverVersion: "11.4",
+			GpuInfos: map[string]*jsonstruct.GpuInfo{
+				"GPU-0": {DeviceId: "GPU-0", ComputeCapability: "7.5"},
+				"GPU-1": {DeviceId: "GPU-1", ComputeCapability: "8.0"},
+				"GPU-2": {DeviceId: "GPU-2", ComputeCapability: "8.0"},
+			},
+			Models:          map[string][]string{"tesla t4": {"GPU-0"}, "a100-sxm4-40gb": {"GPU-1", "GPU-2"}},
+			NodeDeviceInUse: []string{"GPU-2"},
+		},
+		Status: gpunodev1.GpuNodeStatus{Health: gpunodev1.StatusHealth},
+	})
+	cache.DefaultGpuNodeCache.SetGpuNode("node-unknown", &gpunodev1.GpuNode{
+		Spec:   gpunodev1.GpuNodeSpec{Models: map[string][]string{"tesla t4": {"GPU-0"}}},
+		Status: gpunodev1.GpuNodeStatus{Health: gpunodev1.StatusHealth},
+	})
+
+	var tests = []struct {
+		name        string
+		node        string
+		annotations map[string]string
+		gpuNum      int64
+		want        bool
+	}{
+		{name: "no annotation", node: "node-unknown", want: true},
+		{name: "driver fit", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_DRIVER_VERSION: "470.57"}, want: true},
+		{name: "driver too old", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_DRIVER_VERSION: "510.47.03"}},
+		{name: "driver unknown", node: "node-unknown", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_DRIVER_VERSION: "470"}},
+		{name: "cuda fit", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_CUDA_VERSION: "11"}, want: true},
+		{name: "cuda too old", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_CUDA_VERSION: "11.6"}},
+		{name: "invalid version", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_CUDA_VERSION: "latest"}},
+		{name: "compute capability fit", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY: "8.0"}, gpuNum: 1, want: true},
+		{name: "compute capability in use", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY: "8.0"}, gpuNum: 2},
+		{name: "compute capability of all models", node: "node-driver", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY: "7.0"}, gpuNum: 2, want: true},
+		{
+			name: "compute capability of model",
+			node: "node-driver",
+			annotations: map[string]string{
+				options.SCHEDULE_ANNOTATION:                        "Tesla T4",
+				options.SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY: "8.0",
+			},
+			gpuNum: 1,
+		},
+		{name: "compute capability unknown", node: "node-unknown", annotations: map[string]string{options.SCHEDULE_ANNOTATION_MIN_COMPUTE_CAPABILITY: "7.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: tt.annotations},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+					dsoptions.NVIDIAGPUResourceName: *resource.NewQuantity(tt.gpuNum, resource.DecimalExponent),
+				}}}}},
+			}
+			f := &GpuDriverFit{args: &framework.PluginArgs{}}
+			if status := f.Filter(context.TODO(), pod, tt.node); status.Accepted != tt.want {
+				t.Errorf("Filter() accepted = %v, want %v, err: %v", status.Accepted, tt.want, status.Err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package noderesources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dsoptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework/plugins/names"
+	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const GpuMigProfileFitName = names.GpuMigProfileFitName
+
+var _ framework.FilterPlugin = &GpuMigProfileFit{}
+var _ framework.ScorePlugin = &GpuMigProfileFit{}
+
+// NewGpuMigProfileFit builds GpuMigProfileFit, the processes on the gpus in MIG mode are not checked.
+func NewGpuMigProfileFit(args *framework.PluginArgs) (framework.Plugin, error) {
+	return &GpuMigProfileFit{args: args}, nil
+}
+
+// GpuMigProfileFit is a plugin that checks if a node has sufficient MIG devices with profile requested.
+// The num requested is the limit of nvidia.com/mig-<profile>, or nvidia.com/gpu with the single MIG strategy.
+type GpuMigProfileFit struct {
+	args *framework.PluginArgs
+}
+
+func (f *GpuMigProfileFit) Name() string {
+	return GpuMigProfileFitName
+}
+
+func (f *GpuMigProfileFit) Filter(ctx context.Context, pod *corev1.Pod, node string) (status *framework.Status) {
+	status = &framework.Status{Accepted: true}
+	if len(pod.Annotations) != 0 {
+		if reqProfile, exist := pod.Annotations[options.SCHEDULE_ANNOTATION_MIG_PROFILE]; exist {
+			reqProfile = normalizeMigProfile(reqProfile)
+			if status = checkNode(node, f.args); !status.Accepted {
+				return
+			}
+
+			freeDevice := excludeBusyDevice(node, cache.DefaultGpuNodeCache.GetFreeMigDeviceByProfile(node, reqProfile), f.args)
+			if freeDevice.Len() != 0 {
+				reqDeviceNum := getPodRequestMigNum(pod, reqProfile)
+				klog.Infof("node:[%s] pod[%s/%s] reqMigDeviceNum:%d ,availMigDevice:%v",
+					node, pod.Namespace, pod.Name, reqDeviceNum, freeDevice.List())
+				if reqDeviceNum > int64(freeDevice.Len()) {
+					status.Err = fmt.Errorf("node:[%s] pod[%s/%s] reqMigNum:%d > availNum:%d",
+						node, pod.Namespace, pod.Name, reqDeviceNum, freeDevice.Len())
+					status.Accepted = false
+				}
+			} else {
+				status.Err = fmt.Errorf("node:[%s] pod[%s/%s] reqMigProfile:%s not exist",
+					node, pod.Namespace, pod.Name, reqProfile)
+				status.Accepted = false
+			}
+		}
+	}
+	return
+}
+
+func (f *GpuMigProfileFit) Score(ctx context.Context, pod *corev1.Pod, node string) (score int64, status *framework.Status) {
+	status = &framework.Status{Accepted: true}
+	if len(pod.Annotations) != 0 {
+		if reqProfile, exist := pod.Annotations[options.SCHEDULE_ANNOTATION_MIG_PROFILE]; exist {
+			reqProfile = normalizeMigProfile(reqProfile)
+			if status = checkNode(node, f.args); !status.Accepted {
+				return
+			}
+
+			freeDevice := excludeBusyDevice(node, cache.DefaultGpuNodeCache.GetFreeMigDeviceByProfile(node, reqProfile), f.args)
+			if freeDevice.Len() != 0 {
+				//Set score to be the num of the available MIG devices with profile that pod requested, the ones on degraded gpus are not counted.
+				score = int64(freeDevice.Difference(cache.DefaultGpuNodeCache.GetDegradedDevice(node)).Len())
+			} else {
+				status.Err = fmt.Errorf("node:[%s] pod[%s/%s] reqMigProfile:%s not exist",
+					node, pod.Namespace, pod.Name, reqProfile)
+				status.Accepted = false
+			}
+		}
+	}
+	return
+}
+
+// checkNode checks the node exists in the cache and is healthy, with the conditions required by args True.
+// The node draining is not scheduled, as its gpuserver-ds is shutting down and the gpus are not updated.
+func checkNode(node string, args *framework.PluginArgs) *framework.Status {
+	nexist, nhealth := cache.DefaultGpuNodeCache.CheckNodeHealth(node)
+	if !nexist {
+		return &framework.Status{Err: fmt.Errorf("nodeName:%s not exist. nodeCache:%s", node, cache.DefaultGpuNodeCache.DumpNodeGpuInfo())}
+	} else if draining, msg := cache.DefaultGpuNodeCache.GetDraining(node); draining {
+		return &framework.Status{Err: fmt.Errorf("nodeName:%s is draining: %s", node, msg)}
+	} else if !nhealth {
+		return &framework.Status{Err: fmt.Errorf("nodeName:%s is not health", node)}
+	}
+	if args != nil && len(args.RequiredConditions) != 0 {
+		if unmet := cache.DefaultGpuNodeCache.GetUnmetConditions(node, args.RequiredConditions); len(unmet) != 0 {
+			return &framework.Status{Err: fmt.Errorf("nodeName:%s conditions not True: %s", node, strings.Join(unmet, ","))}
+		}
+	}
+	return &framework.Status{Accepted: true}
+}
+
+// normalizeMigProfile accepts both 1g.5gb and the resource name nvidia.com/mig-1g.5gb.
+func normalizeMigProfile(profile string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(profile)), dsoptions.NVIDIAMIGResourcePrefix)
+}
+
+func getPodRequestMigNum(pod *corev1.Pod, profile string) int64 {
+	if num := serverutil.GetPodRequestNum(pod, corev1.ResourceName(dsoptions.NVIDIAMIGResourcePrefix+profile)); num != 0 {
+		return num
+	}
+	return serverutil.GetPodRequestGpuNum(pod)
+}
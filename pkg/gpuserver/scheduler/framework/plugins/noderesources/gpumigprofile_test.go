@@ -0,0 +1,51 @@
+package noderesources
+
+import (
+	"strings"
+	"testing"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckNode(t *testing.T) {
+	cache.DefaultGpuNodeCache.SetGpuNode("node-check-health", &gpunodev1.GpuNode{Status: gpunodev1.GpuNodeStatus{Health: gpunodev1.StatusHealth}})
+	cache.DefaultGpuNodeCache.SetGpuNode("node-check-unhealthy", &gpunodev1.GpuNode{Status: gpunodev1.GpuNodeStatus{Health: gpunodev1.StatusNotHealth}})
+	cache.DefaultGpuNodeCache.SetGpuNode("node-check-draining", &gpunodev1.GpuNode{Status: gpunodev1.GpuNodeStatus{
+		Health: gpunodev1.StatusDraining,
+		Conditions: []metav1.Condition{
+			{Type: gpunodev1.GpuNodeDraining, Status: metav1.ConditionTrue, Reason: "AgentShutdown", Message: "gpuserver-ds is shutting down"},
+		},
+	}})
+	cache.DefaultGpuNodeCache.SetGpuNode("node-check-drained", &gpunodev1.GpuNode{Status: gpunodev1.GpuNodeStatus{
+		Health: gpunodev1.StatusHealth,
+		Conditions: []metav1.Condition{
+			{Type: gpunodev1.GpuNodeDraining, Status: metav1.ConditionFalse, Reason: "AgentRunning"},
+		},
+	}})
+	var tests = []struct {
+		name    string
+		node    string
+		wantErr string
+	}{
+		{name: "healthy", node: "node-check-health"},
+		{name: "not exist", node: "node-check-none", wantErr: "not exist"},
+		{name: "unhealthy", node: "node-check-unhealthy", wantErr: "is not health"},
+		{name: "draining", node: "node-check-draining", wantErr: "is draining: gpuserver-ds is shutting down"},
+		{name: "back from draining", node: "node-check-drained"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := checkNode(tt.node, &framework.PluginArgs{})
+			if tt.wantErr == "" {
+				if !status.Accepted {
+					t.Errorf("checkNode() = %v, want accepted", status.Err)
+				}
+			} else if status.Accepted || status.Err == nil || !strings.Contains(status.Err.Error(), tt.wantErr) {
+				t.Errorf("checkNode() = %v, want err %q", status.Err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
 )
 
@@ -18,12 +19,13 @@ const GpuModelFitName = names.GpuModelFitName
 
 var _ framework.FilterPlugin = &GpuModelFit{}
 
-func NewGpuModelFit() (framework.Plugin, error) {
-	return &GpuModelFit{}, nil
+func NewGpuModelFit(args *framework.PluginArgs) (framework.Plugin, error) {
+	return &GpuModelFit{args: args}, nil
 }
 
 // GpuModelFit is a plugin that checks if a node has sufficient gpu with model requested.
 type GpuModelFit struct {
+	args *framework.PluginArgs
 }
 
 func (f *GpuModelFit) Name() string {
@@ -35,18 +37,11 @@ func (f *GpuModelFit) Filter(ctx context.Context, pod *corev1.Pod, node string)
 	if len(pod.Annotations) != 0 {
 		if reqModel, exist := pod.Annotations[options.SCHEDULE_ANNOTATION]; exist {
 			reqModel = util.NormalizeModelName(reqModel)
-			nexist, nhealth := cache.DefaultGpuNodeCache.CheckNodeHealth(node)
-			if !nexist {
-				status.Err = fmt.Errorf("nodeName:%s not exist. nodeCache:%s", node, cache.DefaultGpuNodeCache.DumpNodeGpuInfo())
-				status.Accepted = false
-				return
-			} else if !nhealth {
-				status.Err = fmt.Errorf("nodeName:%s is not health", node)
-				status.Accepted = false
+			if status = checkNode(node, f.args); !status.Accepted {
 				return
 			}
 
-			freeDevice := cache.DefaultGpuNodeCache.GetFreeDeviceByModel(node, reqModel)
+			freeDevice := getFreeDeviceByModel(node, reqModel, f.args)
 			if freeDevice.Len() != 0 {
 				reqDeviceNum := serverutil.GetPodRequestGpuNum(pod)
 				klog.Infof("node:[%s] pod[%s/%s] reqDeviceNum:%d ,availDevice:%v",
@@ -72,21 +67,14 @@ func (f *GpuModelFit) Score(ctx context.Context, pod *corev1.Pod, node string) (
 		if reqModel, exist := pod.Annotations[options.SCHEDULE_ANNOTATION]; exist {
 			reqModel = util.NormalizeModelName(reqModel)
 			reqModel = util.NormalizeModelName(reqModel)
-			nexist, nhealth := cache.DefaultGpuNodeCache.CheckNodeHealth(node)
-			if !nexist {
-				status.Err = fmt.Errorf("nodeName:%s not exist. nodeCache:%s", node, cache.DefaultGpuNodeCache.DumpNodeGpuInfo())
-				status.Accepted = false
-				return
-			} else if !nhealth {
-				status.Err = fmt.Errorf("nodeName:%s is not health", node)
-				status.Accepted = false
+			if status = checkNode(node, f.args); !status.Accepted {
 				return
 			}
 
-			freeDevice := cache.DefaultGpuNodeCache.GetFreeDeviceByModel(node, reqModel)
+			freeDevice := getFreeDeviceByModel(node, reqModel, f.args)
 			if freeDevice.Len() != 0 {
-				//Set score to be the num of the available gpus with model that pod requested.
-				score = int64(freeDevice.Len())
+				//Set score to be the num of the available gpus with model that pod requested, the degraded ones are not counted.
+				score = int64(freeDevice.Difference(cache.DefaultGpuNodeCache.GetDegradedDevice(node)).Len())
 			} else {
 				status.Err = fmt.Errorf("node:[%s] pod[%s/%s] reqModel:%s not exist",
 					node, pod.Namespace, pod.Name, reqModel)
@@ -96,3 +84,20 @@ func (f *GpuModelFit) Score(ctx context.Context, pod *corev1.Pod, node string) (
 	}
 	return
 }
+
+// getFreeDeviceByModel gets the free gpus by model, the gpus busy by args are excluded.
+func getFreeDeviceByModel(node, model string, args *framework.PluginArgs) sets.String {
+	return excludeBusyDevice(node, cache.DefaultGpuNodeCache.GetFreeDeviceByModel(node, model), args)
+}
+
+// excludeBusyDevice excludes the devices busy by args from the free ones,
+// the gpus occupied by foreign process and the degraded gpus or the MIG devices on them.
+func excludeBusyDevice(node string, freeDevice sets.String, args *framework.PluginArgs) sets.String {
+	if args != nil && args.ForeignProcessAsBusy {
+		freeDevice = freeDevice.Difference(cache.DefaultGpuNodeCache.GetForeignOccupiedDevice(node))
+	}
+	if args != nil && args.ExcludeDegradedDevices {
+		freeDevice = freeDevice.Difference(cache.DefaultGpuNodeCache.GetDegradedDevice(node))
+	}
+	return freeDevice
+}
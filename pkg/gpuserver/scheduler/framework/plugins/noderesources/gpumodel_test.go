@@ -0,0 +1,37 @@
+package noderesources
+
+import (
+	"reflect"
+	"testing"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+)
+
+func TestGetFreeDeviceByModel(t *testing.T) {
+	cache.DefaultGpuNodeCache.SetGpuNode("node-foreign", &gpunodev1.GpuNode{Spec: gpunodev1.GpuNodeSpec{
+		Models: map[string][]string{"tesla t4": {"GPU-0", "GPU-1", "GPU-2"}},
+		ForeignOccupied: map[string]*jsonstruct.DeviceOccupation{"GPU-1": {
+			Message: jsonstruct.ForeignProcessMessage, Processes: []*jsonstruct.GpuProcess{{Pid: 1}},
+		}},
+		DegradedDevices: map[string]*jsonstruct.DeviceDegradation{"GPU-2": {State: jsonstruct.DeviceDegraded}},
+	}})
+	var tests = []struct {
+		name string
+		args *framework.PluginArgs
+		want []string
+	}{
+		{name: "foreign process ignored", args: &framework.PluginArgs{}, want: []string{"GPU-0", "GPU-1", "GPU-2"}},
+		{name: "foreign process as busy", args: &framework.PluginArgs{ForeignProcessAsBusy: true}, want: []string{"GPU-0", "GPU-2"}},
+		{name: "degraded excluded", args: &framework.PluginArgs{ExcludeDegradedDevices: true}, want: []string{"GPU-0", "GPU-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getFreeDeviceByModel("node-foreign", "tesla t4", tt.args).List(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getFreeDeviceByModel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
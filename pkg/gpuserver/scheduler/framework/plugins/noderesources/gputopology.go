@@ -0,0 +1,132 @@
+package noderesources
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework/plugins/names"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
+	serverutil "github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+const GpuTopologyFitName = names.GpuTopologyFitName
+
+var _ framework.ScorePlugin = &GpuTopologyFit{}
+
+// linkWeights ranks the PCIe paths between gpus, NV<n> ranks above all of them.
+var linkWeights = map[string]int64{
+	jsonstruct.TopologyLinkSYS:  1,
+	jsonstruct.TopologyLinkNODE: 2,
+	jsonstruct.TopologyLinkPHB:  3,
+	jsonstruct.TopologyLinkPXB:  4,
+	jsonstruct.TopologyLinkPIX:  5,
+}
+
+// nvLinkWeight is the weight of NV<n> without the n NVLinks.
+const nvLinkWeight = 10
+
+func NewGpuTopologyFit(args *framework.PluginArgs) (framework.Plugin, error) {
+	return &GpuTopologyFit{args: args}, nil
+}
+
+// GpuTopologyFit is a plugin that scores a node by the best connected set of free gpus with model requested,
+// which has as many gpus as the pod requests. The score is the average weight of the links in the set.
+// The pod requests one gpu is not scored.
+type GpuTopologyFit struct {
+	args *framework.PluginArgs
+}
+
+func (f *GpuTopologyFit) Name() string {
+	return GpuTopologyFitName
+}
+
+func (f *GpuTopologyFit) Score(ctx context.Context, pod *corev1.Pod, node string) (score int64, status *framework.Status) {
+	status = &framework.Status{Accepted: true}
+	if len(pod.Annotations) != 0 {
+		if reqModel, exist := pod.Annotations[options.SCHEDULE_ANNOTATION]; exist {
+			reqModel = util.NormalizeModelName(reqModel)
+			reqDeviceNum := serverutil.GetPodRequestGpuNum(pod)
+			if reqDeviceNum < 2 {
+				return
+			}
+			freeDevice := getFreeDeviceByModel(node, reqModel, f.args)
+			if int64(freeDevice.Len()) < reqDeviceNum {
+				// GpuModelFit filters the node out
+				return
+			}
+			// the gpus degraded are picked only if not enough others.
+			if notDegraded := freeDevice.Difference(cache.DefaultGpuNodeCache.GetDegradedDevice(node)); int64(notDegraded.Len()) >= reqDeviceNum {
+				freeDevice = notDegraded
+			}
+			topology := cache.DefaultGpuNodeCache.GetDeviceTopology(node)
+			var devices []string
+			devices, score = bestDeviceSet(freeDevice.List(), int(reqDeviceNum), topology)
+			klog.V(4).Infof("node:[%s] pod[%s/%s] best connected devices:%v score:%d",
+				node, pod.Namespace, pod.Name, devices, score)
+		}
+	}
+	return
+}
+
+// linkWeight gets the weight of the link between the two gpus, 0 if unknown.
+func linkWeight(topology map[string]map[string]string, did, peer string) int64 {
+	link := topology[did][peer]
+	if strings.HasPrefix(link, jsonstruct.TopologyLinkNV) {
+		n, err := strconv.ParseInt(strings.TrimPrefix(link, jsonstruct.TopologyLinkNV), 10, 64)
+		if err != nil {
+			return nvLinkWeight
+		}
+		return nvLinkWeight + n
+	}
+	return linkWeights[link]
+}
+
+// bestDeviceSet picks num devices greedily from each device, the best connected set and its score are returned.
+// The score of a set is the average weight of the links between each pair in the set.
+func bestDeviceSet(devices []string, num int, topology map[string]map[string]string) (best []string, bestScore int64) {
+	if num < 2 || len(devices) < num {
+		return nil, 0
+	}
+	for _, start := range devices {
+		set := []string{start}
+		var total int64
+		for len(set) < num {
+			next, nextWeight := "", int64(-1)
+			for _, candidate := range devices {
+				if contains(set, candidate) {
+					continue
+				}
+				var weight int64
+				for _, did := range set {
+					weight += linkWeight(topology, did, candidate)
+				}
+				if weight > nextWeight {
+					next, nextWeight = candidate, weight
+				}
+			}
+			set = append(set, next)
+			total += nextWeight
+		}
+		score := total / int64(num*(num-1)/2)
+		if best == nil || score > bestScore {
+			best, bestScore = set, score
+		}
+	}
+	return
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
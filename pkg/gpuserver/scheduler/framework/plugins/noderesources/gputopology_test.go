@@ -0,0 +1,159 @@
+package noderesources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	dsoptions "github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework/plugins/names"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework/runtime"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/server/cache"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+)
+
+// fullTopology links each pair of the gpus by link, the pairs in links override it.
+func fullTopology(dids []string, link string, links map[[2]string]string) map[string]map[string]string {
+	topology := make(map[string]map[string]string)
+	for _, did := range dids {
+		topology[did] = make(map[string]string)
+		for _, peer := range dids {
+			if peer != did {
+				topology[did][peer] = link
+			}
+		}
+	}
+	for pair, link := range links {
+		topology[pair[0]][pair[1]] = link
+		topology[pair[1]][pair[0]] = link
+	}
+	return topology
+}
+
+func TestBestDeviceSet(t *testing.T) {
+	dids := []string{"GPU-0", "GPU-1", "GPU-2", "GPU-3"}
+	var tests = []struct {
+		name      string
+		num       int
+		topology  map[string]map[string]string
+		wantSet   []string
+		wantScore int64
+	}{
+		{
+			name: "NVLink pair",
+			num:  2,
+			topology: fullTopology(dids, "SYS", map[[2]string]string{
+				{"GPU-0", "GPU-1"}: "PIX", {"GPU-2", "GPU-3"}: "NV4",
+			}),
+			wantSet:   []string{"GPU-2", "GPU-3"},
+			wantScore: 14,
+		},
+		{
+			name: "NVLink island of three",
+			num:  3,
+			topology: fullTopology(dids, "SYS", map[[2]string]string{
+				{"GPU-1", "GPU-2"}: "NV12", {"GPU-1", "GPU-3"}: "NV12", {"GPU-2", "GPU-3"}: "NV12",
+			}),
+			wantSet:   []string{"GPU-1", "GPU-2", "GPU-3"},
+			wantScore: 22,
+		},
+		{
+			name:      "topology unknown",
+			num:       2,
+			wantSet:   []string{"GPU-0", "GPU-1"},
+			wantScore: 0,
+		},
+		{
+			name: "not enough devices",
+			num:  5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, score := bestDeviceSet(dids, tt.num, tt.topology)
+			if !reflect.DeepEqual(set, tt.wantSet) || score != tt.wantScore {
+				t.Errorf("bestDeviceSet() = %v, %d, want %v, %d", set, score, tt.wantSet, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestGpuTopologyFitScore(t *testing.T) {
+	dids := []string{"GPU-0", "GPU-1", "GPU-2", "GPU-3", "GPU-4", "GPU-5"}
+	models := map[string][]string{"a100-sxm4-40gb": dids}
+	// four free gpus on one NVSwitch island
+	cache.DefaultGpuNodeCache.SetGpuNode("node-island", &gpunodev1.GpuNode{Spec: gpunodev1.GpuNodeSpec{
+		Models:          models,
+		NodeDeviceInUse: []string{"GPU-4", "GPU-5"},
+		Topology: fullTopology(dids, "SYS", map[[2]string]string{
+			{"GPU-0", "GPU-1"}: "NV12", {"GPU-0", "GPU-2"}: "NV12", {"GPU-0", "GPU-3"}: "NV12",
+			{"GPU-1", "GPU-2"}: "NV12", {"GPU-1", "GPU-3"}: "NV12", {"GPU-2", "GPU-3"}: "NV12",
+		}),
+	}})
+	// four free gpus scattered
+	cache.DefaultGpuNodeCache.SetGpuNode("node-scattered", &gpunodev1.GpuNode{Spec: gpunodev1.GpuNodeSpec{
+		Models:          models,
+		NodeDeviceInUse: []string{"GPU-1", "GPU-3"},
+		Topology: fullTopology(dids, "SYS", map[[2]string]string{
+			{"GPU-0", "GPU-1"}: "NV12", {"GPU-2", "GPU-3"}: "NV12", {"GPU-4", "GPU-5"}: "NV12",
+		}),
+	}})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: map[string]string{options.SCHEDULE_ANNOTATION: "A100-SXM4-40GB"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+			dsoptions.NVIDIAGPUResourceName: *resource.NewQuantity(4, resource.DecimalExponent),
+		}}}}},
+	}
+	f := &GpuTopologyFit{}
+	island, status := f.Score(context.TODO(), pod, "node-island")
+	if !status.Accepted {
+		t.Fatal(status.Err)
+	}
+	scattered, status := f.Score(context.TODO(), pod, "node-scattered")
+	if !status.Accepted {
+		t.Fatal(status.Err)
+	}
+	if island <= scattered {
+		t.Errorf("score of node-island %d <= score of node-scattered %d", island, scattered)
+	}
+}
+
+func TestRunScorePluginsNormalized(t *testing.T) {
+	dids := []string{"GPU-0", "GPU-1", "GPU-2", "GPU-3", "GPU-4", "GPU-5", "GPU-6", "GPU-7"}
+	// eight free gpus linked by PIX, GpuModelFit 8 and GpuTopologyFit 5.
+	cache.DefaultGpuNodeCache.SetGpuNode("node-many", &gpunodev1.GpuNode{
+		Spec:   gpunodev1.GpuNodeSpec{Models: map[string][]string{"tesla v100": dids}, Topology: fullTopology(dids, "PIX", nil)},
+		Status: gpunodev1.GpuNodeStatus{Health: gpunodev1.StatusHealth},
+	})
+	// two free gpus linked by NV2, GpuModelFit 2 and GpuTopologyFit 12.
+	cache.DefaultGpuNodeCache.SetGpuNode("node-nvlink", &gpunodev1.GpuNode{
+		Spec:   gpunodev1.GpuNodeSpec{Models: map[string][]string{"tesla v100": dids[:2]}, Topology: fullTopology(dids[:2], "NV2", nil)},
+		Status: gpunodev1.GpuNodeStatus{Health: gpunodev1.StatusHealth},
+	})
+	fw, err := runtime.NewFramework(runtime.Registry{
+		names.GpuModelFitName:    NewGpuModelFit,
+		names.GpuTopologyFitName: NewGpuTopologyFit,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: map[string]string{options.SCHEDULE_ANNOTATION: "Tesla V100"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+			dsoptions.NVIDIAGPUResourceName: *resource.NewQuantity(2, resource.DecimalExponent),
+		}}}}},
+	}
+
+	// summed raw, node-nvlink ranks first only by the larger unit of GpuTopologyFit, 14 to 13.
+	got := fw.RunScorePlugins(context.TODO(), pod, []string{"node-many", "node-nvlink"}, 1)
+	want := extenderv1.HostPriorityList{{Host: "node-many", Score: 100 + 41}, {Host: "node-nvlink", Score: 25 + 100}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunScorePlugins() = %v, want %v", got, want)
+	}
+}
@@ -9,6 +9,9 @@ import (
 // NewInTreeRegistry builds the registry with all the in-tree plugins.
 func NewInTreeRegistry() runtime.Registry {
 	return runtime.Registry{
-		names.GpuModelFitName: noderesources.NewGpuModelFit,
+		names.GpuModelFitName:      noderesources.NewGpuModelFit,
+		names.GpuMigProfileFitName: noderesources.NewGpuMigProfileFit,
+		names.GpuTopologyFitName:   noderesources.NewGpuTopologyFit,
+		names.GpuDriverFitName:     noderesources.NewGpuDriverFit,
 	}
 }
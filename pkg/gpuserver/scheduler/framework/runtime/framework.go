@@ -11,12 +11,15 @@ import (
 	extenderv1 "k8s.io/kube-scheduler/extender/v1"
 )
 
-func NewFramework(r Registry) (framework.Framework, error) {
+func NewFramework(r Registry, args *framework.PluginArgs) (framework.Framework, error) {
 	fw := &frameworkImpl{registry: r}
 	pluginsList := make([]framework.Plugin, 0, len(r))
+	if args == nil {
+		args = &framework.PluginArgs{}
+	}
 
 	for _, factory := range r {
-		plugin, err := factory()
+		plugin, err := factory(args)
 		if err != nil {
 			return nil, err
 		}
@@ -95,6 +98,10 @@ func (f *frameworkImpl) RunScorePlugins(ctx context.Context, pod *corev1.Pod, no
 		}
 	})
 
+	for _, scores := range pluginToNodeScores {
+		normalizeScores(scores)
+	}
+
 	// summarize scores
 	for i := range nodes {
 		hpList = append(hpList, extenderv1.HostPriority{Host: nodes[i], Score: 0})
@@ -106,3 +113,20 @@ func (f *frameworkImpl) RunScorePlugins(ctx context.Context, pod *corev1.Pod, no
 
 	return hpList
 }
+
+// normalizeScores scales the scores of a plugin to [0, MaxNodeScore] with the highest one MaxNodeScore,
+// the scores are left if all of them are 0.
+func normalizeScores(scores extenderv1.HostPriorityList) {
+	var maxScore int64
+	for i := range scores {
+		if scores[i].Score > maxScore {
+			maxScore = scores[i].Score
+		}
+	}
+	if maxScore == 0 {
+		return
+	}
+	for i := range scores {
+		scores[i].Score = framework.MaxNodeScore * scores[i].Score / maxScore
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/gpuserver/scheduler/framework"
 )
 
-// PluginFactory is a function that builds a plugin.
-type PluginFactory = func() (framework.Plugin, error)
+// PluginFactory is a function that builds a plugin with the args.
+type PluginFactory = func(args *framework.PluginArgs) (framework.Plugin, error)
 
 type Registry map[string]PluginFactory
@@ -0,0 +1,138 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+// applyConfiguration is the object of server-side apply, only the fields set are owned by the field manager.
+type applyConfiguration struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   applyMetadata          `json:"metadata"`
+	Spec       map[string]interface{} `json:"spec,omitempty"`
+	Status     map[string]interface{} `json:"status,omitempty"`
+}
+
+type applyMetadata struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// ApplyPatch returns the server-side apply patch of the object with the spec and status given, each of them may be nil.
+// The null fields of spec and status are dropped, so they are not owned and are removed if applied before.
+func ApplyPatch(gvk schema.GroupVersionKind, name, namespace string, labels map[string]string, spec, status interface{}) ([]byte, error) {
+	ac := &applyConfiguration{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Metadata:   applyMetadata{Name: name, Namespace: namespace, Labels: labels},
+	}
+	var err error
+	if ac.Spec, err = toApplyFields(spec); err != nil {
+		return nil, err
+	}
+	if ac.Status, err = toApplyFields(status); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ac)
+}
+
+func toApplyFields(obj interface{}) (map[string]interface{}, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		if v == nil {
+			delete(fields, k)
+		}
+	}
+	return fields, nil
+}
+
+// UpgradeManagedFieldsPatch returns the JSON patch moving the spec owned by the Update of the object to the apply of fieldManager,
+// nil is returned if no spec is owned by Update. The object written by Update before owns each key of the maps in spec,
+// which is not removed by the apply of fieldManager once it is not applied any more.
+// The rest owned by Update, such as the labels set by others, is left to its manager.
+func UpgradeManagedFieldsPatch(obj metav1.Object, fieldManager string) ([]byte, error) {
+	var (
+		upgraded      bool
+		apiVersion    string
+		spec          = &fieldpath.Set{}
+		managedFields = make([]metav1.ManagedFieldsEntry, 0, len(obj.GetManagedFields())+1)
+	)
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Subresource != "" || entry.FieldsV1 == nil {
+			managedFields = append(managedFields, entry)
+			continue
+		}
+		fields := &fieldpath.Set{}
+		if err := fields.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, err
+		}
+		if entry.Manager == fieldManager && entry.Operation == metav1.ManagedFieldsOperationApply {
+			// merged with the spec upgraded.
+			spec, apiVersion = spec.Union(fields), entry.APIVersion
+			continue
+		}
+		owned, rest := &fieldpath.Set{}, &fieldpath.Set{}
+		fields.Iterate(func(path fieldpath.Path) {
+			if path[0].FieldName != nil && *path[0].FieldName == "spec" {
+				owned.Insert(path)
+			} else {
+				rest.Insert(path)
+			}
+		})
+		if entry.Operation != metav1.ManagedFieldsOperationUpdate || owned.Empty() {
+			managedFields = append(managedFields, entry)
+			continue
+		}
+		upgraded = true
+		spec = spec.Union(owned)
+		if apiVersion == "" {
+			apiVersion = entry.APIVersion
+		}
+		if !rest.Empty() {
+			raw, err := rest.ToJSON()
+			if err != nil {
+				return nil, err
+			}
+			entry.FieldsV1 = &metav1.FieldsV1{Raw: raw}
+			managedFields = append(managedFields, entry)
+		}
+	}
+	if !upgraded {
+		return nil, nil
+	}
+
+	raw, err := spec.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	now := metav1.Now()
+	managedFields = append(managedFields, metav1.ManagedFieldsEntry{
+		Manager:    fieldManager,
+		Operation:  metav1.ManagedFieldsOperationApply,
+		APIVersion: apiVersion,
+		Time:       &now,
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: raw},
+	})
+	// the resourceVersion is tested, so the fields written meanwhile are not lost.
+	return json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": obj.GetResourceVersion()},
+		{"op": "replace", "path": "/metadata/managedFields", "value": managedFields},
+	})
+}
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestApplyPatch(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "resources.scheduler.caden2016.github.io", Version: "v1", Kind: "GpuNode"}
+	type spec struct {
+		Busy        []string `json:"device_busy"`
+		Allocatable []string `json:"device_allocatable"`
+	}
+	var tests = []struct {
+		name   string
+		labels map[string]string
+		spec   interface{}
+		status interface{}
+		want   string
+	}{
+		{
+			name: "spec with null dropped",
+			spec: &spec{Busy: []string{}},
+			want: `{"apiVersion":"resources.scheduler.caden2016.github.io/v1","kind":"GpuNode","metadata":{"name":"node1","namespace":"ns"},"spec":{"device_busy":[]}}`,
+		},
+		{
+			name:   "status only with labels",
+			labels: map[string]string{"node": "node1"},
+			status: map[string]interface{}{"health": "Healthy"},
+			want:   `{"apiVersion":"resources.scheduler.caden2016.github.io/v1","kind":"GpuNode","metadata":{"name":"node1","namespace":"ns","labels":{"node":"node1"}},"status":{"health":"Healthy"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyPatch(gvk, "node1", "ns", tt.labels, tt.spec, tt.status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ApplyPatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpgradeManagedFieldsPatch(t *testing.T) {
+	entry := func(manager string, operation metav1.ManagedFieldsOperationType, subresource, fields string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{Manager: manager, Operation: operation, APIVersion: "v1", Subresource: subresource,
+			FieldsType: "FieldsV1", FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)}}
+	}
+	status := entry("lifecycle", metav1.ManagedFieldsOperationUpdate, "status", `{"f:status":{"f:health":{}}}`)
+	obj := &metav1.ObjectMeta{ResourceVersion: "7", ManagedFields: []metav1.ManagedFieldsEntry{
+		entry("gpuserver-ds", metav1.ManagedFieldsOperationUpdate, "", `{"f:metadata":{"f:labels":{"f:node":{}}},"f:spec":{"f:device_infos":{"f:GPU-1":{}}}}`),
+		entry("gpuserver-ds", metav1.ManagedFieldsOperationApply, "", `{"f:spec":{"f:device_infos":{"f:GPU-0":{}}}}`),
+		status,
+	}}
+
+	patch, err := UpgradeManagedFieldsPatch(obj, "gpuserver-ds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].Op != "test" || string(ops[0].Value) != `"7"` || ops[1].Path != "/metadata/managedFields" {
+		t.Fatalf("unexpected patch: %s", patch)
+	}
+	var got []metav1.ManagedFieldsEntry
+	if err := json.Unmarshal(ops[1].Value, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`gpuserver-ds/Update/{"f:metadata":{"f:labels":{"f:node":{}}}}`,
+		`lifecycle/Update/{"f:status":{"f:health":{}}}`,
+		`gpuserver-ds/Apply/{"f:spec":{"f:device_infos":{"f:GPU-0":{},"f:GPU-1":{}}}}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("managedFields = %v, want %v", got, want)
+	}
+	for i := range got {
+		if s := got[i].Manager + "/" + string(got[i].Operation) + "/" + string(got[i].FieldsV1.Raw); s != want[i] {
+			t.Errorf("managedFields[%d] = %s, want %s", i, s, want[i])
+		}
+	}
+
+	// upgraded already.
+	obj.ManagedFields = got
+	if patch, err := UpgradeManagedFieldsPatch(obj, "gpuserver-ds"); err != nil || patch != nil {
+		t.Errorf("UpgradeManagedFieldsPatch() upgraded = %s, %v, want nil", patch, err)
+	}
+}
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	gpuResourceNamesLock sync.RWMutex
+	// gpuResourceNames are the resource names of whole gpus tracked, such as nvidia.com/gpu or nvidia.com/gpu.shared.
+	gpuResourceNames = []string{options.NVIDIAGPUResourceName}
+)
+
+// SetGpuResourceNames sets the resource names of whole gpus tracked by the flag gpu-resource-names.
+func SetGpuResourceNames(names []string) error {
+	tracked := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if errs := validation.IsQualifiedName(name); len(errs) != 0 || !strings.Contains(name, "/") {
+			return fmt.Errorf("invalid gpu resource name %q: should be an extended resource name like nvidia.com/gpu", name)
+		}
+		tracked = append(tracked, name)
+	}
+	if len(tracked) == 0 {
+		return fmt.Errorf("no gpu resource name is tracked")
+	}
+	gpuResourceNamesLock.Lock()
+	defer gpuResourceNamesLock.Unlock()
+	gpuResourceNames = tracked
+	return nil
+}
+
+// GetGpuResourceNames gets the resource names of whole gpus tracked.
+func GetGpuResourceNames() []string {
+	gpuResourceNamesLock.RLock()
+	defer gpuResourceNamesLock.RUnlock()
+	return gpuResourceNames
+}
+
+// ModelResourceName gets the extended resource name of the gpus of model, such as nvidia-gpu-scheduler/tesla-t4.
+// Empty is returned if the model has no valid character.
+func ModelResourceName(prefix, model string) string {
+	name := ToQualifiedName(NormalizeModelName(model))
+	if name == "" {
+		return ""
+	}
+	return prefix + "/" + name
+}
+
+// IsGpuResourceName tells whether the resource is whole gpus tracked.
+func IsGpuResourceName(name string) bool {
+	for _, tracked := range GetGpuResourceNames() {
+		if name == tracked {
+			return true
+		}
+	}
+	return false
+}
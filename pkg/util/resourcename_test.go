@@ -0,0 +1,48 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+)
+
+func TestSetGpuResourceNames(t *testing.T) {
+	defer SetGpuResourceNames([]string{options.NVIDIAGPUResourceName})
+
+	var tests = []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", names: []string{"nvidia.com/gpu"}, want: []string{"nvidia.com/gpu"}},
+		{name: "renamed and trimmed", names: []string{"nvidia.com/gpu", " nvidia.com/gpu.shared ", ""}, want: []string{"nvidia.com/gpu", "nvidia.com/gpu.shared"}},
+		{name: "not extended resource", names: []string{"gpu"}, wantErr: true},
+		{name: "invalid name", names: []string{"nvidia.com/gpu shared"}, wantErr: true},
+		{name: "empty", names: []string{""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetGpuResourceNames([]string{options.NVIDIAGPUResourceName})
+			err := SetGpuResourceNames(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetGpuResourceNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got := GetGpuResourceNames(); !reflect.DeepEqual(got, []string{options.NVIDIAGPUResourceName}) {
+					t.Errorf("GetGpuResourceNames() = %v after error, want unchanged", got)
+				}
+				return
+			}
+			if got := GetGpuResourceNames(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetGpuResourceNames() = %v, want %v", got, tt.want)
+			}
+			for _, name := range tt.want {
+				if !IsGpuResourceName(name) {
+					t.Errorf("IsGpuResourceName(%s) = false", name)
+				}
+			}
+		})
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"sync"
 
 	resourcesschedulerv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -53,23 +56,157 @@ func (gnc *GpuNodeCache) GetDeviceInUse(node string) (value sets.String) {
 	return
 }
 
-// GetFreeDeviceByModel gets the free gpu device set by model type.
+// GetFreeDeviceByModel gets the free gpu device set by model type, the unhealthy devices are not free.
+// The devices not allocatable by kubelet are not free if the node reports allocatable.
 func (gnc *GpuNodeCache) GetFreeDeviceByModel(node, model string) (value sets.String) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	if gnc.gpuNodeMap[node] == nil {
+		return sets.NewString()
+	}
+	return freeDevice(&gnc.gpuNodeMap[node].Spec, gnc.gpuNodeMap[node].Spec.Models[model])
+}
+
+// GetFreeDevice gets the free gpu device set of all models, the same way as GetFreeDeviceByModel.
+func (gnc *GpuNodeCache) GetFreeDevice(node string) (value sets.String) {
 	gnc.RLock()
 	defer gnc.RUnlock()
 	value = sets.NewString()
 	if gnc.gpuNodeMap[node] == nil {
 		return
 	}
-	modelList := gnc.gpuNodeMap[node].Spec.Models[model]
-	if len(modelList) == 0 {
+	for _, modelList := range gnc.gpuNodeMap[node].Spec.Models {
+		value = value.Union(freeDevice(&gnc.gpuNodeMap[node].Spec, modelList))
+	}
+	return
+}
+
+func freeDevice(spec *resourcesschedulerv1.GpuNodeSpec, devices []string) (value sets.String) {
+	value = sets.NewString()
+	if len(devices) == 0 {
 		return
 	}
-	value.Insert(modelList...)
-	value.Delete(gnc.gpuNodeMap[node].Spec.NodeDeviceInUse...)
+	value.Insert(devices...)
+	if spec.Allocatable != nil {
+		value = value.Intersection(sets.NewString(spec.Allocatable...))
+	}
+	value.Delete(spec.NodeDeviceInUse...)
+	for did := range spec.UnhealthyDevices {
+		value.Delete(did)
+	}
+	for did := range spec.DegradedDevices {
+		if needsReset(spec, did) {
+			value.Delete(did)
+		}
+	}
 	return
 }
 
+// needsReset tells whether the gpu needs reset, it is not scheduled until then.
+func needsReset(spec *resourcesschedulerv1.GpuNodeSpec, did string) bool {
+	dd := spec.DegradedDevices[did]
+	return dd != nil && dd.State == jsonstruct.DeviceNeedsReset
+}
+
+// GetFreeMigDeviceByProfile gets the free MIG device set by profile, the MIG devices of unhealthy gpus or the ones needing reset are not free.
+// The MIG devices not allocatable by kubelet are not free if the node reports allocatable.
+func (gnc *GpuNodeCache) GetFreeMigDeviceByProfile(node, profile string) (value sets.String) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	value = sets.NewString()
+	if gnc.gpuNodeMap[node] == nil {
+		return
+	}
+	spec := gnc.gpuNodeMap[node].Spec
+	profileList := spec.MigProfiles[profile]
+	if len(profileList) == 0 {
+		return
+	}
+	value.Insert(profileList...)
+	if spec.Allocatable != nil {
+		value = value.Intersection(sets.NewString(spec.Allocatable...))
+	}
+	value.Delete(spec.NodeDeviceInUse...)
+	for _, mid := range value.List() {
+		if mig := spec.MigDevices[mid]; mig != nil && (spec.UnhealthyDevices[mig.ParentId] != nil || needsReset(&spec, mig.ParentId)) {
+			value.Delete(mid)
+		}
+	}
+	return
+}
+
+// GetDegradedDevice gets the gpus degraded but not needing reset, and the MIG devices on them.
+func (gnc *GpuNodeCache) GetDegradedDevice(node string) (value sets.String) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	value = sets.NewString()
+	if gnc.gpuNodeMap[node] == nil {
+		return
+	}
+	spec := gnc.gpuNodeMap[node].Spec
+	for did, dd := range spec.DegradedDevices {
+		if dd != nil && dd.State == jsonstruct.DeviceDegraded {
+			value.Insert(did)
+		}
+	}
+	for mid, mig := range spec.MigDevices {
+		if mig != nil && value.Has(mig.ParentId) {
+			value.Insert(mid)
+		}
+	}
+	return
+}
+
+// GetForeignOccupiedDevice gets the gpus occupied by foreign process.
+func (gnc *GpuNodeCache) GetForeignOccupiedDevice(node string) (value sets.String) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	value = sets.NewString()
+	if gnc.gpuNodeMap[node] == nil {
+		return
+	}
+	for did := range gnc.gpuNodeMap[node].Spec.ForeignOccupied {
+		value.Insert(did)
+	}
+	return
+}
+
+// GetDeviceTopology gets the topology matrix of the gpus on the node, it must not be modified.
+func (gnc *GpuNodeCache) GetDeviceTopology(node string) map[string]map[string]string {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	if gnc.gpuNodeMap[node] == nil {
+		return nil
+	}
+	return gnc.gpuNodeMap[node].Spec.Topology
+}
+
+// GetDriverVersion gets the versions of the NVIDIA driver and the CUDA supported, empty if not reported.
+func (gnc *GpuNodeCache) GetDriverVersion(node string) (driverVersion, cudaVersion string) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	if gnc.gpuNodeMap[node] == nil {
+		return
+	}
+	return gnc.gpuNodeMap[node].Spec.DriverVersion, gnc.gpuNodeMap[node].Spec.CudaDriverVersion
+}
+
+// GetComputeCapability gets the compute capability of each gpu on the node, the gpus not reported are absent.
+func (gnc *GpuNodeCache) GetComputeCapability(node string) map[string]string {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	if gnc.gpuNodeMap[node] == nil {
+		return nil
+	}
+	computeCapability := make(map[string]string)
+	for did, gi := range gnc.gpuNodeMap[node].Spec.GpuInfos {
+		if gi != nil && gi.ComputeCapability != "" {
+			computeCapability[did] = gi.ComputeCapability
+		}
+	}
+	return computeCapability
+}
+
 func (gnc *GpuNodeCache) CheckNodeHealth(node string) (exist, health bool) {
 	gnc.RLock()
 	defer gnc.RUnlock()
@@ -83,3 +220,31 @@ func (gnc *GpuNodeCache) CheckNodeHealth(node string) (exist, health bool) {
 	}
 	return
 }
+
+// GetDraining gets the message of the condition Draining if it is True on the node.
+func (gnc *GpuNodeCache) GetDraining(node string) (draining bool, message string) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	if gnc.gpuNodeMap[node] == nil {
+		return
+	}
+	if cond := meta.FindStatusCondition(gnc.gpuNodeMap[node].Status.Conditions, resourcesschedulerv1.GpuNodeDraining); cond != nil && cond.Status == metav1.ConditionTrue {
+		return true, cond.Message
+	}
+	return
+}
+
+// GetUnmetConditions gets the condition types required which are not True on the node, the ones not set are not True.
+func (gnc *GpuNodeCache) GetUnmetConditions(node string, required []string) (unmet []string) {
+	gnc.RLock()
+	defer gnc.RUnlock()
+	if gnc.gpuNodeMap[node] == nil {
+		return required
+	}
+	for _, t := range required {
+		if !meta.IsStatusConditionTrue(gnc.gpuNodeMap[node].Status.Conditions, t) {
+			unmet = append(unmet, t)
+		}
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
+	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetFreeDeviceByModel(t *testing.T) {
+	var tests = []struct {
+		name string
+		spec gpunodev1.GpuNodeSpec
+		want []string
+	}{
+		{
+			name: "allocatable unknown",
+			spec: gpunodev1.GpuNodeSpec{
+				Models:          map[string][]string{"tesla t4": {"GPU-0", "GPU-1", "GPU-2"}},
+				NodeDeviceInUse: []string{"GPU-0"},
+			},
+			want: []string{"GPU-1", "GPU-2"},
+		},
+		{
+			name: "not allocatable",
+			spec: gpunodev1.GpuNodeSpec{
+				Models:          map[string][]string{"tesla t4": {"GPU-0", "GPU-1", "GPU-2"}},
+				NodeDeviceInUse: []string{"GPU-0"},
+				Allocatable:     []string{"GPU-0", "GPU-1"},
+			},
+			want: []string{"GPU-1"},
+		},
+		{
+			name: "none allocatable",
+			spec: gpunodev1.GpuNodeSpec{
+				Models:      map[string][]string{"tesla t4": {"GPU-0", "GPU-1"}},
+				Allocatable: []string{},
+			},
+			want: []string{},
+		},
+		{
+			name: "unhealthy",
+			spec: gpunodev1.GpuNodeSpec{
+				Models:           map[string][]string{"tesla t4": {"GPU-0", "GPU-1"}},
+				UnhealthyDevices: map[string]*jsonstruct.DeviceHealth{"GPU-1": {Xid: 79}},
+			},
+			want: []string{"GPU-0"},
+		},
+		{
+			name: "needs reset",
+			spec: gpunodev1.GpuNodeSpec{
+				Models: map[string][]string{"tesla t4": {"GPU-0", "GPU-1", "GPU-2"}},
+				DegradedDevices: map[string]*jsonstruct.DeviceDegradation{
+					"GPU-1": {State: jsonstruct.DeviceNeedsReset},
+					"GPU-2": {State: jsonstruct.DeviceDegraded},
+				},
+			},
+			want: []string{"GPU-0", "GPU-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gnc := NewGpuNodeCache()
+			gnc.SetGpuNode("node", &gpunodev1.GpuNode{Spec: tt.spec})
+			if got := gnc.GetFreeDeviceByModel("node", "tesla t4").List(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFreeDeviceByModel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFreeMigDeviceByProfile(t *testing.T) {
+	migDevices := map[string]*jsonstruct.MigDeviceInfo{
+		"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-0", Profile: "1g.5gb"},
+		"MIG-1": {DeviceId: "MIG-1", ParentId: "GPU-0", Profile: "1g.5gb"},
+		"MIG-2": {DeviceId: "MIG-2", ParentId: "GPU-1", Profile: "1g.5gb"},
+	}
+	migProfiles := map[string][]string{"1g.5gb": {"MIG-0", "MIG-1", "MIG-2"}}
+	var tests = []struct {
+		name string
+		spec gpunodev1.GpuNodeSpec
+		want []string
+	}{
+		{
+			name: "in use",
+			spec: gpunodev1.GpuNodeSpec{MigDevices: migDevices, MigProfiles: migProfiles, NodeDeviceInUse: []string{"MIG-0"}},
+			want: []string{"MIG-1", "MIG-2"},
+		},
+		{
+			name: "not allocatable",
+			spec: gpunodev1.GpuNodeSpec{MigDevices: migDevices, MigProfiles: migProfiles, Allocatable: []string{"GPU-2", "MIG-2"}},
+			want: []string{"MIG-2"},
+		},
+		{
+			name: "gpu unhealthy",
+			spec: gpunodev1.GpuNodeSpec{MigDevices: migDevices, MigProfiles: migProfiles,
+				UnhealthyDevices: map[string]*jsonstruct.DeviceHealth{"GPU-0": {Xid: 79}}},
+			want: []string{"MIG-2"},
+		},
+		{
+			name: "gpu needs reset",
+			spec: gpunodev1.GpuNodeSpec{MigDevices: migDevices, MigProfiles: migProfiles,
+				DegradedDevices: map[string]*jsonstruct.DeviceDegradation{"GPU-1": {State: jsonstruct.DeviceNeedsReset}}},
+			want: []string{"MIG-0", "MIG-1"},
+		},
+		{
+			name: "profile not exist",
+			spec: gpunodev1.GpuNodeSpec{MigDevices: migDevices, MigProfiles: map[string][]string{"3g.20gb": {"MIG-0"}}},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gnc := NewGpuNodeCache()
+			gnc.SetGpuNode("node", &gpunodev1.GpuNode{Spec: tt.spec})
+			if got := gnc.GetFreeMigDeviceByProfile("node", "1g.5gb").List(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFreeMigDeviceByProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDegradedDevice(t *testing.T) {
+	gnc := NewGpuNodeCache()
+	gnc.SetGpuNode("node", &gpunodev1.GpuNode{Spec: gpunodev1.GpuNodeSpec{
+		MigDevices: map[string]*jsonstruct.MigDeviceInfo{
+			"MIG-0": {DeviceId: "MIG-0", ParentId: "GPU-0"},
+			"MIG-1": {DeviceId: "MIG-1", ParentId: "GPU-1"},
+		},
+		DegradedDevices: map[string]*jsonstruct.DeviceDegradation{
+			"GPU-0": {State: jsonstruct.DeviceDegraded, Reasons: []string{jsonstruct.DegradationReasonRetiredPages}},
+			"GPU-1": {State: jsonstruct.DeviceNeedsReset},
+			"GPU-2": {State: jsonstruct.DeviceDegraded},
+		},
+	}})
+	want := []string{"GPU-0", "GPU-2", "MIG-0"}
+	if got := gnc.GetDegradedDevice("node").List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetDegradedDevice() = %v, want %v", got, want)
+	}
+	if got := gnc.GetDegradedDevice("node-unknown").List(); len(got) != 0 {
+		t.Errorf("GetDegradedDevice() of unknown node = %v, want empty", got)
+	}
+}
+
+func TestGetUnmetConditions(t *testing.T) {
+	gnc := NewGpuNodeCache()
+	gnc.SetGpuNode("node", &gpunodev1.GpuNode{Status: gpunodev1.GpuNodeStatus{Conditions: []metav1.Condition{
+		{Type: gpunodev1.GpuNodeNVMLReady, Status: metav1.ConditionTrue},
+		{Type: gpunodev1.GpuNodeDevicesHealthy, Status: metav1.ConditionFalse},
+	}}})
+	var tests = []struct {
+		name     string
+		node     string
+		required []string
+		want     []string
+	}{
+		{name: "none required", node: "node", want: nil},
+		{name: "true", node: "node", required: []string{gpunodev1.GpuNodeNVMLReady}, want: nil},
+		{name: "false and not set", node: "node", required: []string{gpunodev1.GpuNodeNVMLReady, gpunodev1.GpuNodeDevicesHealthy, gpunodev1.GpuNodeInventoryStable},
+			want: []string{gpunodev1.GpuNodeDevicesHealthy, gpunodev1.GpuNodeInventoryStable}},
+		{name: "node not exist", node: "node-none", required: []string{gpunodev1.GpuNodeNVMLReady}, want: []string{gpunodev1.GpuNodeNVMLReady}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gnc.GetUnmetConditions(tt.node, tt.required); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUnmetConditions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@ package server
 import (
 	"context"
 
-	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
@@ -11,18 +11,52 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
+// GetPodRequestGpuNum gets the num of whole gpus the pod requests, which is the sum of the effective request
+// of each gpu resource name tracked.
 func GetPodRequestGpuNum(pod *corev1.Pod) int64 {
-	var numLimit int64
+	var num int64
+	for _, name := range util.GetGpuResourceNames() {
+		num += GetPodRequestNum(pod, corev1.ResourceName(name))
+	}
+	return num
+}
+
+// GetPodRequestNum gets the effective request of the extended resource, such as nvidia.com/mig-1g.5gb.
+// Like kubernetes, it is the larger of the max of init containers and the sum of app containers.
+func GetPodRequestNum(pod *corev1.Pod, resourceName corev1.ResourceName) int64 {
+	var sum, maxInit int64
 	for _, c := range pod.Spec.Containers {
-		if c.Resources.Limits != nil {
-			if gpulimit, exist := c.Resources.Limits[options.NVIDIAGPUResourceName]; exist {
-				if !gpulimit.IsZero() {
-					numLimit += gpulimit.Value()
-				}
-			}
+		sum += getContainerRequestNum(&c, resourceName)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if num := getContainerRequestNum(&c, resourceName); num > maxInit {
+			maxInit = num
 		}
 	}
-	return numLimit
+	if maxInit > sum {
+		return maxInit
+	}
+	return sum
+}
+
+// GetContainerRequestGpuNum gets the request of whole gpus of the container, summed over the gpu resource names tracked.
+func GetContainerRequestGpuNum(c *corev1.Container) int64 {
+	var num int64
+	for _, name := range util.GetGpuResourceNames() {
+		num += getContainerRequestNum(c, corev1.ResourceName(name))
+	}
+	return num
+}
+
+// getContainerRequestNum gets the request of the extended resource, which defaults to the limit if not set.
+func getContainerRequestNum(c *corev1.Container, resourceName corev1.ResourceName) int64 {
+	if req, exist := c.Resources.Requests[resourceName]; exist {
+		return req.Value()
+	}
+	if limit, exist := c.Resources.Limits[resourceName]; exist {
+		return limit.Value()
+	}
+	return 0
 }
 
 func MapSetToList(mapset map[string]sets.String) map[string][]string {
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -60,6 +61,75 @@ func TestGetPodRequestGpuNum(t *testing.T) {
 			}},
 			want: 5,
 		},
+		{
+			name: "pod init container gpu request 4 larger than containers 1",
+			args: args{&corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									options.NVIDIAGPUResourceName: *resource.NewQuantity(4, resource.DecimalExponent),
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									options.NVIDIAGPUResourceName: *resource.NewQuantity(1, resource.DecimalExponent),
+								},
+							},
+						},
+					},
+				},
+			}},
+			want: 4,
+		},
+		{
+			name: "pod init container gpu request 1 smaller than containers 2",
+			args: args{&corev1.Pod{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									options.NVIDIAGPUResourceName: *resource.NewQuantity(1, resource.DecimalExponent),
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									options.NVIDIAGPUResourceName: *resource.NewQuantity(2, resource.DecimalExponent),
+								},
+							},
+						},
+					},
+				},
+			}},
+			want: 2,
+		},
+		{
+			name: "pod gpu request with resource name not tracked",
+			args: args{&corev1.Pod{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									"nvidia.com/gpu.shared": *resource.NewQuantity(2, resource.DecimalExponent),
+								},
+							},
+						},
+					},
+				},
+			}},
+			want: 0,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -70,6 +140,77 @@ func TestGetPodRequestGpuNum(t *testing.T) {
 	}
 }
 
+func TestGetPodRequestGpuNumRenamed(t *testing.T) {
+	if err := util.SetGpuResourceNames([]string{options.NVIDIAGPUResourceName, "nvidia.com/gpu.shared"}); err != nil {
+		t.Fatal(err)
+	}
+	defer util.SetGpuResourceNames([]string{options.NVIDIAGPUResourceName})
+
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							options.NVIDIAGPUResourceName: *resource.NewQuantity(1, resource.DecimalExponent),
+						},
+					},
+				},
+				{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							"nvidia.com/gpu.shared": *resource.NewQuantity(2, resource.DecimalExponent),
+						},
+					},
+				},
+			},
+		},
+	}
+	if got := GetPodRequestGpuNum(pod); got != 3 {
+		t.Errorf("GetPodRequestGpuNum() = %v, want %v", got, 3)
+	}
+}
+
+func TestGetPodRequestNum(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							options.NVIDIAGPUResourceName: *resource.NewQuantity(1, resource.DecimalExponent),
+							"nvidia.com/mig-1g.5gb":       *resource.NewQuantity(2, resource.DecimalExponent),
+						},
+					},
+				},
+				{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							"nvidia.com/mig-1g.5gb": *resource.NewQuantity(1, resource.DecimalExponent),
+						},
+					},
+				},
+			},
+		},
+	}
+	var tests = []struct {
+		name         string
+		resourceName corev1.ResourceName
+		want         int64
+	}{
+		{name: "gpu", resourceName: options.NVIDIAGPUResourceName, want: 1},
+		{name: "mig 1g.5gb", resourceName: "nvidia.com/mig-1g.5gb", want: 3},
+		{name: "mig 3g.20gb", resourceName: "nvidia.com/mig-3g.20gb", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetPodRequestNum(pod, tt.resourceName); got != tt.want {
+				t.Errorf("GetPodRequestNum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMapSetToList(t *testing.T) {
 	type args struct {
 		mapset map[string]sets.String
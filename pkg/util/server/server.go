@@ -18,6 +18,7 @@ import (
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver/app/options"
 	gpuclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpunode/clientset/versioned"
 	gpupodclientset "github.com/caden2016/nvidia-gpu-scheduler/pkg/generated/gpupod/clientset/versioned"
+	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util/info/metadata"
 	"github.com/openkruise/kruise/pkg/webhook/util/generator"
 	"gopkg.in/yaml.v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -136,3 +137,14 @@ func EnsureAPIService(aggregatorClient clientset.Interface, cacert []byte) error
 	_, err := aggregatorClient.ApiregistrationV1().APIServices().Patch(aggctx, apiserviceName, types.StrategicMergePatchType, patchBytes, patchOpt)
 	return err
 }
+
+// EnsureMutatingWebhookConfiguration ensure the caBundle of the webhook requesting the extended resources of gpu models is fresh
+func EnsureMutatingWebhookConfiguration(kubeClient kubernetes.Interface, cacert []byte) error {
+	webhookctx, cancel := context.WithTimeout(context.TODO(), time.Second*2)
+	defer cancel()
+	base64str := base64.StdEncoding.EncodeToString(cacert)
+	patchBytes := []byte(fmt.Sprintf(`{"webhooks":[{"name":"%s","clientConfig":{"caBundle":"%s"}}]}`, options.MutatingWebhookName, base64str))
+	patchOpt := metav1.PatchOptions{FieldManager: options.CERT_Secret_Name}
+	_, err := kubeClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(webhookctx, metadata.MetadataName(), types.StrategicMergePatchType, patchBytes, patchOpt)
+	return err
+}
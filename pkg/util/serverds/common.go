@@ -2,21 +2,20 @@ package serverds
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/caden2016/nvidia-gpu-scheduler/cmd/gpuserver-ds/app/options"
 
 	"github.com/caden2016/nvidia-gpu-scheduler/pkg/util"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
 	"github.com/caden2016/nvidia-gpu-scheduler/api/jsonstruct"
 
 	gpunodev1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpunode/v1"
 	gpupodv1 "github.com/caden2016/nvidia-gpu-scheduler/api/gpupod/v1"
 
-	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1alpha1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 )
@@ -29,56 +28,75 @@ func DumpModelSetInfo(modelset map[string]sets.String) string {
 	return sb.String()
 }
 
-func ToGpuNode(nodeName string, base *gpunodev1.GpuNode, ngi *jsonstruct.NodeGpuInfo, prm map[string]*podresourcesapi.PodResources) *gpunodev1.GpuNode {
-	var gpuNode *gpunodev1.GpuNode
-
-	if base == nil {
-		gpuNode = &gpunodev1.GpuNode{}
-		gpuNode.Name = nodeName
-	} else {
-		gpuNode = base.DeepCopy()
+// ToGpuNodeSpec returns the spec of GpuNode owned by gpuserver-ds, ReportTime is left to be set when it is applied.
+func ToGpuNodeSpec(ngi *jsonstruct.NodeGpuInfo, prm map[string]*podresourcesapi.PodResources,
+	unhealthy map[string]*jsonstruct.DeviceHealth, degraded map[string]*jsonstruct.DeviceDegradation, allocatable map[string][]int64,
+	foreign map[string]*jsonstruct.DeviceOccupation) *gpunodev1.GpuNodeSpec {
+	spec := &gpunodev1.GpuNodeSpec{
+		GpuInfos:          ngi.GpuInfos,
+		Models:            mapSetToList(ngi.Models),
+		MigDevices:        ngi.MigDevices,
+		MigProfiles:       mapSetToList(ngi.MigProfiles),
+		Topology:          ngi.Topology,
+		DriverVersion:     ngi.DriverVersion,
+		CudaDriverVersion: ngi.CudaDriverVersion,
+		NodeDeviceInUse:   getBusyDeviceSet(prm, ngi.MigDevices),
+		UnhealthyDevices:  unhealthy,
+		DegradedDevices:   degraded,
+		ForeignOccupied:   foreign,
 	}
-
-	if ngi != nil {
-		gpuNode.Spec.GpuInfos = ngi.GpuInfos
-		gpuNode.Spec.Models = mapSetToList(ngi.Models)
-		gpuNode.Spec.ReportTime = metav1.Now()
-		gpuNode.Status.NodeName = ngi.NodeName
+	if allocatable != nil {
+		spec.Allocatable = sets.StringKeySet(allocatable).List()
+		spec.GpuInfos = withNumaNodes(spec.GpuInfos, allocatable)
 	}
+	return spec
+}
 
-	if prm != nil {
-		gpuNode.Spec.NodeDeviceInUse = getBusyDeviceSet(prm)
+// ToGpuPodSpec returns the spec of GpuPod owned by gpuserver-ds.
+func ToGpuPodSpec(nodeName string, prd *jsonstruct.PodResourcesDetail) *gpupodv1.GpuPodSpec {
+	spec := &gpupodv1.GpuPodSpec{
+		Namespace: prd.Namespace,
+		Name:      prd.Name,
+		NodeName:  nodeName,
 	}
+	for _, crd := range *(prd.ContainerDevices) {
+		spec.ContainerDevices = append(spec.ContainerDevices, gpupodv1.ContainerResourcesDetail(*crd))
+	}
+	return spec
+}
 
-	gpuNode.Status.LastHealthyTime = metav1.Now()
-	gpuNode.Status.LastTransitionTime = metav1.Now()
-	gpuNode.Status.Message = "Just Populate from gpuserver-ds."
+// GpuNodeApplyPatch returns the server-side apply patch of GpuNode with the spec.
+func GpuNodeApplyPatch(nodeName, namespace string, spec *gpunodev1.GpuNodeSpec) ([]byte, error) {
+	return util.ApplyPatch(gpunodev1.GroupVersion.WithKind("GpuNode"), nodeName, namespace, nil, spec, nil)
+}
 
-	return gpuNode
+// GpuNodeStatusApplyPatch returns the server-side apply patch of the status subresource of GpuNode with the status fields.
+func GpuNodeStatusApplyPatch(nodeName, namespace string, status map[string]interface{}) ([]byte, error) {
+	return util.ApplyPatch(gpunodev1.GroupVersion.WithKind("GpuNode"), nodeName, namespace, nil, nil, status)
 }
 
-func ToGpuPod(nodeName string, base *gpupodv1.GpuPod, prd *jsonstruct.PodResourcesDetail) *gpupodv1.GpuPod {
-	var gpuPod *gpupodv1.GpuPod
-
-	if base == nil {
-		gpuPod = &gpupodv1.GpuPod{}
-		gpuPod.Name = util.MetadataToName(prd.Namespace, prd.Name)
-		gpuPod.Spec.Namespace = prd.Namespace
-		gpuPod.Spec.Name = prd.Name
-		gpuPod.Labels = make(map[string]string)
-		gpuPod.Labels[options.GPUPOD_ANNOTATION_TAG_Node] = nodeName
-		gpuPod.Spec.NodeName = nodeName
-	} else {
-		gpuPod = base.DeepCopy()
-	}
+// GpuPodApplyPatch returns the server-side apply patch of GpuPod with the spec, it is labeled with the node.
+func GpuPodApplyPatch(namespace string, spec *gpupodv1.GpuPodSpec) ([]byte, error) {
+	labels := map[string]string{options.GPUPOD_ANNOTATION_TAG_Node: spec.NodeName}
+	return util.ApplyPatch(gpupodv1.GroupVersion.WithKind("GpuPod"), util.MetadataToName(spec.Namespace, spec.Name), namespace, labels, spec, nil)
+}
 
-	gpuPod.Spec.ContainerDevices = nil
-	for _, crd := range *(prd.ContainerDevices) {
-		gpuPod.Spec.ContainerDevices = append(gpuPod.Spec.ContainerDevices, gpupodv1.ContainerResourcesDetail(*crd))
-	}
-	gpuPod.Status.LastChangedTime = time.Now().Format(time.RFC3339)
+// GpuPodStatusApplyPatch returns the server-side apply patch of the status subresource of GpuPod with the status.
+func GpuPodStatusApplyPatch(name, namespace string, status *gpupodv1.GpuPodStatus) ([]byte, error) {
+	return util.ApplyPatch(gpupodv1.GroupVersion.WithKind("GpuPod"), name, namespace, nil, nil, status)
+}
 
-	return gpuPod
+// withNumaNodes returns the copy of gpuInfos with the NUMA nodes of allocatable devices.
+func withNumaNodes(gpuInfos map[string]*jsonstruct.GpuInfo, allocatable map[string][]int64) map[string]*jsonstruct.GpuInfo {
+	r := make(map[string]*jsonstruct.GpuInfo, len(gpuInfos))
+	for did, gi := range gpuInfos {
+		if numaNodes := allocatable[did]; gi != nil && numaNodes != nil {
+			gi = gi.DeepCopy()
+			gi.NumaNodes = numaNodes
+		}
+		r[did] = gi
+	}
+	return r
 }
 
 func mapSetToList(mapset map[string]sets.String) map[string][]string {
@@ -89,16 +107,47 @@ func mapSetToList(mapset map[string]sets.String) map[string][]string {
 	return r
 }
 
-func getBusyDeviceSet(prm map[string]*podresourcesapi.PodResources) []string {
+func getBusyDeviceSet(prm map[string]*podresourcesapi.PodResources, migDevices map[string]*jsonstruct.MigDeviceInfo) []string {
 	deviceList := make([]string, 0)
 	for _, pr := range prm {
 		for _, cr := range pr.Containers {
 			for _, device := range cr.Devices {
 				for _, did := range device.DeviceIds {
+					if mig := FindMigDevice(migDevices, did); mig != nil {
+						did = mig.DeviceId
+					}
 					deviceList = append(deviceList, did)
 				}
 			}
 		}
 	}
+	// sorted to be compared with the last applied.
+	sort.Strings(deviceList)
 	return deviceList
 }
+
+// IsMigResourceName tells whether the resource is a MIG device of nvidia.com/mig-<profile>.
+func IsMigResourceName(resourceName string) bool {
+	return strings.HasPrefix(resourceName, options.NVIDIAMIGResourcePrefix)
+}
+
+// FindMigDevice finds the MIG device by the device id from kubelet, nil is returned if it is not a MIG device.
+// The device plugin reports the MIG uuid, or MIG-<gpu uuid>/<gi>/<ci> with the legacy driver.
+func FindMigDevice(migDevices map[string]*jsonstruct.MigDeviceInfo, did string) *jsonstruct.MigDeviceInfo {
+	if mig, exist := migDevices[did]; exist {
+		return mig
+	}
+	if !strings.HasPrefix(did, "MIG-GPU-") {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(did, "MIG-"), "/")
+	if len(parts) != 3 {
+		return nil
+	}
+	for _, mig := range migDevices {
+		if mig.ParentId == parts[0] && strconv.Itoa(mig.GpuInstanceId) == parts[1] && strconv.Itoa(mig.ComputeInstanceId) == parts[2] {
+			return mig
+		}
+	}
+	return nil
+}
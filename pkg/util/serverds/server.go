@@ -11,9 +11,20 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 )
 
+// NewEventRecorder creates the recorder of the Events reported by the component.
+func NewEventRecorder(kubeClient kubernetes.Interface, component string) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartStructuredLogging(0)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+}
+
 // EnsureGetCaFromSecrets block until get the ca from secret
 func EnsureGetCaFromSecrets(kubeclient kubernetes.Interface) (cacert []byte) {
 	var secret *corev1.Secret
@@ -1,11 +1,27 @@
 package util
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
 
 func NormalizeModelName(model string) string {
 	return strings.ToLower(strings.TrimSpace(model))
 }
 
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// ToQualifiedName makes the name part of a label key or resource name valid, such as gpu.model.tesla-t4 from gpu.model.tesla t4.
+func ToQualifiedName(name string) string {
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > validation.LabelValueMaxLength {
+		name = name[:validation.LabelValueMaxLength]
+	}
+	return strings.Trim(name, "._-")
+}
+
 func MetadataToName(ns, name string) string {
 	return strings.Join([]string{ns, name}, "-")
 }
@@ -0,0 +1,23 @@
+package util
+
+import "testing"
+
+func TestToQualifiedName(t *testing.T) {
+	var tests = []struct {
+		name string
+		want string
+	}{
+		{name: "gpu.model.tesla t4", want: "gpu.model.tesla-t4"},
+		{name: "gpu.model.NVIDIA A100-SXM4-40GB", want: "gpu.model.nvidia-a100-sxm4-40gb"},
+		{name: "gpu.model.geforce rtx 3090 (ti)", want: "gpu.model.geforce-rtx-3090-ti"},
+		{name: "-tesla t4-", want: "tesla-t4"},
+		{name: "gpu.model." + "abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghij-", want: "gpu.model.abcdefghij-abcdefghij-abcdefghij-abcdefghij-abcdefghi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToQualifiedName(tt.name); got != tt.want {
+				t.Errorf("ToQualifiedName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
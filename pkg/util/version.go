@@ -0,0 +1,52 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompareVersion compares the dotted numeric versions, such as driver 470.57.02, cuda 11.4 or compute capability 8.0.
+// The missing parts are 0, so 11 equals 11.0. It returns -1, 0 or 1 when a is lower than, equal to or higher than b.
+func CompareVersion(a, b string) (int, error) {
+	av, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bv, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(av) || i < len(bv); i++ {
+		var x, y int
+		if i < len(av) {
+			x = av[i]
+		}
+		if i < len(bv) {
+			y = bv[i]
+		}
+		if x < y {
+			return -1, nil
+		} else if x > y {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(version string) ([]int, error) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(version, ".")
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		nums[i] = n
+	}
+	return nums, nil
+}
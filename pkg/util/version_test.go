@@ -0,0 +1,33 @@
+package util
+
+import "testing"
+
+func TestCompareVersion(t *testing.T) {
+	var tests = []struct {
+		a, b    string
+		want    int
+		wantErr bool
+	}{
+		{a: "470.57.02", b: "470.57.02", want: 0},
+		{a: "470.57.02", b: "470.103.01", want: -1},
+		{a: "510.47.03", b: "470", want: 1},
+		{a: "11", b: "11.0", want: 0},
+		{a: "11.4", b: "11.10", want: -1},
+		{a: "8.6", b: "8.0", want: 1},
+		{a: " 7.5 ", b: "7.5", want: 0},
+		{a: "", b: "11.4", wantErr: true},
+		{a: "11.x", b: "11.4", wantErr: true},
+		{a: "11.4", b: "11..4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got, err := CompareVersion(tt.a, tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CompareVersion() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("CompareVersion() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}